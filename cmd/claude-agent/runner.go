@@ -11,7 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Config captures runtime options for the Claude CLI shim.
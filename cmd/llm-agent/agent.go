@@ -4,22 +4,23 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
-	"sync"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/agentsdk"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
+// heartbeatInterval is how often the agent reports liveness
+const heartbeatInterval = 10 * time.Second
+
 // LLMAgent represents the main agent implementation
 type LLMAgent struct {
 	// Configuration
 	config AgentConfig
 
-	// NDJSON I/O
-	encoder *ndjson.Encoder
-	decoder *ndjson.Decoder
+	// Protocol runtime (heartbeats, status, version pinning, IK replay)
+	runtime *agentsdk.Agent
+	agentID string
 
 	// Injected interfaces
 	llmCaller    LLMCaller
@@ -27,17 +28,8 @@ type LLMAgent struct {
 	fsProvider   FSProvider
 	eventEmitter EventEmitter
 
-	// Heartbeat fields
-	startTime              time.Time
-	hbSeq                  int64
-	currentStatus          protocol.HeartbeatStatus
-	currentTaskID          string
-	lastActivityAt         time.Time
-	agentID                string
-	mu                     sync.Mutex
-
-	// Version tracking
-	firstObservedSnapshotID string
+	// Context of the command being handled; nil outside of Run
+	cmdCtx context.Context
 }
 
 // NewLLMAgent creates a new LLM agent with the given configuration
@@ -51,98 +43,72 @@ func NewLLMAgent(cfg *AgentConfig) (*LLMAgent, error) {
 	// Generate unique agent ID
 	agentID := fmt.Sprintf("%s-%d", string(cfg.Role), time.Now().UnixNano())
 
+	runtime, err := agentsdk.New(agentsdk.Config{
+		Role:              cfg.Role,
+		AgentID:           agentID,
+		Logger:            cfg.Logger,
+		HeartbeatInterval: heartbeatInterval,
+		MaxMessageBytes:   cfg.MaxMessageBytes,
+		Truncate:          truncateEventPayload,
+		// Cancelling a command aborts the LLM CLI call behind it
+		Capabilities: protocol.Capabilities{Cancellation: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	agent := &LLMAgent{
 		config:       *cfg,
+		runtime:      runtime,
+		agentID:      agentID,
 		llmCaller:    llmCaller,
 		receiptStore: receiptStore,
 		fsProvider:   fsProvider,
-		startTime:    time.Now(),
-		lastActivityAt: time.Now(),
-		currentStatus: protocol.HeartbeatStatusStarting,
-		agentID:      agentID,
 	}
 
-	// Create event emitter (will be set up in Run method with encoder)
+	// Every action goes through handleCommand, which enforces role routing
+	for _, action := range []protocol.Action{
+		protocol.ActionIntake,
+		protocol.ActionTaskDiscovery,
+		protocol.ActionImplement,
+		protocol.ActionImplementChanges,
+		protocol.ActionReview,
+		protocol.ActionUpdateSpec,
+	} {
+		runtime.HandleFunc(action, agent.handle)
+	}
+
 	return agent, nil
 }
 
 // Run starts the agent's NDJSON I/O loop
 func (a *LLMAgent) Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
-	// Set up encoder/decoder
-	a.encoder = ndjson.NewEncoder(stdout, a.config.Logger)
-	a.decoder = ndjson.NewDecoder(stdin, a.config.Logger)
-
-	// Create event emitter with encoder
-	a.eventEmitter = NewRealEventEmitter(a.encoder, a.config.Logger, a.config.Role, a.agentID, a.config.MaxMessageBytes)
-
-	// Initialize heartbeat timers before first emission
-	a.startTime = time.Now()
-	a.lastActivityAt = time.Now()
-	a.currentStatus = protocol.HeartbeatStatusStarting
-
-	// Start heartbeat goroutine
-	go a.heartbeatLoop(ctx)
-
-	// Send initial heartbeat (status: starting)
-	if err := a.sendHeartbeat(protocol.HeartbeatStatusStarting, ""); err != nil {
-		return fmt.Errorf("failed to send starting heartbeat: %w", err)
-	}
+	return a.runtime.Run(ctx, stdin, stdout)
+}
 
-	// Mark ready
-	a.setStatus(protocol.HeartbeatStatusReady, "")
-	if err := a.sendHeartbeat(protocol.HeartbeatStatusReady, ""); err != nil {
-		return fmt.Errorf("failed to send ready heartbeat: %w", err)
+// handle adapts the SDK handler signature to the agent's injected emitter
+func (a *LLMAgent) handle(ctx context.Context, cmd *protocol.Command, e *agentsdk.Emitter) error {
+	if a.eventEmitter == nil {
+		a.eventEmitter = newRealEventEmitterFromSDK(e)
 	}
+	a.cmdCtx = ctx
+	defer func() { a.cmdCtx = nil }()
+	return a.handleCommand(cmd)
+}
 
-	// Process commands from stdin
-	for {
-		select {
-		case <-ctx.Done():
-			a.setStatus(protocol.HeartbeatStatusStopping, "")
-			a.sendHeartbeat(protocol.HeartbeatStatusStopping, "")
-			return nil
-		default:
-			var cmd protocol.Command
-			if err := a.decoder.Decode(&cmd); err != nil {
-				if err == io.EOF {
-					return nil // Clean shutdown
-				}
-				return fmt.Errorf("failed to decode command: %w", err)
-			}
-
-			// Route to handler
-			if err := a.handleCommand(&cmd); err != nil {
-				a.config.Logger.Error("command failed", "action", cmd.Action, "error", err)
-				// Send error event but continue processing
-				a.eventEmitter.SendErrorEvent(&cmd, "command_failed", err.Error())
-			}
-		}
+// commandContext returns the context of the command being handled, which
+// ends when lorch cancels it
+func (a *LLMAgent) commandContext() context.Context {
+	if a.cmdCtx == nil {
+		return context.Background()
 	}
+	return a.cmdCtx
 }
 
 // handleCommand routes commands to appropriate handlers
 func (a *LLMAgent) handleCommand(cmd *protocol.Command) error {
 	a.config.Logger.Info("handling command", "action", cmd.Action, "task_id", cmd.TaskID)
 
-	// Update activity timestamp
-	a.updateActivity()
-
-	// Version mismatch detection
-	a.mu.Lock()
-	if a.firstObservedSnapshotID == "" {
-		a.firstObservedSnapshotID = cmd.Version.SnapshotID
-		a.config.Logger.Info("recorded initial snapshot", "snapshot_id", a.firstObservedSnapshotID)
-	} else if cmd.Version.SnapshotID != a.firstObservedSnapshotID {
-		a.mu.Unlock()
-		return a.eventEmitter.SendErrorEvent(cmd, "version_mismatch",
-			fmt.Sprintf("expected snapshot %s, received %s", a.firstObservedSnapshotID, cmd.Version.SnapshotID))
-	}
-	a.mu.Unlock()
-
-	// Set status to busy
-	a.setStatus(protocol.HeartbeatStatusBusy, cmd.TaskID)
-	defer a.setStatus(protocol.HeartbeatStatusReady, "")
-
 	// Route to appropriate handler based on action
 	switch cmd.Action {
 	case protocol.ActionIntake, protocol.ActionTaskDiscovery:
@@ -184,68 +150,3 @@ func (a *LLMAgent) handleOrchestration(cmd *protocol.Command) error {
 	// Delegate to the orchestration logic
 	return a.handleOrchestrationLogic(cmd)
 }
-
-// setStatus updates the agent status and activity timestamp
-func (a *LLMAgent) setStatus(status protocol.HeartbeatStatus, taskID string) {
-	a.mu.Lock()
-	a.currentStatus = status
-	a.currentTaskID = taskID
-	a.lastActivityAt = time.Now()
-	a.mu.Unlock()
-}
-
-// updateActivity updates the last activity timestamp
-func (a *LLMAgent) updateActivity() {
-	a.mu.Lock()
-	a.lastActivityAt = time.Now()
-	a.mu.Unlock()
-}
-
-// heartbeatLoop sends heartbeats at regular intervals
-func (a *LLMAgent) heartbeatLoop(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			a.mu.Lock()
-			status := a.currentStatus
-			taskID := a.currentTaskID
-			a.mu.Unlock()
-
-			// Send heartbeat (errors are logged but don't stop the loop)
-			if err := a.sendHeartbeat(status, taskID); err != nil {
-				a.config.Logger.Error("failed to send heartbeat", "error", err)
-			}
-		case <-ctx.Done():
-			return
-		}
-	}
-}
-
-// sendHeartbeat sends a heartbeat message
-func (a *LLMAgent) sendHeartbeat(status protocol.HeartbeatStatus, taskID string) error {
-	a.mu.Lock()
-	a.hbSeq++
-	seq := a.hbSeq
-	lastActivityAt := a.lastActivityAt
-	a.mu.Unlock()
-
-	hb := protocol.Heartbeat{
-		Kind: protocol.MessageKindHeartbeat,
-		Agent: protocol.AgentRef{
-			AgentType: a.config.Role,
-			AgentID:   a.agentID,
-		},
-		Seq:            seq,
-		Status:         status,
-		PID:            os.Getpid(),
-		PPID:           os.Getppid(),
-		UptimeS:        time.Since(a.startTime).Seconds(),
-		LastActivityAt: lastActivityAt,
-		TaskID:         taskID,
-		// Stats optional - can add CPU/memory monitoring
-	}
-	return a.encoder.Encode(hb)
-}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -44,21 +50,21 @@ func TestLLMAgentStatusTransitions(t *testing.T) {
 	require.NoError(t, err)
 
 	// Test initial status
-	assert.Equal(t, protocol.HeartbeatStatusStarting, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	assert.Equal(t, protocol.HeartbeatStatusStarting, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 
 	// Test status transitions
-	agent.setStatus(protocol.HeartbeatStatusReady, "")
-	assert.Equal(t, protocol.HeartbeatStatusReady, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusReady, "")
+	assert.Equal(t, protocol.HeartbeatStatusReady, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 
-	agent.setStatus(protocol.HeartbeatStatusBusy, "T-001")
-	assert.Equal(t, protocol.HeartbeatStatusBusy, agent.currentStatus)
-	assert.Equal(t, "T-001", agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusBusy, "T-001")
+	assert.Equal(t, protocol.HeartbeatStatusBusy, agentStatus(agent))
+	assert.Equal(t, "T-001", agentTaskID(agent))
 
-	agent.setStatus(protocol.HeartbeatStatusReady, "")
-	assert.Equal(t, protocol.HeartbeatStatusReady, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusReady, "")
+	assert.Equal(t, protocol.HeartbeatStatusReady, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 }
 
 func TestLLMAgentActivityUpdate(t *testing.T) {
@@ -72,35 +78,37 @@ func TestLLMAgentActivityUpdate(t *testing.T) {
 	agent, err := NewLLMAgent(cfg)
 	require.NoError(t, err)
 
-	initialTime := agent.lastActivityAt
+	initialTime := agent.runtime.LastActivityAt()
 
 	// Wait a bit and update activity
 	time.Sleep(10 * time.Millisecond)
-	agent.updateActivity()
+	agent.runtime.Touch()
 
-	assert.True(t, agent.lastActivityAt.After(initialTime))
+	assert.True(t, agent.runtime.LastActivityAt().After(initialTime))
 }
 
 func TestLLMAgentVersionTracking(t *testing.T) {
-	cfg := &AgentConfig{
-		Role:      protocol.AgentTypeOrchestration,
-		LLMCLI:    "claude",
-		Workspace: "/tmp/test",
-		Logger:    createTestLogger(),
-	}
+	tu := NewTestUtilities(t)
+	defer tu.Cleanup()
 
-	agent, err := NewLLMAgent(cfg)
-	require.NoError(t, err)
+	agent := tu.CreateTestAgent(protocol.AgentTypeOrchestration)
 
 	// Test initial state
-	assert.Empty(t, agent.firstObservedSnapshotID)
+	assert.Empty(t, agent.runtime.ObservedSnapshotID())
+
+	// The first command pins the snapshot
+	cmd := tu.CreateTestCommand(protocol.ActionImplement, "T-001")
+	cmd.Version.SnapshotID = "snap-001"
+	tu.RunCommands(agent, cmd)
 
-	// Simulate first command
-	agent.mu.Lock()
-	agent.firstObservedSnapshotID = "snap-001"
-	agent.mu.Unlock()
+	assert.Equal(t, "snap-001", agent.runtime.ObservedSnapshotID())
 
-	assert.Equal(t, "snap-001", agent.firstObservedSnapshotID)
+	// A new command follows the snapshot lorch captured after a step
+	next := tu.CreateTestCommand(protocol.ActionImplement, "T-001")
+	next.Version.SnapshotID = "snap-002"
+	tu.RunCommands(agent, next)
+
+	assert.Equal(t, "snap-002", agent.runtime.ObservedSnapshotID())
 }
 
 func TestLLMAgentHeartbeatSequence(t *testing.T) {
@@ -114,22 +122,27 @@ func TestLLMAgentHeartbeatSequence(t *testing.T) {
 	agent, err := NewLLMAgent(cfg)
 	require.NoError(t, err)
 
-	// Test heartbeat sequence increment
-	initialSeq := agent.hbSeq
-
-	agent.mu.Lock()
-	agent.hbSeq++
-	seq1 := agent.hbSeq
-	agent.mu.Unlock()
+	// Test heartbeat sequence increment across the run lifecycle
+	initialSeq := agent.runtime.HeartbeatSeq()
 
-	assert.Equal(t, initialSeq+1, seq1)
-
-	agent.mu.Lock()
-	agent.hbSeq++
-	seq2 := agent.hbSeq
-	agent.mu.Unlock()
+	var stdout bytes.Buffer
+	err = agent.Run(context.Background(), strings.NewReader(""), &stdout, io.Discard)
+	require.NoError(t, err)
 
-	assert.Equal(t, seq1+1, seq2)
+	dec := ndjson.NewDecoder(&stdout, createTestLogger())
+	seq := initialSeq
+	for {
+		var hb protocol.Heartbeat
+		if err := dec.Decode(&hb); err != nil {
+			break
+		}
+		if hb.Kind != protocol.MessageKindHeartbeat {
+			continue // the opening hello
+		}
+		assert.Equal(t, seq+1, hb.Seq)
+		seq = hb.Seq
+	}
+	assert.Equal(t, initialSeq+3, seq)
 }
 
 func TestLLMAgentCommandRouting(t *testing.T) {
@@ -182,37 +195,14 @@ func TestLLMAgentCommandRouting(t *testing.T) {
 }
 
 func TestLLMAgentVersionMismatch(t *testing.T) {
-	cfg := &AgentConfig{
-		Role:      protocol.AgentTypeOrchestration,
-		LLMCLI:    "claude",
-		Workspace: "/tmp/test",
-		Logger:    createTestLogger(),
-	}
+	tu := NewTestUtilities(t)
+	defer tu.Cleanup()
 
-	agent, err := NewLLMAgent(cfg)
-	require.NoError(t, err)
+	agent := tu.CreateTestAgent(protocol.AgentTypeOrchestration)
 
-	// Set up mock event emitter for testing
-	agent.eventEmitter = NewMockEventEmitter()
-
-	// Set initial snapshot
-	agent.mu.Lock()
-	agent.firstObservedSnapshotID = "snap-001"
-	agent.mu.Unlock()
-
-	// Test version mismatch
-	cmd := &protocol.Command{
-		Action: protocol.ActionIntake,
-		TaskID: "T-001",
-		Version: protocol.Version{
-			SnapshotID: "snap-002", // Different snapshot
-		},
-	}
-
-	// This should trigger version mismatch error
-	err = agent.handleCommand(cmd)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "version_mismatch")
+	// A second snapshot after the first pinned one triggers version_mismatch
+	tu.AssertVersionMismatch(agent)
+	assert.Equal(t, 0, agent.llmCaller.(*MockLLMCaller).CallCount())
 }
 
 func TestLLMAgentMockInterfaces(t *testing.T) {
@@ -229,9 +219,6 @@ func TestLLMAgentMockInterfaces(t *testing.T) {
 		llmCaller:    NewMockLLMCaller(),
 		receiptStore: NewMockReceiptStore(),
 		fsProvider:   NewMockFSProvider(),
-		startTime:    time.Now(),
-		lastActivityAt: time.Now(),
-		currentStatus: protocol.HeartbeatStatusStarting,
 	}
 
 	assert.NotNil(t, agent.llmCaller)
@@ -256,8 +243,7 @@ func TestLLMAgentBasicIntegration(t *testing.T) {
 	assert.NotNil(t, agent.llmCaller)
 	assert.NotNil(t, agent.receiptStore)
 	assert.NotNil(t, agent.fsProvider)
-	assert.Equal(t, protocol.HeartbeatStatusStarting, agent.currentStatus)
-	assert.True(t, agent.startTime.Before(time.Now()) || agent.startTime.Equal(time.Now()))
+	assert.Equal(t, protocol.HeartbeatStatusStarting, agentStatus(agent))
 }
 
 func TestLLMAgentHeartbeatFields(t *testing.T) {
@@ -272,12 +258,11 @@ func TestLLMAgentHeartbeatFields(t *testing.T) {
 	require.NoError(t, err)
 
 	// Test heartbeat field initialization
-	assert.Equal(t, int64(0), agent.hbSeq)
-	assert.Equal(t, protocol.HeartbeatStatusStarting, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
-	assert.Empty(t, agent.firstObservedSnapshotID)
-	assert.True(t, agent.startTime.Before(time.Now()) || agent.startTime.Equal(time.Now()))
-	assert.True(t, agent.lastActivityAt.Before(time.Now()) || agent.lastActivityAt.Equal(time.Now()))
+	assert.Equal(t, int64(0), agent.runtime.HeartbeatSeq())
+	assert.Equal(t, protocol.HeartbeatStatusStarting, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
+	assert.Empty(t, agent.runtime.ObservedSnapshotID())
+	assert.True(t, agent.runtime.LastActivityAt().Before(time.Now()) || agent.runtime.LastActivityAt().Equal(time.Now()))
 }
 
 func TestLLMAgentConcurrentAccess(t *testing.T) {
@@ -296,9 +281,9 @@ func TestLLMAgentConcurrentAccess(t *testing.T) {
 
 	for i := 0; i < 10; i++ {
 		go func() {
-			agent.setStatus(protocol.HeartbeatStatusBusy, "T-001")
-			agent.updateActivity()
-			agent.setStatus(protocol.HeartbeatStatusReady, "")
+			agent.runtime.SetStatus(protocol.HeartbeatStatusBusy, "T-001")
+			agent.runtime.Touch()
+			agent.runtime.SetStatus(protocol.HeartbeatStatusReady, "")
 			done <- true
 		}()
 	}
@@ -324,53 +309,50 @@ func TestLLMAgentHeartbeatLifecycle(t *testing.T) {
 	require.NoError(t, err)
 
 	// Test complete heartbeat lifecycle: starting → ready → busy → ready → stopping
-	assert.Equal(t, protocol.HeartbeatStatusStarting, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	assert.Equal(t, protocol.HeartbeatStatusStarting, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 
 	// Transition to ready
-	agent.setStatus(protocol.HeartbeatStatusReady, "")
-	assert.Equal(t, protocol.HeartbeatStatusReady, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusReady, "")
+	assert.Equal(t, protocol.HeartbeatStatusReady, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 
 	// Transition to busy with task
-	agent.setStatus(protocol.HeartbeatStatusBusy, "T-001")
-	assert.Equal(t, protocol.HeartbeatStatusBusy, agent.currentStatus)
-	assert.Equal(t, "T-001", agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusBusy, "T-001")
+	assert.Equal(t, protocol.HeartbeatStatusBusy, agentStatus(agent))
+	assert.Equal(t, "T-001", agentTaskID(agent))
 
 	// Transition back to ready
-	agent.setStatus(protocol.HeartbeatStatusReady, "")
-	assert.Equal(t, protocol.HeartbeatStatusReady, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusReady, "")
+	assert.Equal(t, protocol.HeartbeatStatusReady, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 
 	// Transition to stopping
-	agent.setStatus(protocol.HeartbeatStatusStopping, "")
-	assert.Equal(t, protocol.HeartbeatStatusStopping, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusStopping, "")
+	assert.Equal(t, protocol.HeartbeatStatusStopping, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 }
 
 func TestLLMAgentHeartbeatSequenceIncrement(t *testing.T) {
-	cfg := &AgentConfig{
-		Role:      protocol.AgentTypeOrchestration,
-		LLMCLI:    "claude",
-		Workspace: "/tmp/test",
-		Logger:    createTestLogger(),
-	}
+	tu := NewTestUtilities(t)
+	defer tu.Cleanup()
 
-	agent, err := NewLLMAgent(cfg)
-	require.NoError(t, err)
+	agent := tu.CreateTestAgent(protocol.AgentTypeOrchestration)
 
 	// Test that heartbeat sequence increments properly
-	initialSeq := agent.hbSeq
+	initialSeq := agent.runtime.HeartbeatSeq()
 	assert.Equal(t, int64(0), initialSeq)
 
-	// Simulate multiple heartbeat sends
+	// Each command adds a busy heartbeat on top of starting, ready and stopping
+	var cmds []*protocol.Command
 	for i := 0; i < 5; i++ {
-		agent.mu.Lock()
-		agent.hbSeq++
-		seq := agent.hbSeq
-		agent.mu.Unlock()
-		assert.Equal(t, int64(i+1), seq)
+		cmd := tu.CreateTestCommand(protocol.ActionImplement, "T-001")
+		cmd.IdempotencyKey = fmt.Sprintf("ik:test:%d", i)
+		cmds = append(cmds, cmd)
 	}
+	tu.RunCommands(agent, cmds...)
+
+	assert.Equal(t, int64(3+5), agent.runtime.HeartbeatSeq())
 }
 
 func TestLLMAgentHeartbeatFieldsInitialization(t *testing.T) {
@@ -386,11 +368,10 @@ func TestLLMAgentHeartbeatFieldsInitialization(t *testing.T) {
 
 	// Test that all required heartbeat fields are properly initialized
 	assert.NotEmpty(t, agent.agentID)
-	assert.True(t, agent.startTime.Before(time.Now()) || agent.startTime.Equal(time.Now()))
-	assert.True(t, agent.lastActivityAt.Before(time.Now()) || agent.lastActivityAt.Equal(time.Now()))
-	assert.Equal(t, int64(0), agent.hbSeq)
-	assert.Equal(t, protocol.HeartbeatStatusStarting, agent.currentStatus)
-	assert.Empty(t, agent.currentTaskID)
+	assert.True(t, agent.runtime.LastActivityAt().Before(time.Now()) || agent.runtime.LastActivityAt().Equal(time.Now()))
+	assert.Equal(t, int64(0), agent.runtime.HeartbeatSeq())
+	assert.Equal(t, protocol.HeartbeatStatusStarting, agentStatus(agent))
+	assert.Empty(t, agentTaskID(agent))
 }
 
 func TestLLMAgentActivityTracking(t *testing.T) {
@@ -405,19 +386,19 @@ func TestLLMAgentActivityTracking(t *testing.T) {
 	require.NoError(t, err)
 
 	// Test activity tracking
-	initialActivity := agent.lastActivityAt
+	initialActivity := agent.runtime.LastActivityAt()
 
 	// Wait a bit and update activity
 	time.Sleep(10 * time.Millisecond)
-	agent.updateActivity()
+	agent.runtime.Touch()
 
-	assert.True(t, agent.lastActivityAt.After(initialActivity))
+	assert.True(t, agent.runtime.LastActivityAt().After(initialActivity))
 
 	// Test that setStatus also updates activity
 	time.Sleep(10 * time.Millisecond)
-	agent.setStatus(protocol.HeartbeatStatusBusy, "T-001")
+	agent.runtime.SetStatus(protocol.HeartbeatStatusBusy, "T-001")
 
-	assert.True(t, agent.lastActivityAt.After(initialActivity))
+	assert.True(t, agent.runtime.LastActivityAt().After(initialActivity))
 }
 
 func TestLLMAgentHeartbeatContinuity(t *testing.T) {
@@ -433,20 +414,20 @@ func TestLLMAgentHeartbeatContinuity(t *testing.T) {
 
 	// Test that heartbeats continue during long operations
 	// This simulates the scenario where an agent is busy for a long time
-	agent.setStatus(protocol.HeartbeatStatusBusy, "T-001")
+	agent.runtime.SetStatus(protocol.HeartbeatStatusBusy, "T-001")
 
 	// Simulate activity updates during long operation
 	for i := 0; i < 5; i++ {
 		time.Sleep(5 * time.Millisecond)
-		agent.updateActivity()
+		agent.runtime.Touch()
 	}
 
 	// Status should still be busy
-	assert.Equal(t, protocol.HeartbeatStatusBusy, agent.currentStatus)
-	assert.Equal(t, "T-001", agent.currentTaskID)
+	assert.Equal(t, protocol.HeartbeatStatusBusy, agentStatus(agent))
+	assert.Equal(t, "T-001", agentTaskID(agent))
 
 	// Activity should be recent
-	assert.True(t, time.Since(agent.lastActivityAt) < 100*time.Millisecond)
+	assert.True(t, time.Since(agent.runtime.LastActivityAt()) < 100*time.Millisecond)
 }
 
 func TestLLMAgentAgentIDGeneration(t *testing.T) {
@@ -497,16 +478,16 @@ func TestLLMAgentHeartbeatStatusTransitions(t *testing.T) {
 	}
 
 	for i, status := range statuses {
-		agent.setStatus(status, "")
-		assert.Equal(t, status, agent.currentStatus, "Status transition %d failed", i)
+		agent.runtime.SetStatus(status, "")
+		assert.Equal(t, status, agentStatus(agent), "Status transition %d failed", i)
 	}
 
 	// Test busy status with task ID
-	agent.setStatus(protocol.HeartbeatStatusBusy, "T-001")
-	assert.Equal(t, protocol.HeartbeatStatusBusy, agent.currentStatus)
-	assert.Equal(t, "T-001", agent.currentTaskID)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusBusy, "T-001")
+	assert.Equal(t, protocol.HeartbeatStatusBusy, agentStatus(agent))
+	assert.Equal(t, "T-001", agentTaskID(agent))
 
 	// Test backoff status
-	agent.setStatus(protocol.HeartbeatStatusBackoff, "")
-	assert.Equal(t, protocol.HeartbeatStatusBackoff, agent.currentStatus)
+	agent.runtime.SetStatus(protocol.HeartbeatStatusBackoff, "")
+	assert.Equal(t, protocol.HeartbeatStatusBackoff, agentStatus(agent))
 }
@@ -12,7 +12,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -7,70 +7,46 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/agentsdk"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
-// RealEventEmitter implements EventEmitter using real NDJSON encoding
+// RealEventEmitter implements EventEmitter on top of the agentsdk emitter
 type RealEventEmitter struct {
-	encoder  *ndjson.Encoder
-	logger   *slog.Logger
-	agentType protocol.AgentType
-	agentID  string
+	emitter         *agentsdk.Emitter
 	maxMessageBytes int
 }
 
 // NewRealEventEmitter creates a new real event emitter
 func NewRealEventEmitter(encoder *ndjson.Encoder, logger *slog.Logger, agentType protocol.AgentType, agentID string, maxMessageBytes int) *RealEventEmitter {
-	if maxMessageBytes <= 0 {
-		maxMessageBytes = 256 * 1024 // 256 KiB default (Spec §12)
-	}
+	return newRealEventEmitterFromSDK(agentsdk.NewEmitter(encoder, logger, agentType, agentID, maxMessageBytes, truncateEventPayload))
+}
+
+// newRealEventEmitterFromSDK wraps an emitter owned by the agentsdk runtime
+func newRealEventEmitterFromSDK(emitter *agentsdk.Emitter) *RealEventEmitter {
 	return &RealEventEmitter{
-		encoder:   encoder,
-		logger:    logger,
-		agentType: agentType,
-		agentID:   agentID,
-		maxMessageBytes: maxMessageBytes,
+		emitter:         emitter,
+		maxMessageBytes: emitter.MaxMessageBytes(),
 	}
 }
 
+// truncateEventPayload is the agentsdk.TruncateFunc used for oversized events
+func truncateEventPayload(eventName string, payload map[string]any, maxBytes int) map[string]any {
+	e := &RealEventEmitter{maxMessageBytes: maxBytes}
+	return e.truncatePayloadDeterministically(eventName, payload)
+}
+
 // NewEvent creates a base event with all required fields
 func (e *RealEventEmitter) NewEvent(cmd *protocol.Command, eventName string) protocol.Event {
-	return protocol.Event{
-		Kind:          protocol.MessageKindEvent,
-		MessageID:     uuid.New().String(),
-		CorrelationID: cmd.CorrelationID,
-		TaskID:        cmd.TaskID,
-		From: protocol.AgentRef{
-			AgentType: e.agentType,
-			AgentID:   e.agentID,
-		},
-		Event: eventName,
-		ObservedVersion: &protocol.Version{
-			SnapshotID: cmd.Version.SnapshotID,
-		},
-		OccurredAt: time.Now().UTC(),
-	}
+	return e.emitter.NewEvent(cmd, eventName)
 }
 
-// EncodeEventCapped marshals and emits an event, enforcing the NDJSON message size cap
+// EncodeEventCapped emits an event, enforcing the NDJSON message size cap
 func (e *RealEventEmitter) EncodeEventCapped(evt protocol.Event) error {
-	b, err := json.Marshal(evt)
-	if err != nil {
-		return err
-	}
-	if len(b) <= e.maxMessageBytes {
-		return e.encoder.Encode(evt)
-	}
-
-	// Apply deterministic truncation strategy based on event type
-	truncatedPayload := e.truncatePayloadDeterministically(evt.Event, evt.Payload)
-	evt.Payload = truncatedPayload
-	return e.encoder.Encode(evt)
+	return e.emitter.Emit(evt)
 }
 
-
 // truncatePayloadDeterministically applies event-specific truncation strategies
 func (e *RealEventEmitter) truncatePayloadDeterministically(eventName string, payload map[string]any) map[string]any {
 	switch eventName {
@@ -168,21 +144,7 @@ func (e *RealEventEmitter) truncateOrchestrationPlanConflict(payload map[string]
 
 // truncateGenericPayload provides fallback truncation for non-orchestration events
 func (e *RealEventEmitter) truncateGenericPayload(payload map[string]any) map[string]any {
-	// Fallback: stringify payload preview under "_truncated" and clear original payload
-	preview := ""
-	if pb, err := json.Marshal(payload); err == nil {
-		// Limit preview to 25% of max message size or 2KB, whichever is smaller
-		maxPreviewSize := e.maxMessageBytes / 4
-		if maxPreviewSize > 2048 {
-			maxPreviewSize = 2048
-		}
-		if len(pb) > maxPreviewSize {
-			preview = string(pb[:maxPreviewSize]) + "…"
-		} else {
-			preview = string(pb)
-		}
-	}
-	return map[string]any{"_truncated": preview}
+	return agentsdk.TruncateGeneric(payload, e.maxMessageBytes)
 }
 
 // sortCandidatesByConfidence sorts candidates by confidence (descending)
@@ -259,13 +221,7 @@ func (e *RealEventEmitter) truncateTasksList(tasks []map[string]any, maxSize int
 
 // SendErrorEvent sends a structured error event with machine-readable error codes
 func (e *RealEventEmitter) SendErrorEvent(cmd *protocol.Command, code, message string) error {
-	evt := e.NewEvent(cmd, "error")
-	evt.Status = "failed"
-	evt.Payload = map[string]any{
-		"code":    code,
-		"message": message,
-	}
-	return e.EncodeEventCapped(evt)
+	return e.emitter.SendError(cmd, code, message)
 }
 
 // SendOrchestrationProposedTasksEvent sends an orchestration.proposed_tasks event
@@ -319,15 +275,7 @@ func (e *RealEventEmitter) SendLog(level, message string, fields map[string]any)
 	if fields != nil {
 		fields = e.redactSecrets(fields)
 	}
-
-	log := protocol.Log{
-		Kind:      protocol.MessageKindLog,
-		Level:     protocol.LogLevel(level),
-		Message:   message,
-		Fields:    fields,
-		Timestamp: time.Now().UTC(),
-	}
-	return e.encoder.Encode(log)
+	return e.emitter.SendLog(protocol.LogLevel(level), message, fields)
 }
 
 // redactSecrets redacts fields ending with _TOKEN, _KEY, _SECRET
@@ -8,7 +8,7 @@ import (
 	"testing"
 
 	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
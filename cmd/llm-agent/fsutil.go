@@ -9,7 +9,7 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // RealFSProvider implements FSProvider using real filesystem operations
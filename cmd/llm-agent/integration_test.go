@@ -9,8 +9,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -96,27 +95,29 @@ func TestLLMAgentHeartbeatOutput(t *testing.T) {
 	agent, err := NewLLMAgent(cfg)
 	require.NoError(t, err)
 
-	// Test heartbeat generation
-	var stdout bytes.Buffer
-	agent.encoder = ndjson.NewEncoder(&stdout, nil)
-
-	// Send a heartbeat
-	err = agent.sendHeartbeat(protocol.HeartbeatStatusReady, "")
+	// Run with no commands: starting, ready, then stopping on EOF
+	var stdout, stderr bytes.Buffer
+	err = agent.Run(context.Background(), strings.NewReader(""), &stdout, &stderr)
 	require.NoError(t, err)
 
-	// Verify heartbeat output
-	output := stdout.String()
-	assert.NotEmpty(t, output)
+	// Verify output: hello, then the heartbeats
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 4)
+
+	var hello protocol.Hello
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &hello))
+	assert.Equal(t, protocol.MessageKindHello, hello.Kind)
+	assert.Equal(t, protocol.AgentTypeOrchestration, hello.Agent.AgentType)
 
-	// Parse heartbeat
+	// Parse the ready heartbeat
 	var hb protocol.Heartbeat
-	err = json.Unmarshal([]byte(output), &hb)
+	err = json.Unmarshal([]byte(lines[2]), &hb)
 	require.NoError(t, err)
 
 	assert.Equal(t, protocol.MessageKindHeartbeat, hb.Kind)
 	assert.Equal(t, protocol.AgentTypeOrchestration, hb.Agent.AgentType)
 	assert.Equal(t, protocol.HeartbeatStatusReady, hb.Status)
-	assert.Equal(t, int64(1), hb.Seq)
+	assert.Equal(t, int64(2), hb.Seq)
 	assert.Greater(t, hb.PID, 0)
 	assert.GreaterOrEqual(t, hb.UptimeS, 0.0)
 	assert.NotEmpty(t, hb.LastActivityAt)
@@ -5,7 +5,7 @@ import (
 	"log/slog"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // LLMCaller defines the interface for calling external LLM CLI tools
@@ -110,6 +110,9 @@ func (r *RealLLMCaller) Call(ctx context.Context, prompt string) (string, error)
 
 	// Wait for the process to complete
 	if err := cmd.Wait(); err != nil {
+		if ctxErr := cmdCtx.Err(); ctxErr != nil {
+			return "", fmt.Errorf("LLM CLI stopped: %w", ctxErr)
+		}
 		// Log stderr for diagnostics (but don't fail on stderr content)
 		if stderrBuf.Len() > 0 {
 			fmt.Fprintf(os.Stderr, "LLM CLI stderr: %s\n", stderrBuf.String())
@@ -9,7 +9,8 @@ import (
 	"os/signal"
 	"syscall"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func main() {
@@ -18,6 +19,7 @@ func main() {
 		llmCLI    = flag.String("llm-cli", "claude", "LLM CLI command (claude, codex, etc.)")
 		workspace = flag.String("workspace", ".", "Workspace root")
 		logLevel  = flag.String("log-level", "info", "Log level")
+		maxBytes  = flag.Int("max-message-bytes", ndjson.MaxMessageSize, "Largest NDJSON message to send or accept; lorch may lower it during the handshake")
 	)
 	flag.Parse()
 
@@ -49,7 +51,7 @@ func main() {
 		LLMCLI:    *llmCLI,
 		Workspace: *workspace,
 		Logger:    logger,
-		MaxMessageBytes: 256 * 1024, // 256 KiB default (Spec §12)
+		MaxMessageBytes: *maxBytes,
 	}
 
 	// Create agent
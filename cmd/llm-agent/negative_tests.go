@@ -8,7 +8,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -684,18 +684,8 @@ func TestNegativeAgentBehavior(t *testing.T) {
 	})
 
 	t.Run("VersionMismatch", func(t *testing.T) {
-		// Set initial snapshot
-		agent.mu.Lock()
-		agent.firstObservedSnapshotID = "snap-001"
-		agent.mu.Unlock()
-
-		// Create command with different snapshot
-		cmd := tu.CreateTestCommand(protocol.ActionIntake, "T-001")
-		cmd.Version.SnapshotID = "snap-002"
-
-		err := agent.handleCommand(cmd)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "version_mismatch")
+		// A command for a different snapshot than the first one is rejected
+		tu.AssertVersionMismatch(agent)
 	})
 
 	t.Run("LLMError", func(t *testing.T) {
@@ -3,12 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // OrchestrationResult represents the parsed result from the LLM
@@ -56,6 +57,10 @@ func (a *LLMAgent) handleOrchestrationLogic(cmd *protocol.Command) error {
 
 	// 2. Cache miss - process normally with LLM
 	result, err := a.callOrchestrationLLM(cmd)
+	if errors.Is(err, context.Canceled) {
+		// lorch cancelled the command; the runtime acknowledges it
+		return err
+	}
 	if err != nil {
 		return a.eventEmitter.SendErrorEvent(cmd, "llm_call_failed", err.Error())
 	}
@@ -142,7 +147,7 @@ func (a *LLMAgent) callOrchestrationLLM(cmd *protocol.Command) (*OrchestrationRe
 	prompt := a.buildOrchestrationPrompt(isTaskDiscovery, inputs.UserInstruction, candidates, planContents, cmd)
 
 	// Call LLM
-	response, err := a.llmCaller.Call(context.Background(), prompt)
+	response, err := a.llmCaller.Call(a.commandContext(), prompt)
 	if err != nil {
 		return nil, fmt.Errorf("LLM call failed: %w", err)
 	}
@@ -6,7 +6,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -402,19 +402,8 @@ func (tr *TestRunner) RunRegressionTests() {
 
 			agent := tu.CreateTestAgent(protocol.AgentTypeOrchestration)
 
-			// Set initial snapshot
-			agent.mu.Lock()
-			agent.firstObservedSnapshotID = "snap-001"
-			agent.mu.Unlock()
-
-			// Create command with different snapshot
-			cmd := tu.CreateTestCommand(protocol.ActionIntake, "T-001")
-			cmd.Version.SnapshotID = "snap-002"
-
-			// Should handle version mismatch gracefully
-			err := agent.handleCommand(cmd)
-			require.Error(t, err)
-			assert.Contains(t, err.Error(), "version_mismatch")
+			// A command for a different snapshot than the first one is rejected
+			tu.AssertVersionMismatch(agent)
 
 			t.Log("Version mismatch regression test completed successfully")
 		})
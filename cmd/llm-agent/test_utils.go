@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -12,7 +14,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -82,6 +85,66 @@ func (tu *TestUtilities) CreateTestAgent(role protocol.AgentType) *LLMAgent {
 	return agent
 }
 
+// RunCommands feeds commands to the agent over NDJSON and returns the events it emitted
+func (tu *TestUtilities) RunCommands(agent *LLMAgent, cmds ...*protocol.Command) []protocol.Event {
+	var stdin bytes.Buffer
+	enc := ndjson.NewEncoder(&stdin, nil)
+	for _, cmd := range cmds {
+		require.NoError(tu.t, enc.Encode(cmd))
+	}
+
+	var stdout bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(tu.t, agent.Run(ctx, &stdin, &stdout, io.Discard))
+
+	var events []protocol.Event
+	dec := ndjson.NewDecoder(&stdout, slog.Default())
+	for {
+		msg, err := dec.DecodeEnvelope()
+		if err != nil {
+			break
+		}
+		if evt, ok := msg.(*protocol.Event); ok {
+			events = append(events, *evt)
+		}
+	}
+	return events
+}
+
+// AssertVersionMismatch pins the agent to one snapshot and checks that a
+// retry for another snapshot is rejected without reaching a handler
+func (tu *TestUtilities) AssertVersionMismatch(agent *LLMAgent) {
+	// The first command pins snap-001; implement is rejected by role routing,
+	// so it never reaches the LLM
+	pin := tu.CreateTestCommand(protocol.ActionImplement, "T-001")
+	pin.Version.SnapshotID = "snap-001"
+
+	cmd := tu.CreateTestCommand(protocol.ActionIntake, "T-001")
+	cmd.IdempotencyKey = "ik:test:mismatch"
+	cmd.Version.SnapshotID = "snap-002"
+	cmd.Retry.Attempt = 1
+
+	events := tu.RunCommands(agent, pin, cmd)
+	require.NotEmpty(tu.t, events)
+	last := events[len(events)-1]
+	assert.Equal(tu.t, "error", last.Event)
+	assert.Equal(tu.t, "failed", last.Status)
+	assert.Equal(tu.t, "version_mismatch", last.Payload["code"])
+}
+
+// agentStatus returns the heartbeat status the agent will report next
+func agentStatus(agent *LLMAgent) protocol.HeartbeatStatus {
+	status, _ := agent.runtime.Status()
+	return status
+}
+
+// agentTaskID returns the task the agent reports as busy with
+func agentTaskID(agent *LLMAgent) string {
+	_, taskID := agent.runtime.Status()
+	return taskID
+}
+
 // CreateTestCommand creates a test command with default values
 func (tu *TestUtilities) CreateTestCommand(action protocol.Action, taskID string) *protocol.Command {
 	return &protocol.Command{
@@ -4,12 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -455,9 +456,9 @@ func TestConcurrentAccess(t *testing.T) {
 		// Start multiple goroutines updating status
 		for i := 0; i < 10; i++ {
 			go func() {
-				agent.setStatus(protocol.HeartbeatStatusBusy, "T-001")
-				agent.updateActivity()
-				agent.setStatus(protocol.HeartbeatStatusReady, "")
+				agent.runtime.SetStatus(protocol.HeartbeatStatusBusy, "T-001")
+				agent.runtime.Touch()
+				agent.runtime.SetStatus(protocol.HeartbeatStatusReady, "")
 				done <- true
 			}()
 		}
@@ -474,23 +475,24 @@ func TestConcurrentAccess(t *testing.T) {
 	t.Run("ConcurrentHeartbeatSequence", func(t *testing.T) {
 		done := make(chan bool, 5)
 
-		// Start multiple goroutines incrementing heartbeat sequence
+		// Read the heartbeat sequence while the agent runs its lifecycle
 		for i := 0; i < 5; i++ {
 			go func() {
-				agent.mu.Lock()
-				agent.hbSeq++
-				agent.mu.Unlock()
+				_ = agent.runtime.HeartbeatSeq()
 				done <- true
 			}()
 		}
 
+		err := agent.Run(context.Background(), strings.NewReader(""), io.Discard, io.Discard)
+		require.NoError(t, err)
+
 		// Wait for all goroutines to complete
 		for i := 0; i < 5; i++ {
 			<-done
 		}
 
-		// Sequence should be incremented exactly 5 times
-		assert.Equal(t, int64(5), agent.hbSeq)
+		// starting, ready and stopping heartbeats were each numbered once
+		assert.Equal(t, int64(3), agent.runtime.HeartbeatSeq())
 	})
 }
 
@@ -510,18 +512,8 @@ func TestErrorHandling(t *testing.T) {
 	})
 
 	t.Run("VersionMismatch", func(t *testing.T) {
-		// Set initial snapshot
-		agent.mu.Lock()
-		agent.firstObservedSnapshotID = "snap-001"
-		agent.mu.Unlock()
-
-		// Create command with different snapshot
-		cmd := tu.CreateTestCommand(protocol.ActionIntake, "T-001")
-		cmd.Version.SnapshotID = "snap-002"
-
-		err := agent.handleCommand(cmd)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "version_mismatch")
+		// A command for a different snapshot than the first one is rejected
+		tu.AssertVersionMismatch(agent)
 	})
 
 	t.Run("LLMCallerError", func(t *testing.T) {
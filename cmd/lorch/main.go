@@ -5,9 +5,13 @@ import (
 	"os"
 
 	"github.com/iambrandonn/lorch/internal/cli"
+	"github.com/iambrandonn/lorch/internal/supervisor"
 )
 
 func main() {
+	// Sandboxed agents start as lorch re-executed in their namespaces
+	supervisor.SandboxInit()
+
 	if err := cli.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
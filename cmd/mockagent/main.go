@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -15,7 +16,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/iambrandonn/lorch/internal/agent/script"
 	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func main() {
@@ -27,6 +28,7 @@ func main() {
 	scriptFile := flag.String("script", "", "Path to response script file (JSON)")
 	reviewChangesCount := flag.Int("review-changes-count", 0, "Number of times to request changes before approving")
 	specChangesCount := flag.Int("spec-changes-count", 0, "Number of times to request spec changes before updating")
+	workspace := flag.String("workspace", "", "Directory to write artifacts under: scripted artifacts with content (default: working directory) and, only when set, the command's expected outputs")
 	flag.Parse()
 
 	// Setup logger (stderr for diagnostics, stdout for protocol)
@@ -75,6 +77,7 @@ func main() {
 		ppid:               os.Getppid(),
 		reviewChangesCount: *reviewChangesCount,
 		specChangesCount:   *specChangesCount,
+		workspace:          *workspace,
 	}
 
 	// Load script if provided
@@ -123,7 +126,16 @@ type MockAgent struct {
 	reviewChangesCount int // How many times to request changes before approving
 	specChangesCount   int // How many times to request spec changes before updating
 
+	// workspace is where artifacts are written; empty means scripted
+	// artifacts go to the working directory and expected outputs are not
+	// written
+	workspace string
+
+	// encMu serializes stdout writes from the heartbeat and command goroutines
+	encMu sync.Mutex
+
 	mu              sync.Mutex
+	inflight        *inflightCommand
 	heartbeatSeq    int64
 	lastActivityAt  time.Time
 	currentTaskID   string
@@ -161,6 +173,11 @@ func (a *MockAgent) Run(ctx context.Context) error {
 		}()
 	}
 
+	// Introduce ourselves before anything else so lorch can negotiate
+	if err := a.sendHello(); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+
 	// Send initial heartbeat
 	if err := a.sendHeartbeat(); err != nil {
 		return fmt.Errorf("failed to send initial heartbeat: %w", err)
@@ -227,13 +244,61 @@ func (a *MockAgent) sendHeartbeat() error {
 		TaskID:         taskID,
 	}
 
-	return a.encoder.Encode(hb)
+	return a.send(hb)
+}
+
+// sendHello announces the protocol versions the mock speaks. It handles every
+// action, so it declares none and lorch routes anything to it. Scripted
+// delays can be cancelled.
+func (a *MockAgent) sendHello() error {
+	return a.send(protocol.Hello{
+		Kind: protocol.MessageKindHello,
+		Agent: protocol.AgentRef{
+			AgentType: a.agentType,
+			AgentID:   a.agentID,
+		},
+		ProtocolVersions: protocol.SupportedProtocolVersions,
+		MaxMessageBytes:  ndjson.MaxMessageSize,
+		Capabilities:     protocol.Capabilities{Cancellation: true},
+	})
+}
+
+// send writes one protocol message to stdout
+func (a *MockAgent) send(v any) error {
+	a.encMu.Lock()
+	defer a.encMu.Unlock()
+	return a.encoder.Encode(v)
+}
+
+// inflightCommand is the command the worker is handling
+type inflightCommand struct {
+	cmd       *protocol.Command
+	cancel    context.CancelFunc
+	cancelReq *protocol.Cancel
 }
 
 func (a *MockAgent) processCommands(ctx context.Context, cancel context.CancelFunc) error {
+	// Commands are handled one at a time by a worker so that cancel messages
+	// can be read while a command is in flight
+	work := make(chan *protocol.Command, 16)
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		for cmd := range work {
+			a.runCommand(ctx, cmd)
+		}
+	}()
+	// Let queued commands finish before shutting down
+	drain := func() {
+		close(work)
+		<-workerDone
+		cancel()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
+			close(work)
 			return nil
 		default:
 		}
@@ -241,33 +306,113 @@ func (a *MockAgent) processCommands(ctx context.Context, cancel context.CancelFu
 		msg, err := a.decoder.DecodeEnvelope()
 		if err == io.EOF {
 			a.logger.Info("stdin closed, exiting")
-			cancel() // Cancel context to trigger shutdown
+			drain() // Cancel context to trigger shutdown
 			return io.EOF
 		}
+		var oversize *ndjson.OversizeError
+		if errors.As(err, &oversize) {
+			// The line has been skipped; keep serving
+			a.logger.Error("skipping message over the size limit", "error", err)
+			continue
+		}
 		if err != nil {
 			a.logger.Error("failed to decode message", "error", err)
 			continue
 		}
 
-		cmd, ok := msg.(*protocol.Command)
-		if !ok {
+		switch m := msg.(type) {
+		case *protocol.HelloAck:
+			if !m.Accepted {
+				a.logger.Error("lorch refused the protocol handshake", "reason", m.Reason)
+				drain()
+				return fmt.Errorf("handshake refused: %s", m.Reason)
+			}
+			a.logger.Info("protocol negotiated", "version", m.ProtocolVersion)
+
+		case *protocol.Cancel:
+			a.cancelCommand(m)
+
+		case *protocol.Command:
+			work <- m
+
+		default:
 			a.logger.Warn("received non-command message", "type", fmt.Sprintf("%T", msg))
-			continue
 		}
+	}
+}
 
-		a.updateActivity()
-		a.setTaskID(cmd.TaskID)
-		a.setStatus(protocol.HeartbeatStatusBusy)
+// runCommand handles one command, acknowledging a cancel that arrived while
+// it ran
+func (a *MockAgent) runCommand(ctx context.Context, cmd *protocol.Command) {
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		if err := a.handleCommand(cmd); err != nil {
-			a.logger.Error("failed to handle command", "error", err, "command_id", cmd.MessageID)
+	f := &inflightCommand{cmd: cmd, cancel: cancel}
+	a.mu.Lock()
+	a.inflight = f
+	a.mu.Unlock()
+
+	a.updateActivity()
+	a.setTaskID(cmd.TaskID)
+	a.setStatus(protocol.HeartbeatStatusBusy)
+
+	if err := a.handleCommand(cmdCtx, cmd); err != nil {
+		a.logger.Error("failed to handle command", "error", err, "command_id", cmd.MessageID)
+	}
+
+	a.mu.Lock()
+	a.inflight = nil
+	cancelReq := f.cancelReq
+	a.mu.Unlock()
+
+	if cancelReq != nil {
+		if err := a.sendCancelAck(cancelReq, protocol.CancelStatusCancelled); err != nil {
+			a.logger.Error("failed to acknowledge cancel", "error", err)
 		}
+	}
+
+	a.setStatus(protocol.HeartbeatStatusReady)
+}
+
+// cancelCommand stops the in-flight command if it matches the request, or
+// acknowledges at once that nothing matching is running
+func (a *MockAgent) cancelCommand(req *protocol.Cancel) {
+	a.mu.Lock()
+	f := a.inflight
+	matched := f != nil && f.cmd.CorrelationID == req.CorrelationID && f.cancelReq == nil
+	if matched {
+		f.cancelReq = req
+	}
+	a.mu.Unlock()
 
-		a.setStatus(protocol.HeartbeatStatusReady)
+	if matched {
+		a.logger.Info("cancelling command", "correlation_id", req.CorrelationID, "reason", req.Reason)
+		f.cancel()
+		return
 	}
+	if err := a.sendCancelAck(req, protocol.CancelStatusNotRunning); err != nil {
+		a.logger.Error("failed to acknowledge cancel", "error", err)
+	}
+}
+
+func (a *MockAgent) sendCancelAck(req *protocol.Cancel, status string) error {
+	return a.send(protocol.Event{
+		Kind:          protocol.MessageKindEvent,
+		MessageID:     fmt.Sprintf("evt-%s", uuid.New().String()[:8]),
+		CorrelationID: req.CorrelationID,
+		TaskID:        req.TaskID,
+		From: protocol.AgentRef{
+			AgentType: a.agentType,
+			AgentID:   a.agentID,
+		},
+		Event:      protocol.EventCancelAcknowledged,
+		Status:     status,
+		Payload:    map[string]any{"cancel_message_id": req.MessageID},
+		OccurredAt: time.Now().UTC(),
+	})
 }
 
-func (a *MockAgent) handleCommand(cmd *protocol.Command) error {
+func (a *MockAgent) handleCommand(ctx context.Context, cmd *protocol.Command) error {
 	a.logger.Info("handling command",
 		"action", cmd.Action,
 		"task_id", cmd.TaskID,
@@ -278,7 +423,7 @@ func (a *MockAgent) handleCommand(cmd *protocol.Command) error {
 	if a.script != nil {
 		if template, ok := a.script.Responses[string(cmd.Action)]; ok {
 			a.logger.Info("using scripted response", "action", cmd.Action)
-			return a.executeScriptedResponse(cmd, template)
+			return a.executeScriptedResponse(ctx, cmd, template)
 		}
 	}
 
@@ -297,7 +442,7 @@ func (a *MockAgent) handleCommand(cmd *protocol.Command) error {
 	}
 }
 
-func (a *MockAgent) executeScriptedResponse(cmd *protocol.Command, template script.ResponseTemplate) error {
+func (a *MockAgent) executeScriptedResponse(ctx context.Context, cmd *protocol.Command, template script.ResponseTemplate) error {
 	// Check if this is an error response
 	if template.Error != "" {
 		a.logger.Info("returning scripted error", "error", template.Error)
@@ -308,7 +453,12 @@ func (a *MockAgent) executeScriptedResponse(cmd *protocol.Command, template scri
 	if template.DelayMs > 0 {
 		delay := time.Duration(template.DelayMs) * time.Millisecond
 		a.logger.Info("applying scripted delay", "delay_ms", template.DelayMs)
-		time.Sleep(delay)
+		select {
+		case <-ctx.Done():
+			a.logger.Info("scripted response cancelled", "task_id", cmd.TaskID)
+			return nil
+		case <-time.After(delay):
+		}
 	}
 
 	// Send all events in order
@@ -318,11 +468,11 @@ func (a *MockAgent) executeScriptedResponse(cmd *protocol.Command, template scri
 		// Convert artifact templates to protocol artifacts
 		var artifacts []protocol.Artifact
 		for _, artTemplate := range evtTemplate.Artifacts {
-			artifacts = append(artifacts, protocol.Artifact{
-				Path:   artTemplate.Path,
-				SHA256: artTemplate.SHA256,
-				Size:   artTemplate.Size,
-			})
+			artifact, err := artTemplate.Artifact(a.artifactDir())
+			if err != nil {
+				return err
+			}
+			artifacts = append(artifacts, artifact)
 		}
 
 		evt := protocol.Event{
@@ -340,8 +490,11 @@ func (a *MockAgent) executeScriptedResponse(cmd *protocol.Command, template scri
 			Artifacts:  artifacts,
 			OccurredAt: time.Now().UTC(),
 		}
+		if evtTemplate.ObservedSnapshotID != "" {
+			evt.ObservedVersion = &protocol.Version{SnapshotID: evtTemplate.ObservedSnapshotID}
+		}
 
-		if err := a.encoder.Encode(evt); err != nil {
+		if err := a.send(evt); err != nil {
 			return fmt.Errorf("failed to send event %d: %w", i, err)
 		}
 	}
@@ -349,10 +502,43 @@ func (a *MockAgent) executeScriptedResponse(cmd *protocol.Command, template scri
 	return nil
 }
 
+// artifactDir is where scripted artifacts with content are written
+func (a *MockAgent) artifactDir() string {
+	if a.workspace == "" {
+		return "."
+	}
+	return a.workspace
+}
+
+// writeExpectedOutputs writes a placeholder for each of the command's
+// expected outputs when a workspace was given
+func (a *MockAgent) writeExpectedOutputs(cmd *protocol.Command) ([]protocol.Artifact, error) {
+	if a.workspace == "" {
+		return nil, nil
+	}
+	var artifacts []protocol.Artifact
+	for _, output := range cmd.ExpectedOutputs {
+		artifact, err := script.ArtifactTemplate{
+			Path:    output.Path,
+			Content: fmt.Sprintf("// %s: mock output for %s\n", output.Path, cmd.TaskID),
+		}.Artifact(a.workspace)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
 func (a *MockAgent) handleImplement(cmd *protocol.Command) error {
 	// Simulate work
 	time.Sleep(100 * time.Millisecond)
 
+	artifacts, err := a.writeExpectedOutputs(cmd)
+	if err != nil {
+		return err
+	}
+
 	// Send completion event
 	evt := protocol.Event{
 		Kind:          protocol.MessageKindEvent,
@@ -371,10 +557,11 @@ func (a *MockAgent) handleImplement(cmd *protocol.Command) error {
 				"summary": "Mock tests passed",
 			},
 		},
+		Artifacts:  artifacts,
 		OccurredAt: time.Now().UTC(),
 	}
 
-	return a.encoder.Encode(evt)
+	return a.send(evt)
 }
 
 func (a *MockAgent) handleReview(cmd *protocol.Command) error {
@@ -413,7 +600,7 @@ func (a *MockAgent) handleReview(cmd *protocol.Command) error {
 		OccurredAt: time.Now().UTC(),
 	}
 
-	return a.encoder.Encode(evt)
+	return a.send(evt)
 }
 
 func (a *MockAgent) handleUpdateSpec(cmd *protocol.Command) error {
@@ -452,7 +639,7 @@ func (a *MockAgent) handleUpdateSpec(cmd *protocol.Command) error {
 		OccurredAt: time.Now().UTC(),
 	}
 
-	return a.encoder.Encode(evt)
+	return a.send(evt)
 }
 
 func (a *MockAgent) handleIntake(cmd *protocol.Command) error {
@@ -484,7 +671,7 @@ func (a *MockAgent) handleIntake(cmd *protocol.Command) error {
 		OccurredAt: time.Now().UTC(),
 	}
 
-	return a.encoder.Encode(evt)
+	return a.send(evt)
 }
 
 func (a *MockAgent) updateActivity() {
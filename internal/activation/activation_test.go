@@ -2,12 +2,14 @@ package activation
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/taskgraph"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/require"
 )
 
@@ -306,6 +308,66 @@ func TestExecutionOrderingMultipleTasksSequential(t *testing.T) {
 	require.Equal(t, []string{"TASK-1", "TASK-2", "TASK-3"}, exec.sequence)
 }
 
+func TestExecutionOrderingDependencies(t *testing.T) {
+	tasks := []Task{
+		{ID: "TASK-2", Title: "Second", DependsOn: []string{"TASK-1"}},
+		{ID: "TASK-1", Title: "First"},
+		{ID: "TASK-3", Title: "Third", DependsOn: []string{"TASK-2"}},
+		{ID: "TASK-4", Title: "Unrelated"},
+	}
+
+	exec := &recordingExecutor{failures: map[string]error{"TASK-1": errors.New("builder failed")}}
+	err := Activate(context.Background(), exec, tasks)
+	require.Error(t, err)
+	require.Equal(t, []string{"TASK-1", "TASK-4"}, exec.sequence, "dependents of the failed task are skipped, unrelated tasks still run")
+
+	var incomplete *taskgraph.IncompleteError
+	require.ErrorAs(t, err, &incomplete)
+	require.Equal(t, []taskgraph.Skip{
+		{Task: "TASK-2", Prerequisite: "TASK-1"},
+		{Task: "TASK-3", Prerequisite: "TASK-2"},
+	}, incomplete.Skipped)
+}
+
+func TestTaskActivationDependencyOrder(t *testing.T) {
+	workspace := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "PLAN.md"), []byte("# Plan"), 0o644))
+
+	input := Input{
+		RunID:           "intake-1",
+		WorkspaceRoot:   workspace,
+		Instruction:     "Implement feature",
+		ApprovedPlan:    "PLAN.md",
+		ApprovedTaskIDs: []string{"T-101", "T-100", "T-102"},
+		DerivedTasks: []DerivedTask{
+			{ID: "T-100", Title: "Schema"},
+			{ID: "T-101", Title: "Handlers", DependsOn: []string{"T-100"}},
+			{ID: "T-102", Title: "Docs", DependsOn: []string{"T-099"}},
+			{ID: "T-099", Title: "Earlier"},
+		},
+		AlreadyActivated: map[string]struct{}{"T-099": {}},
+		DecisionStatus:   "approved",
+	}
+
+	tasks, err := PrepareTasks(input)
+	require.NoError(t, err)
+	require.Len(t, tasks, 3)
+	require.Equal(t, "T-100", tasks[0].ID)
+	require.Equal(t, "T-101", tasks[1].ID)
+	require.Equal(t, []string{"T-100"}, tasks[1].DependsOn)
+	require.Equal(t, "T-102", tasks[2].ID)
+	require.Empty(t, tasks[2].DependsOn, "prerequisites activated earlier are satisfied")
+
+	input.AlreadyActivated = nil
+	_, err = PrepareTasks(input)
+	require.ErrorContains(t, err, "task T-102 depends on T-099, which was not approved")
+
+	input.ApprovedTaskIDs = []string{"T-100", "T-101"}
+	input.DerivedTasks[0].DependsOn = []string{"T-101"}
+	_, err = PrepareTasks(input)
+	require.ErrorContains(t, err, "dependency cycle: T-100 -> T-101 -> T-100")
+}
+
 func TestExecutionOrderingSnapshotMismatch(t *testing.T) {
 	t.Skip("TODO: EO-005 – snapshot/version mismatch detected and surfaced")
 }
@@ -390,9 +452,10 @@ func TestPerformanceLargeTaskSet(t *testing.T) {
 
 type recordingExecutor struct {
 	sequence []string
+	failures map[string]error
 }
 
 func (r *recordingExecutor) ExecuteTask(ctx context.Context, taskID string, inputs map[string]any) error {
 	r.sequence = append(r.sequence, taskID)
-	return nil
+	return r.failures[taskID]
 }
@@ -6,7 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/iambrandonn/lorch/internal/idempotency"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // DefaultCommandTimeout specifies how long activation commands are valid.
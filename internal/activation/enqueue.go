@@ -3,6 +3,8 @@ package activation
 import (
 	"context"
 	"fmt"
+
+	"github.com/iambrandonn/lorch/internal/taskgraph"
 )
 
 // TaskExecutor encapsulates the ability to execute a task end-to-end.
@@ -12,13 +14,21 @@ type TaskExecutor interface {
 }
 
 // Activate sequentially executes the provided tasks using the supplied executor.
-// Tasks are processed in the order they were approved during intake.
+// Tasks run after the tasks they depend on and otherwise in the order they
+// were approved during intake. When a task fails, the tasks depending on it
+// are skipped and the others still run; the returned error then wraps a
+// *taskgraph.IncompleteError listing both.
 func Activate(ctx context.Context, exec TaskExecutor, tasks []Task) error {
+	byID := make(map[string]Task, len(tasks))
 	for _, task := range tasks {
-		inputs := task.ToCommandInputs()
-		if err := exec.ExecuteTask(ctx, task.ID, inputs); err != nil {
-			return fmt.Errorf("activation: executing task %s: %w", task.ID, err)
-		}
+		byID[task.ID] = task
+	}
+	ids, deps := Dependencies(tasks)
+	err := taskgraph.Execute(ctx, ids, deps, func(ctx context.Context, id string) error {
+		return exec.ExecuteTask(ctx, id, byID[id].ToCommandInputs())
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("activation: %w", err)
 	}
 	return nil
 }
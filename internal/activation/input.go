@@ -3,7 +3,7 @@ package activation
 import (
 	"fmt"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Input captures everything derived from intake that the activation
@@ -35,6 +35,8 @@ type DerivedTask struct {
 	ID    string
 	Title string
 	Files []string
+	// DependsOn lists the derived tasks that must complete first
+	DependsOn []string
 }
 
 // Task represents a concrete piece of work ready for the scheduler layer.
@@ -42,6 +44,7 @@ type Task struct {
 	ID                  string
 	Title               string
 	Files               []string
+	DependsOn           []string
 	Instruction         string
 	ApprovedPlan        string
 	Clarifications      []string
@@ -51,6 +54,19 @@ type Task struct {
 	IntakeCorrelationID string
 }
 
+// Dependencies maps each task to its prerequisites
+func Dependencies(tasks []Task) ([]string, map[string][]string) {
+	ids := make([]string, 0, len(tasks))
+	deps := make(map[string][]string, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+		if len(task.DependsOn) > 0 {
+			deps[task.ID] = task.DependsOn
+		}
+	}
+	return ids, deps
+}
+
 // ToCommandInputs produces the canonical command inputs map that will be
 // passed to the builder implement command (Task B wiring).
 // Includes traceability metadata for receipts (P2.4 Task C).
@@ -78,8 +94,8 @@ func (t Task) ToActivationMetadata() map[string]any {
 	}
 }
 
-// ToExpectedOutputs is a placeholder helper for future integration.
-// It returns an empty slice for now; Task B will populate expected outputs.
+// ToExpectedOutputs declares the task's files as required outputs. The
+// scheduler derives the same outputs from the task_files input.
 func (t Task) ToExpectedOutputs() []protocol.ExpectedOutput {
 	outputs := make([]protocol.ExpectedOutput, 0, len(t.Files))
 	for _, path := range t.Files {
@@ -11,10 +11,10 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/receipt"
 	"github.com/iambrandonn/lorch/internal/scheduler"
 	"github.com/iambrandonn/lorch/internal/supervisor"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestActivationEndToEnd(t *testing.T) {
@@ -162,9 +162,11 @@ func TestReceiptTraceability(t *testing.T) {
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
+	// The builder writes the task's expected outputs into the workspace
+	workspace := t.TempDir()
 	builder := supervisor.NewAgentSupervisor(
 		protocol.AgentTypeBuilder,
-		[]string{mockAgentPath, "-type", "builder", "-no-heartbeat"},
+		[]string{mockAgentPath, "-type", "builder", "-no-heartbeat", "-workspace", workspace},
 		map[string]string{},
 		logger,
 	)
@@ -202,7 +204,6 @@ func TestReceiptTraceability(t *testing.T) {
 	defer specMaintainer.Stop(context.Background())
 
 	// Setup workspace and scheduler
-	workspace := t.TempDir()
 	planPath := filepath.Join(workspace, "PLAN.md")
 	if err := os.WriteFile(planPath, []byte("# Plan"), 0o644); err != nil {
 		t.Fatalf("failed to write plan: %v", err)
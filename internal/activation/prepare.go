@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/iambrandonn/lorch/internal/taskgraph"
 )
 
 var (
@@ -56,6 +58,11 @@ func PrepareTasks(input Input) ([]Task, error) {
 		already[id] = struct{}{}
 	}
 
+	approved := make(map[string]struct{}, len(input.ApprovedTaskIDs))
+	for _, taskID := range input.ApprovedTaskIDs {
+		approved[taskID] = struct{}{}
+	}
+
 	var tasks []Task
 	for _, taskID := range input.ApprovedTaskIDs {
 		if _, seen := already[taskID]; seen {
@@ -71,10 +78,24 @@ func PrepareTasks(input Input) ([]Task, error) {
 			return nil, fmt.Errorf("activation: derived task %s missing title", taskID)
 		}
 
+		// Prerequisites activated earlier are satisfied; the others must
+		// have been approved too
+		var dependsOn []string
+		for _, dep := range derived.DependsOn {
+			if _, done := already[dep]; done {
+				continue
+			}
+			if _, ok := approved[dep]; !ok {
+				return nil, fmt.Errorf("activation: task %s depends on %s, which was not approved", taskID, dep)
+			}
+			dependsOn = append(dependsOn, dep)
+		}
+
 		task := Task{
 			ID:                  taskID,
 			Title:               derived.Title,
 			Files:               append([]string(nil), derived.Files...),
+			DependsOn:           dependsOn,
 			Instruction:         input.Instruction,
 			ApprovedPlan:        input.ApprovedPlan,
 			Clarifications:      append([]string(nil), input.Clarifications...),
@@ -86,5 +107,23 @@ func PrepareTasks(input Input) ([]Task, error) {
 		tasks = append(tasks, task)
 	}
 
-	return tasks, nil
+	return sortTasks(tasks)
+}
+
+// sortTasks orders tasks after their prerequisites, keeping the approval
+// order otherwise
+func sortTasks(tasks []Task) ([]Task, error) {
+	order, err := taskgraph.Sort(Dependencies(tasks))
+	if err != nil {
+		return nil, fmt.Errorf("activation: %w", err)
+	}
+	byID := make(map[string]Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	sorted := make([]Task, 0, len(tasks))
+	for _, id := range order {
+		sorted = append(sorted, byID[id])
+	}
+	return sorted, nil
 }
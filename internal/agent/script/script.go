@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	"github.com/iambrandonn/lorch/internal/fsutil"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Script represents a scripted set of responses for mock agents.
@@ -20,18 +23,38 @@ type ResponseTemplate struct {
 }
 
 // EventTemplate describes an event emitted by a scripted agent.
+// ObservedSnapshotID, when set, is reported as the event's observed_version
+// whatever snapshot the command was pinned to.
 type EventTemplate struct {
-	Type      string             `json:"type"`
-	Status    string             `json:"status,omitempty"`
-	Payload   map[string]any     `json:"payload,omitempty"`
-	Artifacts []ArtifactTemplate `json:"artifacts,omitempty"`
+	Type               string             `json:"type"`
+	Status             string             `json:"status,omitempty"`
+	Payload            map[string]any     `json:"payload,omitempty"`
+	Artifacts          []ArtifactTemplate `json:"artifacts,omitempty"`
+	ObservedSnapshotID string             `json:"observed_snapshot_id,omitempty"`
 }
 
 // ArtifactTemplate describes an artifact to include in a scripted event.
+// With Content set, the agent writes the file and reports its real checksum
+// and size, so lorch's artifact verification passes; otherwise SHA256 and
+// Size are reported as given.
 type ArtifactTemplate struct {
-	Path   string `json:"path"`
-	SHA256 string `json:"sha256"`
-	Size   int64  `json:"size"`
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// Artifact returns the artifact to report, first writing Content to Path
+// under workspace when it is set.
+func (t ArtifactTemplate) Artifact(workspace string) (protocol.Artifact, error) {
+	if t.Content == "" {
+		return protocol.Artifact{Path: t.Path, SHA256: t.SHA256, Size: t.Size}, nil
+	}
+	written, err := fsutil.WriteArtifactAtomic(workspace, t.Path, []byte(t.Content))
+	if err != nil {
+		return protocol.Artifact{}, fmt.Errorf("write scripted artifact %s: %w", t.Path, err)
+	}
+	return protocol.Artifact{Path: written.Path, SHA256: written.SHA256, Size: written.Size}, nil
 }
 
 // Load reads a script from the provided path.
@@ -0,0 +1,330 @@
+// Package agentlog persists the structured log messages agents send to
+// logs/<agent>/<run_id>.ndjson, rotating and gzipping the file as it grows,
+// and reads them back for `lorch logs`.
+package agentlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// DefaultMaxFileBytes is the size at which a log file is rotated
+const DefaultMaxFileBytes = 10 << 20
+
+// DefaultMaxBackups is how many rotated files are kept per agent and run
+const DefaultMaxBackups = 5
+
+// Options configures a Sink
+type Options struct {
+	// MaxFileBytes rotates the file before it would grow past this size;
+	// zero means DefaultMaxFileBytes
+	MaxFileBytes int64
+	// MaxBackups is how many rotated files to keep; zero means
+	// DefaultMaxBackups
+	MaxBackups int
+	// Redactor, when set, removes secrets from messages before they are
+	// written
+	Redactor *redact.Redactor
+}
+
+// Path returns the log file for an agent's logs in a run
+func Path(workspaceRoot string, agentType protocol.AgentType, runID string) string {
+	return filepath.Join(workspaceRoot, "logs", string(agentType), runID+".ndjson")
+}
+
+// Sink appends an agent's log messages to its NDJSON log file
+type Sink struct {
+	path   string
+	opts   Options
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the log file at path for appending, creating it if needed
+func Open(path string, opts Options, logger *slog.Logger) (*Sink, error) {
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = DefaultMaxFileBytes
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = DefaultMaxBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create agent log directory: %w", err)
+	}
+	s := &Sink{path: path, opts: opts, logger: logger}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Sink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open agent log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat agent log: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Write appends msg to the log, rotating the file first if it would grow
+// past its size limit
+func (s *Sink) Write(msg *protocol.Log) error {
+	line, err := json.Marshal(s.opts.Redactor.Log(msg))
+	if err != nil {
+		return fmt.Errorf("failed to encode agent log: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errors.New("agent log is closed")
+	}
+	if s.size > 0 && s.size+int64(len(line)) > s.opts.MaxFileBytes {
+		if err := s.rotate(); err != nil {
+			// Keep logging to the oversized file rather than losing messages
+			s.logger.Warn("failed to rotate agent log", "path", s.path, "error", err)
+			if s.file == nil {
+				if err := s.open(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write agent log: %w", err)
+	}
+	return nil
+}
+
+// rotate compresses the current file into the next numbered backup, drops
+// the oldest backups beyond the limit and starts a new file. The caller
+// holds s.mu.
+func (s *Sink) rotate() error {
+	backups, err := backupsOf(s.path)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(backups) > 0 {
+		next = backups[len(backups)-1].n + 1
+	}
+
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	rotated := fmt.Sprintf("%s.%d", s.path, next)
+	if err := os.Rename(s.path, rotated); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	if err := compress(rotated, backupPath(s.path, next)); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", rotated, err)
+	}
+	os.Remove(rotated)
+
+	backups = append(backups, backup{n: next, path: backupPath(s.path, next)})
+	for len(backups) > s.opts.MaxBackups {
+		os.Remove(backups[0].path)
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Close closes the log file
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// backupPath names the n-th rotated file of path: <run_id>.<n>.ndjson.gz
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d.ndjson.gz", strings.TrimSuffix(path, ".ndjson"), n)
+}
+
+type backup struct {
+	n    int
+	path string
+}
+
+// backupsOf lists the rotated files of path, oldest first
+func backupsOf(path string) ([]backup, error) {
+	prefix := strings.TrimSuffix(filepath.Base(path), ".ndjson") + "."
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".ndjson.gz") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".ndjson.gz"))
+		if err != nil || n < 1 {
+			continue
+		}
+		backups = append(backups, backup{n: n, path: filepath.Join(filepath.Dir(path), name)})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].n < backups[j].n })
+	return backups, nil
+}
+
+// compress gzips src into dst
+func compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// levelRank orders log levels by severity
+func levelRank(level protocol.LogLevel) int {
+	switch level {
+	case protocol.LogLevelWarn:
+		return 1
+	case protocol.LogLevelError:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// ParseLevel checks a level given on the command line
+func ParseLevel(s string) (protocol.LogLevel, error) {
+	switch level := protocol.LogLevel(strings.ToLower(s)); level {
+	case protocol.LogLevelInfo, protocol.LogLevelWarn, protocol.LogLevelError:
+		return level, nil
+	}
+	return "", fmt.Errorf("invalid log level %q (use info, warn or error)", s)
+}
+
+// Read calls fn for every log message of at least minLevel in the log at
+// path, oldest first, reading the rotated backups before the current file.
+// It returns os.ErrNotExist if the agent has no log for the run.
+func Read(path string, minLevel protocol.LogLevel, fn func(*protocol.Log) error) error {
+	backups, err := backupsOf(path)
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(backups)+1)
+	for _, b := range backups {
+		files = append(files, b.path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no agent log at %s: %w", path, os.ErrNotExist)
+	}
+
+	min := levelRank(minLevel)
+	for _, file := range files {
+		if err := readFile(file, func(msg *protocol.Log) error {
+			if levelRank(msg.Level) < min {
+				return nil
+			}
+			return fn(msg)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFile decodes one log file, gzipped or not
+func readFile(path string, fn func(*protocol.Log) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg protocol.Log
+		if err := json.Unmarshal(line, &msg); err != nil {
+			// A line cut short by a crash is skipped
+			continue
+		}
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package agentlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func logMsg(level protocol.LogLevel, message string, fields map[string]any) *protocol.Log {
+	return &protocol.Log{
+		Kind:      protocol.MessageKindLog,
+		Level:     level,
+		Message:   message,
+		Fields:    fields,
+		Timestamp: time.Date(2025, 10, 20, 14, 8, 18, 0, time.UTC),
+	}
+}
+
+func TestSinkRotatesAndReadsBackInOrder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := Path(t.TempDir(), protocol.AgentTypeBuilder, "run-1")
+
+	sink, err := Open(path, Options{MaxFileBytes: 1024, MaxBackups: 3}, logger)
+	if err != nil {
+		t.Fatalf("failed to open sink: %v", err)
+	}
+	const total = 200
+	for i := 0; i < total; i++ {
+		if err := sink.Write(logMsg(protocol.LogLevelInfo, fmt.Sprintf("line %d", i), nil)); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+	sink.Close()
+
+	backups, err := backupsOf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("expected 3 backups to be kept, got %d", len(backups))
+	}
+	for _, b := range backups {
+		if filepath.Ext(b.path) != ".gz" {
+			t.Errorf("expected a gzipped backup, got %s", b.path)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() > 1024 {
+		t.Fatalf("expected the current file to stay under the limit, got %v, %v", info, err)
+	}
+
+	// The oldest lines were pruned; the rest read back in order
+	var got []string
+	if err := Read(path, protocol.LogLevelInfo, func(msg *protocol.Log) error {
+		got = append(got, msg.Message)
+		return nil
+	}); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(got) == 0 || len(got) >= total || got[len(got)-1] != fmt.Sprintf("line %d", total-1) {
+		t.Fatalf("expected the most recent lines, got %d ending %v", len(got), got[len(got)-1:])
+	}
+	var first int
+	fmt.Sscanf(got[0], "line %d", &first)
+	for i, msg := range got {
+		if want := fmt.Sprintf("line %d", first+i); msg != want {
+			t.Fatalf("expected %q at %d, got %q", want, i, msg)
+		}
+	}
+}
+
+func TestSinkRedactsSecretFields(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := Path(t.TempDir(), protocol.AgentTypeReviewer, "run-1")
+
+	red, err := redact.New(redact.Options{Env: []string{"ANTHROPIC_API_KEY=sk-live-1234"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := Open(path, Options{Redactor: red}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]any{
+		"api_key": "sk-live-1234",
+		"request": map[string]any{"auth": "Bearer sk-live-1234", "path": "/v1"},
+		"attempt": 2,
+	}
+	if err := sink.Write(logMsg(protocol.LogLevelInfo, "calling model", fields)); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	if fields["api_key"] != "sk-live-1234" {
+		t.Error("redaction must not modify the caller's fields")
+	}
+	err = Read(path, protocol.LogLevelInfo, func(msg *protocol.Log) error {
+		if msg.Fields["api_key"] != redact.Marker {
+			t.Errorf("expected the key to be redacted, got %v", msg.Fields["api_key"])
+		}
+		request := msg.Fields["request"].(map[string]any)
+		if request["auth"] != "Bearer "+redact.Marker || request["path"] != "/v1" {
+			t.Errorf("expected only the nested token to be redacted, got %v", request)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadFiltersByLevel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := Path(t.TempDir(), protocol.AgentTypeBuilder, "run-1")
+
+	if err := Read(path, protocol.LogLevelInfo, func(*protocol.Log) error { return nil }); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing log to be reported, got %v", err)
+	}
+
+	sink, err := Open(path, Options{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []protocol.LogLevel{protocol.LogLevelInfo, protocol.LogLevelWarn, protocol.LogLevelError} {
+		sink.Write(logMsg(level, string(level), nil))
+	}
+	sink.Close()
+
+	var got []string
+	Read(path, protocol.LogLevelWarn, func(msg *protocol.Log) error {
+		got = append(got, msg.Message)
+		return nil
+	})
+	if len(got) != 2 || got[0] != "warn" || got[1] != "error" {
+		t.Fatalf("expected warn and error, got %v", got)
+	}
+
+	if _, err := ParseLevel("debug"); err == nil {
+		t.Error("expected debug to be rejected")
+	}
+}
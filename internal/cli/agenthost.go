@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/iambrandonn/lorch/internal/supervisor"
+)
+
+// agentsSocketLink is a stable path under state/ that points at the current
+// run's agent socket, so agent daemons can be configured once
+const agentsSocketLink = "agents.sock"
+
+// agentHost holds what a run's agents share: the workspace they work in and,
+// once an agent uses the unix transport, the run's agent socket
+type agentHost struct {
+	workspaceRoot string
+	runID         string
+	logger        *slog.Logger
+
+	// workDir, when set, is where started agents run instead of lorch's
+	// working directory (a parallel task's worktree)
+	workDir string
+
+	socket *supervisor.SocketListener
+}
+
+func newAgentHost(workspaceRoot, runID string, logger *slog.Logger) *agentHost {
+	return &agentHost{workspaceRoot: workspaceRoot, runID: runID, logger: logger}
+}
+
+// listener returns the run's agent socket at state/<run_id>.sock, opening it
+// on first use
+func (h *agentHost) listener() (*supervisor.SocketListener, error) {
+	if h.socket != nil {
+		return h.socket, nil
+	}
+	stateDir := filepath.Join(h.workspaceRoot, "state")
+	ln, err := supervisor.ListenSocket(filepath.Join(stateDir, h.runID+".sock"), h.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Point state/agents.sock at this run; the link is relative so the
+	// workspace can move
+	link := filepath.Join(stateDir, agentsSocketLink)
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(h.runID+".sock", tmp); err == nil {
+		err = os.Rename(tmp, link)
+		if err != nil {
+			os.Remove(tmp)
+			h.logger.Warn("failed to update agent socket link", "path", link, "error", err)
+		}
+	} else {
+		h.logger.Warn("failed to create agent socket link", "path", link, "error", err)
+	}
+
+	h.socket = ln
+	return ln, nil
+}
+
+// Close stops accepting agents and removes the run's socket
+func (h *agentHost) Close() error {
+	if h.socket == nil {
+		return nil
+	}
+	err := h.socket.Close()
+	h.socket = nil
+	if err != nil {
+		return fmt.Errorf("failed to close agent socket: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/conformance"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance --agent <cmd> [-- <agent args>...]",
+	Short: "Check an agent binary against the NDJSON protocol",
+	Long: `Launch an agent and drive it through the protocol conformance checks from
+MASTER-SPEC §11.2: heartbeat cadence, schema validity against schemas/v1,
+correlation IDs, idempotent replay of a repeated idempotency key, oversize
+message handling, and clean shutdown on stdin EOF.
+
+The agent command can be given with --agent (split on whitespace) or after "--"
+to preserve quoting:
+
+  lorch conformance --role builder --agent "./bin/mockagent -type builder"
+  lorch conformance --role reviewer -- ./bin/my-agent --config "my config.json"`,
+	RunE: runConformance,
+}
+
+func init() {
+	conformanceCmd.Flags().String("agent", "", "Agent command line to test")
+	conformanceCmd.Flags().String("role", string(protocol.AgentTypeBuilder), "Agent role: builder, reviewer, spec_maintainer or orchestration")
+	conformanceCmd.Flags().Duration("heartbeat-interval", 10*time.Second, "Heartbeat interval the agent is expected to keep")
+	conformanceCmd.Flags().Duration("timeout", 30*time.Second, "Maximum wait for each agent response")
+	conformanceCmd.Flags().StringSlice("env", nil, "Extra KEY=VALUE environment variables for the agent")
+	conformanceCmd.Flags().String("junit", "", "Write a JUnit XML report to this path")
+	conformanceCmd.Flags().Bool("verbose", false, "Log supervisor diagnostics to stderr")
+	rootCmd.AddCommand(conformanceCmd)
+}
+
+func runConformance(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	agentCmd := args
+	if len(agentCmd) == 0 {
+		agentFlag, err := cmd.Flags().GetString("agent")
+		if err != nil {
+			return err
+		}
+		agentCmd = strings.Fields(agentFlag)
+	}
+	if len(agentCmd) == 0 {
+		return fmt.Errorf("an agent command is required (use --agent or pass it after --)")
+	}
+
+	role, err := cmd.Flags().GetString("role")
+	if err != nil {
+		return err
+	}
+	interval, err := cmd.Flags().GetDuration("heartbeat-interval")
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	envPairs, err := cmd.Flags().GetStringSlice("env")
+	if err != nil {
+		return err
+	}
+	junitPath, err := cmd.Flags().GetString("junit")
+	if err != nil {
+		return err
+	}
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return err
+	}
+
+	env, err := parseEnvPairs(envPairs)
+	if err != nil {
+		return err
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if verbose {
+		logger = slog.New(slog.NewTextHandler(cmd.ErrOrStderr(), &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	report, err := conformance.Run(ctx, conformance.Options{
+		AgentCmd:          agentCmd,
+		Role:              protocol.AgentType(strings.ReplaceAll(strings.ToLower(role), "-", "_")),
+		Env:               env,
+		HeartbeatInterval: interval,
+		Timeout:           timeout,
+		Logger:            logger,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := report.WriteText(cmd.OutOrStdout()); err != nil {
+		return err
+	}
+
+	if junitPath != "" {
+		if err := writeJUnitReport(junitPath, report); err != nil {
+			return err
+		}
+	}
+
+	if !report.Passed() {
+		return fmt.Errorf("conformance failed: %d of %d checks did not pass", report.Failures(), len(report.Cases))
+	}
+	return nil
+}
+
+func parseEnvPairs(pairs []string) (map[string]string, error) {
+	env := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --env %q (expected KEY=VALUE)", pair)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+func writeJUnitReport(path string, report *conformance.Report) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create junit directory: %w", err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create junit report: %w", err)
+	}
+	if err := report.WriteJUnit(f); err != nil {
+		f.Close()
+		return fmt.Errorf("write junit report: %w", err)
+	}
+	return f.Close()
+}
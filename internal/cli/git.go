@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/gitrepo"
+	"github.com/iambrandonn/lorch/internal/scheduler"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// maxListedChanges caps the uncommitted files named when a run is refused
+const maxListedChanges = 10
+
+// requireCleanGitWorkspace refuses to start a git-mode run while the
+// workspace has uncommitted changes, which the run's commits would
+// otherwise sweep up. Nothing is checked outside git mode.
+func requireCleanGitWorkspace(cfg *config.Config, workspaceRoot string) error {
+	if !cfg.Git.Active() {
+		return nil
+	}
+	repo, err := gitrepo.Open(workspaceRoot)
+	if err != nil {
+		return fmt.Errorf("git mode is enabled but %w\n\nHint: Run lorch inside a git repository, or disable git mode:\n  \"git\": {\"enabled\": false}", err)
+	}
+	changes, err := repo.Changes()
+	if err != nil {
+		return fmt.Errorf("failed to check the workspace for uncommitted changes: %w", err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	listed := changes
+	if len(listed) > maxListedChanges {
+		listed = listed[:maxListedChanges]
+	}
+	more := ""
+	if len(changes) > len(listed) {
+		more = fmt.Sprintf("\n  ... and %d more", len(changes)-len(listed))
+	}
+	return fmt.Errorf("git mode: the workspace has %d uncommitted change(s):\n  %s%s\n\nHint: Commit or stash them before starting a run, so lorch's commits only contain the agents' work.",
+		len(changes), strings.Join(listed, "\n  "), more)
+}
+
+// startGitMode checks out the run's lorch/<run_id> branch, creating it at
+// HEAD for a new run, and returns the committer that records accepted
+// steps on it. It returns nil outside git mode.
+func startGitMode(cfg *config.Config, workspaceRoot, runID string, logger *slog.Logger) (scheduler.StepCommitter, error) {
+	if !cfg.Git.Active() {
+		return nil, nil
+	}
+	repo, err := gitrepo.Open(workspaceRoot)
+	if err != nil {
+		return nil, fmt.Errorf("git mode is enabled but %w", err)
+	}
+	if err := checkoutRunBranch(repo, runID, logger); err != nil {
+		return nil, err
+	}
+	return newStepCommitter(repo, workspaceRoot, runID, logger), nil
+}
+
+// checkoutRunBranch switches to the run's branch, creating it at HEAD when
+// the run is new
+func checkoutRunBranch(repo *gitrepo.Repo, runID string, logger *slog.Logger) error {
+	branch := gitrepo.BranchName(runID)
+	current, err := repo.CurrentBranch()
+	if err != nil {
+		return fmt.Errorf("failed to read the current branch: %w", err)
+	}
+	switch {
+	case current == branch:
+	case repo.BranchExists(branch):
+		if err := repo.Checkout(branch); err != nil {
+			return fmt.Errorf("failed to check out run branch %s: %w", branch, err)
+		}
+	default:
+		if err := repo.CreateBranch(branch); err != nil {
+			return fmt.Errorf("failed to create run branch %s: %w", branch, err)
+		}
+	}
+	logger.Info("git mode: working on run branch", "branch", branch, "from", current)
+	return nil
+}
+
+// newStepCommitter returns a committer that records each accepted step as a
+// commit on the branch checked out in repo
+func newStepCommitter(repo *gitrepo.Repo, workspaceRoot, runID string, logger *slog.Logger) scheduler.StepCommitter {
+	return func(cmd *protocol.Command, step int, receiptPath string) error {
+		rel, err := filepath.Rel(workspaceRoot, receiptPath)
+		if err != nil {
+			rel = receiptPath
+		}
+		commit, err := repo.CommitStep(gitrepo.Step{
+			RunID:          runID,
+			TaskID:         cmd.TaskID,
+			Action:         cmd.Action,
+			Step:           step,
+			IdempotencyKey: cmd.IdempotencyKey,
+			Receipt:        rel,
+		})
+		if err != nil {
+			return err
+		}
+		if commit == "" {
+			logger.Info("git mode: step changed nothing, no commit", "task_id", cmd.TaskID, "step", step)
+			return nil
+		}
+		logger.Info("git mode: committed step", "task_id", cmd.TaskID, "step", step, "commit", commit)
+		return nil
+	}
+}
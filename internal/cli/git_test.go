@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// newGitWorkspace creates a local repository with one commit and a git-mode
+// configuration
+func newGitWorkspace(t *testing.T) (string, *config.Config) {
+	t.Helper()
+	dir := t.TempDir()
+	git(t, dir, "init", "-q", "-b", "main")
+	git(t, dir, "config", "user.name", "Test")
+	git(t, dir, "config", "user.email", "test@example.com")
+	writeWorkspaceFile(t, dir, "src/main.go", "package src\n")
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "-q", "-m", "initial")
+
+	cfg := config.GenerateDefault()
+	cfg.Git = &config.GitConfig{Enabled: true}
+	return dir, cfg
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeWorkspaceFile(t *testing.T, dir, path, content string) {
+	t.Helper()
+	full := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireCleanGitWorkspace(t *testing.T) {
+	dir, cfg := newGitWorkspace(t)
+
+	// lorch's own files do not count as user changes
+	writeWorkspaceFile(t, dir, "state/run.json", "{}")
+	writeWorkspaceFile(t, dir, "lorch.json", "{}")
+	if err := requireCleanGitWorkspace(cfg, dir); err != nil {
+		t.Fatalf("clean workspace refused: %v", err)
+	}
+
+	writeWorkspaceFile(t, dir, "src/main.go", "package src\n\n// local edit\n")
+	err := requireCleanGitWorkspace(cfg, dir)
+	if err == nil || !strings.Contains(err.Error(), "src/main.go") {
+		t.Fatalf("expected the uncommitted change to be refused, got %v", err)
+	}
+
+	cfg.Git.Enabled = false
+	if err := requireCleanGitWorkspace(cfg, dir); err != nil {
+		t.Errorf("git mode off: %v", err)
+	}
+}
+
+func TestRequireCleanGitWorkspaceOutsideRepository(t *testing.T) {
+	cfg := config.GenerateDefault()
+	cfg.Git = &config.GitConfig{Enabled: true}
+	if err := requireCleanGitWorkspace(cfg, t.TempDir()); err == nil {
+		t.Fatal("expected git mode to refuse a workspace outside git")
+	}
+}
+
+func TestStartGitModeCommitsSteps(t *testing.T) {
+	dir, cfg := newGitWorkspace(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	committer, err := startGitMode(cfg, dir, "run-1", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch := git(t, dir, "branch", "--show-current"); branch != "lorch/run-1" {
+		t.Fatalf("branch = %s, want lorch/run-1", branch)
+	}
+
+	writeWorkspaceFile(t, dir, "src/feature.go", "package src\n\nfunc Feature() {}\n")
+	cmd := &protocol.Command{TaskID: "T-1", Action: protocol.ActionImplement, IdempotencyKey: "ik-1"}
+	if err := committer(cmd, 1, receipt.GetReceiptPath(dir, "T-1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	trailers := git(t, dir, "log", "-1", "--format=%(trailers:only,unfold)")
+	for _, want := range []string{"Lorch-Run: run-1", "Lorch-Task: T-1", "Lorch-Step: 1", "Lorch-Idempotency-Key: ik-1", "Lorch-Receipt: receipts/T-1/step-1.json"} {
+		if !strings.Contains(trailers, want) {
+			t.Errorf("trailers missing %q:\n%s", want, trailers)
+		}
+	}
+
+	// A resumed run goes back to its branch
+	git(t, dir, "checkout", "-q", "main")
+	if _, err := startGitMode(cfg, dir, "run-1", logger); err != nil {
+		t.Fatal(err)
+	}
+	if branch := git(t, dir, "branch", "--show-current"); branch != "lorch/run-1" {
+		t.Errorf("resume branch = %s, want lorch/run-1", branch)
+	}
+}
@@ -16,9 +16,9 @@ import (
 	"time"
 
 	"github.com/iambrandonn/lorch/internal/config"
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/runstate"
 	"github.com/iambrandonn/lorch/internal/workspace"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 )
@@ -82,7 +82,7 @@ func TestRunIntakeFlow_PlanApprovalRecordsDecision(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 	require.NoError(t, err, out.String())
 	require.NotNil(t, outcome)
 	require.NotNil(t, outcome.FinalEvent)
@@ -191,7 +191,7 @@ func TestRunIntakeFlow_ClarificationLoopReuseIdempotencyKey(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 	require.NoError(t, err, out.String())
 	require.NotNil(t, outcome)
 	require.NotNil(t, outcome.Decision)
@@ -284,7 +284,7 @@ func TestRunIntakeFlow_TaskDiscoveryRequest(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 	require.NoError(t, err, out.String())
 	require.NotNil(t, outcome.Decision)
 	require.Equal(t, "docs/plan_v2.md", outcome.Decision.ApprovedPlan)
@@ -392,7 +392,7 @@ func TestRunIntakeFlow_MultipleClarifications(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 	require.NoError(t, err, out.String())
 	require.NotNil(t, outcome)
 	require.Equal(t, []string{"Focus on API", "Add unit tests"}, outcome.Clarifications)
@@ -491,7 +491,7 @@ func TestRunIntakeFlow_PlanConflictResolution(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 	require.NoError(t, err, out.String())
 	require.NotNil(t, outcome)
 	require.NotNil(t, outcome.Decision)
@@ -573,7 +573,7 @@ func TestRunIntakeFlow_ResumesExistingState(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 	require.NoError(t, err, out.String())
 	require.NotNil(t, outcome)
 	require.Equal(t, "Manage PLAN.md", outcome.Instruction)
@@ -641,7 +641,7 @@ func TestRunIntakeFlow_UserDeclineRecorded(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 	require.Error(t, err)
 	require.True(t, errors.Is(err, errUserDeclined))
 	require.Nil(t, outcome)
@@ -771,7 +771,7 @@ func cloneInputs(inputs map[string]any) map[string]any {
 func overrideOrchestrationSupervisorFactory(t *testing.T, sup *fakeOrchestrationSupervisor) {
 	t.Helper()
 	oldFactory := agentSupervisorFactory
-	agentSupervisorFactory = func(cfg *config.AgentConfig, agentType protocol.AgentType, logger *slog.Logger) (agentSupervisor, error) {
+	agentSupervisorFactory = func(cfg *config.AgentConfig, agentType protocol.AgentType, host *agentHost, logger *slog.Logger) (agentSupervisor, error) {
 		require.Equal(t, protocol.AgentTypeOrchestration, agentType)
 		return sup, nil
 	}
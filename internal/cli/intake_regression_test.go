@@ -14,8 +14,8 @@ import (
 	"time"
 
 	"github.com/iambrandonn/lorch/internal/config"
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/workspace"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 )
@@ -97,7 +97,7 @@ func runNonTTYIntake(t *testing.T, workspaceRoot string, fixturePath string, inp
 	cmd.SetOut(&output)
 	cmd.SetErr(&output)
 
-	return runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	return runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 }
 
 // buildTestBinary builds claude-fixture binary for tests
@@ -220,7 +220,7 @@ func TestRegression_DeclineAfterMultipleClarifications(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.Error(t, err)
 	require.ErrorIs(t, err, errUserDeclined)
 	require.Nil(t, outcome)
@@ -320,7 +320,7 @@ func TestRegression_AbortDuringConflictResolution(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.Error(t, err)
 	require.ErrorIs(t, err, errUserDeclined)
 	require.Nil(t, outcome)
@@ -540,7 +540,7 @@ func TestRegression_MultipleConflictResolutions(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.NoError(t, err)
 	require.NotNil(t, outcome)
 	require.Equal(t, "approved", outcome.Decision.Status)
@@ -629,7 +629,7 @@ func TestRegression_ClarificationConflictApprovalFlow(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.NoError(t, err)
 	require.NotNil(t, outcome)
 	require.Equal(t, "approved", outcome.Decision.Status)
@@ -731,7 +731,7 @@ func TestRegression_InvalidInputRetryLimit(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.NoError(t, err, "should eventually accept valid input after many retries")
 	require.NotNil(t, outcome)
 	require.Equal(t, "approved", outcome.Decision.Status)
@@ -786,7 +786,7 @@ func TestRegression_ResumeAfterPartialNegotiation(t *testing.T) {
 
 	doneCh := make(chan error, 1)
 	go func() {
-		_, err := runIntakeFlow(cmd1, cfg, workspaceRoot, slog.Default())
+		_, err := runIntakeFlow(cmd1, bufio.NewReader(cmd1.InOrStdin()), cfg, workspaceRoot, slog.Default())
 		doneCh <- err
 	}()
 
@@ -827,7 +827,7 @@ func TestRegression_ResumeAfterPartialNegotiation(t *testing.T) {
 	cmd2.SetOut(io.Discard)
 	cmd2.SetErr(io.Discard)
 
-	outcome, err := runIntakeFlow(cmd2, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd2, bufio.NewReader(cmd2.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.NoError(t, err)
 	require.NotNil(t, outcome)
 	require.True(t, resumeIKSeen, "resume should reuse original idempotency key")
@@ -941,7 +941,7 @@ func TestRegression_NonTTY_WithClarifications(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.NoError(t, err)
 	require.NotNil(t, outcome)
 	require.Equal(t, "approved", outcome.Decision.Status)
@@ -1018,7 +1018,7 @@ func TestRegression_NonTTY_WithConflictResolution(t *testing.T) {
 	cmd.SetOut(&out)
 	cmd.SetErr(&out)
 
-	outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, slog.Default())
+	outcome, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, slog.Default())
 	require.NoError(t, err)
 	require.NotNil(t, outcome)
 	require.Equal(t, "approved", outcome.Decision.Status)
@@ -1114,7 +1114,7 @@ func TestRegression_NonTTY_EOFHandling(t *testing.T) {
 	cmd.SetOut(&output)
 	cmd.SetErr(&output)
 
-	_, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+	_, err := runIntakeFlow(cmd, bufio.NewReader(cmd.InOrStdin()), cfg, workspaceRoot, logger)
 
 	// Should fail gracefully, not hang
 	require.Error(t, err)
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/agentlog"
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs --run <id>",
+	Short: "Show the structured logs agents sent during a run",
+	Long: `Print the log messages agents sent during a run, read from
+logs/<agent>/<run_id>.ndjson and its rotated .gz backups, oldest first.
+
+  lorch logs --run run-20251019-... --agent builder --level warn`,
+	RunE: runLogs,
+}
+
+func init() {
+	logsCmd.Flags().StringP("run", "r", "", "Run ID whose logs to show (required)")
+	logsCmd.Flags().String("agent", "", "Only show logs from this agent (default: all agents)")
+	logsCmd.Flags().String("level", string(protocol.LogLevelInfo), "Minimum level to show: info, warn or error")
+	logsCmd.Flags().Bool("json", false, "Print the log messages as NDJSON")
+	logsCmd.MarkFlagRequired("run")
+	rootCmd.AddCommand(logsCmd)
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	runID, err := cmd.Flags().GetString("run")
+	if err != nil {
+		return err
+	}
+	agent, err := cmd.Flags().GetString("agent")
+	if err != nil {
+		return err
+	}
+	levelFlag, err := cmd.Flags().GetString("level")
+	if err != nil {
+		return err
+	}
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	minLevel, err := agentlog.ParseLevel(levelFlag)
+	if err != nil {
+		return err
+	}
+
+	workspaceRoot, err := locateWorkspaceRoot(cmd)
+	if err != nil {
+		return err
+	}
+
+	agents := []string{agent}
+	if agent == "" {
+		agents, err = agentsWithLogs(workspaceRoot, runID)
+		if err != nil {
+			return err
+		}
+		if len(agents) == 0 {
+			return fmt.Errorf("no agent logs found for run %s in %s", runID, filepath.Join(workspaceRoot, "logs"))
+		}
+	}
+
+	return printAgentLogs(cmd.OutOrStdout(), workspaceRoot, runID, agents, minLevel, asJSON)
+}
+
+// printAgentLogs writes the logs of each agent in turn
+func printAgentLogs(w io.Writer, workspaceRoot, runID string, agents []string, minLevel protocol.LogLevel, asJSON bool) error {
+	enc := json.NewEncoder(w)
+	for _, agent := range agents {
+		path := agentlog.Path(workspaceRoot, protocol.AgentType(agent), runID)
+		err := agentlog.Read(path, minLevel, func(msg *protocol.Log) error {
+			if asJSON {
+				return enc.Encode(msg)
+			}
+			_, err := fmt.Fprintln(w, formatAgentLog(agent, msg))
+			return err
+		})
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("agent %s has no logs for run %s", agent, runID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatAgentLog renders a log message as one line, fields sorted by name
+func formatAgentLog(agent string, msg *protocol.Log) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s] %-5s %s", msg.Timestamp.UTC().Format(time.RFC3339), agent, strings.ToUpper(string(msg.Level)), msg.Message)
+
+	keys := make([]string, 0, len(msg.Fields))
+	for k := range msg.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, err := json.Marshal(msg.Fields[k])
+		if err != nil {
+			value = []byte(fmt.Sprint(msg.Fields[k]))
+		}
+		fmt.Fprintf(&b, " %s=%s", k, value)
+	}
+	return b.String()
+}
+
+// agentsWithLogs lists the agents that logged during a run, in name order
+func agentsWithLogs(workspaceRoot, runID string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(workspaceRoot, "logs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var agents []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := agentlog.Path(workspaceRoot, protocol.AgentType(entry.Name()), runID)
+		matches, _ := filepath.Glob(strings.TrimSuffix(path, ".ndjson") + ".*ndjson*")
+		if _, err := os.Stat(path); err == nil || len(matches) > 0 {
+			agents = append(agents, entry.Name())
+		}
+	}
+	return agents, nil
+}
+
+// locateWorkspaceRoot finds the workspace from lorch.json without creating
+// a config, falling back to the current directory
+func locateWorkspaceRoot(cmd *cobra.Command) (string, error) {
+	root, _, err := locateWorkspace(cmd)
+	return root, err
+}
+
+// locateWorkspace is locateWorkspaceRoot also returning the config, which
+// is nil when there is no lorch.json
+func locateWorkspace(cmd *cobra.Command) (string, *config.Config, error) {
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return "", nil, err
+	}
+	if configPath == "" {
+		if configPath, err = findConfigInTree(); err != nil {
+			return "", nil, err
+		}
+	}
+	if configPath == "" {
+		root, err := os.Getwd()
+		return root, nil, err
+	}
+	cfg, err := config.LoadFromFile(configPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load config from %s: %w", configPath, err)
+	}
+	// Ledgers and logs are read with the limit they were written with
+	ndjson.SetDefaultLimit(cfg.Policy.MessageMaxBytes)
+	return determineWorkspaceRoot(cfg, configPath), cfg, nil
+}
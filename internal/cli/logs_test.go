@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/agentlog"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintAgentLogs(t *testing.T) {
+	workspace := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	at := time.Date(2025, 10, 20, 14, 8, 18, 0, time.UTC)
+
+	for _, agent := range []protocol.AgentType{protocol.AgentTypeBuilder, protocol.AgentTypeReviewer} {
+		sink, err := agentlog.Open(agentlog.Path(workspace, agent, "run-logs"), agentlog.Options{}, logger)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(&protocol.Log{Kind: protocol.MessageKindLog, Level: protocol.LogLevelInfo, Message: "started", Timestamp: at}))
+		require.NoError(t, sink.Write(&protocol.Log{Kind: protocol.MessageKindLog, Level: protocol.LogLevelWarn, Message: "tests flaky", Fields: map[string]any{"retries": 2}, Timestamp: at}))
+		require.NoError(t, sink.Close())
+	}
+
+	agents, err := agentsWithLogs(workspace, "run-logs")
+	require.NoError(t, err)
+	require.Equal(t, []string{"builder", "reviewer"}, agents)
+
+	var out bytes.Buffer
+	require.NoError(t, printAgentLogs(&out, workspace, "run-logs", []string{"builder"}, protocol.LogLevelWarn, false))
+	require.Equal(t, "2025-10-20T14:08:18Z [builder] WARN  tests flaky retries=2\n", out.String())
+
+	err = printAgentLogs(&out, workspace, "run-logs", []string{"spec_maintainer"}, protocol.LogLevelInfo, false)
+	require.ErrorContains(t, err, "has no logs for run run-logs")
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/scheduler"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// newOutputsPrompt returns an approver that asks the user on the terminal
+// whether to accept a step whose required outputs are still missing after
+// its retries. EOF counts as "no".
+func newOutputsPrompt(reader *bufio.Reader, out io.Writer) scheduler.OutputsApprover {
+	return func(ctx context.Context, taskID string, action protocol.Action, missing []receipt.OutputStatus) (bool, error) {
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Task %s: %s did not produce %d required output(s):\n", taskID, action, len(missing))
+		for _, o := range missing {
+			fmt.Fprintf(out, "  - %s\n", o.Path)
+		}
+		fmt.Fprint(out, "Accept the step anyway? [y/N]: ")
+
+		line, err := readLine(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(out)
+				return false, nil
+			}
+			return false, err
+		}
+
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+}
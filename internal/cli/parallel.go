@@ -0,0 +1,586 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/iambrandonn/lorch/internal/activation"
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/eventlog"
+	"github.com/iambrandonn/lorch/internal/fsutil"
+	"github.com/iambrandonn/lorch/internal/gitrepo"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/scheduler"
+	"github.com/iambrandonn/lorch/internal/taskgraph"
+	"github.com/iambrandonn/lorch/internal/usage"
+	"github.com/iambrandonn/lorch/internal/workspace"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// worktreeTask is a task running in its own git worktree, on its own
+// branch, with its own agents
+type worktreeTask struct {
+	id     string
+	title  string
+	inputs map[string]any
+	branch string
+	// dir is the worktree; workspace is the task's workspace root in it
+	dir       string
+	workspace string
+	err       error
+	merged    bool
+}
+
+// sharedRunState serialises the parallel tasks' updates of the run state
+type sharedRunState struct {
+	mu     sync.Mutex
+	state  *runstate.RunState
+	path   string
+	logger *slog.Logger
+}
+
+// update applies fn to the run state and saves it
+func (s *sharedRunState) update(fn func(*runstate.RunState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.state)
+	if err := runstate.SaveRunState(s.state, s.path); err != nil {
+		s.logger.Warn("failed to save run state", "error", err)
+	}
+}
+
+// lockedWriter keeps writes of concurrent tasks from interleaving
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// executeTasksInWorktrees runs approved tasks in parallel, up to
+// policy.concurrency at a time. Each task gets a worktree under
+// state/worktrees/<run_id>/ on its own branch, created from the run branch,
+// with its own agents, snapshots and receipts, so every worktree still has
+// a single agent at work at a time. Tasks run in waves: a task only starts
+// once the tasks it depends on are merged, and is skipped when one of them
+// did not complete. Once a wave's tasks have finished, their branches are
+// merged into the run branch one at a time in task order; a merge that
+// conflicts is handed to the user to resolve or skip.
+func executeTasksInWorktrees(
+	ctx context.Context,
+	reader *bufio.Reader,
+	outputWriter io.Writer,
+	cfg *config.Config,
+	workspaceRoot string,
+	runID string,
+	tasks []activation.Task,
+	shared *sharedRunState,
+	evtLog *eventlog.EventLog,
+	logger *slog.Logger,
+) error {
+	shared.update(func(s *runstate.RunState) {
+		for _, task := range tasks {
+			s.AddTask(task.ID, task.Title, task.DependsOn, task.ToCommandInputs())
+			s.Tasks[task.ID].Worktree = true
+		}
+	})
+	return runWorktreeGraph(ctx, reader, outputWriter, cfg, workspaceRoot, runID, shared, evtLog, logger)
+}
+
+// worktreeRun holds what the waves of a parallel run share
+type worktreeRun struct {
+	cfg           *config.Config
+	repo          *gitrepo.Repo
+	workspaceRoot string
+	workspaceRel  string
+	runID         string
+	shared        *sharedRunState
+	evtLog        *eventlog.EventLog
+	logger        *slog.Logger
+	out           io.Writer
+	reader        *bufio.Reader
+	tracker       *usage.Tracker
+	approvers     taskApprovers
+	// started counts the tasks started so far, for progress lines
+	started int
+}
+
+// runWorktreeGraph runs the unfinished tasks of the run state in parallel
+// worktrees, wave by wave, and marks the run completed or failed
+func runWorktreeGraph(
+	ctx context.Context,
+	reader *bufio.Reader,
+	outputWriter io.Writer,
+	cfg *config.Config,
+	workspaceRoot string,
+	runID string,
+	shared *sharedRunState,
+	evtLog *eventlog.EventLog,
+	logger *slog.Logger,
+) error {
+	repo, err := gitrepo.Open(workspaceRoot)
+	if err != nil {
+		return fmt.Errorf("parallel tasks need git mode but %w", err)
+	}
+	if err := checkoutRunBranch(repo, runID, logger); err != nil {
+		return err
+	}
+	workspaceRel, err := workspaceInRepo(repo, workspaceRoot)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	var waves [][]string
+	shared.update(func(s *runstate.RunState) {
+		var deps map[string][]string
+		ids, deps = taskDependencies(s)
+		waves, err = taskgraph.Waves(ids, deps)
+	})
+	if err != nil {
+		return err
+	}
+
+	out := &lockedWriter{w: outputWriter}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Running %d tasks in parallel (up to %d at a time), each in its own git worktree\n", len(ids), cfg.Policy.Concurrency)
+
+	// Tasks share the usage totals, and take turns at the terminal
+	var promptMu sync.Mutex
+	tracker := usage.NewTracker(cfg.Pricing, cfg.Policy.Budget)
+	if shared.state.Usage != nil {
+		tracker.Restore(shared.state.Usage.Run, shared.state.Usage.Tasks)
+	}
+	budgetPrompt := newBudgetPrompt(reader, out)
+	outputsPrompt := newOutputsPrompt(reader, out)
+	w := &worktreeRun{
+		cfg:           cfg,
+		repo:          repo,
+		workspaceRoot: workspaceRoot,
+		workspaceRel:  workspaceRel,
+		runID:         runID,
+		shared:        shared,
+		evtLog:        evtLog,
+		logger:        logger,
+		out:           out,
+		reader:        reader,
+		tracker:       tracker,
+		approvers: taskApprovers{
+			budget: func(ctx context.Context, exceeded *usage.BudgetExceeded) (bool, error) {
+				promptMu.Lock()
+				defer promptMu.Unlock()
+				return budgetPrompt(ctx, exceeded)
+			},
+			outputs: func(ctx context.Context, taskID string, action protocol.Action, missing []receipt.OutputStatus) (bool, error) {
+				promptMu.Lock()
+				defer promptMu.Unlock()
+				return outputsPrompt(ctx, taskID, action, missing)
+			},
+		},
+	}
+
+	// A task whose prerequisite did not complete is skipped, which in turn
+	// skips the tasks depending on it
+	var unfinished []string
+	notDone := make(map[string]bool)
+	for _, wave := range waves {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var runs []*worktreeTask
+		for _, id := range wave {
+			var prerequisite string
+			shared.update(func(s *runstate.RunState) {
+				task := s.Tasks[id]
+				for _, dep := range task.DependsOn {
+					if notDone[dep] {
+						prerequisite = dep
+						s.SetTaskStatus(id, runstate.TaskSkipped, fmt.Sprintf("prerequisite %s did not complete", dep))
+						return
+					}
+				}
+				runs = append(runs, &worktreeTask{id: id, title: task.Title, inputs: task.Inputs})
+			})
+			if prerequisite != "" {
+				notDone[id] = true
+				unfinished = append(unfinished, fmt.Sprintf("%s (skipped: prerequisite %s did not complete)", id, prerequisite))
+				fmt.Fprintf(out, "Skipping task %s: prerequisite %s did not complete\n", id, prerequisite)
+			}
+		}
+		if len(runs) == 0 {
+			continue
+		}
+
+		if err := w.runWave(ctx, len(ids), runs); err != nil {
+			return err
+		}
+		for _, run := range runs {
+			switch {
+			case run.err != nil:
+				unfinished = append(unfinished, fmt.Sprintf("%s (failed: %v; branch %s keeps its committed steps)", run.id, run.err, run.branch))
+			case !run.merged:
+				unfinished = append(unfinished, fmt.Sprintf("%s (not merged; branch %s)", run.id, run.branch))
+			default:
+				continue
+			}
+			notDone[run.id] = true
+		}
+	}
+
+	if len(unfinished) > 0 {
+		shared.update(func(s *runstate.RunState) { s.MarkFailed() })
+		printUsageSummary(out, tracker)
+		return fmt.Errorf("%d of %d tasks did not complete:\n  %s\n\nHint: Merged tasks are on branch %s. Branches of the others are kept for inspection; merge them by hand, or run lorch resume --run %s to run the unfinished tasks again on their branches.",
+			len(unfinished), len(ids), strings.Join(unfinished, "\n  "), gitrepo.BranchName(runID), runID)
+	}
+
+	shared.update(func(s *runstate.RunState) { s.MarkCompleted() })
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "All %d tasks completed successfully and were merged into %s\n", len(ids), gitrepo.BranchName(runID))
+	printUsageSummary(out, tracker)
+	return nil
+}
+
+// runWave runs one wave of tasks side by side, then merges them in task
+// order, recording each task's status. It only fails when the wave could
+// not start, or when ctx was cancelled; the tasks' own failures are left in
+// their err.
+func (w *worktreeRun) runWave(ctx context.Context, total int, runs []*worktreeTask) error {
+	// Worktrees are created up front, one at a time, so concurrent git
+	// commands never race on the repository's refs. A worktree left behind
+	// by an earlier attempt still on the task's branch is carried on in,
+	// uncommitted work and all.
+	for i, run := range runs {
+		run.branch = gitrepo.TaskBranchName(w.runID, run.id)
+		run.dir = filepath.Join(w.workspaceRoot, "state", "worktrees", w.runID, run.id)
+		run.workspace = filepath.Join(run.dir, w.workspaceRel)
+		if _, err := os.Stat(run.dir); err == nil {
+			if taskRepo, err := gitrepo.Open(run.workspace); err == nil {
+				if branch, _ := taskRepo.CurrentBranch(); branch == run.branch {
+					w.logger.Info("reusing task worktree", "task_id", run.id, "path", run.dir)
+					continue
+				}
+			}
+			if _, err := w.removeWorktree(run); err != nil {
+				w.logger.Warn("failed to remove stale task worktree", "task_id", run.id, "path", run.dir, "error", err)
+			}
+		}
+		if err := w.repo.AddWorktree(run.dir, run.branch); err != nil {
+			for _, created := range runs[:i] {
+				w.removeWorktree(created)
+			}
+			return fmt.Errorf("failed to create worktree for task %s: %w", run.id, err)
+		}
+	}
+
+	slots := make(chan struct{}, w.cfg.Policy.Concurrency)
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		w.started++
+		n := w.started
+		w.shared.update(func(s *runstate.RunState) { s.SetTaskStatus(run.id, runstate.TaskRunning, "") })
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				run.err = ctx.Err()
+				return
+			}
+			defer func() { <-slots }()
+
+			fmt.Fprintf(w.out, "Executing task %d/%d: %s (%s) in %s\n", n, total, run.title, run.id, run.dir)
+			run.err = runWorktreeTask(ctx, w.cfg, w.runID, run, w.shared, w.tracker, w.approvers, w.evtLog, w.out, w.logger.With("task_id", run.id))
+			if run.err != nil {
+				fmt.Fprintf(w.out, "Task %s failed: %v\n", run.id, run.err)
+				return
+			}
+			fmt.Fprintf(w.out, "Task %s finished on branch %s\n", run.id, run.branch)
+		}()
+	}
+	wg.Wait()
+
+	// Merge back in task order
+	for _, run := range runs {
+		if run.err == nil {
+			run.err = commitTaskWork(w.runID, run)
+		}
+		if err := collectTaskRecords(run.workspace, w.workspaceRoot); err != nil {
+			w.logger.Warn("failed to collect task records", "task_id", run.id, "error", err)
+		}
+
+		if run.err == nil {
+			run.merged, run.err = mergeWorktreeTask(w.reader, w.out, w.repo, w.runID, run)
+		}
+		changes, err := w.removeWorktree(run)
+		switch {
+		case err != nil:
+			w.logger.Warn("failed to remove task worktree", "task_id", run.id, "path", run.dir, "error", err)
+		case len(changes) > 0:
+			fmt.Fprintf(w.out, "Keeping worktree %s of task %s: it has %d uncommitted change(s)\n", run.dir, run.id, len(changes))
+		}
+
+		switch {
+		case run.err != nil && ctx.Err() != nil:
+			// Interrupted tasks stay running, for resume to run again
+		case run.err != nil:
+			w.shared.update(func(s *runstate.RunState) { s.SetTaskStatus(run.id, runstate.TaskFailed, run.err.Error()) })
+		case !run.merged:
+			w.shared.update(func(s *runstate.RunState) {
+				s.SetTaskStatus(run.id, runstate.TaskFailed, "not merged into "+gitrepo.BranchName(w.runID))
+			})
+		default:
+			if err := w.repo.DeleteBranch(run.branch); err != nil {
+				w.logger.Warn("failed to delete merged task branch", "branch", run.branch, "error", err)
+			}
+			w.shared.update(func(s *runstate.RunState) { s.SetTaskStatus(run.id, runstate.TaskCompleted, "") })
+			fmt.Fprintf(w.out, "Task %s merged into %s\n", run.id, gitrepo.BranchName(w.runID))
+		}
+	}
+	return ctx.Err()
+}
+
+// removeWorktree deletes a task's worktree when nothing but lorch's own
+// files, already collected, would be lost with it. A worktree holding other
+// uncommitted changes is kept, for the task's next attempt to carry on in,
+// and the changes are returned.
+func (w *worktreeRun) removeWorktree(run *worktreeTask) ([]string, error) {
+	taskRepo, err := gitrepo.Open(run.workspace)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := taskRepo.Changes()
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		return changes, nil
+	}
+	return nil, w.repo.RemoveWorktree(run.dir)
+}
+
+// commitTaskWork commits whatever a finished task left uncommitted on its
+// branch, so the merge carries all of its work
+func commitTaskWork(runID string, run *worktreeTask) error {
+	taskRepo, err := gitrepo.Open(run.workspace)
+	if err != nil {
+		return err
+	}
+	if _, err := taskRepo.CommitTask(runID, run.id); err != nil {
+		return fmt.Errorf("failed to commit the task's remaining work: %w", err)
+	}
+	return nil
+}
+
+// taskApprovers are the prompts the parallel tasks share
+type taskApprovers struct {
+	budget  scheduler.BudgetApprover
+	outputs scheduler.OutputsApprover
+}
+
+// runWorktreeTask executes one task in its worktree with agents of its own.
+// Accepted steps are committed on the task's branch.
+func runWorktreeTask(
+	ctx context.Context,
+	cfg *config.Config,
+	runID string,
+	run *worktreeTask,
+	shared *sharedRunState,
+	tracker *usage.Tracker,
+	approvers taskApprovers,
+	evtLog *eventlog.EventLog,
+	out io.Writer,
+	logger *slog.Logger,
+) error {
+	if err := workspace.Initialize(run.workspace); err != nil {
+		return fmt.Errorf("failed to initialize task workspace: %w", err)
+	}
+	taskRepo, err := gitrepo.Open(run.workspace)
+	if err != nil {
+		return err
+	}
+	snap, err := captureSnapshot(run.workspace, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to capture snapshot: %w", err)
+	}
+
+	host := newAgentHost(run.workspace, runID, logger)
+	host.workDir = run.workspace
+	env, err := startExecutionEnvironment(ctx, cfg, host, snap.SnapshotID, evtLog, out, logger)
+	if err != nil {
+		return err
+	}
+	defer env.cleanup()
+
+	// Agents of parallel tasks are recorded per task, for orphan reaping
+	shared.update(func(s *runstate.RunState) {
+		for agentType, sup := range env.agents {
+			recordAgent(s, protocol.AgentType(string(agentType)+"@"+run.id), sup)
+		}
+	})
+
+	sched := env.scheduler
+	sched.SetStepCommitter(newStepCommitter(taskRepo, run.workspace, runID, logger))
+	sched.SetUsageTracker(tracker)
+	sched.SetBudgetApprover(approvers.budget)
+	sched.SetOutputsApprover(approvers.outputs)
+	sched.SetEventHandler(func(evt *protocol.Event) {
+		if evt.Usage == nil {
+			return
+		}
+		shared.update(func(s *runstate.RunState) { s.RecordUsage(evt.TaskID, *evt.Usage) })
+	})
+
+	return sched.ExecuteTask(ctx, run.id, run.inputs)
+}
+
+// mergeWorktreeTask merges a finished task's branch into the run branch.
+// On conflicts the user resolves and commits the merge, or skips the task,
+// which aborts the merge and keeps its branch. EOF counts as skipping.
+func mergeWorktreeTask(reader *bufio.Reader, out io.Writer, repo *gitrepo.Repo, runID string, run *worktreeTask) (bool, error) {
+	conflicts, err := repo.MergeTask(runID, run.id, run.branch)
+	if err != nil {
+		return false, fmt.Errorf("failed to merge branch %s: %w", run.branch, err)
+	}
+	if len(conflicts) == 0 {
+		return true, nil
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Merging task %s into %s conflicts in %d file(s):\n", run.id, gitrepo.BranchName(runID), len(conflicts))
+	for _, path := range conflicts {
+		fmt.Fprintf(out, "  - %s\n", path)
+	}
+	for {
+		fmt.Fprintf(out, "Resolve the conflicts in %s and commit the merge, then press Enter (or type \"skip\" to abort the merge and keep branch %s): ", repo.Dir(), run.branch)
+		line, err := readLine(reader)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		if errors.Is(err, io.EOF) || strings.EqualFold(line, "skip") {
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(out)
+			}
+			if repo.Merging() {
+				if err := repo.AbortMerge(); err != nil {
+					return false, fmt.Errorf("failed to abort the merge of %s: %w", run.branch, err)
+				}
+			}
+			return false, nil
+		}
+
+		if repo.Merging() {
+			remaining, _ := repo.Conflicts()
+			fmt.Fprintf(out, "The merge is still in progress (%d conflicted file(s) left).\n", len(remaining))
+			continue
+		}
+		if repo.HasMerged(run.branch) {
+			return true, nil
+		}
+		// The user aborted the merge themselves
+		return false, nil
+	}
+}
+
+// workspaceInRepo returns the workspace root relative to the top of its
+// git work tree, which is where it sits in every worktree too
+func workspaceInRepo(repo *gitrepo.Repo, workspaceRoot string) (string, error) {
+	top, err := repo.Toplevel()
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.Abs(workspaceRoot)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+	if top, err = filepath.EvalSymlinks(top); err != nil {
+		return "", fmt.Errorf("failed to resolve repository root: %w", err)
+	}
+	return filepath.Rel(top, root)
+}
+
+// collectTaskRecords brings a task's records from its worktree into the
+// run's workspace. Receipts and snapshot manifests replace the run's copies,
+// so a task run again brings its latest attempt; snapshot blobs, named by
+// their content, are only copied when missing. Agent logs are appended to
+// the run's and removed from the worktree, so a kept worktree never hands
+// over the same lines twice.
+func collectTaskRecords(taskWorkspace, workspaceRoot string) error {
+	for _, dir := range []string{"receipts", "snapshots", "logs"} {
+		err := filepath.WalkDir(filepath.Join(taskWorkspace, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(taskWorkspace, path)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(workspaceRoot, rel)
+			switch {
+			case dir == "logs":
+				if err := appendRecord(path, dst); err != nil {
+					return err
+				}
+				return os.Remove(path)
+			case strings.HasPrefix(rel, filepath.Join("snapshots", "blobs")+string(filepath.Separator)):
+				if _, err := os.Stat(dst); err == nil {
+					return nil
+				}
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return fsutil.AtomicWrite(dst, data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendRecord appends src to dst, creating dst when missing
+func appendRecord(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, in); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/activation"
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/eventlog"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/workspace"
+	"github.com/stretchr/testify/require"
+)
+
+// newParallelWorkspace creates a git-mode workspace whose mock agents write
+// each task's files in the directory they run in
+func newParallelWorkspace(t *testing.T) (string, *config.Config) {
+	t.Helper()
+	binary := buildHelperBinary(t, "./cmd/mockagent")
+	dir, cfg := newGitWorkspace(t)
+	require.NoError(t, workspace.Initialize(dir))
+
+	cfg.Policy.Concurrency = 2
+	for agentType, agent := range map[string]*config.AgentConfig{
+		"builder":         cfg.Agents.Builder,
+		"reviewer":        cfg.Agents.Reviewer,
+		"spec_maintainer": cfg.Agents.SpecMaintainer,
+	} {
+		agent.Cmd = []string{binary, "-type", agentType, "-workspace", ".", "-no-heartbeat"}
+	}
+	require.NoError(t, cfg.Validate())
+	return dir, cfg
+}
+
+// runParallel executes tasks in worktrees of dir as run-par, with in as the
+// user's input
+func runParallel(t *testing.T, dir string, cfg *config.Config, in io.Reader, tasks ...activation.Task) (*runstate.RunState, string, error) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	evtLog, err := eventlog.NewEventLog(filepath.Join(dir, "events", "run-par.ndjson"), logger)
+	require.NoError(t, err)
+	defer evtLog.Close()
+
+	state := runstate.NewIntakeState("intake-1", "snap-1", "build it", nil)
+	shared := &sharedRunState{state: state, path: runstate.GetRunStatePath(dir), logger: logger}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var out bytes.Buffer
+	err = executeTasksInWorktrees(ctx, bufio.NewReader(in), &out, cfg, dir, "run-par", tasks, shared, evtLog, logger)
+	return state, out.String(), err
+}
+
+func TestExecuteTasksInWorktrees(t *testing.T) {
+	dir, cfg := newParallelWorkspace(t)
+
+	state, out, err := runParallel(t, dir, cfg, strings.NewReader(""),
+		activation.Task{ID: "T-1", Title: "First", Files: []string{"src/a.go"}},
+		activation.Task{ID: "T-2", Title: "Second", Files: []string{"src/b.go"}},
+	)
+	require.NoError(t, err, out)
+
+	require.Equal(t, "lorch/run-par", git(t, dir, "branch", "--show-current"))
+	for _, task := range []string{"T-1", "T-2"} {
+		require.Contains(t, git(t, dir, "log", "--format=%s"), "lorch: merge "+task)
+		require.FileExists(t, filepath.Join(dir, "receipts", task, "step-1.json"))
+		require.Empty(t, git(t, dir, "branch", "--list", "lorch/run-par-"+task), "merged task branch should be deleted")
+	}
+	require.FileExists(t, filepath.Join(dir, "src", "a.go"))
+	require.FileExists(t, filepath.Join(dir, "src", "b.go"))
+	require.NotContains(t, git(t, dir, "worktree", "list"), "state/worktrees")
+
+	require.ElementsMatch(t, []string{"T-1", "T-2"}, state.ActivatedTaskIDs)
+	require.Equal(t, runstate.StatusCompleted, state.Status)
+}
+
+func TestExecuteTasksInWorktreesSkipsConflictingMerge(t *testing.T) {
+	dir, cfg := newParallelWorkspace(t)
+
+	// Both tasks write src/shared.go; EOF at the conflict prompt skips T-2
+	state, out, err := runParallel(t, dir, cfg, strings.NewReader(""),
+		activation.Task{ID: "T-1", Title: "First", Files: []string{"src/shared.go"}},
+		activation.Task{ID: "T-2", Title: "Second", Files: []string{"src/shared.go"}},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "T-2 (not merged; branch lorch/run-par-T-2)")
+	require.Contains(t, out, "Merging task T-2 into lorch/run-par conflicts in 1 file(s):\n  - src/shared.go")
+
+	require.NotEmpty(t, git(t, dir, "branch", "--list", "lorch/run-par-T-2"), "skipped task branch should be kept")
+	require.Empty(t, git(t, dir, "status", "--porcelain", "--", "src"), "the aborted merge should leave no changes")
+	content, readErr := os.ReadFile(filepath.Join(dir, "src", "shared.go"))
+	require.NoError(t, readErr)
+	require.Contains(t, string(content), "T-1")
+
+	require.Equal(t, []string{"T-1"}, state.ActivatedTaskIDs)
+	require.Equal(t, runstate.StatusFailed, state.Status)
+}
+
+// resolvingReader resolves the merge conflict in dir when lorch first asks
+// for input, then confirms
+type resolvingReader struct {
+	t        *testing.T
+	dir      string
+	resolved bool
+}
+
+func (r *resolvingReader) Read(p []byte) (int, error) {
+	if r.resolved {
+		return 0, io.EOF
+	}
+	r.resolved = true
+	writeWorkspaceFile(r.t, r.dir, "src/shared.go", "package src\n\n// T-1 and T-2\n")
+	git(r.t, r.dir, "add", "src/shared.go")
+	git(r.t, r.dir, "commit", "-q", "--no-edit")
+	return copy(p, "\n"), nil
+}
+
+func TestExecuteTasksInWorktreesWaitsForResolvedConflict(t *testing.T) {
+	dir, cfg := newParallelWorkspace(t)
+
+	state, out, err := runParallel(t, dir, cfg, &resolvingReader{t: t, dir: dir},
+		activation.Task{ID: "T-1", Title: "First", Files: []string{"src/shared.go"}},
+		activation.Task{ID: "T-2", Title: "Second", Files: []string{"src/shared.go"}},
+	)
+	require.NoError(t, err, out)
+	require.Contains(t, out, "Task T-2 merged into lorch/run-par")
+	require.ElementsMatch(t, []string{"T-1", "T-2"}, state.ActivatedTaskIDs)
+}
+
+func TestExecuteTasksInWorktreesRunsDependentsAfterPrerequisites(t *testing.T) {
+	dir, cfg := newParallelWorkspace(t)
+
+	// T-2 writes the file T-1 wrote; starting from T-1's merge, it merges
+	// without conflict
+	state, out, err := runParallel(t, dir, cfg, strings.NewReader(""),
+		activation.Task{ID: "T-1", Title: "First", Files: []string{"src/shared.go"}},
+		activation.Task{ID: "T-2", Title: "Second", Files: []string{"src/shared.go"}, DependsOn: []string{"T-1"}},
+		activation.Task{ID: "T-3", Title: "Third", Files: []string{"src/c.go"}},
+	)
+	require.NoError(t, err, out)
+	require.NotContains(t, out, "conflicts")
+
+	merges := strings.Fields(git(t, dir, "log", "--merges", "--reverse", "--format=%s"))
+	require.Equal(t, "lorch: merge T-1 lorch: merge T-3 lorch: merge T-2", strings.Join(merges, " "))
+	require.True(t, strings.Index(out, "Task T-1 merged") < strings.Index(out, "Executing task 3/3: Second (T-2)"), out)
+
+	for _, task := range []string{"T-1", "T-2", "T-3"} {
+		require.Equal(t, runstate.TaskCompleted, state.Tasks[task].Status, task)
+		require.True(t, state.Tasks[task].Worktree)
+	}
+	require.Equal(t, runstate.StatusCompleted, state.Status)
+}
+
+func TestExecuteTasksInWorktreesSkipsDependentsOfFailedTask(t *testing.T) {
+	dir, cfg := newParallelWorkspace(t)
+	script := filepath.Join(repoRoot(t), "testdata", "fixtures", "builder-tests-failed.json")
+	cfg.Agents.Builder.Cmd = append(cfg.Agents.Builder.Cmd, "-script", script)
+
+	state, out, err := runParallel(t, dir, cfg, strings.NewReader(""),
+		activation.Task{ID: "T-1", Title: "First", Files: []string{"src/a.go"}},
+		activation.Task{ID: "T-2", Title: "Second", Files: []string{"src/b.go"}, DependsOn: []string{"T-1"}},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "T-2 (skipped: prerequisite T-1 did not complete)")
+	require.Contains(t, out, "Skipping task T-2: prerequisite T-1 did not complete")
+	require.NotContains(t, out, "(T-2) in")
+
+	require.Equal(t, runstate.TaskFailed, state.Tasks["T-1"].Status)
+	require.Equal(t, runstate.TaskSkipped, state.Tasks["T-2"].Status)
+	require.Equal(t, []string{"T-1", "T-2"}, state.UnfinishedTasks())
+	require.Equal(t, runstate.StatusFailed, state.Status)
+}
+
+func TestExecuteTasksInWorktreesKeepsSpecMaintainerEdits(t *testing.T) {
+	dir, cfg := newParallelWorkspace(t)
+	script := filepath.Join(t.TempDir(), "spec.json")
+	require.NoError(t, os.WriteFile(script, []byte(`{"responses": {"update_spec": {"events": [{
+		"type": "spec.updated",
+		"payload": {"summary": "Spec updated"},
+		"artifacts": [{"path": "SPEC.md", "content": "# Spec\n\nUpdated by the spec maintainer\n"}]
+	}]}}}`), 0o644))
+	cfg.Agents.SpecMaintainer.Cmd = append(cfg.Agents.SpecMaintainer.Cmd, "-script", script)
+
+	state, out, err := runParallel(t, dir, cfg, strings.NewReader(""),
+		activation.Task{ID: "T-1", Title: "First", Files: []string{"src/a.go"}},
+		activation.Task{ID: "T-2", Title: "Second", Files: []string{"src/b.go"}},
+	)
+	require.NoError(t, err, out)
+	require.Equal(t, runstate.StatusCompleted, state.Status)
+
+	// The spec edit is merged into the run branch, which is left clean
+	content, readErr := os.ReadFile(filepath.Join(dir, "SPEC.md"))
+	require.NoError(t, readErr)
+	require.Contains(t, string(content), "Updated by the spec maintainer")
+	require.Contains(t, git(t, dir, "log", "--format=%s"), "lorch: update_spec T-1")
+	require.NoError(t, requireCleanGitWorkspace(cfg, dir))
+	require.NotContains(t, git(t, dir, "worktree", "list"), "state/worktrees")
+}
+
+func TestCollectTaskRecordsReplacesEarlierAttempts(t *testing.T) {
+	taskWorkspace, workspaceRoot := t.TempDir(), t.TempDir()
+	receiptPath := filepath.Join("receipts", "T-1", "step-1.json")
+	logPath := filepath.Join("logs", "builder.log")
+	writeWorkspaceFile(t, workspaceRoot, receiptPath, `{"attempt": 1}`)
+	writeWorkspaceFile(t, workspaceRoot, logPath, "first attempt\n")
+
+	// A task run again in its kept worktree brings its latest receipt
+	writeWorkspaceFile(t, taskWorkspace, receiptPath, `{"attempt": 2}`)
+	writeWorkspaceFile(t, taskWorkspace, logPath, "second attempt\n")
+	require.NoError(t, collectTaskRecords(taskWorkspace, workspaceRoot))
+	require.NoError(t, collectTaskRecords(taskWorkspace, workspaceRoot))
+
+	data, err := os.ReadFile(filepath.Join(workspaceRoot, receiptPath))
+	require.NoError(t, err)
+	require.Equal(t, `{"attempt": 2}`, string(data))
+	data, err = os.ReadFile(filepath.Join(workspaceRoot, logPath))
+	require.NoError(t, err)
+	require.Equal(t, "first attempt\nsecond attempt\n", string(data), "logs are handed over once")
+}
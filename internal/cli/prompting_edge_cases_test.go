@@ -3,9 +3,14 @@ package cli
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"io"
 	"strings"
 	"testing"
 
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/usage"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/require"
 )
 
@@ -458,3 +463,83 @@ func TestParsePlanResponse_MalformedPayload(t *testing.T) {
 		})
 	}
 }
+
+// TestBudgetPrompt validates the budget approval prompt answers
+func TestBudgetPrompt(t *testing.T) {
+	exceeded := &usage.BudgetExceeded{Scope: usage.ScopeRun, Metric: "usd", Limit: 1, Actual: 1.5}
+
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "yes", input: "y\n", want: true},
+		{name: "yes uppercase", input: "YES\n", want: true},
+		{name: "no", input: "n\n", want: false},
+		{name: "empty defaults to no", input: "\n", want: false},
+		{name: "EOF declines", input: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			approve := newBudgetPrompt(bufio.NewReader(strings.NewReader(tt.input)), &output)
+
+			approved, err := approve(context.Background(), exceeded)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, approved)
+			require.Contains(t, output.String(), "run budget exceeded")
+			require.Contains(t, output.String(), "[y/N]")
+		})
+	}
+}
+
+// TestOutputsPrompt validates the missing outputs approval prompt answers
+func TestOutputsPrompt(t *testing.T) {
+	missing := []receipt.OutputStatus{{Path: "src/auth.go", Required: true, Status: receipt.OutputMissing}}
+
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "yes", input: "yes\n", want: true},
+		{name: "no", input: "n\n", want: false},
+		{name: "EOF declines", input: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			approve := newOutputsPrompt(bufio.NewReader(strings.NewReader(tt.input)), &output)
+
+			approved, err := approve(context.Background(), "T-1", protocol.ActionImplement, missing)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, approved)
+			require.Contains(t, output.String(), "src/auth.go")
+			require.Contains(t, output.String(), "[y/N]")
+		})
+	}
+}
+
+// TestPromptsShareStdin validates that answers typed ahead are not lost
+// between prompts reading the same stdin
+func TestPromptsShareStdin(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("y\nn\ny\n"))
+	budget := newBudgetPrompt(reader, io.Discard)
+	outputs := newOutputsPrompt(reader, io.Discard)
+	exceeded := &usage.BudgetExceeded{Scope: usage.ScopeRun, Metric: "usd", Limit: 1, Actual: 1.5}
+	missing := []receipt.OutputStatus{{Path: "src/auth.go", Required: true, Status: receipt.OutputMissing}}
+
+	approved, err := budget(context.Background(), exceeded)
+	require.NoError(t, err)
+	require.True(t, approved)
+
+	approved, err = outputs(context.Background(), "T-1", protocol.ActionImplement, missing)
+	require.NoError(t, err)
+	require.False(t, approved)
+
+	approved, err = budget(context.Background(), exceeded)
+	require.NoError(t, err)
+	require.True(t, approved)
+}
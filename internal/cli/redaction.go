@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+// redactorFor builds the redactor for the configured policy, or returns nil
+// when policy.redact_secrets_in_logs is off. Secret values are taken from
+// lorch's environment and the agents' configured env.
+func redactorFor(cfg *config.Config) (*redact.Redactor, error) {
+	if !cfg.Policy.RedactSecretsInLogs {
+		return nil, nil
+	}
+
+	env := os.Environ()
+	for _, agent := range []*config.AgentConfig{cfg.Agents.Builder, cfg.Agents.Reviewer, cfg.Agents.SpecMaintainer, cfg.Agents.Orchestration} {
+		if agent == nil {
+			continue
+		}
+		names := make([]string, 0, len(agent.Env))
+		for name := range agent.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			env = append(env, name+"="+agent.Env[name])
+		}
+	}
+
+	return redact.New(redact.Options{
+		Env:         env,
+		Patterns:    cfg.Policy.RedactPatterns,
+		HighEntropy: cfg.Policy.RedactHighEntropy,
+	})
+}
+
+// redactConsole routes the command's output through red and returns a
+// logger that writes through it too. The returned function restores the
+// command's output.
+func redactConsole(cmd *cobra.Command, red *redact.Redactor) (*slog.Logger, func()) {
+	logger := slog.New(slog.NewTextHandler(red.Writer(os.Stdout), &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	if red == nil {
+		return logger, func() {}
+	}
+	out := cmd.OutOrStdout()
+	cmd.SetOut(red.Writer(out))
+	return logger, func() { cmd.SetOut(out) }
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/eventlog"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore --snapshot <id>",
+	Short: "Roll the workspace back to a snapshot",
+	Long: `Bring the workspace back to a snapshot, using the file contents kept in
+the blob store under snapshots/blobs/ (enabled with "snapshot": {"blobs":
+true} in lorch.json).
+
+The changes are listed first: files to rewrite, files to recreate, and files
+the snapshot did not have, which are deleted. Only files the snapshot's
+include and exclude rules select are considered; --paths narrows the
+restore to some files or directories. Every file is staged and verified
+before any is replaced, and the restore is recorded in the run's ledger.
+
+  lorch restore --snapshot snap-0123456789ab --paths src/api --dry-run`,
+	RunE: runRestore,
+}
+
+func init() {
+	addRestoreFlags(restoreCmd.Flags())
+	restoreCmd.MarkFlagRequired("snapshot")
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func addRestoreFlags(flags *pflag.FlagSet) {
+	flags.String("snapshot", "", "Snapshot ID to restore (required)")
+	flags.StringSlice("paths", nil, "Only restore these files or directories (globs allowed)")
+	flags.Bool("dry-run", false, "List the changes without applying them")
+	flags.BoolP("yes", "y", false, "Apply the changes without asking")
+	flags.StringP("run", "r", "", "Run whose ledger records the restore (default: the run in state/run.json)")
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	snapshotID, err := flags.GetString("snapshot")
+	if err != nil {
+		return err
+	}
+	paths, err := flags.GetStringSlice("paths")
+	if err != nil {
+		return err
+	}
+	dryRun, err := flags.GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	yes, err := flags.GetBool("yes")
+	if err != nil {
+		return err
+	}
+	runID, err := flags.GetString("run")
+	if err != nil {
+		return err
+	}
+
+	workspaceRoot, cfg, err := locateWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	manifest, err := snapshot.LoadSnapshot(filepath.Join(workspaceRoot, "snapshots", snapshotID+".manifest.json"))
+	if err != nil {
+		return fmt.Errorf("snapshot %s not found: %w", snapshotID, err)
+	}
+
+	// The snapshot's own rules decide which files belong to it, so files a
+	// later configuration tracks are never deleted
+	scope := manifest.Rules.Scope()
+	if cfg != nil {
+		scope.IgnoreGitignore = cfg.Snapshot.Scope().IgnoreGitignore
+	}
+	plan, err := snapshot.PlanRestore(workspaceRoot, manifest, scope, paths)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	printRestorePlan(out, plan)
+	if len(plan.Changes) == 0 || dryRun {
+		return nil
+	}
+	if len(plan.Missing) > 0 {
+		return fmt.Errorf("cannot restore %s: %d file(s) have no stored content\n\nHint: Enable the blob store before the snapshot is captured:\n  \"snapshot\": {\"blobs\": true}", snapshotID, len(plan.Missing))
+	}
+
+	if runID == "" {
+		state, err := runstate.LoadRunState(runstate.GetRunStatePath(workspaceRoot))
+		if err != nil {
+			return fmt.Errorf("no run to record the restore in (pass --run): %w", err)
+		}
+		runID = state.RunID
+	}
+
+	if !yes {
+		ok, err := confirmRestore(cmd.InOrStdin(), out, len(plan.Changes))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(out, "Restore cancelled; nothing changed.")
+			return nil
+		}
+	}
+
+	evtLog, err := eventlog.NewEventLog(filepath.Join(workspaceRoot, "events", runID+".ndjson"), slog.Default())
+	if err != nil {
+		return err
+	}
+	defer evtLog.Close()
+
+	restoreErr := snapshot.Restore(workspaceRoot, plan)
+	if err := evtLog.WriteLog(restoreLog(plan, paths, restoreErr)); err != nil {
+		return fmt.Errorf("failed to record the restore in the ledger: %w", err)
+	}
+	if restoreErr != nil {
+		return restoreErr
+	}
+
+	fmt.Fprintf(out, "Restored %d file(s) from %s; recorded in events/%s.ndjson\n", len(plan.Changes), snapshotID, runID)
+	return nil
+}
+
+// restoreVerb describes what restoring does to a changed file
+func restoreVerb(change snapshot.FileChange) string {
+	switch change.Change {
+	case snapshot.ChangeAdded:
+		return "recreate"
+	case snapshot.ChangeRemoved:
+		return "delete"
+	default:
+		return "rewrite"
+	}
+}
+
+// printRestorePlan lists what restoring would change
+func printRestorePlan(w io.Writer, plan *snapshot.RestorePlan) {
+	if len(plan.Changes) == 0 {
+		fmt.Fprintf(w, "Workspace already matches %s; nothing to restore.\n", plan.SnapshotID)
+		return
+	}
+
+	missing := make(map[string]bool, len(plan.Missing))
+	for _, path := range plan.Missing {
+		missing[path] = true
+	}
+	fmt.Fprintf(w, "Restore %s: %d change(s)\n", plan.SnapshotID, len(plan.Changes))
+	for _, change := range plan.Changes {
+		note := ""
+		if missing[change.Path] {
+			note = "  (content not stored)"
+		}
+		fmt.Fprintf(w, "  %-8s  %s%s\n", restoreVerb(change), change.Path, note)
+	}
+}
+
+// confirmRestore asks the user whether to apply the changes. EOF counts as
+// "no".
+func confirmRestore(in io.Reader, out io.Writer, changes int) (bool, error) {
+	fmt.Fprintf(out, "Apply %d change(s)? [y/N]: ", changes)
+	line, err := readLine(bufio.NewReader(in))
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(out)
+			return false, nil
+		}
+		return false, err
+	}
+	switch strings.ToLower(line) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// restoreLog renders a restore as a ledger log entry
+func restoreLog(plan *snapshot.RestorePlan, paths []string, restoreErr error) *protocol.Log {
+	changed := map[string][]string{}
+	for _, change := range plan.Changes {
+		verb := restoreVerb(change)
+		changed[verb] = append(changed[verb], change.Path)
+	}
+	fields := map[string]any{
+		"snapshot_id": plan.SnapshotID,
+		"rewritten":   changed["rewrite"],
+		"recreated":   changed["recreate"],
+		"deleted":     changed["delete"],
+	}
+	if len(paths) > 0 {
+		fields["paths"] = paths
+	}
+
+	level, message := protocol.LogLevelInfo, "workspace restored"
+	if restoreErr != nil {
+		level, message = protocol.LogLevelError, "workspace restore failed"
+		fields["error"] = restoreErr.Error()
+	}
+	return &protocol.Log{
+		Kind:      protocol.MessageKindLog,
+		Level:     level,
+		Message:   message,
+		Fields:    fields,
+		Timestamp: time.Now().UTC(),
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/ledger"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreCommand(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := config.GenerateDefault()
+	cfg.Snapshot = &config.SnapshotConfig{Blobs: true}
+	configPath := filepath.Join(workspace, "lorch.json")
+	require.NoError(t, cfg.SaveToFile(configPath))
+
+	write := func(rel, content string) {
+		path := filepath.Join(workspace, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("src/main.go", "package main\n")
+
+	snap, err := captureSnapshot(workspace, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	require.NoError(t, snapshot.SaveSnapshot(snap, filepath.Join(workspace, "snapshots", snap.SnapshotID+".manifest.json")))
+	require.NoError(t, runstate.SaveRunState(runstate.NewRunState("run-restore", "T-1", snap.SnapshotID), runstate.GetRunStatePath(workspace)))
+
+	write("src/main.go", "package broken\n")
+	write("src/extra.go", "package main\n")
+
+	restore := func(input string, args ...string) (string, error) {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("config", configPath, "")
+		addRestoreFlags(cmd.Flags())
+		require.NoError(t, cmd.Flags().Set("snapshot", snap.SnapshotID))
+		for _, arg := range args {
+			name, value, _ := strings.Cut(arg, "=")
+			require.NoError(t, cmd.Flags().Set(name, value))
+		}
+		var out bytes.Buffer
+		cmd.SetIn(strings.NewReader(input))
+		cmd.SetOut(&out)
+		err := runRestore(cmd, nil)
+		return out.String(), err
+	}
+
+	out, err := restore("", "dry-run=true")
+	require.NoError(t, err)
+	require.Contains(t, out, "Restore "+snap.SnapshotID+": 2 change(s)")
+	require.Contains(t, out, "rewrite   src/main.go")
+	require.Contains(t, out, "delete    src/extra.go")
+
+	out, err = restore("n\n")
+	require.NoError(t, err)
+	require.Contains(t, out, "Restore cancelled")
+
+	out, err = restore("y\n")
+	require.NoError(t, err, out)
+	content, err := os.ReadFile(filepath.Join(workspace, "src", "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package main\n", string(content))
+	require.NoFileExists(t, filepath.Join(workspace, "src", "extra.go"))
+
+	lg, err := ledger.ReadLedger(filepath.Join(workspace, "events", "run-restore.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, lg.Logs, 1)
+	require.Equal(t, "workspace restored", lg.Logs[0].Message)
+	require.Equal(t, snap.SnapshotID, lg.Logs[0].Fields["snapshot_id"])
+
+	out, err = restore("")
+	require.NoError(t, err)
+	require.Contains(t, out, "nothing to restore")
+}
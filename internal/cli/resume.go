@@ -1,8 +1,10 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -11,11 +13,12 @@ import (
 	"github.com/iambrandonn/lorch/internal/config"
 	"github.com/iambrandonn/lorch/internal/eventlog"
 	"github.com/iambrandonn/lorch/internal/ledger"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/ndjson"
 	"github.com/iambrandonn/lorch/internal/runstate"
 	"github.com/iambrandonn/lorch/internal/scheduler"
 	"github.com/iambrandonn/lorch/internal/supervisor"
 	"github.com/iambrandonn/lorch/internal/transcript"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/spf13/cobra"
 )
 
@@ -35,6 +38,7 @@ func runResume(cmd *cobra.Command, args []string) error {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	}))
+	defer interruptible(cmd)()
 
 	runID, err := cmd.Flags().GetString("run")
 	if err != nil {
@@ -61,6 +65,25 @@ func runResume(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Keep secrets out of everything printed from here on
+	red, err := redactorFor(cfg)
+	if err != nil {
+		return err
+	}
+	logger, restoreOut := redactConsole(cmd, red)
+	defer restoreOut()
+
+	// Every prompt of the resume reads its answers from the same buffered stdin
+	reader := bufio.NewReader(cmd.InOrStdin())
+
+	if err := configureSchemaValidation(cfg, logger); err != nil {
+		return err
+	}
+
+	// Agent streams, the ledger and the handshake all use the configured
+	// message size limit
+	ndjson.SetDefaultLimit(cfg.Policy.MessageMaxBytes)
+
 	// Determine workspace root
 	workspaceRoot := determineWorkspaceRoot(cfg, cfgPath)
 	logger.Info("workspace root", "path", workspaceRoot)
@@ -87,6 +110,8 @@ func runResume(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("run was aborted, cannot resume")
 	}
 
+	reapOrphans(cmd.Context(), state, logger)
+
 	logger.Info("resuming run",
 		"task_id", state.TaskID,
 		"snapshot_id", state.SnapshotID,
@@ -95,7 +120,7 @@ func runResume(cmd *cobra.Command, args []string) error {
 
 	if state.CurrentStage == runstate.StageIntake {
 		logger.Info("resuming intake negotiation")
-		outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+		outcome, err := runIntakeFlow(cmd, reader, cfg, workspaceRoot, logger)
 		if err != nil {
 			return err
 		}
@@ -115,9 +140,23 @@ func runResume(cmd *cobra.Command, args []string) error {
 		"events", len(lg.Events),
 		"heartbeats", len(lg.Heartbeats))
 
+	// A multi-task run continues the unfinished part of its task graph:
+	// interrupted tasks resume from the ledger, failed ones run again, and
+	// so do the ones skipped because of them
+	graph := len(state.Tasks) > 0
+	if graph {
+		unfinished := state.UnfinishedTasks()
+		if len(unfinished) == 0 {
+			logger.Info("all tasks completed, marking run complete")
+			state.MarkCompleted()
+			return runstate.SaveRunState(state, statePath)
+		}
+		logger.Info("resuming task graph", "tasks", len(state.Tasks), "unfinished", len(unfinished))
+	}
+
 	// Analyze ledger to find pending commands
 	pending := lg.GetPendingCommands()
-	if len(pending) == 0 {
+	if len(pending) == 0 && !graph {
 		logger.Info("no pending commands, marking run complete")
 		state.MarkCompleted()
 		return runstate.SaveRunState(state, statePath)
@@ -125,39 +164,42 @@ func runResume(cmd *cobra.Command, args []string) error {
 
 	logger.Info("found pending commands", "count", len(pending))
 
-	// Determine task inputs: use stored inputs for idempotent resume (P2.4 Task B review)
+	// Determine task inputs: use stored inputs for idempotent resume (P2.4 Task B review).
+	// Graph tasks each have their own stored inputs instead.
 	var inputs map[string]any
-	if state.CurrentTaskInputs != nil && len(state.CurrentTaskInputs) > 0 {
-		// P2.4 Task B: use stored inputs to ensure idempotency keys match
-		logger.Info("resuming with stored task inputs", "task_id", state.TaskID)
-		inputs = state.CurrentTaskInputs
-	} else if state.Intake != nil && state.Intake.LastDecision != nil {
-		// P2.4 Task B: older intake-derived run without stored inputs (backward compat)
-		logger.Warn("resuming intake run without stored inputs, idempotency may not match", "task_id", state.TaskID)
-		inputs = map[string]any{
-			"instruction":   state.Intake.Instruction,
-			"approved_plan": state.Intake.LastDecision.ApprovedPlan,
-			"goal":          state.TaskID,
-		}
-		if len(state.Intake.LastClarifications) > 0 {
-			inputs["clarifications"] = state.Intake.LastClarifications
-		}
-		if len(state.Intake.ConflictResolutions) > 0 {
-			inputs["conflict_resolutions"] = state.Intake.ConflictResolutions
-		}
-	} else {
-		// Phase 1: config-based task
-		var task *config.Task
-		for i := range cfg.Tasks {
-			if cfg.Tasks[i].ID == state.TaskID {
-				task = &cfg.Tasks[i]
-				break
+	if !graph {
+		if state.CurrentTaskInputs != nil && len(state.CurrentTaskInputs) > 0 {
+			// P2.4 Task B: use stored inputs to ensure idempotency keys match
+			logger.Info("resuming with stored task inputs", "task_id", state.TaskID)
+			inputs = state.CurrentTaskInputs
+		} else if state.Intake != nil && state.Intake.LastDecision != nil {
+			// P2.4 Task B: older intake-derived run without stored inputs (backward compat)
+			logger.Warn("resuming intake run without stored inputs, idempotency may not match", "task_id", state.TaskID)
+			inputs = map[string]any{
+				"instruction":   state.Intake.Instruction,
+				"approved_plan": state.Intake.LastDecision.ApprovedPlan,
+				"goal":          state.TaskID,
 			}
+			if len(state.Intake.LastClarifications) > 0 {
+				inputs["clarifications"] = state.Intake.LastClarifications
+			}
+			if len(state.Intake.ConflictResolutions) > 0 {
+				inputs["conflict_resolutions"] = state.Intake.ConflictResolutions
+			}
+		} else {
+			// Phase 1: config-based task
+			var task *config.Task
+			for i := range cfg.Tasks {
+				if cfg.Tasks[i].ID == state.TaskID {
+					task = &cfg.Tasks[i]
+					break
+				}
+			}
+			if task == nil {
+				return fmt.Errorf("task %s not found in config", state.TaskID)
+			}
+			inputs = map[string]any{"goal": task.Goal}
 		}
-		if task == nil {
-			return fmt.Errorf("task %s not found in config", state.TaskID)
-		}
-		inputs = map[string]any{"goal": task.Goal}
 	}
 
 	// Reopen event log for appending
@@ -165,24 +207,51 @@ func runResume(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to reopen event log: %w", err)
 	}
+	evtLog.SetRedactor(red)
 	defer evtLog.Close()
+	defer recordSchemaFindings(evtLog, logger)()
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Minute)
 	defer cancel()
 
+	// Tasks that ran in worktrees of their own run in new ones, on their
+	// branches, when the run still runs tasks in parallel
+	if graph && cfg.Policy.Concurrency > 1 && hasWorktreeTasks(state) {
+		state.Status = runstate.StatusRunning
+		state.CompletedAt = nil
+		shared := &sharedRunState{state: state, path: statePath, logger: logger}
+		if err := runWorktreeGraph(ctx, reader, cmd.OutOrStdout(), cfg, workspaceRoot, runID, shared, evtLog, logger); err != nil {
+			return fmt.Errorf("task execution failed: %w", err)
+		}
+		logger.Info("resume complete", "run_id", runID)
+		return nil
+	}
+
+	// In git mode the run continues on its branch; changes left by an
+	// interrupted step are kept for the step's retry
+	committer, err := startGitMode(cfg, workspaceRoot, runID, logger)
+	if err != nil {
+		return err
+	}
+
+	// Agent daemons on the unix transport reconnect to the run's socket and
+	// are reattached
+	host := newAgentHost(workspaceRoot, runID, logger)
+	defer host.Close()
+
 	// Create agent supervisors
-	builderSup, err := agentSupervisorFactory(cfg.Agents.Builder, protocol.AgentTypeBuilder, logger)
+	builderSup, err := agentSupervisorFactory(cfg.Agents.Builder, protocol.AgentTypeBuilder, host, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create builder supervisor: %w", err)
 	}
 
-	reviewerSup, err := agentSupervisorFactory(cfg.Agents.Reviewer, protocol.AgentTypeReviewer, logger)
+	reviewerSup, err := agentSupervisorFactory(cfg.Agents.Reviewer, protocol.AgentTypeReviewer, host, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create reviewer supervisor: %w", err)
 	}
 
-	specMaintainerSup, err := agentSupervisorFactory(cfg.Agents.SpecMaintainer, protocol.AgentTypeSpecMaintainer, logger)
+	specMaintainerSup, err := agentSupervisorFactory(cfg.Agents.SpecMaintainer, protocol.AgentTypeSpecMaintainer, host, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create spec maintainer supervisor: %w", err)
 	}
@@ -216,20 +285,58 @@ func runResume(cmd *cobra.Command, args []string) error {
 	}
 	defer specMaintainer.Stop(context.Background())
 
+	for agentType, sup := range map[protocol.AgentType]*supervisor.AgentSupervisor{
+		protocol.AgentTypeBuilder:        builder,
+		protocol.AgentTypeReviewer:       reviewer,
+		protocol.AgentTypeSpecMaintainer: specMaintainer,
+	} {
+		if err := startAgentLogSink(ctx, sup, agentType, workspaceRoot, runID, red, logger); err != nil {
+			return fmt.Errorf("failed to start %s log sink: %w", agentType, err)
+		}
+	}
+
+	recordAgent(state, protocol.AgentTypeBuilder, builder)
+	recordAgent(state, protocol.AgentTypeReviewer, reviewer)
+	recordAgent(state, protocol.AgentTypeSpecMaintainer, specMaintainer)
+	if err := runstate.SaveRunState(state, statePath); err != nil {
+		logger.Warn("failed to save run state", "error", err)
+	}
+
 	// Create scheduler
 	sched := scheduler.NewScheduler(builder, reviewer, specMaintainer, logger)
 	sched.SetSnapshotID(state.SnapshotID)
 	sched.SetWorkspaceRoot(workspaceRoot)
+	sched.SetArtifactMaxBytes(int64(cfg.Policy.ArtifactMaxBytes))
+	sched.SetSnapshotScope(cfg.Snapshot.Scope())
+	sched.SetSnapshotBlobs(cfg.Snapshot.KeepBlobs())
+	sched.SetStrictVersionPinning(cfg.Policy.StrictVersionPinning)
+	if committer != nil {
+		sched.SetStepCommitter(committer)
+	}
 	sched.SetEventLogger(evtLog)
-	sched.SetTranscriptFormatter(transcript.NewFormatter())
-
-	// Resume execution using ledger-aware resume
-	// This will skip commands that already have terminal events
-	logger.Info("resuming task execution...")
-	if err := sched.ResumeTask(ctx, state.TaskID, inputs, lg); err != nil {
-		state.MarkFailed()
-		runstate.SaveRunState(state, statePath)
-		return fmt.Errorf("task execution failed: %w", err)
+	formatter := transcript.NewFormatter()
+	formatter.SetRedactor(red)
+	sched.SetTranscriptFormatter(formatter)
+	sched.SetRedactor(red)
+	tracker := configureUsageAccounting(sched, cfg, state, statePath, reader, cmd.OutOrStdout(), logger)
+	sched.SetOutputsApprover(newOutputsPrompt(reader, cmd.OutOrStdout()))
+
+	if graph {
+		if err := resumeTaskGraph(ctx, cmd.OutOrStdout(), sched, state, statePath, lg, logger); err != nil {
+			state.MarkFailed()
+			runstate.SaveRunState(state, statePath)
+			printUsageSummary(cmd.OutOrStdout(), tracker)
+			return fmt.Errorf("task execution failed: %w", taskGraphError(err, runID, len(state.Tasks)))
+		}
+	} else {
+		// Resume execution using ledger-aware resume
+		// This will skip commands that already have terminal events
+		logger.Info("resuming task execution...")
+		if err := sched.ResumeTask(ctx, state.TaskID, inputs, lg); err != nil {
+			state.MarkFailed()
+			runstate.SaveRunState(state, statePath)
+			return fmt.Errorf("task execution failed: %w", err)
+		}
 	}
 
 	// Mark run complete
@@ -238,6 +345,58 @@ func runResume(cmd *cobra.Command, args []string) error {
 		logger.Warn("failed to save final run state", "error", err)
 	}
 
+	printUsageSummary(cmd.OutOrStdout(), tracker)
 	logger.Info("resume complete", "run_id", runID)
 	return nil
 }
+
+// resumeTaskGraph runs the unfinished tasks of a multi-task run. A task
+// that was interrupted resumes from the ledger, skipping the steps that
+// already finished; every other unfinished task runs from the start.
+func resumeTaskGraph(ctx context.Context, out io.Writer, sched *scheduler.Scheduler, state *runstate.RunState, statePath string, lg *ledger.Ledger, logger *slog.Logger) error {
+	interrupted := make(map[string]bool)
+	for id, task := range state.Tasks {
+		if task.Status == runstate.TaskRunning && !task.Worktree {
+			interrupted[id] = true
+		}
+	}
+	state.Status = runstate.StatusRunning
+	state.CompletedAt = nil
+
+	return runTaskGraph(ctx, out, state, statePath, logger, func(ctx context.Context, taskID string, task *runstate.TaskState) error {
+		if interrupted[taskID] {
+			logger.Info("resuming interrupted task", "task_id", taskID)
+			return sched.ResumeTask(ctx, taskID, task.Inputs, lg)
+		}
+		return sched.ExecuteTask(ctx, taskID, task.Inputs)
+	})
+}
+
+// hasWorktreeTasks reports whether an unfinished task of the run ran in a
+// worktree of its own
+func hasWorktreeTasks(state *runstate.RunState) bool {
+	for _, id := range state.UnfinishedTasks() {
+		if state.Tasks[id].Worktree {
+			return true
+		}
+	}
+	return false
+}
+
+// reapOrphans terminates agent process groups that survived the lorch
+// process which started them. Agents speak NDJSON over stdio and those pipes
+// closed when the previous lorch died, so a survivor cannot be re-attached
+// and its heartbeats can never be read again; it is stopped (SIGTERM, then
+// SIGKILL after the grace period) and the resume starts fresh agents.
+func reapOrphans(ctx context.Context, state *runstate.RunState, logger *slog.Logger) {
+	for agentType, p := range state.Processes {
+		info := supervisor.ProcessInfo{PID: p.PID, PGID: p.PGID, StartTicks: p.StartTicks, StartedAt: p.StartedAt}
+		if !supervisor.Survives(info) {
+			continue
+		}
+		logger.Warn("found agent from previous run still running", "agent", agentType, "pid", p.PID, "started_at", p.StartedAt)
+		escalation := supervisor.ReapOrphan(ctx, info, supervisor.DefaultTerminateGracePeriod, logger)
+		logger.Info("orphaned agent stopped", "agent", agentType, "pid", p.PID, "escalation", escalation)
+	}
+	state.Processes = nil
+}
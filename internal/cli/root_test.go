@@ -50,3 +50,20 @@ func lookupFlag(cmd *cobra.Command, name string) *pflag.Flag {
 	}
 	return cmd.PersistentFlags().Lookup(name)
 }
+
+func TestConformanceCommandRegistered(t *testing.T) {
+	found, _, err := rootCmd.Find([]string{"conformance"})
+	require.NoError(t, err)
+	require.Equal(t, conformanceCmd, found)
+	require.NotNil(t, lookupFlag(conformanceCmd, "agent"))
+	require.NotNil(t, lookupFlag(conformanceCmd, "junit"))
+}
+
+func TestParseEnvPairs(t *testing.T) {
+	env, err := parseEnvPairs([]string{"A=1", "B=x=y"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"A": "1", "B": "x=y"}, env)
+
+	_, err = parseEnvPairs([]string{"novalue"})
+	require.Error(t, err)
+}
@@ -10,25 +10,30 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/iambrandonn/lorch/internal/activation"
+	"github.com/iambrandonn/lorch/internal/agentlog"
 	"github.com/iambrandonn/lorch/internal/config"
 	"github.com/iambrandonn/lorch/internal/discovery"
 	"github.com/iambrandonn/lorch/internal/eventlog"
 	"github.com/iambrandonn/lorch/internal/idempotency"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/internal/redact"
 	"github.com/iambrandonn/lorch/internal/runstate"
 	"github.com/iambrandonn/lorch/internal/scheduler"
 	"github.com/iambrandonn/lorch/internal/snapshot"
 	"github.com/iambrandonn/lorch/internal/supervisor"
 	"github.com/iambrandonn/lorch/internal/transcript"
 	"github.com/iambrandonn/lorch/internal/workspace"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/spf13/cobra"
 )
 
@@ -66,6 +71,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	}))
+	defer interruptible(cmd)()
 
 	outWriter := cmd.OutOrStdout()
 
@@ -87,6 +93,26 @@ func runRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Keep secrets out of everything printed from here on
+	red, err := redactorFor(cfg)
+	if err != nil {
+		return err
+	}
+	logger, restoreOut := redactConsole(cmd, red)
+	defer restoreOut()
+	outWriter = cmd.OutOrStdout()
+
+	// Every prompt of the run reads its answers from the same buffered stdin
+	reader := bufio.NewReader(cmd.InOrStdin())
+
+	if err := configureSchemaValidation(cfg, logger); err != nil {
+		return err
+	}
+
+	// Agent streams, the ledger and the handshake all use the configured
+	// message size limit
+	ndjson.SetDefaultLimit(cfg.Policy.MessageMaxBytes)
+
 	// Determine workspace root (relative to config file location)
 	workspaceRoot := determineWorkspaceRoot(cfg, cfgPath)
 	logger.Info("workspace root", "path", workspaceRoot)
@@ -98,6 +124,10 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 	logger.Info("workspace initialized")
 
+	if err := requireCleanGitWorkspace(cfg, workspaceRoot); err != nil {
+		return err
+	}
+
 	// Get task ID if specified
 	taskID, err := cmd.Flags().GetString("task")
 	if err != nil {
@@ -106,7 +136,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 	if taskID == "" {
 		// P2.4: NL intake → activation → execution flow
-		outcome, err := runIntakeFlow(cmd, cfg, workspaceRoot, logger)
+		outcome, err := runIntakeFlow(cmd, reader, cfg, workspaceRoot, logger)
 		if err != nil {
 			return err
 		}
@@ -119,10 +149,10 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 		// P2.4 Task B: Execute the approved tasks
 		// Create context and snapshot for execution
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Minute)
 		defer cancel()
 
-		snap, err := snapshot.CaptureSnapshot(workspaceRoot)
+		snap, err := captureSnapshot(workspaceRoot, cfg, logger)
 		if err != nil {
 			return fmt.Errorf("failed to capture snapshot for execution: %w", err)
 		}
@@ -133,7 +163,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 		}
 
 		// Execute approved tasks through scheduler pipeline
-		if err := executeApprovedTasks(ctx, cmd, outcome, cfg, workspaceRoot, snap.SnapshotID, logger); err != nil {
+		if err := executeApprovedTasks(ctx, cmd, reader, outcome, cfg, workspaceRoot, snap.SnapshotID, logger); err != nil {
 			return fmt.Errorf("task execution failed: %w", err)
 		}
 
@@ -153,11 +183,17 @@ func runRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("task %s not found in config", taskID)
 	}
 
-	logger.Info("executing task", "task_id", taskID, "goal", task.Goal)
+	// The task's prerequisites run first
+	graph, err := configTaskGraph(cfg, taskID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("executing task", "task_id", taskID, "goal", task.Goal, "prerequisites", len(graph)-1)
 
 	// P1.3: Capture snapshot
 	logger.Info("capturing workspace snapshot...")
-	snap, err := snapshot.CaptureSnapshot(workspaceRoot)
+	snap, err := captureSnapshot(workspaceRoot, cfg, logger)
 	if err != nil {
 		return fmt.Errorf("failed to capture snapshot: %w", err)
 	}
@@ -189,9 +225,10 @@ func runRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create event log: %w", err)
 	}
 	defer evtLog.Close()
+	defer recordSchemaFindings(evtLog, logger)()
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Minute)
 	defer cancel()
 
 	// Set up execution environment (agents + scheduler)
@@ -200,14 +237,36 @@ func runRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer env.cleanup()
+	env.recordAgents(state)
+	if err := runstate.SaveRunState(state, statePath); err != nil {
+		logger.Warn("failed to save run state", "error", err)
+	}
+
+	tracker := configureUsageAccounting(env.scheduler, cfg, state, statePath, reader, outWriter, logger)
+	env.scheduler.SetOutputsApprover(newOutputsPrompt(reader, outWriter))
 
 	// Execute task
 	logger.Info("starting task execution...")
-	inputs := map[string]any{"goal": task.Goal}
-	if err := env.scheduler.ExecuteTask(ctx, taskID, inputs); err != nil {
-		state.MarkFailed()
-		runstate.SaveRunState(state, statePath)
-		return fmt.Errorf("task execution failed: %w", err)
+	if len(graph) == 1 {
+		inputs := map[string]any{"goal": task.Goal}
+		if err := env.scheduler.ExecuteTask(ctx, taskID, inputs); err != nil {
+			state.MarkFailed()
+			runstate.SaveRunState(state, statePath)
+			return fmt.Errorf("task execution failed: %w", err)
+		}
+	} else {
+		for _, t := range graph {
+			state.AddTask(t.ID, t.Goal, t.DependsOn, map[string]any{"goal": t.Goal})
+		}
+		err := runTaskGraph(ctx, outWriter, state, statePath, logger, func(ctx context.Context, id string, t *runstate.TaskState) error {
+			return env.scheduler.ExecuteTask(ctx, id, t.Inputs)
+		})
+		if err != nil {
+			state.MarkFailed()
+			runstate.SaveRunState(state, statePath)
+			printUsageSummary(outWriter, tracker)
+			return taskGraphError(err, runID, len(graph))
+		}
 	}
 
 	// Mark run complete
@@ -216,6 +275,8 @@ func runRun(cmd *cobra.Command, args []string) error {
 		logger.Warn("failed to save final run state", "error", err)
 	}
 
+	printUsageSummary(outWriter, tracker)
+
 	logger.Info("task execution complete", "run_id", runID)
 	return nil
 }
@@ -250,17 +311,15 @@ type UserDecision struct {
 	CorrelationID string    `json:"correlation_id,omitempty"`
 }
 
-func runIntakeFlow(cmd *cobra.Command, cfg *config.Config, workspaceRoot string, logger *slog.Logger) (*IntakeOutcome, error) {
+func runIntakeFlow(cmd *cobra.Command, reader *bufio.Reader, cfg *config.Config, workspaceRoot string, logger *slog.Logger) (*IntakeOutcome, error) {
 	if cfg.Agents.Orchestration == nil || !cfg.Agents.Orchestration.Enabled {
 		return nil, fmt.Errorf("orchestration agent is not configured or enabled in lorch.json")
 	}
 
-	inputReader := cmd.InOrStdin()
 	outputWriter := cmd.OutOrStdout()
-	reader := bufio.NewReader(inputReader)
 
 	isTTY := false
-	if file, ok := inputReader.(*os.File); ok {
+	if file, ok := cmd.InOrStdin().(*os.File); ok {
 		isTTY = isTerminalFile(file)
 	}
 
@@ -388,7 +447,13 @@ func runIntakeFlow(cmd *cobra.Command, cfg *config.Config, workspaceRoot string,
 	if err != nil {
 		return nil, fmt.Errorf("failed to create intake log: %w", err)
 	}
+	red, err := redactorFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	intakeLog.SetRedactor(red)
 	defer intakeLog.Close()
+	defer recordSchemaFindings(intakeLog, logger)()
 
 	// Create stderr log file for agent diagnostic output - follows spec structure: /logs/<agent>/<run_id>
 	orchLogDir := filepath.Join(workspaceRoot, "logs", "orchestration")
@@ -402,7 +467,17 @@ func runIntakeFlow(cmd *cobra.Command, cfg *config.Config, workspaceRoot string,
 	}
 	defer stderrLogFile.Close()
 
-	orchSupervisor, err := agentSupervisorFactory(cfg.Agents.Orchestration, protocol.AgentTypeOrchestration, logger)
+	orchLogSink, err := agentlog.Open(agentlog.Path(workspaceRoot, protocol.AgentTypeOrchestration, runID),
+		agentlog.Options{Redactor: red}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create orchestration log: %w", err)
+	}
+	defer orchLogSink.Close()
+
+	host := newAgentHost(workspaceRoot, runID, logger)
+	defer host.Close()
+
+	orchSupervisor, err := agentSupervisorFactory(cfg.Agents.Orchestration, protocol.AgentTypeOrchestration, host, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create orchestration supervisor: %w", err)
 	}
@@ -417,8 +492,10 @@ func runIntakeFlow(cmd *cobra.Command, cfg *config.Config, workspaceRoot string,
 			"See docs/AGENT-SHIMS.md for agent configuration details.", err, runID)
 	}
 	defer orchSupervisor.Stop(context.Background())
+	recordAgent(state, protocol.AgentTypeOrchestration, orchSupervisor)
 
 	formatter := transcript.NewFormatter()
+	formatter.SetRedactor(red)
 
 	if err := intakeLog.WriteCommand(command); err != nil {
 		return nil, fmt.Errorf("failed to write intake command: %w", err)
@@ -728,6 +805,9 @@ func runIntakeFlow(cmd *cobra.Command, cfg *config.Config, workspaceRoot string,
 			if err := intakeLog.WriteLog(logMsg); err != nil {
 				return nil, fmt.Errorf("failed to write log message: %w", err)
 			}
+			if err := orchLogSink.Write(logMsg); err != nil {
+				logger.Warn("failed to persist agent log", "type", protocol.AgentTypeOrchestration, "error", err)
+			}
 			fmt.Fprintln(outputWriter, formatter.FormatLog(logMsg))
 
 		case stderrLine, ok := <-stderrLines:
@@ -736,6 +816,7 @@ func runIntakeFlow(cmd *cobra.Command, cfg *config.Config, workspaceRoot string,
 				continue
 			}
 			// Prefix stderr output to distinguish it from lorch output
+			stderrLine = red.Text(stderrLine)
 			prefixed := fmt.Sprintf("[lorch→orchestration] %s", stderrLine)
 			fmt.Fprintln(outputWriter, prefixed)
 
@@ -793,6 +874,7 @@ func runIntakeFlow(cmd *cobra.Command, cfg *config.Config, workspaceRoot string,
 func executeApprovedTasks(
 	ctx context.Context,
 	cmd *cobra.Command,
+	reader *bufio.Reader,
 	outcome *IntakeOutcome,
 	cfg *config.Config,
 	workspaceRoot string,
@@ -813,22 +895,7 @@ func executeApprovedTasks(
 	// Extract derived tasks from finalEvent payload
 	var derivedTasks []derivedTask
 	if outcome.FinalEvent != nil && outcome.FinalEvent.Payload != nil {
-		if rawTasks, ok := outcome.FinalEvent.Payload["derived_tasks"].([]any); ok {
-			for _, raw := range rawTasks {
-				entry, ok := raw.(map[string]any)
-				if !ok {
-					continue
-				}
-				id, _ := entry["id"].(string)
-				title, _ := entry["title"].(string)
-				files := extractStringSlice(entry["files"])
-				derivedTasks = append(derivedTasks, derivedTask{
-					ID:    id,
-					Title: title,
-					Files: files,
-				})
-			}
-		}
+		derivedTasks = parseDerivedTasks(outcome.FinalEvent.Payload["derived_tasks"])
 	}
 
 	// Load run state to check for already-activated tasks (idempotent resume)
@@ -867,6 +934,24 @@ func executeApprovedTasks(
 		return fmt.Errorf("failed to create execution event log: %w", err)
 	}
 	defer evtLog.Close()
+	defer recordSchemaFindings(evtLog, logger)()
+
+	// With policy.concurrency above 1, tasks run side by side, each in its
+	// own git worktree
+	if cfg.Policy.Concurrency > 1 && len(tasks) > 1 {
+		shared := &sharedRunState{state: state, path: statePath, logger: logger}
+		shared.update(func(s *runstate.RunState) {
+			s.RunID = runID
+			s.SnapshotID = snapshotID
+			s.SetStage(runstate.StageImplement)
+			startTaskGraph(s, tasks)
+		})
+		if err := executeTasksInWorktrees(ctx, reader, outputWriter, cfg, workspaceRoot, runID, tasks, shared, evtLog, logger); err != nil {
+			return err
+		}
+		fmt.Fprintf(outputWriter, "Execution transcript: %s\n", eventLogPath)
+		return nil
+	}
 
 	// Set up execution environment
 	env, err := setupExecutionEnvironment(ctx, cfg, workspaceRoot, snapshotID, runID, evtLog, outputWriter, logger)
@@ -880,40 +965,28 @@ func executeApprovedTasks(
 	state.RunID = runID
 	state.SnapshotID = snapshotID
 	state.SetStage(runstate.StageImplement)
+	env.recordAgents(state)
 	if err := runstate.SaveRunState(state, statePath); err != nil {
 		logger.Warn("failed to save run state", "error", err)
 	}
 
-	// Execute each task through scheduler pipeline
-	for i, task := range tasks {
-		fmt.Fprintln(outputWriter)
-		fmt.Fprintf(outputWriter, "Executing task %d/%d: %s (%s)\n", i+1, len(tasks), task.Title, task.ID)
-
-		// Prepare full command inputs
-		inputs := task.ToCommandInputs()
-
-		// P2.4 Task B review finding #2 & resume idempotency:
-		// Persist current task ID and full inputs for idempotent resume
-		state.TaskID = task.ID
-		state.SetCurrentTaskInputs(inputs)
-		if err := runstate.SaveRunState(state, statePath); err != nil {
-			logger.Warn("failed to save run state before task execution", "error", err)
-		}
+	tracker := configureUsageAccounting(env.scheduler, cfg, state, statePath, reader, outputWriter, logger)
+	env.scheduler.SetOutputsApprover(newOutputsPrompt(reader, outputWriter))
 
-		// Execute via scheduler (implement → review → spec-maintainer)
-		if err := env.scheduler.ExecuteTask(ctx, task.ID, inputs); err != nil {
-			state.MarkFailed()
-			runstate.SaveRunState(state, statePath)
-			return fmt.Errorf("task %s execution failed: %w", task.ID, err)
-		}
-
-		// Mark task as activated in run state
-		state.MarkTaskActivated(task.ID)
-		if err := runstate.SaveRunState(state, statePath); err != nil {
-			logger.Warn("failed to save run state", "error", err)
-		}
-
-		fmt.Fprintf(outputWriter, "Task %s completed successfully\n", task.ID)
+	// Execute each task through scheduler pipeline (implement → review →
+	// spec-maintainer) once its prerequisites have completed
+	startTaskGraph(state, tasks)
+	if err := runstate.SaveRunState(state, statePath); err != nil {
+		logger.Warn("failed to save run state", "error", err)
+	}
+	err = runTaskGraph(ctx, outputWriter, state, statePath, logger, func(ctx context.Context, taskID string, task *runstate.TaskState) error {
+		return env.scheduler.ExecuteTask(ctx, taskID, task.Inputs)
+	})
+	if err != nil {
+		state.MarkFailed()
+		runstate.SaveRunState(state, statePath)
+		printUsageSummary(outputWriter, tracker)
+		return taskGraphError(err, runID, len(tasks))
 	}
 
 	// Mark run complete
@@ -924,6 +997,7 @@ func executeApprovedTasks(
 
 	fmt.Fprintln(outputWriter)
 	fmt.Fprintf(outputWriter, "All %d tasks completed successfully\n", len(tasks))
+	printUsageSummary(outputWriter, tracker)
 	fmt.Fprintf(outputWriter, "Execution transcript: %s\n", eventLogPath)
 
 	return nil
@@ -941,9 +1015,10 @@ func buildActivationInput(
 	actDerived := make([]activation.DerivedTask, len(derivedTasks))
 	for i, dt := range derivedTasks {
 		actDerived[i] = activation.DerivedTask{
-			ID:    dt.ID,
-			Title: dt.Title,
-			Files: dt.Files,
+			ID:        dt.ID,
+			Title:     dt.Title,
+			Files:     dt.Files,
+			DependsOn: dt.DependsOn,
 		}
 	}
 
@@ -1112,9 +1187,10 @@ type planCandidate struct {
 }
 
 type derivedTask struct {
-	ID    string
-	Title string
-	Files []string
+	ID        string
+	Title     string
+	Files     []string
+	DependsOn []string
 }
 
 func parsePlanResponse(payload map[string]any) ([]planCandidate, []derivedTask, string, error) {
@@ -1139,29 +1215,37 @@ func parsePlanResponse(payload map[string]any) ([]planCandidate, []derivedTask,
 		})
 	}
 
-	var tasks []derivedTask
-	if rawTasks, ok := payload["derived_tasks"].([]any); ok {
-		tasks = make([]derivedTask, 0, len(rawTasks))
-		for _, raw := range rawTasks {
-			entry, ok := raw.(map[string]any)
-			if !ok {
-				continue
-			}
-			id, _ := entry["id"].(string)
-			title, _ := entry["title"].(string)
-			files := extractStringSlice(entry["files"])
-			tasks = append(tasks, derivedTask{
-				ID:    id,
-				Title: title,
-				Files: files,
-			})
-		}
-	}
+	tasks := parseDerivedTasks(payload["derived_tasks"])
 
 	notes, _ := payload["notes"].(string)
 	return candidates, tasks, notes, nil
 }
 
+// parseDerivedTasks reads the derived_tasks entries of an orchestration
+// payload
+func parseDerivedTasks(v any) []derivedTask {
+	rawTasks, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	tasks := make([]derivedTask, 0, len(rawTasks))
+	for _, raw := range rawTasks {
+		entry, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, _ := entry["id"].(string)
+		title, _ := entry["title"].(string)
+		tasks = append(tasks, derivedTask{
+			ID:        id,
+			Title:     title,
+			Files:     extractStringSlice(entry["files"]),
+			DependsOn: extractStringSlice(entry["depends_on"]),
+		})
+	}
+	return tasks
+}
+
 func toFloat(v any) float64 {
 	switch val := v.(type) {
 	case float64:
@@ -1300,6 +1384,9 @@ func promptTaskSelection(reader *bufio.Reader, w io.Writer, tty bool, tasks []de
 		if len(task.Files) > 0 {
 			fmt.Fprintf(w, "       files: %s\n", strings.Join(task.Files, ", "))
 		}
+		if len(task.DependsOn) > 0 {
+			fmt.Fprintf(w, "       after: %s\n", strings.Join(task.DependsOn, ", "))
+		}
 	}
 
 	for {
@@ -1347,6 +1434,10 @@ func promptTaskSelection(reader *bufio.Reader, w io.Writer, tty bool, tasks []de
 			fmt.Fprintln(w, "Invalid selection. Please try again.")
 			continue
 		}
+		if added := addPrerequisites(tasks, approved); len(added) > len(approved) {
+			fmt.Fprintf(w, "Also selecting prerequisites: %s\n", strings.Join(added[len(approved):], ", "))
+			approved = added
+		}
 		return approved, nil
 	}
 }
@@ -1369,6 +1460,29 @@ func parseNumberList(input string) ([]int, error) {
 	return result, nil
 }
 
+// addPrerequisites appends the derived tasks the selected ones depend on,
+// directly or not, that are not selected yet
+func addPrerequisites(tasks []derivedTask, selected []string) []string {
+	byID := make(map[string]derivedTask, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	chosen := make(map[string]bool, len(selected))
+	for _, id := range selected {
+		chosen[id] = true
+	}
+	result := append([]string(nil), selected...)
+	for i := 0; i < len(result); i++ {
+		for _, dep := range byID[result[i]].DependsOn {
+			if _, known := byID[dep]; known && !chosen[dep] {
+				chosen[dep] = true
+				result = append(result, dep)
+			}
+		}
+	}
+	return result
+}
+
 func collectAllTaskIDs(tasks []derivedTask) []string {
 	ids := make([]string, 0, len(tasks))
 	for _, task := range tasks {
@@ -1592,10 +1706,47 @@ func isTerminalFile(f *os.File) bool {
 type executionEnvironment struct {
 	scheduler *scheduler.Scheduler
 	cleanup   func()
+	agents    map[protocol.AgentType]*supervisor.AgentSupervisor
+}
+
+// recordAgents copies the agents' handshake outcomes and processes into run
+// state
+func (env *executionEnvironment) recordAgents(state *runstate.RunState) {
+	for agentType, sup := range env.agents {
+		recordAgent(state, agentType, sup)
+	}
+}
+
+// negotiator is implemented by supervisors that perform the hello handshake
+type negotiator interface {
+	Negotiation() *protocol.Negotiation
+}
+
+// processReporter is implemented by supervisors that run a local process
+type processReporter interface {
+	Process() (supervisor.ProcessInfo, bool)
+}
+
+// recordAgent stores sup's handshake outcome and process in run state when
+// sup has them
+func recordAgent(state *runstate.RunState, agentType protocol.AgentType, sup agentSupervisor) {
+	if n, ok := sup.(negotiator); ok {
+		state.RecordNegotiation(string(agentType), n.Negotiation())
+	}
+	if p, ok := sup.(processReporter); ok {
+		if info, running := p.Process(); running {
+			state.RecordProcess(string(agentType), &runstate.AgentProcess{
+				PID:        info.PID,
+				PGID:       info.PGID,
+				StartTicks: info.StartTicks,
+				StartedAt:  info.StartedAt,
+			})
+		}
+	}
 }
 
 // startAgentStderrConsumer starts a goroutine to consume and display stderr from an agent
-func startAgentStderrConsumer(ctx context.Context, sup *supervisor.AgentSupervisor, agentType protocol.AgentType, workspaceRoot, runID string, outputWriter io.Writer) error {
+func startAgentStderrConsumer(ctx context.Context, sup *supervisor.AgentSupervisor, agentType protocol.AgentType, workspaceRoot, runID string, outputWriter io.Writer, red *redact.Redactor) error {
 	// Create stderr log file for this agent - follows spec structure: /logs/<agent>/<run_id>
 	agentLogDir := filepath.Join(workspaceRoot, "logs", string(agentType))
 	stderrLogPath := filepath.Join(agentLogDir, fmt.Sprintf("%s-stderr.log", runID))
@@ -1620,6 +1771,7 @@ func startAgentStderrConsumer(ctx context.Context, sup *supervisor.AgentSupervis
 					return
 				}
 				// Prefix stderr output to distinguish it
+				line = red.Text(line)
 				prefixed := fmt.Sprintf("[lorch→%s] %s", agentType, line)
 				fmt.Fprintln(outputWriter, prefixed)
 
@@ -1632,6 +1784,35 @@ func startAgentStderrConsumer(ctx context.Context, sup *supervisor.AgentSupervis
 	return nil
 }
 
+// startAgentLogSink starts a goroutine that writes the agent's structured log
+// messages to logs/<agent>/<run_id>.ndjson
+func startAgentLogSink(ctx context.Context, sup agentSupervisor, agentType protocol.AgentType, workspaceRoot, runID string, red *redact.Redactor, logger *slog.Logger) error {
+	sink, err := agentlog.Open(agentlog.Path(workspaceRoot, agentType, runID), agentlog.Options{Redactor: red}, logger)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer sink.Close()
+		logs := sup.Logs()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-logs:
+				if !ok {
+					return
+				}
+				if err := sink.Write(msg); err != nil {
+					logger.Warn("failed to persist agent log", "type", agentType, "error", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
 // setupExecutionEnvironment creates agents, scheduler, and returns a cleanup function.
 // This is used by both --task mode and P2.4 intake-derived task execution.
 func setupExecutionEnvironment(
@@ -1644,18 +1825,62 @@ func setupExecutionEnvironment(
 	outputWriter io.Writer,
 	logger *slog.Logger,
 ) (*executionEnvironment, error) {
+	// Agents work on the run's branch in git mode
+	committer, err := startGitMode(cfg, workspaceRoot, runID, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := startExecutionEnvironment(ctx, cfg, newAgentHost(workspaceRoot, runID, logger), snapshotID, eventLog, outputWriter, logger)
+	if err != nil {
+		return nil, err
+	}
+	if committer != nil {
+		env.scheduler.SetStepCommitter(committer)
+	}
+	return env, nil
+}
+
+// startExecutionEnvironment starts the agents of host's workspace and a
+// scheduler driving them. The host is closed by the returned cleanup, or on
+// failure.
+func startExecutionEnvironment(
+	ctx context.Context,
+	cfg *config.Config,
+	host *agentHost,
+	snapshotID string,
+	eventLog *eventlog.EventLog,
+	outputWriter io.Writer,
+	logger *slog.Logger,
+) (*executionEnvironment, error) {
+	workspaceRoot, runID := host.workspaceRoot, host.runID
+
+	red, err := redactorFor(cfg)
+	if err != nil {
+		host.Close()
+		return nil, err
+	}
+	eventLog.SetRedactor(red)
+
+	ready := false
+	defer func() {
+		if !ready {
+			host.Close()
+		}
+	}()
+
 	// Create agent supervisors
-	builderSup, err := agentSupervisorFactory(cfg.Agents.Builder, protocol.AgentTypeBuilder, logger)
+	builderSup, err := agentSupervisorFactory(cfg.Agents.Builder, protocol.AgentTypeBuilder, host, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create builder supervisor: %w", err)
 	}
 
-	reviewerSup, err := agentSupervisorFactory(cfg.Agents.Reviewer, protocol.AgentTypeReviewer, logger)
+	reviewerSup, err := agentSupervisorFactory(cfg.Agents.Reviewer, protocol.AgentTypeReviewer, host, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create reviewer supervisor: %w", err)
 	}
 
-	specMaintainerSup, err := agentSupervisorFactory(cfg.Agents.SpecMaintainer, protocol.AgentTypeSpecMaintainer, logger)
+	specMaintainerSup, err := agentSupervisorFactory(cfg.Agents.SpecMaintainer, protocol.AgentTypeSpecMaintainer, host, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create spec maintainer supervisor: %w", err)
 	}
@@ -1684,7 +1909,7 @@ func setupExecutionEnvironment(
 			"Check logs/builder/%s-stderr.log for agent diagnostics.\n"+
 			"See docs/AGENT-SHIMS.md for agent configuration details.", err, runID)
 	}
-	if err := startAgentStderrConsumer(ctx, builder, protocol.AgentTypeBuilder, workspaceRoot, runID, outputWriter); err != nil {
+	if err := startAgentStderrConsumer(ctx, builder, protocol.AgentTypeBuilder, workspaceRoot, runID, outputWriter, red); err != nil {
 		builder.Stop(context.Background())
 		return nil, fmt.Errorf("failed to start builder stderr consumer: %w", err)
 	}
@@ -1693,7 +1918,7 @@ func setupExecutionEnvironment(
 		builder.Stop(context.Background())
 		return nil, fmt.Errorf("failed to start reviewer: %w", err)
 	}
-	if err := startAgentStderrConsumer(ctx, reviewer, protocol.AgentTypeReviewer, workspaceRoot, runID, outputWriter); err != nil {
+	if err := startAgentStderrConsumer(ctx, reviewer, protocol.AgentTypeReviewer, workspaceRoot, runID, outputWriter, red); err != nil {
 		builder.Stop(context.Background())
 		reviewer.Stop(context.Background())
 		return nil, fmt.Errorf("failed to start reviewer stderr consumer: %w", err)
@@ -1704,39 +1929,94 @@ func setupExecutionEnvironment(
 		reviewer.Stop(context.Background())
 		return nil, fmt.Errorf("failed to start spec maintainer: %w", err)
 	}
-	if err := startAgentStderrConsumer(ctx, specMaintainer, protocol.AgentTypeSpecMaintainer, workspaceRoot, runID, outputWriter); err != nil {
+	if err := startAgentStderrConsumer(ctx, specMaintainer, protocol.AgentTypeSpecMaintainer, workspaceRoot, runID, outputWriter, red); err != nil {
 		builder.Stop(context.Background())
 		reviewer.Stop(context.Background())
 		specMaintainer.Stop(context.Background())
 		return nil, fmt.Errorf("failed to start spec maintainer stderr consumer: %w", err)
 	}
 
+	for agentType, sup := range map[protocol.AgentType]*supervisor.AgentSupervisor{
+		protocol.AgentTypeBuilder:        builder,
+		protocol.AgentTypeReviewer:       reviewer,
+		protocol.AgentTypeSpecMaintainer: specMaintainer,
+	} {
+		if err := startAgentLogSink(ctx, sup, agentType, workspaceRoot, runID, red, logger); err != nil {
+			builder.Stop(context.Background())
+			reviewer.Stop(context.Background())
+			specMaintainer.Stop(context.Background())
+			return nil, fmt.Errorf("failed to start %s log sink: %w", agentType, err)
+		}
+	}
+
 	// Create scheduler
 	sched := scheduler.NewScheduler(builder, reviewer, specMaintainer, logger)
 	sched.SetSnapshotID(snapshotID)
 	sched.SetWorkspaceRoot(workspaceRoot)
+	sched.SetArtifactMaxBytes(int64(cfg.Policy.ArtifactMaxBytes))
+	sched.SetSnapshotScope(cfg.Snapshot.Scope())
+	sched.SetSnapshotBlobs(cfg.Snapshot.KeepBlobs())
+	sched.SetStrictVersionPinning(cfg.Policy.StrictVersionPinning)
 	sched.SetEventLogger(eventLog)
-	sched.SetTranscriptFormatter(transcript.NewFormatter())
+	formatter := transcript.NewFormatter()
+	formatter.SetRedactor(red)
+	sched.SetTranscriptFormatter(formatter)
+	sched.SetRedactor(red)
 
 	// Create cleanup function
 	cleanup := func() {
 		builder.Stop(context.Background())
 		reviewer.Stop(context.Background())
 		specMaintainer.Stop(context.Background())
+		host.Close()
 	}
 
+	ready = true
 	return &executionEnvironment{
 		scheduler: sched,
 		cleanup:   cleanup,
+		agents: map[protocol.AgentType]*supervisor.AgentSupervisor{
+			protocol.AgentTypeBuilder:        builder,
+			protocol.AgentTypeReviewer:       reviewer,
+			protocol.AgentTypeSpecMaintainer: specMaintainer,
+		},
 	}, nil
 }
 
+// interruptible makes cmd's context end on Ctrl-C or SIGTERM, so the
+// in-flight agent command is cancelled and recorded in its receipt instead
+// of the agents simply being killed
+func interruptible(cmd *cobra.Command) context.CancelFunc {
+	parent := cmd.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	cmd.SetContext(ctx)
+	return stop
+}
+
 // realAgentSupervisorFactory creates an agent supervisor from config
-func realAgentSupervisorFactory(agentCfg *config.AgentConfig, agentType protocol.AgentType, logger *slog.Logger) (agentSupervisor, error) {
+func realAgentSupervisorFactory(agentCfg *config.AgentConfig, agentType protocol.AgentType, host *agentHost, logger *slog.Logger) (agentSupervisor, error) {
 	if agentCfg == nil {
 		return nil, fmt.Errorf("agent config for %s is nil", agentType)
 	}
 
+	// Agent daemons connect to the run's socket instead of being started
+	if agentCfg.Transport == config.TransportUnix {
+		listener, err := host.listener()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open agent socket for %s: %w", agentType, err)
+		}
+		sup := supervisor.NewAgentSupervisor(agentType, agentCfg.Cmd, agentCfg.Env, logger)
+		if grace := agentCfg.TimeoutsS["cancel_grace"]; grace > 0 {
+			sup.SetCancelGracePeriod(time.Duration(grace) * time.Second)
+		}
+		timeout := time.Duration(agentCfg.TimeoutsS["connect"]) * time.Second
+		sup.SetTransport(listener.Transport(agentType, timeout))
+		return sup, nil
+	}
+
 	// Validate command exists and is executable
 	if len(agentCfg.Cmd) == 0 {
 		return nil, fmt.Errorf("agent %s has no command configured", agentType)
@@ -1758,7 +2038,38 @@ func realAgentSupervisorFactory(agentCfg *config.AgentConfig, agentType protocol
 			agentType, cmdPath, cmdPath, agentType)
 	}
 
-	return supervisor.NewAgentSupervisor(agentType, agentCfg.Cmd, agentCfg.Env, logger), nil
+	sup := supervisor.NewAgentSupervisor(agentType, agentCfg.Cmd, agentCfg.Env, logger)
+	if grace := agentCfg.TimeoutsS["cancel_grace"]; grace > 0 {
+		sup.SetCancelGracePeriod(time.Duration(grace) * time.Second)
+	}
+	if host.workDir != "" {
+		sup.SetWorkDir(host.workDir)
+	}
+	if l := agentCfg.Limits; l != nil {
+		sup.SetLimits(supervisor.Limits{
+			MemoryBytes:  int64(l.MemoryMB) << 20,
+			CPUPercent:   l.CPUPercent,
+			MaxProcs:     l.MaxProcs,
+			MaxOpenFiles: l.MaxOpenFiles,
+			WallTime:     time.Duration(l.WallTimeS) * time.Second,
+		})
+	}
+	if sb := agentCfg.Sandbox; sb != nil && sb.Enabled {
+		readOnly := sb.Workspace == "ro" || (sb.Workspace == "" && agentType == protocol.AgentTypeReviewer)
+		writable := append([]string(nil), sb.WritablePaths...)
+		if readOnly && agentType == protocol.AgentTypeReviewer {
+			// Reviewers still record their reviews in the workspace
+			writable = append(writable, filepath.Join(host.workspaceRoot, "reviews"))
+		}
+		sup.SetSandbox(supervisor.Sandbox{
+			Workspace:     host.workspaceRoot,
+			ReadOnly:      readOnly,
+			Network:       sb.Network,
+			EnvAllowlist:  sb.EnvAllowlist,
+			WritablePaths: writable,
+		})
+	}
+	return sup, nil
 }
 
 // loadOrCreateConfig finds an existing config or creates a new one
@@ -1847,6 +2158,29 @@ func findConfigInTree() (string, error) {
 	return "", nil
 }
 
+// captureSnapshot captures the workspace with the configured scope, reusing
+// and then updating the stat cache under state/. With snapshot.blobs set,
+// the content of the snapshotted files is kept in the blob store.
+func captureSnapshot(workspaceRoot string, cfg *config.Config, logger *slog.Logger) (*snapshot.Manifest, error) {
+	cache := snapshot.LoadStatCache(snapshot.GetStatCachePath(workspaceRoot))
+	snap, err := snapshot.CaptureCached(workspaceRoot, cfg.Snapshot.Scope(), cache)
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.Save(); err != nil {
+		logger.Warn("failed to save snapshot stat cache", "error", err)
+	}
+
+	if cfg.Snapshot.KeepBlobs() {
+		stored, err := snapshot.StoreBlobs(workspaceRoot, snap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store snapshot content: %w", err)
+		}
+		logger.Info("snapshot content stored", "new_blobs", stored)
+	}
+	return snap, nil
+}
+
 // determineWorkspaceRoot resolves the workspace root relative to the config file
 // Following the decision: resolve relative to directory containing lorch.json
 func determineWorkspaceRoot(cfg *config.Config, configPath string) string {
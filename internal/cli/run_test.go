@@ -16,8 +16,13 @@ import (
 	"time"
 
 	"github.com/iambrandonn/lorch/internal/config"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/eventlog"
+	"github.com/iambrandonn/lorch/internal/ledger"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/internal/supervisor"
 	"github.com/iambrandonn/lorch/internal/workspace"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 )
@@ -120,6 +125,22 @@ func TestPromptTaskSelectionNonTTY(t *testing.T) {
 	require.Contains(t, out.String(), "Select tasks")
 }
 
+func TestPromptTaskSelectionAddsPrerequisites(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("3\n"))
+	var out bytes.Buffer
+	tasks := []derivedTask{
+		{ID: "T-100", Title: "Schema"},
+		{ID: "T-101", Title: "Handlers", DependsOn: []string{"T-100"}},
+		{ID: "T-102", Title: "Docs", DependsOn: []string{"T-101"}},
+	}
+
+	selected, err := promptTaskSelection(reader, &out, false, tasks)
+	require.NoError(t, err)
+	require.Equal(t, []string{"T-102", "T-101", "T-100"}, selected)
+	require.Contains(t, out.String(), "after: T-101")
+	require.Contains(t, out.String(), "Also selecting prerequisites: T-101, T-100")
+}
+
 func TestRunIntakeFlowSuccess(t *testing.T) {
 	binary := buildHelperBinary(t, "./cmd/claude-fixture")
 	fixturePath := filepath.Join(repoRoot(t), "testdata", "fixtures", "orchestration-simple.json")
@@ -146,7 +167,7 @@ func TestRunIntakeFlowSuccess(t *testing.T) {
 	command.SetOut(&output)
 	command.SetErr(&output)
 
-	outcome, err := runIntakeFlow(command, cfg, workspaceRoot, logger)
+	outcome, err := runIntakeFlow(command, bufio.NewReader(command.InOrStdin()), cfg, workspaceRoot, logger)
 	require.NoError(t, err, output.String())
 	require.NotNil(t, outcome)
 	require.Equal(t, "Manage PLAN.md", outcome.Instruction)
@@ -189,7 +210,7 @@ func TestRunIntakeFlowRequiresInstruction(t *testing.T) {
 	command.SetOut(io.Discard)
 	command.SetErr(io.Discard)
 
-	result, err := runIntakeFlow(command, cfg, t.TempDir(), logger)
+	result, err := runIntakeFlow(command, bufio.NewReader(command.InOrStdin()), cfg, t.TempDir(), logger)
 	require.Error(t, err)
 	require.Nil(t, result)
 	require.Contains(t, err.Error(), "instruction required")
@@ -227,7 +248,7 @@ func TestRunIntakeFlowContextCancellation(t *testing.T) {
 	}
 	resultCh := make(chan result, 1)
 	go func() {
-		out, err := runIntakeFlow(command, cfg, workspaceRoot, logger)
+		out, err := runIntakeFlow(command, bufio.NewReader(command.InOrStdin()), cfg, workspaceRoot, logger)
 		resultCh <- result{outcome: out, err: err}
 	}()
 
@@ -304,3 +325,84 @@ func buildSlowFixture(t *testing.T) string {
 	require.NoError(t, os.WriteFile(path, data, 0o644))
 	return path
 }
+
+func TestSchemaViolationsRecordedInLedger(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.GenerateDefault()
+	cfg.Policy.SchemaValidation = "warn"
+	require.NoError(t, configureSchemaValidation(cfg, logger))
+	t.Cleanup(func() { schema.SetDefaultEnforcer(nil) })
+
+	ledgerPath := filepath.Join(t.TempDir(), "events", "run.ndjson")
+	evtLog, err := eventlog.NewEventLog(ledgerPath, logger)
+	require.NoError(t, err)
+
+	stop := recordSchemaFindings(evtLog, logger)
+	bad := []byte(`{"kind":"heartbeat","agent":{"agent_type":"builder"},"seq":1,"status":"sleeping","pid":1,"uptime_s":0,"last_activity_at":"2025-10-20T14:08:18Z"}`)
+	require.NoError(t, schema.DefaultEnforcer().Check("builder", schema.Heartbeat, bad))
+	stop()
+	require.NoError(t, evtLog.Close())
+
+	l, err := ledger.ReadLedger(ledgerPath)
+	require.NoError(t, err)
+	require.Len(t, l.Logs, 1)
+
+	entry := l.Logs[0]
+	require.Equal(t, protocol.LogLevelWarn, entry.Level)
+	require.Equal(t, "schema violation", entry.Message)
+	require.Equal(t, "heartbeat", entry.Fields["schema"])
+	require.Equal(t, "builder", entry.Fields["source"])
+	violations, ok := entry.Fields["violations"].([]any)
+	require.True(t, ok)
+	require.Len(t, violations, 1)
+	require.Equal(t, "$.status", violations[0].(map[string]any)["path"])
+}
+
+func TestReapOrphansStopsSurvivingAgents(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Stands in for an agent left behind by a lorch that died
+	sup := supervisor.NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", "sleep 300"}, nil, logger)
+	sup.SetHandshakeTimeout(50 * time.Millisecond)
+	require.NoError(t, sup.Start(context.Background()))
+	defer sup.Stop(context.Background())
+
+	state := runstate.NewRunState("run-1", "T-0001", "snap-1")
+	recordAgent(state, protocol.AgentTypeBuilder, sup)
+	require.Contains(t, state.Processes, string(protocol.AgentTypeBuilder))
+	info, _ := sup.Process()
+
+	reapOrphans(context.Background(), state, logger)
+
+	require.Nil(t, state.Processes, "reaped processes should be forgotten")
+	require.False(t, supervisor.Survives(info), "orphaned agent should have been stopped")
+}
+
+func TestUnixTransportAgentUsesRunSocket(t *testing.T) {
+	workspace := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	host := newAgentHost(workspace, "run-socket", logger)
+	defer host.Close()
+
+	agentCfg := &config.AgentConfig{Transport: config.TransportUnix, TimeoutsS: map[string]int{"connect": 1}}
+	sup, err := realAgentSupervisorFactory(agentCfg, protocol.AgentTypeBuilder, host, logger)
+	require.NoError(t, err)
+	require.NotNil(t, sup)
+
+	socketPath := filepath.Join(workspace, "state", "run-socket.sock")
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&os.ModeSocket)
+
+	target, err := os.Readlink(filepath.Join(workspace, "state", agentsSocketLink))
+	require.NoError(t, err)
+	require.Equal(t, "run-socket.sock", target)
+
+	// No daemon connects, so starting the agent times out
+	err = sup.Start(context.Background())
+	require.ErrorContains(t, err, "no builder agent connected")
+
+	require.NoError(t, host.Close())
+	_, err = os.Stat(socketPath)
+	require.True(t, os.IsNotExist(err), "socket should be removed on close")
+}
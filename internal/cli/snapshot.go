@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+	"github.com/iambrandonn/lorch/internal/ledger"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/internal/textdiff"
+	"github.com/iambrandonn/lorch/internal/transcript"
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Inspect workspace snapshots",
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff <snapshot-a> <snapshot-b> | --run <id> --step <n>",
+	Short: "Show the files that changed between two snapshots",
+	Long: `List the files added, removed and modified between two snapshot manifests,
+with their sizes, followed by unified diffs of their content.
+
+Content comes from the blob store under snapshots/blobs/ ("snapshot":
+{"blobs": true} in lorch.json), or else from git (HEAD and the index) or the
+working tree when they still hold the same content. Files whose content is
+not available are only listed.
+
+With --run and --step, the step's command snapshot is compared with the
+snapshot captured after it; builder steps record both in their receipt.
+
+  lorch snapshot diff snap-0123456789ab snap-ba9876543210
+  lorch snapshot diff --run run-20251019-... --step 1 --stat`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: runSnapshotDiff,
+}
+
+func init() {
+	snapshotDiffCmd.Flags().StringP("run", "r", "", "Run whose step to diff")
+	snapshotDiffCmd.Flags().Int("step", 0, "Step number, with --run")
+	snapshotDiffCmd.Flags().String("task", "", "Task of the step, when several tasks of the run have that step")
+	snapshotDiffCmd.Flags().Bool("stat", false, "Only list the changed files")
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+	rootCmd.AddCommand(snapshotCmd)
+}
+
+func runSnapshotDiff(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	runID, err := flags.GetString("run")
+	if err != nil {
+		return err
+	}
+	step, err := flags.GetInt("step")
+	if err != nil {
+		return err
+	}
+	taskID, err := flags.GetString("task")
+	if err != nil {
+		return err
+	}
+	statOnly, err := flags.GetBool("stat")
+	if err != nil {
+		return err
+	}
+
+	workspaceRoot, err := locateWorkspaceRoot(cmd)
+	if err != nil {
+		return err
+	}
+
+	var fromID, toID string
+	switch {
+	case runID != "":
+		if len(args) > 0 || step <= 0 {
+			return fmt.Errorf("--run needs --step and no snapshot arguments")
+		}
+		rec, err := findStepReceipt(workspaceRoot, runID, taskID, step)
+		if err != nil {
+			return err
+		}
+		if rec.PostSnapshotID == "" {
+			return fmt.Errorf("step %d of run %s (%s %s) has no post-step snapshot; only builder steps capture one", step, runID, rec.TaskID, rec.Action)
+		}
+		fromID, toID = rec.SnapshotID, rec.PostSnapshotID
+	case len(args) == 2:
+		fromID, toID = args[0], args[1]
+	default:
+		return fmt.Errorf("pass two snapshot IDs, or --run and --step")
+	}
+
+	from, err := loadManifest(workspaceRoot, fromID)
+	if err != nil {
+		return err
+	}
+	to, err := loadManifest(workspaceRoot, toID)
+	if err != nil {
+		return err
+	}
+
+	changes := snapshot.Diff(from, to)
+	out := cmd.OutOrStdout()
+	printSnapshotDiff(out, from.SnapshotID, to.SnapshotID, changes)
+	if !statOnly {
+		printUnifiedDiffs(out, changes, contentSource(workspaceRoot))
+	}
+	return nil
+}
+
+func loadManifest(workspaceRoot, snapshotID string) (*snapshot.Manifest, error) {
+	manifest, err := snapshot.LoadSnapshot(filepath.Join(workspaceRoot, "snapshots", snapshotID+".manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s not found: %w", snapshotID, err)
+	}
+	return manifest, nil
+}
+
+// findStepReceipt returns the receipt of a step of the run, optionally
+// restricted to one task
+func findStepReceipt(workspaceRoot, runID, taskID string, step int) (*receipt.Receipt, error) {
+	lg, err := ledger.ReadLedger(filepath.Join(workspaceRoot, "events", runID+".ndjson"))
+	if err != nil {
+		return nil, fmt.Errorf("no ledger for run %s: %w", runID, err)
+	}
+	commands := make(map[string]bool, len(lg.Commands))
+	var tasks []string
+	for _, c := range lg.Commands {
+		commands[c.MessageID] = true
+		if (taskID == "" || c.TaskID == taskID) && !slices.Contains(tasks, c.TaskID) {
+			tasks = append(tasks, c.TaskID)
+		}
+	}
+
+	var found []*receipt.Receipt
+	for _, task := range tasks {
+		rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspaceRoot, task, step))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if commands[rec.CommandMessageID] {
+			found = append(found, rec)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("run %s has no receipt for step %d", runID, step)
+	case 1:
+		return found[0], nil
+	}
+	var names []string
+	for _, rec := range found {
+		names = append(names, rec.TaskID)
+	}
+	return nil, fmt.Errorf("step %d of run %s exists for tasks %s; pass --task", step, runID, strings.Join(names, ", "))
+}
+
+// printSnapshotDiff lists the changed files with their sizes
+func printSnapshotDiff(w io.Writer, fromID, toID string, changes []snapshot.FileChange) {
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.Change]++
+	}
+	fmt.Fprintf(w, "%s → %s: %d added, %d modified, %d removed\n", fromID, toID,
+		counts[snapshot.ChangeAdded], counts[snapshot.ChangeModified], counts[snapshot.ChangeRemoved])
+
+	formatter := transcript.NewFormatter()
+	for _, c := range changes {
+		fmt.Fprintf(w, "  %s\n", formatter.FormatChange(c))
+	}
+}
+
+// printUnifiedDiffs prints a unified diff for each changed file whose
+// content is available
+func printUnifiedDiffs(w io.Writer, changes []snapshot.FileChange, content func(path, sha256 string) ([]byte, bool)) {
+	for _, c := range changes {
+		fromLabel, toLabel := "a/"+c.Path, "b/"+c.Path
+		var before, after []byte
+		available := true
+		if c.From != nil {
+			before, available = content(c.Path, c.From.SHA256)
+		} else {
+			fromLabel = "/dev/null"
+		}
+		if c.To != nil && available {
+			after, available = content(c.Path, c.To.SHA256)
+		} else if c.To == nil {
+			toLabel = "/dev/null"
+		}
+
+		fmt.Fprintln(w)
+		if !available {
+			fmt.Fprintf(w, "%s: content not available (enable snapshot.blobs to keep it)\n", c.Path)
+			continue
+		}
+		fmt.Fprint(w, textdiff.Unified(fromLabel, toLabel, before, after))
+	}
+}
+
+// contentSource looks up a file's content by checksum in the blob store,
+// then in git's HEAD and index, then in the working tree. Only content
+// matching the checksum is returned.
+func contentSource(workspaceRoot string) func(path, sha256 string) ([]byte, bool) {
+	return func(path, sha256 string) ([]byte, bool) {
+		if content, err := snapshot.ReadBlob(workspaceRoot, sha256); err == nil {
+			return content, true
+		}
+		for _, rev := range []string{"HEAD:./", ":./"} {
+			content, err := exec.Command("git", "-C", workspaceRoot, "show", rev+path).Output()
+			if err == nil && checksum.SHA256Bytes(content) == sha256 {
+				return content, true
+			}
+		}
+		content, err := os.ReadFile(filepath.Join(workspaceRoot, filepath.FromSlash(path)))
+		if err == nil && checksum.SHA256Bytes(content) == sha256 {
+			return content, true
+		}
+		return nil, false
+	}
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotDiffCommand(t *testing.T) {
+	workspace := t.TempDir()
+	configPath := filepath.Join(workspace, "lorch.json")
+	require.NoError(t, config.GenerateDefault().SaveToFile(configPath))
+	write := func(rel, content string) {
+		path := filepath.Join(workspace, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	capture := func() *snapshot.Manifest {
+		snap, err := snapshot.CaptureSnapshot(workspace)
+		require.NoError(t, err)
+		require.NoError(t, snapshot.SaveSnapshot(snap, filepath.Join(workspace, "snapshots", snap.SnapshotID+".manifest.json")))
+		_, err = snapshot.StoreBlobs(workspace, snap)
+		require.NoError(t, err)
+		return snap
+	}
+
+	write("src/main.go", "package main\n\nfunc main() {}\n")
+	write("src/old.go", "package main\n")
+	pre := capture()
+	write("src/main.go", "package main\n\nfunc main() { run() }\n")
+	write("src/new.go", "package main\n\nfunc run() {}\n")
+	require.NoError(t, os.Remove(filepath.Join(workspace, "src", "old.go")))
+	post := capture()
+
+	// A builder step of run-diff went from pre to post
+	cmdMsg := protocol.Command{Kind: protocol.MessageKindCommand, MessageID: "cmd-1", CorrelationID: "corr-1", TaskID: "T-1", Action: protocol.ActionImplement}
+	line, err := json.Marshal(cmdMsg)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(workspace, "events"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "events", "run-diff.ndjson"), append(line, '\n'), 0o644))
+	require.NoError(t, receipt.WriteReceipt(&receipt.Receipt{
+		TaskID: "T-1", Step: 1, Action: string(protocol.ActionImplement), IdempotencyKey: "ik:" + strings.Repeat("0", 64),
+		SnapshotID: pre.SnapshotID, PostSnapshotID: post.SnapshotID, CommandMessageID: "cmd-1",
+		CorrelationID: "corr-1", Artifacts: []protocol.Artifact{}, Events: []string{}, CreatedAt: time.Now().UTC(),
+	}, receipt.GetReceiptPath(workspace, "T-1", 1)))
+
+	diff := func(args []string, flags map[string]string) (string, error) {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("config", configPath, "")
+		cmd.Flags().AddFlagSet(snapshotDiffCmd.LocalFlags())
+		cmd.Flags().Set("run", "")
+		cmd.Flags().Set("step", "0")
+		cmd.Flags().Set("stat", "false")
+		for name, value := range flags {
+			require.NoError(t, cmd.Flags().Set(name, value))
+		}
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		err := runSnapshotDiff(cmd, args)
+		return out.String(), err
+	}
+
+	want := pre.SnapshotID + " → " + post.SnapshotID + ": 1 added, 1 modified, 1 removed\n" +
+		"  M src/main.go (29 B → 36 B)\n" +
+		"  A src/new.go (28 B)\n" +
+		"  D src/old.go (13 B)\n"
+
+	out, err := diff([]string{pre.SnapshotID, post.SnapshotID}, map[string]string{"stat": "true"})
+	require.NoError(t, err)
+	require.Equal(t, want, out)
+
+	out, err = diff(nil, map[string]string{"run": "run-diff", "step": "1"})
+	require.NoError(t, err)
+	require.Contains(t, out, want)
+	require.Contains(t, out, "--- a/src/main.go\n+++ b/src/main.go\n@@ -1,3 +1,3 @@\n package main\n \n-func main() {}\n+func main() { run() }\n")
+	require.Contains(t, out, "--- /dev/null\n+++ b/src/new.go\n")
+	require.Contains(t, out, "--- a/src/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-package main\n")
+
+	_, err = diff(nil, map[string]string{"run": "run-diff", "step": "2"})
+	require.ErrorContains(t, err, "run run-diff has no receipt for step 2")
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/activation"
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/taskgraph"
+)
+
+// taskRunner executes one task of the run's graph with its recorded inputs
+type taskRunner func(ctx context.Context, taskID string, task *runstate.TaskState) error
+
+// startTaskGraph replaces the run's task graph with tasks, all pending
+func startTaskGraph(state *runstate.RunState, tasks []activation.Task) {
+	state.Tasks = nil
+	state.TaskOrder = nil
+	for _, task := range tasks {
+		state.AddTask(task.ID, task.Title, task.DependsOn, task.ToCommandInputs())
+	}
+}
+
+// configTaskGraph returns the configured task with its prerequisites,
+// directly or not, in the order they run
+func configTaskGraph(cfg *config.Config, taskID string) ([]config.Task, error) {
+	ids, deps := cfg.TaskDependencies()
+	closure, err := taskgraph.Closure(taskID, ids, deps)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]config.Task, len(cfg.Tasks))
+	for _, task := range cfg.Tasks {
+		byID[task.ID] = task
+	}
+	tasks := make([]config.Task, 0, len(closure))
+	for _, id := range closure {
+		tasks = append(tasks, byID[id])
+	}
+	return tasks, nil
+}
+
+// taskDependencies maps the run's unfinished tasks to their unfinished
+// prerequisites; completed ones, and ones outside the run, are satisfied
+func taskDependencies(state *runstate.RunState) ([]string, map[string][]string) {
+	ids := state.UnfinishedTasks()
+	deps := make(map[string][]string, len(ids))
+	for _, id := range ids {
+		for _, dep := range state.Tasks[id].DependsOn {
+			if task, ok := state.Tasks[dep]; ok && task.Status != runstate.TaskCompleted {
+				deps[id] = append(deps[id], dep)
+			}
+		}
+	}
+	return ids, deps
+}
+
+// runTaskGraph executes the run's unfinished tasks one at a time, each after
+// its prerequisites. A failed task's dependents are skipped while unrelated
+// tasks still run. Every task's status is saved as it changes; a task cut
+// short by ctx stays running, for resume to pick up where it stopped.
+func runTaskGraph(ctx context.Context, out io.Writer, state *runstate.RunState, statePath string, logger *slog.Logger, run taskRunner) error {
+	save := func() {
+		if err := runstate.SaveRunState(state, statePath); err != nil {
+			logger.Warn("failed to save run state", "error", err)
+		}
+	}
+
+	ids, deps := taskDependencies(state)
+	n := 0
+	err := taskgraph.Execute(ctx, ids, deps, func(ctx context.Context, id string) error {
+		n++
+		task := state.Tasks[id]
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Executing task %d/%d: %s (%s)\n", n, len(ids), task.Title, id)
+
+		// Persist the current task and its full inputs for idempotent resume
+		state.TaskID = id
+		state.SetCurrentTaskInputs(task.Inputs)
+		state.SetTaskStatus(id, runstate.TaskRunning, "")
+		save()
+
+		if err := run(ctx, id, task); err != nil {
+			if ctx.Err() == nil {
+				state.SetTaskStatus(id, runstate.TaskFailed, err.Error())
+				save()
+				fmt.Fprintf(out, "Task %s failed: %v\n", id, err)
+			}
+			return err
+		}
+		state.SetTaskStatus(id, runstate.TaskCompleted, "")
+		save()
+		fmt.Fprintf(out, "Task %s completed successfully\n", id)
+		return nil
+	}, func(skip taskgraph.Skip) {
+		reason := fmt.Sprintf("prerequisite %s did not complete", skip.Prerequisite)
+		state.SetTaskStatus(skip.Task, runstate.TaskSkipped, reason)
+		save()
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Skipping task %s: %s\n", skip.Task, reason)
+	})
+	return err
+}
+
+// taskGraphError explains which tasks of a run did not complete
+func taskGraphError(err error, runID string, total int) error {
+	var incomplete *taskgraph.IncompleteError
+	if !errors.As(err, &incomplete) {
+		return err
+	}
+	var lines []string
+	for _, f := range incomplete.Failed {
+		lines = append(lines, fmt.Sprintf("%s (failed: %v)", f.Task, f.Err))
+	}
+	for _, s := range incomplete.Skipped {
+		lines = append(lines, fmt.Sprintf("%s (skipped: prerequisite %s did not complete)", s.Task, s.Prerequisite))
+	}
+	return fmt.Errorf("%d of %d tasks did not complete:\n  %s\n\nHint: Tasks that do not depend on a failed task still ran. Run lorch resume --run %s to retry the failed tasks and the ones skipped because of them.",
+		len(lines), total, strings.Join(lines, "\n  "), runID)
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/iambrandonn/lorch/internal/activation"
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/stretchr/testify/require"
+)
+
+func newGraphState(t *testing.T, tasks ...activation.Task) (*runstate.RunState, string) {
+	t.Helper()
+	state := runstate.NewRunState("run-graph", "", "snap-1")
+	startTaskGraph(state, tasks)
+	return state, filepath.Join(t.TempDir(), "run.json")
+}
+
+func TestRunTaskGraphSkipsDependentsOfFailedTask(t *testing.T) {
+	state, statePath := newGraphState(t,
+		activation.Task{ID: "T-2", Title: "Handlers", DependsOn: []string{"T-1"}},
+		activation.Task{ID: "T-1", Title: "Schema"},
+		activation.Task{ID: "T-3", Title: "Docs"},
+		activation.Task{ID: "T-4", Title: "Client", DependsOn: []string{"T-2"}},
+	)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var ran []string
+	var out bytes.Buffer
+	err := runTaskGraph(context.Background(), &out, state, statePath, logger, func(_ context.Context, id string, task *runstate.TaskState) error {
+		ran = append(ran, id)
+		require.Equal(t, task.Title, task.Inputs["goal"], "tasks run with their recorded inputs")
+		if id == "T-1" {
+			return errors.New("review failed")
+		}
+		return nil
+	})
+	require.Error(t, err)
+	require.Equal(t, []string{"T-1", "T-3"}, ran)
+
+	require.Equal(t, runstate.TaskFailed, state.Tasks["T-1"].Status)
+	require.Equal(t, "review failed", state.Tasks["T-1"].Error)
+	require.Equal(t, runstate.TaskSkipped, state.Tasks["T-2"].Status)
+	require.Equal(t, runstate.TaskSkipped, state.Tasks["T-4"].Status)
+	require.Equal(t, "prerequisite T-2 did not complete", state.Tasks["T-4"].Error)
+	require.Equal(t, runstate.TaskCompleted, state.Tasks["T-3"].Status)
+	require.Equal(t, []string{"T-3"}, state.ActivatedTaskIDs)
+	require.Contains(t, out.String(), "Skipping task T-2: prerequisite T-1 did not complete")
+
+	saved, loadErr := runstate.LoadRunState(statePath)
+	require.NoError(t, loadErr)
+	require.Equal(t, runstate.TaskSkipped, saved.Tasks["T-4"].Status)
+
+	graphErr := taskGraphError(err, "run-graph", len(state.Tasks))
+	require.Contains(t, graphErr.Error(), "3 of 4 tasks did not complete:\n  T-1 (failed: review failed)\n  T-2 (skipped: prerequisite T-1 did not complete)")
+	require.Contains(t, graphErr.Error(), "lorch resume --run run-graph")
+
+	// A resume runs the unfinished part of the graph only
+	ran = nil
+	err = runTaskGraph(context.Background(), io.Discard, state, statePath, logger, func(_ context.Context, id string, _ *runstate.TaskState) error {
+		ran = append(ran, id)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"T-1", "T-2", "T-4"}, ran)
+	require.Empty(t, state.UnfinishedTasks())
+}
+
+func TestRunTaskGraphLeavesInterruptedTaskRunning(t *testing.T) {
+	state, statePath := newGraphState(t,
+		activation.Task{ID: "T-1", Title: "Schema"},
+		activation.Task{ID: "T-2", Title: "Handlers"},
+	)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := runTaskGraph(ctx, io.Discard, state, statePath, logger, func(ctx context.Context, _ string, _ *runstate.TaskState) error {
+		cancel()
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, runstate.TaskRunning, state.Tasks["T-1"].Status)
+	require.Equal(t, runstate.TaskPending, state.Tasks["T-2"].Status)
+	require.Equal(t, "T-1", state.TaskID)
+}
+
+func TestConfigTaskGraph(t *testing.T) {
+	cfg := config.GenerateDefault()
+	cfg.Tasks = []config.Task{
+		{ID: "T-3", Goal: "client", DependsOn: []string{"T-2"}},
+		{ID: "T-1", Goal: "schema"},
+		{ID: "T-2", Goal: "handlers", DependsOn: []string{"T-1"}},
+		{ID: "T-4", Goal: "docs"},
+	}
+
+	graph, err := configTaskGraph(cfg, "T-3")
+	require.NoError(t, err)
+	var ids []string
+	for _, task := range graph {
+		ids = append(ids, task.ID)
+	}
+	require.Equal(t, []string{"T-1", "T-2", "T-3"}, ids)
+
+	graph, err = configTaskGraph(cfg, "T-4")
+	require.NoError(t, err)
+	require.Len(t, graph, 1)
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/scheduler"
+	"github.com/iambrandonn/lorch/internal/usage"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// configureUsageAccounting wires LLM usage tracking and budget enforcement into
+// a scheduler. Totals already recorded in the run state (resume) count towards
+// the budget, and each priced usage report is persisted back to the run state.
+func configureUsageAccounting(
+	sched *scheduler.Scheduler,
+	cfg *config.Config,
+	state *runstate.RunState,
+	statePath string,
+	reader *bufio.Reader,
+	out io.Writer,
+	logger *slog.Logger,
+) *usage.Tracker {
+	tracker := usage.NewTracker(cfg.Pricing, cfg.Policy.Budget)
+	if state.Usage != nil {
+		tracker.Restore(state.Usage.Run, state.Usage.Tasks)
+	}
+
+	sched.SetUsageTracker(tracker)
+	sched.SetBudgetApprover(newBudgetPrompt(reader, out))
+	sched.SetEventHandler(func(evt *protocol.Event) {
+		if evt.Usage == nil {
+			return
+		}
+		state.RecordUsage(evt.TaskID, *evt.Usage)
+		if err := runstate.SaveRunState(state, statePath); err != nil {
+			logger.Warn("failed to save run state usage", "error", err)
+		}
+	})
+
+	return tracker
+}
+
+// newBudgetPrompt returns an approver that asks the user on the terminal
+// whether to keep going after a budget is exceeded. EOF counts as "no".
+func newBudgetPrompt(reader *bufio.Reader, out io.Writer) scheduler.BudgetApprover {
+	return func(ctx context.Context, exceeded *usage.BudgetExceeded) (bool, error) {
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Budget exceeded: %s\n", exceeded.Error())
+		fmt.Fprint(out, "Continue anyway? [y/N]: ")
+
+		line, err := readLine(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(out)
+				return false, nil
+			}
+			return false, err
+		}
+
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+}
+
+// printUsageSummary prints run totals when any usage was reported.
+func printUsageSummary(w io.Writer, tracker *usage.Tracker) {
+	total := tracker.RunTotal()
+	if total.TotalTokens() == 0 && total.EstimatedCostUSD == 0 {
+		return
+	}
+	fmt.Fprintf(w, "LLM usage: %d input tokens, %d output tokens, estimated cost $%.4f\n",
+		total.InputTokens, total.OutputTokens, total.EstimatedCostUSD)
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/internal/eventlog"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// configureSchemaValidation installs the process-wide schema enforcer for the
+// configured policy. Supervisors created afterwards validate every inbound
+// message with it, and receipts and run state are validated on write.
+func configureSchemaValidation(cfg *config.Config, logger *slog.Logger) error {
+	mode, err := schema.ParseMode(cfg.Policy.SchemaValidation)
+	if err != nil {
+		return err
+	}
+	validator, err := schema.Default()
+	if err != nil {
+		return err
+	}
+
+	schema.SetDefaultEnforcer(schema.NewEnforcer(validator, mode, logger))
+	logger.Debug("schema validation configured", "mode", mode)
+	return nil
+}
+
+// recordSchemaFindings routes schema violations into the run's event ledger
+// until the returned function is called
+func recordSchemaFindings(evtLog *eventlog.EventLog, logger *slog.Logger) func() {
+	enforcer := schema.DefaultEnforcer()
+	enforcer.SetRecorder(func(f schema.Finding) {
+		if err := evtLog.WriteLog(schemaFindingLog(f)); err != nil {
+			logger.Warn("failed to record schema violation", "error", err)
+		}
+	})
+	return func() { enforcer.SetRecorder(nil) }
+}
+
+// schemaFindingLog renders a finding as a ledger log entry carrying the
+// offending field paths
+func schemaFindingLog(f schema.Finding) *protocol.Log {
+	violations := make([]map[string]any, 0, len(f.Violations))
+	for _, v := range f.Violations {
+		violations = append(violations, map[string]any{
+			"path":    v.Path,
+			"message": v.Message,
+		})
+	}
+
+	level := protocol.LogLevelWarn
+	if f.Rejected {
+		level = protocol.LogLevelError
+	}
+
+	return &protocol.Log{
+		Kind:    protocol.MessageKindLog,
+		Level:   level,
+		Message: "schema violation",
+		Fields: map[string]any{
+			"schema":     f.Schema,
+			"source":     f.Source,
+			"rejected":   f.Rejected,
+			"violations": violations,
+		},
+		Timestamp: time.Now().UTC(),
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/iambrandonn/lorch/internal/runcheck"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify --run <id>",
+	Short: "Check a finished run against the passing-run criteria",
+	Long: `Load a run's ledger, receipts, snapshot and run state and check the
+passing-run criteria from MASTER-SPEC §11.1: reported artifacts still match
+their receipts, each task's final review was approved and its spec
+maintenance finished, spec documents were only edited in the allowed
+sections, every command has a terminal event, and state/run.json shows the
+run completed.
+
+Criteria that cannot be checked from what the run left on disk are skipped.
+The command exits non-zero when any check fails:
+
+  lorch verify --run run-20251019-... --json`,
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().StringP("run", "r", "", "Run ID to verify (required)")
+	verifyCmd.Flags().Bool("json", false, "Print the report as JSON")
+	verifyCmd.MarkFlagRequired("run")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	runID, err := cmd.Flags().GetString("run")
+	if err != nil {
+		return err
+	}
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	workspaceRoot, err := locateWorkspaceRoot(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Spec edits are checked against the content kept in the blob store
+	baseline := func(path, sha256 string) ([]byte, bool) {
+		content, err := snapshot.ReadBlob(workspaceRoot, sha256)
+		return content, err == nil
+	}
+	report, err := runcheck.Verify(runcheck.Options{WorkspaceRoot: workspaceRoot, RunID: runID, Baseline: baseline})
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		err = report.WriteJSON(cmd.OutOrStdout())
+	} else {
+		err = report.WriteText(cmd.OutOrStdout())
+	}
+	if err != nil {
+		return err
+	}
+
+	if !report.Passed {
+		return fmt.Errorf("run %s failed verification: %d of %d checks failed", runID, report.Failures(), len(report.Checks))
+	}
+	return nil
+}
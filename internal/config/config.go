@@ -4,6 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/internal/taskgraph"
 )
 
 // Config represents the lorch.json configuration file
@@ -13,6 +19,75 @@ type Config struct {
 	Policy        Policy  `json:"policy"`
 	Agents        Agents  `json:"agents"`
 	Tasks         []Task  `json:"tasks"`
+
+	// Pricing maps a model name (as reported in event usage blocks) to its
+	// per-token price. Used to estimate cost when agents omit it.
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+
+	// Snapshot selects the workspace files snapshots track
+	Snapshot *SnapshotConfig `json:"snapshot,omitempty"`
+
+	// Git enables git mode
+	Git *GitConfig `json:"git,omitempty"`
+}
+
+// SnapshotConfig selects the files workspace snapshots track. Include globs
+// replace the default directories (specs, src, tests, docs); "**" matches
+// any number of directories. Exclude patterns use .gitignore syntax and
+// apply after .gitignore and .lorchignore files.
+type SnapshotConfig struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// Gitignore honours .gitignore files (default true)
+	Gitignore *bool `json:"gitignore,omitempty"`
+	// Blobs keeps the content of every snapshotted file under
+	// snapshots/blobs/, so lorch restore can roll the workspace back
+	Blobs bool `json:"blobs,omitempty"`
+}
+
+// Scope returns the snapshot scope the configuration selects
+func (s *SnapshotConfig) Scope() snapshot.Scope {
+	if s == nil {
+		return snapshot.Scope{}
+	}
+	return snapshot.Scope{
+		Include:         s.Include,
+		Exclude:         s.Exclude,
+		IgnoreGitignore: s.Gitignore != nil && !*s.Gitignore,
+	}
+}
+
+// KeepBlobs reports whether snapshot content goes to the blob store
+func (s *SnapshotConfig) KeepBlobs() bool {
+	return s != nil && s.Blobs
+}
+
+// GitConfig configures git mode. When enabled, a run only starts in a git
+// work tree without uncommitted changes, works on a lorch/<run_id> branch,
+// and commits each accepted builder step with trailers linking it to its
+// task, step, idempotency key and receipt.
+type GitConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Active reports whether git mode is enabled
+func (g *GitConfig) Active() bool {
+	return g != nil && g.Enabled
+}
+
+// ModelPrice is the price of one million tokens for a model, in USD
+type ModelPrice struct {
+	InputPerMTokUSD  float64 `json:"input_per_mtok_usd"`
+	OutputPerMTokUSD float64 `json:"output_per_mtok_usd"`
+}
+
+// Budget limits LLM spend per task and per run. Zero values mean unlimited.
+// Exceeding a limit pauses the run until a human approves continuing.
+type Budget struct {
+	PerTaskUSD    float64 `json:"per_task_usd,omitempty"`
+	PerRunUSD     float64 `json:"per_run_usd,omitempty"`
+	PerTaskTokens int64   `json:"per_task_tokens,omitempty"`
+	PerRunTokens  int64   `json:"per_run_tokens,omitempty"`
 }
 
 // Policy contains orchestrator policy settings
@@ -24,6 +99,14 @@ type Policy struct {
 	StrictVersionPinning bool   `json:"strict_version_pinning"`
 	ParallelReviews      bool   `json:"parallel_reviews"`
 	RedactSecretsInLogs  bool   `json:"redact_secrets_in_logs"`
+	Budget               *Budget `json:"budget,omitempty"`
+	// SchemaValidation is "off", "warn" (default) or "strict"
+	SchemaValidation string `json:"schema_validation,omitempty"`
+	// RedactPatterns are regular expressions whose matches are redacted
+	// alongside secret environment values when RedactSecretsInLogs is set
+	RedactPatterns []string `json:"redact_patterns,omitempty"`
+	// RedactHighEntropy also redacts long random-looking tokens
+	RedactHighEntropy bool `json:"redact_high_entropy,omitempty"`
 }
 
 // Retry contains retry policy configuration
@@ -55,12 +138,67 @@ type AgentConfig struct {
 	HeartbeatIntervalS int               `json:"heartbeat_interval_s,omitempty"`
 	TimeoutsS          map[string]int    `json:"timeouts_s,omitempty"`
 	Env                map[string]string `json:"env,omitempty"`
+	Limits             *ResourceLimits   `json:"limits,omitempty"`
+	Sandbox            *SandboxConfig    `json:"sandbox,omitempty"`
+	// Transport is how lorch reaches the agent: "stdio" (the default) starts
+	// cmd as a child process; "unix" waits for an agent daemon to connect to
+	// the run's socket, and cmd is not used
+	Transport string `json:"transport,omitempty"`
+}
+
+// Agent transports
+const (
+	TransportStdio = "stdio"
+	TransportUnix  = "unix"
+)
+
+// ResourceLimits caps what an agent's processes may use. Zero values mean
+// unlimited. Memory, CPU and process limits use a cgroup v2 sub-tree when
+// one is available.
+type ResourceLimits struct {
+	MemoryMB     int `json:"memory_mb,omitempty"`
+	CPUPercent   int `json:"cpu_pct,omitempty"` // 100 is one core
+	MaxProcs     int `json:"max_procs,omitempty"`
+	MaxOpenFiles int `json:"max_open_files,omitempty"`
+	// WallTimeS is how long the agent process may run in total
+	WallTimeS int `json:"wall_time_s,omitempty"`
+}
+
+// SandboxConfig confines an agent in Linux user, mount and network
+// namespaces. When enabled, the agent fails to start where the kernel cannot
+// provide them.
+type SandboxConfig struct {
+	Enabled bool `json:"enabled"`
+	// Workspace is "rw" or "ro"; reviewers default to "ro", others to "rw"
+	Workspace string `json:"workspace,omitempty"`
+	// Network keeps host networking; by default agents only get loopback
+	Network bool `json:"network,omitempty"`
+	// EnvAllowlist names variables passed through from lorch's environment.
+	// PATH, HOME, USER, LOGNAME, LANG, LC_ALL, TERM and TZ always are.
+	EnvAllowlist []string `json:"env_allowlist,omitempty"`
+	// WritablePaths stay writable besides the workspace and a private /tmp
+	WritablePaths []string `json:"writable_paths,omitempty"`
 }
 
 // Task represents a development task
 type Task struct {
 	ID   string `json:"id"`
 	Goal string `json:"goal"`
+	// DependsOn lists the tasks that must complete before this one runs
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// TaskDependencies maps each configured task to its prerequisites
+func (c *Config) TaskDependencies() ([]string, map[string][]string) {
+	ids := make([]string, 0, len(c.Tasks))
+	deps := make(map[string][]string, len(c.Tasks))
+	for _, task := range c.Tasks {
+		ids = append(ids, task.ID)
+		if len(task.DependsOn) > 0 {
+			deps[task.ID] = task.DependsOn
+		}
+	}
+	return ids, deps
 }
 
 // GenerateDefault creates a new Config with default values matching MASTER-SPEC §8.2
@@ -94,6 +232,8 @@ func GenerateDefault() *Config {
 			StrictVersionPinning: true,
 			ParallelReviews:      false,
 			RedactSecretsInLogs:  true,
+			SchemaValidation:     "warn",
+			RedactHighEntropy:    true,
 		},
 		Agents: Agents{
 			Builder: &AgentConfig{
@@ -150,9 +290,13 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("configuration error: missing required field 'version'\n\nHint: Add a version field like:\n  \"version\": \"1.0\"")
 	}
 
-	// Concurrency must be exactly 1 in Phase 1
-	if c.Policy.Concurrency != 1 {
-		return fmt.Errorf("configuration error: invalid 'policy.concurrency' value: %d\n\nHint: Concurrency must be 1 (single-agent-at-a-time). Update your config:\n  \"policy\": {\n    \"concurrency\": 1\n  }", c.Policy.Concurrency)
+	// Concurrency is the number of tasks run at once; each parallel task
+	// works in its own git worktree, so more than 1 needs git mode
+	if c.Policy.Concurrency < 1 {
+		return fmt.Errorf("configuration error: invalid 'policy.concurrency' value: %d\n\nHint: Concurrency must be at least 1 (1 runs one task at a time). Update your config:\n  \"policy\": {\n    \"concurrency\": 1\n  }", c.Policy.Concurrency)
+	}
+	if c.Policy.Concurrency > 1 && !c.Git.Active() {
+		return fmt.Errorf("configuration error: 'policy.concurrency' %d needs git mode\n\nHint: Parallel tasks each work in their own git worktree. Enable git mode or run one task at a time:\n  \"git\": {\"enabled\": true}", c.Policy.Concurrency)
 	}
 
 	// Required agents: builder, reviewer, spec_maintainer
@@ -185,15 +329,105 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Parallel tasks start their own agents; a daemon on the run's socket
+	// cannot serve several worktrees
+	if c.Policy.Concurrency > 1 {
+		for _, name := range []string{"builder", "reviewer", "spec_maintainer"} {
+			if agents[name].Transport == TransportUnix {
+				return fmt.Errorf("configuration error: agent '%s' uses the unix transport, which 'policy.concurrency' %d does not support\n\nHint: Parallel tasks start their own agents over stdio. Remove the transport setting or set:\n  \"concurrency\": 1", name, c.Policy.Concurrency)
+			}
+		}
+	}
+
+	// Zero means the protocol default
+	if n := c.Policy.MessageMaxBytes; n != 0 && (n < ndjson.MinMessageSizeLimit || n > ndjson.MaxMessageSizeLimit) {
+		return fmt.Errorf("configuration error: 'policy.message_max_bytes' must be between %d and %d (got %d)\n\nHint: The default is 256 KiB:\n  \"message_max_bytes\": 262144", ndjson.MinMessageSizeLimit, ndjson.MaxMessageSizeLimit, n)
+	}
+
+	// Zero means no cap
+	if c.Policy.ArtifactMaxBytes < 0 {
+		return fmt.Errorf("configuration error: 'policy.artifact_max_bytes' must not be negative (got %d)\n\nHint: The default is 1 GiB:\n  \"artifact_max_bytes\": 1073741824", c.Policy.ArtifactMaxBytes)
+	}
+
+	if b := c.Policy.Budget; b != nil {
+		if b.PerTaskUSD < 0 || b.PerRunUSD < 0 || b.PerTaskTokens < 0 || b.PerRunTokens < 0 {
+			return fmt.Errorf("configuration error: 'policy.budget' limits must not be negative\n\nHint: Use 0 (or omit the field) for no limit:\n  \"budget\": {\"per_task_usd\": 5.0, \"per_run_usd\": 20.0}")
+		}
+	}
+
+	for _, p := range c.Policy.RedactPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("configuration error: invalid 'policy.redact_patterns' entry %q: %v\n\nHint: Patterns use Go regular expression syntax:\n  \"redact_patterns\": [\"ghp_[A-Za-z0-9]{36}\"]", p, err)
+		}
+	}
+
+	switch c.Policy.SchemaValidation {
+	case "", "off", "warn", "strict":
+	default:
+		return fmt.Errorf("configuration error: 'policy.schema_validation' must be off, warn or strict (got %q)\n\nHint: Use warn to log violations or strict to reject them:\n  \"schema_validation\": \"strict\"", c.Policy.SchemaValidation)
+	}
+
+	if s := c.Snapshot; s != nil {
+		for field, globs := range map[string][]string{"include": s.Include, "exclude": s.Exclude} {
+			for _, glob := range globs {
+				if err := snapshot.ValidatePattern(glob); err != nil {
+					return fmt.Errorf("configuration error: invalid 'snapshot.%s' pattern %q: %v\n\nHint: Patterns are relative to the workspace root:\n  \"snapshot\": {\"include\": [\"cmd/**\", \"internal/**\"], \"exclude\": [\"*.pb.go\"]}", field, glob, err)
+				}
+			}
+		}
+	}
+
+	for model, price := range c.Pricing {
+		if price.InputPerMTokUSD < 0 || price.OutputPerMTokUSD < 0 {
+			return fmt.Errorf("configuration error: 'pricing.%s' has a negative price\n\nHint: Prices are USD per million tokens:\n  \"pricing\": {\"%s\": {\"input_per_mtok_usd\": 3.0, \"output_per_mtok_usd\": 15.0}}", model, model)
+		}
+	}
+
+	if _, err := taskgraph.Sort(c.TaskDependencies()); err != nil {
+		return fmt.Errorf("configuration error: invalid task 'depends_on': %v\n\nHint: Each task may only depend on other configured tasks, without cycles:\n  \"tasks\": [{\"id\": \"T-100\", \"goal\": \"...\"}, {\"id\": \"T-101\", \"goal\": \"...\", \"depends_on\": [\"T-100\"]}]", err)
+	}
+
 	return nil
 }
 
 // Validate checks an agent configuration for errors
 func (a *AgentConfig) Validate(agentName string) error {
+	switch a.Transport {
+	case "", TransportStdio:
+	case TransportUnix:
+		// The agent is a daemon lorch does not start, so nothing that
+		// applies to its process can be enforced
+		if a.Limits != nil || (a.Sandbox != nil && a.Sandbox.Enabled) {
+			return fmt.Errorf("configuration error: agent '%s' uses the unix transport, which does not support 'limits' or 'sandbox'\n\nHint: Apply limits and sandboxing to the agent daemon itself, or use the stdio transport", agentName)
+		}
+		return nil
+	default:
+		return fmt.Errorf("configuration error: agent '%s' has invalid 'transport' %q\n\nHint: Use stdio (the default) or unix:\n  \"transport\": \"unix\"", agentName, a.Transport)
+	}
+
 	if len(a.Cmd) == 0 {
 		return fmt.Errorf("configuration error: agent '%s' has empty 'cmd' field\n\nHint: Specify the command to run the agent:\n  \"cmd\": [\"claude\"]", agentName)
 	}
 
+	if l := a.Limits; l != nil {
+		if l.MemoryMB < 0 || l.CPUPercent < 0 || l.MaxProcs < 0 || l.MaxOpenFiles < 0 || l.WallTimeS < 0 {
+			return fmt.Errorf("configuration error: agent '%s' has a negative value in 'limits'\n\nHint: Use 0 (or omit the field) for no limit:\n  \"limits\": {\"memory_mb\": 4096, \"cpu_pct\": 200, \"max_procs\": 256}", agentName)
+		}
+	}
+
+	if sb := a.Sandbox; sb != nil {
+		switch sb.Workspace {
+		case "", "rw", "ro":
+		default:
+			return fmt.Errorf("configuration error: agent '%s' has invalid 'sandbox.workspace' %q\n\nHint: Use rw or ro:\n  \"sandbox\": {\"enabled\": true, \"workspace\": \"ro\"}", agentName, sb.Workspace)
+		}
+		for _, p := range sb.WritablePaths {
+			if !filepath.IsAbs(p) {
+				return fmt.Errorf("configuration error: agent '%s' has a relative path in 'sandbox.writable_paths': %s\n\nHint: Writable paths must be absolute:\n  \"writable_paths\": [\"/home/me/.claude\"]", agentName, p)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -129,7 +129,46 @@ func TestValidate_InvalidConcurrencyGreaterThanOne(t *testing.T) {
 	err := cfg.Validate()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "concurrency")
-	assert.Contains(t, err.Error(), "must be 1")
+	assert.Contains(t, err.Error(), "needs git mode")
+}
+
+func TestValidate_ConcurrencyWithGitMode(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Policy.Concurrency = 4
+	cfg.Git = &GitConfig{Enabled: true}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Agents.Builder.Transport = TransportUnix
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unix transport")
+}
+
+func TestValidate_NegativeBudget(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Policy.Budget = &Budget{PerRunUSD: -1}
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "policy.budget")
+}
+
+func TestValidate_SchemaValidationMode(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Policy.SchemaValidation = "strict"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Policy.SchemaValidation = "loud"
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "policy.schema_validation")
+}
+
+func TestValidate_NegativePrice(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Pricing = map[string]ModelPrice{"claude-sonnet": {InputPerMTokUSD: -3}}
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "pricing.claude-sonnet")
 }
 
 func TestValidate_EmptyAgentCmd(t *testing.T) {
@@ -140,6 +179,53 @@ func TestValidate_EmptyAgentCmd(t *testing.T) {
 	assert.Contains(t, err.Error(), "cmd")
 }
 
+func TestValidate_NegativeLimits(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Agents.Builder.Limits = &ResourceLimits{MemoryMB: 2048, CPUPercent: 200}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Agents.Builder.Limits.MaxProcs = -1
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "builder")
+	assert.Contains(t, err.Error(), "limits")
+}
+
+func TestValidate_Sandbox(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Agents.Reviewer.Sandbox = &SandboxConfig{Enabled: true, Workspace: "ro", WritablePaths: []string{"/home/me/.claude"}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Agents.Reviewer.Sandbox.Workspace = "readonly"
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "sandbox.workspace")
+
+	cfg.Agents.Reviewer.Sandbox.Workspace = ""
+	cfg.Agents.Reviewer.Sandbox.WritablePaths = []string{".claude"}
+	err = cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "writable_paths")
+}
+
+func TestValidate_Transport(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Agents.Builder.Transport = TransportUnix
+	cfg.Agents.Builder.Cmd = nil
+	assert.NoError(t, cfg.Validate(), "unix agents need no cmd")
+
+	cfg.Agents.Builder.Limits = &ResourceLimits{MemoryMB: 1024}
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unix transport")
+
+	cfg.Agents.Builder.Limits = nil
+	cfg.Agents.Builder.Transport = "tcp"
+	err = cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'transport'")
+}
+
 func TestLoadFromFile_ValidFile(t *testing.T) {
 	goldenPath := filepath.Join("..", "..", "testdata", "golden_config.json")
 	cfg, err := LoadFromFile(goldenPath)
@@ -189,3 +275,79 @@ func TestSaveToFile(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
 }
+
+func TestValidate_RedactPatterns(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Policy.RedactPatterns = []string{`password=\S+`}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Policy.RedactPatterns = []string{"("}
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'policy.redact_patterns'")
+}
+
+func TestValidate_ArtifactMaxBytes(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Policy.ArtifactMaxBytes = 0
+	assert.NoError(t, cfg.Validate(), "zero means no cap")
+
+	cfg.Policy.ArtifactMaxBytes = -1
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'policy.artifact_max_bytes'")
+}
+
+func TestValidate_SnapshotPatterns(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Snapshot = &SnapshotConfig{Include: []string{"cmd/**", "internal"}, Exclude: []string{"*.pb.go", "!keep.pb.go"}}
+	assert.NoError(t, cfg.Validate())
+
+	for _, glob := range []string{"", "../outside", "src/[a-"} {
+		cfg.Snapshot = &SnapshotConfig{Include: []string{glob}}
+		err := cfg.Validate()
+		assert.Error(t, err, "pattern %q", glob)
+		assert.Contains(t, err.Error(), "'snapshot.include'")
+	}
+
+	disabled := false
+	cfg.Snapshot = &SnapshotConfig{Gitignore: &disabled}
+	assert.True(t, cfg.Snapshot.Scope().IgnoreGitignore)
+	assert.False(t, (*SnapshotConfig)(nil).Scope().IgnoreGitignore)
+}
+
+func TestValidate_MessageMaxBytes(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Policy.MessageMaxBytes = 0
+	assert.NoError(t, cfg.Validate(), "zero selects the default")
+
+	cfg.Policy.MessageMaxBytes = 4 << 20
+	assert.NoError(t, cfg.Validate())
+
+	for _, n := range []int{-1, 100, 64 << 20} {
+		cfg.Policy.MessageMaxBytes = n
+		err := cfg.Validate()
+		assert.Error(t, err, "limit %d", n)
+		assert.Contains(t, err.Error(), "'policy.message_max_bytes'")
+	}
+}
+
+func TestValidate_TaskDependencies(t *testing.T) {
+	cfg := GenerateDefault()
+	cfg.Tasks = []Task{
+		{ID: "T-100", Goal: "schema"},
+		{ID: "T-101", Goal: "handlers", DependsOn: []string{"T-100"}},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tasks[1].DependsOn = []string{"T-999"}
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "task T-101 depends on unknown task T-999")
+
+	cfg.Tasks[0].DependsOn = []string{"T-101"}
+	cfg.Tasks[1].DependsOn = []string{"T-100"}
+	err = cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "dependency cycle: T-100 -> T-101 -> T-100")
+}
@@ -0,0 +1,624 @@
+// Package conformance drives an agent binary through a battery of protocol
+// checks (MASTER-SPEC §11.2) and reports the outcome per check.
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/internal/supervisor"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Check names, in the order they are reported
+const (
+	CheckStartup          = "startup"
+	CheckHeartbeatCadence = "heartbeat_cadence"
+	CheckCorrelationIDs   = "correlation_ids"
+	CheckIdempotentReplay = "idempotent_replay"
+	CheckCleanShutdown    = "clean_shutdown"
+	CheckSchemaValidity   = "schema_validity"
+	CheckOversizeMessage  = "oversize_message"
+)
+
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	defaultTimeout           = 30 * time.Second
+
+	// maxViolationsReported caps how many schema violations a report lists
+	maxViolationsReported = 20
+)
+
+// Options configures a conformance run
+type Options struct {
+	// AgentCmd is the agent command line (binary followed by arguments)
+	AgentCmd []string
+	// Role is the agent type under test; it selects the action that is exercised
+	Role protocol.AgentType
+	// Env adds environment variables for the agent process
+	Env map[string]string
+	// HeartbeatInterval is the cadence the agent is expected to keep (default 10s)
+	HeartbeatInterval time.Duration
+	// Timeout bounds each wait for agent output (default 30s)
+	Timeout time.Duration
+	// Logger receives supervisor diagnostics (default: discarded)
+	Logger *slog.Logger
+}
+
+// Run launches the agent and executes every check. It returns an error only
+// when the options are unusable; agent misbehaviour is reported in the Report.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if len(opts.AgentCmd) == 0 {
+		return nil, fmt.Errorf("agent command is required")
+	}
+	if _, ok := roleActions[opts.Role]; !ok {
+		return nil, fmt.Errorf("unsupported role %q", opts.Role)
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	validator, err := schema.Default()
+	if err != nil {
+		return nil, fmt.Errorf("load schemas: %w", err)
+	}
+
+	r := &runner{opts: opts, validator: validator}
+	report := &Report{
+		Agent:     strings.Join(opts.AgentCmd, " "),
+		Role:      opts.Role,
+		StartedAt: time.Now().UTC(),
+	}
+
+	report.Cases = append(report.Cases, r.mainSession(ctx)...)
+	report.Cases = append(report.Cases, r.oversizeSession(ctx))
+	report.Duration = time.Since(report.StartedAt)
+	return report, nil
+}
+
+// roleActions maps each role to the action used to exercise it
+var roleActions = map[protocol.AgentType]protocol.Action{
+	protocol.AgentTypeBuilder:        protocol.ActionImplement,
+	protocol.AgentTypeReviewer:       protocol.ActionReview,
+	protocol.AgentTypeSpecMaintainer: protocol.ActionUpdateSpec,
+	protocol.AgentTypeOrchestration:  protocol.ActionIntake,
+}
+
+type runner struct {
+	opts      Options
+	validator *schema.Validator
+	seq       int
+}
+
+// mainSession runs every check except oversize handling against one agent process
+func (r *runner) mainSession(ctx context.Context) []Case {
+	pending := []string{
+		CheckHeartbeatCadence, CheckCorrelationIDs, CheckIdempotentReplay,
+		CheckCleanShutdown, CheckSchemaValidity,
+	}
+
+	start := time.Now()
+	s, err := r.start(ctx)
+	if err != nil {
+		return append([]Case{failed(CheckStartup, start, "failed to start agent: %v", err)}, skipped(pending, "agent did not start")...)
+	}
+	defer s.kill()
+
+	if !s.wait(ctx, r.opts.Timeout, func() bool { return len(s.heartbeats) > 0 }) {
+		return append([]Case{failed(CheckStartup, start, "no heartbeat within %s", r.opts.Timeout)}, skipped(pending, "agent did not start")...)
+	}
+	first := s.heartbeatsSnapshot()[0]
+	cases := []Case{passed(CheckStartup, start, "first heartbeat after %s (status %s)", first.at.Sub(start).Round(time.Millisecond), first.hb.Status)}
+
+	cases = append(cases, r.checkCadence(ctx, s))
+
+	snapshotID := newSnapshotID()
+	ik := r.newIK()
+	cmd := r.newCommand(ik, snapshotID)
+	corrCase, firstEvents := r.checkCorrelation(ctx, s, cmd)
+	cases = append(cases, corrCase)
+
+	if firstEvents == nil {
+		cases = append(cases, skipped([]string{CheckIdempotentReplay}, "first command did not complete")...)
+	} else {
+		replay := r.newCommand(ik, snapshotID)
+		cases = append(cases, r.checkReplay(ctx, s, replay, firstEvents))
+	}
+
+	cases = append(cases, r.checkShutdown(ctx, s))
+	cases = append(cases, r.checkSchema(s))
+	return cases
+}
+
+func (r *runner) checkCadence(ctx context.Context, s *session) Case {
+	start := time.Now()
+	interval := r.opts.HeartbeatInterval
+	tolerance := interval / 2
+	first := s.heartbeatsSnapshot()[0].at
+
+	// Observe long enough for two periodic heartbeats after the first one
+	window := 2*interval + tolerance
+	s.wait(ctx, window, func() bool { return time.Since(first) >= window })
+
+	hbs := s.heartbeatsSnapshot()
+	var problems []string
+	for i := 1; i < len(hbs); i++ {
+		if hbs[i].hb.Seq <= hbs[i-1].hb.Seq {
+			problems = append(problems, fmt.Sprintf("seq %d followed seq %d", hbs[i].hb.Seq, hbs[i-1].hb.Seq))
+		}
+	}
+
+	// Gaps include the open interval since the last heartbeat
+	var maxGap time.Duration
+	for i := 1; i <= len(hbs); i++ {
+		end := time.Now()
+		if i < len(hbs) {
+			end = hbs[i].at
+		}
+		if gap := end.Sub(hbs[i-1].at); gap > maxGap {
+			maxGap = gap
+		}
+	}
+	if maxGap > interval+tolerance {
+		problems = append(problems, fmt.Sprintf("gap of %s between heartbeats exceeds %s", maxGap.Round(time.Millisecond), interval+tolerance))
+	}
+
+	if len(problems) > 0 {
+		return failed(CheckHeartbeatCadence, start, "%s", strings.Join(problems, "; "))
+	}
+	return passed(CheckHeartbeatCadence, start, "%d heartbeats, max gap %s (expected interval %s)", len(hbs), maxGap.Round(time.Millisecond), interval)
+}
+
+// checkCorrelation sends cmd and verifies every resulting event carries its
+// correlation and task IDs. It returns the events when the command completed.
+func (r *runner) checkCorrelation(ctx context.Context, s *session, cmd *protocol.Command) (Case, []*protocol.Event) {
+	start := time.Now()
+	mark := s.eventCount()
+	if err := s.sup.SendCommand(cmd); err != nil {
+		return failed(CheckCorrelationIDs, start, "send command: %v", err), nil
+	}
+
+	events, ok := s.waitTerminal(ctx, r.opts.Timeout, mark, cmd.CorrelationID)
+	var problems []string
+	for _, evt := range events {
+		if evt.CorrelationID != cmd.CorrelationID {
+			problems = append(problems, fmt.Sprintf("%s has correlation_id %q, want %q", evt.Event, evt.CorrelationID, cmd.CorrelationID))
+		}
+		if evt.TaskID != cmd.TaskID {
+			problems = append(problems, fmt.Sprintf("%s has task_id %q, want %q", evt.Event, evt.TaskID, cmd.TaskID))
+		}
+	}
+	if !ok {
+		problems = append(problems, fmt.Sprintf("no terminal event for %s within %s", cmd.Action, r.opts.Timeout))
+	}
+
+	if len(problems) > 0 {
+		c := failed(CheckCorrelationIDs, start, "%s", problems[0])
+		c.Details = problems
+		if !ok {
+			return c, nil
+		}
+		return c, events
+	}
+	return passed(CheckCorrelationIDs, start, "%d event(s) for %s, ending with %s", len(events), cmd.Action, events[len(events)-1].Event), events
+}
+
+// checkReplay resends a command with the same idempotency key and expects the
+// same outcome under the new correlation ID
+func (r *runner) checkReplay(ctx context.Context, s *session, cmd *protocol.Command, original []*protocol.Event) Case {
+	start := time.Now()
+	mark := s.eventCount()
+	if err := s.sup.SendCommand(cmd); err != nil {
+		return failed(CheckIdempotentReplay, start, "send command: %v", err)
+	}
+
+	events, ok := s.waitTerminal(ctx, r.opts.Timeout, mark, cmd.CorrelationID)
+	if !ok {
+		return failed(CheckIdempotentReplay, start, "no terminal event for the repeated idempotency key within %s", r.opts.Timeout)
+	}
+
+	var problems []string
+	for _, evt := range events {
+		if evt.CorrelationID != cmd.CorrelationID {
+			problems = append(problems, fmt.Sprintf("replayed %s has correlation_id %q, want %q", evt.Event, evt.CorrelationID, cmd.CorrelationID))
+		}
+	}
+	want, got := outcome(original), outcome(events)
+	if strings.Join(want, ",") != strings.Join(got, ",") {
+		problems = append(problems, fmt.Sprintf("replay produced [%s], first run produced [%s]", strings.Join(got, ", "), strings.Join(want, ", ")))
+	}
+
+	if len(problems) > 0 {
+		c := failed(CheckIdempotentReplay, start, "%s", problems[0])
+		c.Details = problems
+		return c
+	}
+	return passed(CheckIdempotentReplay, start, "repeated key produced the same outcome [%s]", strings.Join(got, ", "))
+}
+
+func (r *runner) checkShutdown(ctx context.Context, s *session) Case {
+	start := time.Now()
+	stopCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	// Stop closes stdin and waits for the process to exit
+	err := s.sup.Stop(stopCtx)
+	s.waitDrained(r.opts.Timeout)
+	if err != nil {
+		return failed(CheckCleanShutdown, start, "agent did not exit cleanly after stdin EOF: %v", err)
+	}
+
+	msg := "agent exited with status 0 after stdin EOF"
+	if hbs := s.heartbeatsSnapshot(); len(hbs) > 0 && hbs[len(hbs)-1].hb.Status == protocol.HeartbeatStatusStopping {
+		msg += " (sent stopping heartbeat)"
+	}
+	return passed(CheckCleanShutdown, start, "%s", msg)
+}
+
+// checkSchema validates every raw message the agent produced during the session
+func (r *runner) checkSchema(s *session) Case {
+	start := time.Now()
+
+	s.mu.Lock()
+	raws := append([]rawMessage(nil), s.raw...)
+	s.mu.Unlock()
+
+	var problems []string
+	total := 0
+	for i, msg := range raws {
+		name, ok := schema.ForKind(string(msg.kind))
+		if !ok {
+			problems = append(problems, fmt.Sprintf("message %d: unknown kind %q", i+1, msg.kind))
+			continue
+		}
+		violations, err := r.validator.Validate(name, msg.data)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("message %d (%s): %v", i+1, msg.kind, err))
+			continue
+		}
+		total += len(violations)
+		for _, v := range violations {
+			problems = append(problems, fmt.Sprintf("message %d (%s) %s", i+1, msg.kind, v))
+		}
+	}
+
+	if len(problems) > 0 {
+		c := failed(CheckSchemaValidity, start, "%d violation(s) across %d message(s)", max(total, len(problems)), len(raws))
+		if len(problems) > maxViolationsReported {
+			problems = append(problems[:maxViolationsReported], fmt.Sprintf("... %d more", len(problems)-maxViolationsReported))
+		}
+		c.Details = problems
+		return c
+	}
+	return passed(CheckSchemaValidity, start, "%d message(s) valid against schemas/v1", len(raws))
+}
+
+// oversizeSession sends a line larger than the protocol limit to a fresh agent
+// process. The agent must not act on it, and must either keep serving commands
+// or exit; hanging is a failure.
+func (r *runner) oversizeSession(ctx context.Context) Case {
+	start := time.Now()
+	s, err := r.start(ctx)
+	if err != nil {
+		return failed(CheckOversizeMessage, start, "failed to start agent: %v", err)
+	}
+	defer s.kill()
+
+	if !s.wait(ctx, r.opts.Timeout, func() bool { return len(s.heartbeats) > 0 }) {
+		return failed(CheckOversizeMessage, start, "no heartbeat within %s", r.opts.Timeout)
+	}
+
+	snapshotID := newSnapshotID()
+	oversize := r.newCommand(r.newIK(), snapshotID)
+	oversize.Inputs["padding"] = strings.Repeat("x", ndjson.MaxMessageSize)
+	line, err := json.Marshal(oversize)
+	if err != nil {
+		return failed(CheckOversizeMessage, start, "marshal oversize command: %v", err)
+	}
+
+	mark := s.eventCount()
+	// A write error means the agent stopped reading, which the wait below reports
+	_ = s.sup.SendRaw(line)
+
+	followUp := r.newCommand(r.newIK(), snapshotID)
+	_ = s.sup.SendCommand(followUp)
+
+	var answered bool
+	s.wait(ctx, r.opts.Timeout, func() bool {
+		answered = s.hasTerminal(mark, followUp.CorrelationID)
+		return answered || s.drained
+	})
+
+	for _, evt := range s.eventsSince(mark) {
+		if evt.CorrelationID == oversize.CorrelationID && evt.Event != protocol.EventError {
+			return failed(CheckOversizeMessage, start, "agent acted on a %d byte message (emitted %s)", len(line), evt.Event)
+		}
+	}
+
+	switch {
+	case answered:
+		return passed(CheckOversizeMessage, start, "agent skipped the %d byte message and kept serving commands", len(line))
+	case !s.sup.IsRunning() || s.isDrained():
+		return passed(CheckOversizeMessage, start, "agent stopped after the %d byte message", len(line))
+	default:
+		return failed(CheckOversizeMessage, start, "agent neither answered a follow-up command nor exited within %s after a %d byte message", r.opts.Timeout, len(line))
+	}
+}
+
+func (r *runner) start(ctx context.Context) (*session, error) {
+	sup := supervisor.NewAgentSupervisor(r.opts.Role, r.opts.AgentCmd, r.opts.Env, r.opts.Logger)
+	s := newSession(sup)
+	// Validation is reported by the schema_validity check, so invalid messages
+	// must still reach the session rather than be logged or dropped
+	sup.SetSchemaEnforcer(nil)
+	sup.SetMessageObserver(s.observe)
+	if err := sup.Start(ctx); err != nil {
+		return nil, err
+	}
+	go s.pump(ctx)
+	return s, nil
+}
+
+// newCommand builds a schema-valid command for the role under test
+func (r *runner) newCommand(ik, snapshotID string) *protocol.Command {
+	r.seq++
+	action := roleActions[r.opts.Role]
+
+	inputs := map[string]any{"goal": "lorch conformance check"}
+	if action == protocol.ActionIntake {
+		inputs = map[string]any{"user_instruction": "lorch conformance check"}
+	}
+
+	return &protocol.Command{
+		Kind:            protocol.MessageKindCommand,
+		MessageID:       fmt.Sprintf("cmd-%s", randomHex(4)),
+		CorrelationID:   fmt.Sprintf("corr-conformance-%d", r.seq),
+		TaskID:          "T-0001",
+		IdempotencyKey:  ik,
+		To:              protocol.AgentRef{AgentType: r.opts.Role},
+		Action:          action,
+		Inputs:          inputs,
+		ExpectedOutputs: []protocol.ExpectedOutput{},
+		Version:         protocol.Version{SnapshotID: snapshotID},
+		Deadline:        time.Now().Add(r.opts.Timeout).UTC(),
+		Retry:           protocol.Retry{Attempt: 0, MaxAttempts: 1},
+		Priority:        5,
+	}
+}
+
+func (r *runner) newIK() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("conformance:%d:%s", r.seq, randomHex(8))))
+	return "ik:" + hex.EncodeToString(sum[:])
+}
+
+func newSnapshotID() string {
+	return "snap-" + randomHex(6)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// outcome summarises events as "event/status" pairs for replay comparison
+func outcome(events []*protocol.Event) []string {
+	out := make([]string, 0, len(events))
+	for _, evt := range events {
+		out = append(out, evt.Event+"/"+evt.Status)
+	}
+	return out
+}
+
+// isTerminal reports whether an event ends the command it answers
+func isTerminal(evt *protocol.Event) bool {
+	switch evt.Event {
+	case protocol.EventBuilderCompleted,
+		protocol.EventReviewCompleted,
+		protocol.EventSpecUpdated,
+		protocol.EventSpecNoChangesNeeded,
+		protocol.EventSpecChangesRequested,
+		protocol.EventOrchestrationProposedTasks,
+		protocol.EventOrchestrationNeedsClarification,
+		protocol.EventOrchestrationPlanConflict,
+		protocol.EventError:
+		return true
+	default:
+		return false
+	}
+}
+
+type observedHeartbeat struct {
+	hb *protocol.Heartbeat
+	at time.Time
+}
+
+type rawMessage struct {
+	kind protocol.MessageKind
+	data []byte
+}
+
+// session collects everything one agent process emits
+type session struct {
+	sup *supervisor.AgentSupervisor
+
+	mu         sync.Mutex
+	events     []*protocol.Event
+	heartbeats []observedHeartbeat
+	raw        []rawMessage
+	drained    bool
+
+	changed chan struct{}
+}
+
+func newSession(sup *supervisor.AgentSupervisor) *session {
+	return &session{sup: sup, changed: make(chan struct{}, 1)}
+}
+
+func (s *session) observe(kind protocol.MessageKind, data []byte) {
+	s.mu.Lock()
+	s.raw = append(s.raw, rawMessage{kind: kind, data: data})
+	s.mu.Unlock()
+}
+
+// pump drains the supervisor channels until the agent's stdout closes
+func (s *session) pump(ctx context.Context) {
+	events, heartbeats, logs := s.sup.Events(), s.sup.Heartbeats(), s.sup.Logs()
+	stderr := s.sup.StderrLines()
+	for events != nil || heartbeats != nil || logs != nil {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			s.mu.Lock()
+			s.events = append(s.events, evt)
+			s.mu.Unlock()
+		case hb, ok := <-heartbeats:
+			if !ok {
+				heartbeats = nil
+				continue
+			}
+			s.mu.Lock()
+			s.heartbeats = append(s.heartbeats, observedHeartbeat{hb: hb, at: time.Now()})
+			s.mu.Unlock()
+		case _, ok := <-logs:
+			if !ok {
+				logs = nil
+				continue
+			}
+		case _, ok := <-stderr:
+			if !ok {
+				stderr = nil
+			}
+			continue
+		}
+		s.notify()
+	}
+
+	s.mu.Lock()
+	s.drained = true
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *session) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until cond (evaluated under the session lock) holds or timeout elapses
+func (s *session) wait(ctx context.Context, timeout time.Duration, cond func() bool) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(50 * time.Millisecond)
+	defer poll.Stop()
+
+	for {
+		s.mu.Lock()
+		ok := cond()
+		s.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			s.mu.Lock()
+			ok := cond()
+			s.mu.Unlock()
+			return ok
+		case <-s.changed:
+		case <-poll.C:
+		}
+	}
+}
+
+// waitTerminal returns the events after mark up to the terminal event for correlationID
+func (s *session) waitTerminal(ctx context.Context, timeout time.Duration, mark int, correlationID string) ([]*protocol.Event, bool) {
+	ok := s.wait(ctx, timeout, func() bool {
+		return s.hasTerminal(mark, correlationID) || s.drained
+	})
+
+	events := s.eventsSince(mark)
+	for i, evt := range events {
+		if evt.CorrelationID == correlationID && isTerminal(evt) {
+			return events[:i+1], ok
+		}
+	}
+	return events, false
+}
+
+// hasTerminal must be called with s.mu held
+func (s *session) hasTerminal(mark int, correlationID string) bool {
+	for _, evt := range s.events[min(mark, len(s.events)):] {
+		if evt.CorrelationID == correlationID && isTerminal(evt) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitDrained waits for the pump to observe stdout closing
+func (s *session) waitDrained(timeout time.Duration) {
+	s.wait(context.Background(), timeout, func() bool { return s.drained })
+}
+
+func (s *session) isDrained() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.drained
+}
+
+func (s *session) eventCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func (s *session) eventsSince(mark int) []*protocol.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*protocol.Event(nil), s.events[min(mark, len(s.events)):]...)
+}
+
+func (s *session) heartbeatsSnapshot() []observedHeartbeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]observedHeartbeat(nil), s.heartbeats...)
+}
+
+// kill stops the agent if a check left it running
+func (s *session) kill() {
+	if !s.sup.IsRunning() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = s.sup.Stop(ctx)
+}
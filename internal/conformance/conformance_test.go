@@ -0,0 +1,138 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildMockAgent(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mockagent")
+	out, err := exec.Command("go", "build", "-o", path, "../../cmd/mockagent").CombinedOutput()
+	require.NoError(t, err, "build mockagent: %s", out)
+	return path
+}
+
+func caseByName(t *testing.T, report *Report, name string) Case {
+	t.Helper()
+	for _, c := range report.Cases {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no case %q in report", name)
+	return Case{}
+}
+
+func TestRunMockAgentPasses(t *testing.T) {
+	mock := buildMockAgent(t)
+
+	report, err := Run(context.Background(), Options{
+		AgentCmd:          []string{mock, "-type", "builder", "-heartbeat-interval", "200ms"},
+		Role:              protocol.AgentTypeBuilder,
+		HeartbeatInterval: 200 * time.Millisecond,
+		Timeout:           5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	require.True(t, report.Passed(), text.String())
+
+	names := make([]string, 0, len(report.Cases))
+	for _, c := range report.Cases {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{
+		CheckStartup, CheckHeartbeatCadence, CheckCorrelationIDs, CheckIdempotentReplay,
+		CheckCleanShutdown, CheckSchemaValidity, CheckOversizeMessage,
+	}, names)
+}
+
+func TestRunReportsMisbehavingAgent(t *testing.T) {
+	// Emits one heartbeat with an invalid status, then ignores every command
+	script := filepath.Join(t.TempDir(), "agent.sh")
+	body := `#!/bin/sh
+echo '{"kind":"heartbeat","agent":{"agent_type":"builder"},"seq":1,"status":"sleeping","pid":1,"uptime_s":0,"last_activity_at":"2025-10-20T14:08:18Z"}'
+cat >/dev/null
+`
+	require.NoError(t, os.WriteFile(script, []byte(body), 0o755))
+
+	report, err := Run(context.Background(), Options{
+		AgentCmd:          []string{script},
+		Role:              protocol.AgentTypeBuilder,
+		HeartbeatInterval: 100 * time.Millisecond,
+		Timeout:           500 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.False(t, report.Passed())
+
+	assert.True(t, caseByName(t, report, CheckStartup).Passed)
+	assert.False(t, caseByName(t, report, CheckHeartbeatCadence).Passed)
+	assert.False(t, caseByName(t, report, CheckCorrelationIDs).Passed)
+	assert.True(t, caseByName(t, report, CheckIdempotentReplay).Skipped)
+	assert.True(t, caseByName(t, report, CheckCleanShutdown).Passed)
+	assert.False(t, caseByName(t, report, CheckOversizeMessage).Passed)
+
+	schemaCase := caseByName(t, report, CheckSchemaValidity)
+	assert.False(t, schemaCase.Passed)
+	require.NotEmpty(t, schemaCase.Details)
+	assert.Contains(t, schemaCase.Details[0], "$.status")
+}
+
+func TestRunRejectsBadOptions(t *testing.T) {
+	_, err := Run(context.Background(), Options{Role: protocol.AgentTypeBuilder})
+	assert.Error(t, err)
+
+	_, err = Run(context.Background(), Options{AgentCmd: []string{"true"}, Role: "wizard"})
+	assert.Error(t, err)
+}
+
+func TestReportWriters(t *testing.T) {
+	report := &Report{
+		Agent:     "./agent",
+		Role:      protocol.AgentTypeReviewer,
+		StartedAt: time.Date(2025, 10, 20, 14, 0, 0, 0, time.UTC),
+		Duration:  1500 * time.Millisecond,
+		Cases: []Case{
+			{Name: CheckStartup, Passed: true, Message: "ok"},
+			{Name: CheckCorrelationIDs, Message: "wrong id", Details: []string{"review.completed has correlation_id \"x\""}},
+			{Name: CheckIdempotentReplay, Skipped: true, Message: "first command did not complete"},
+		},
+	}
+	assert.Equal(t, 2, report.Failures())
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	out := text.String()
+	assert.Contains(t, out, "PASS  startup")
+	assert.Contains(t, out, "FAIL  correlation_ids")
+	assert.Contains(t, out, "SKIP  idempotent_replay")
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(out), "FAILED: 1/3 checks passed in 1.5s"))
+
+	var junit bytes.Buffer
+	require.NoError(t, report.WriteJUnit(&junit))
+
+	var parsed junitTestSuites
+	require.NoError(t, xml.Unmarshal(junit.Bytes(), &parsed))
+	require.Len(t, parsed.Suites, 1)
+	suite := parsed.Suites[0]
+	assert.Equal(t, "lorch.conformance.reviewer", suite.Name)
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	require.NotNil(t, suite.Cases[1].Failure)
+	assert.Equal(t, "wrong id", suite.Cases[1].Failure.Message)
+	assert.Contains(t, suite.Cases[1].Failure.Body, "correlation_id")
+}
@@ -0,0 +1,169 @@
+package conformance
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Report is the outcome of one conformance run
+type Report struct {
+	Agent     string
+	Role      protocol.AgentType
+	StartedAt time.Time
+	Duration  time.Duration
+	Cases     []Case
+}
+
+// Case is the result of a single check
+type Case struct {
+	Name     string
+	Passed   bool
+	Skipped  bool
+	Message  string
+	Details  []string
+	Duration time.Duration
+}
+
+// Passed reports whether every check passed; skipped checks count as failures
+func (r *Report) Passed() bool {
+	for _, c := range r.Cases {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Failures counts checks that did not pass
+func (r *Report) Failures() int {
+	n := 0
+	for _, c := range r.Cases {
+		if !c.Passed {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText renders a human-readable pass/fail summary
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Conformance: %s (role %s)\n\n", r.Agent, r.Role)
+	for _, c := range r.Cases {
+		status := "PASS"
+		switch {
+		case c.Skipped:
+			status = "SKIP"
+		case !c.Passed:
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "  %-4s  %-18s %s\n", status, c.Name, c.Message)
+		for _, d := range c.Details {
+			fmt.Fprintf(&b, "          - %s\n", d)
+		}
+	}
+
+	result := "PASSED"
+	if !r.Passed() {
+		result = "FAILED"
+	}
+	fmt.Fprintf(&b, "\n%s: %d/%d checks passed in %s\n", result, len(r.Cases)-r.Failures(), len(r.Cases), r.Duration.Round(time.Millisecond))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit renders the report as JUnit XML for CI systems
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("lorch.conformance.%s", r.Role),
+		Tests:     len(r.Cases),
+		Time:      seconds(r.Duration),
+		Timestamp: r.StartedAt.Format(time.RFC3339),
+	}
+
+	for _, c := range r.Cases {
+		tc := junitTestCase{
+			Name:      c.Name,
+			ClassName: suite.Name,
+			Time:      seconds(c.Duration),
+		}
+		body := strings.Join(c.Details, "\n")
+		switch {
+		case c.Skipped:
+			suite.Skipped++
+			tc.Skipped = &junitMessage{Message: c.Message}
+		case !c.Passed:
+			suite.Failures++
+			tc.Failure = &junitMessage{Message: c.Message, Body: body}
+		default:
+			tc.SystemOut = c.Message
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func passed(name string, start time.Time, format string, args ...any) Case {
+	return Case{Name: name, Passed: true, Message: fmt.Sprintf(format, args...), Duration: time.Since(start)}
+}
+
+func failed(name string, start time.Time, format string, args ...any) Case {
+	return Case{Name: name, Message: fmt.Sprintf(format, args...), Duration: time.Since(start)}
+}
+
+func skipped(names []string, reason string) []Case {
+	cases := make([]Case, 0, len(names))
+	for _, name := range names {
+		cases = append(cases, Case{Name: name, Skipped: true, Message: reason})
+	}
+	return cases
+}
@@ -18,7 +18,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // DefaultSearchPaths enumerates the directories inspected (relative to workspace root).
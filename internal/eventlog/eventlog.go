@@ -7,7 +7,8 @@ import (
 	"sync"
 
 	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"log/slog"
 )
 
@@ -17,6 +18,9 @@ type EventLog struct {
 	encoder *ndjson.Encoder
 	logger  *slog.Logger
 	mu      sync.Mutex
+
+	// redactor removes secrets before messages are written
+	redactor *redact.Redactor
 }
 
 // NewEventLog creates a new event log
@@ -42,12 +46,20 @@ func NewEventLog(logPath string, logger *slog.Logger) (*EventLog, error) {
 	}, nil
 }
 
+// SetRedactor removes secrets from commands, events and logs before they
+// are written. The idempotency keys of redacted commands are unchanged.
+func (l *EventLog) SetRedactor(r *redact.Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = r
+}
+
 // WriteCommand writes a command to the log
 func (l *EventLog) WriteCommand(cmd *protocol.Command) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	return l.encoder.Encode(cmd)
+	return l.encoder.Encode(l.redactor.Command(cmd))
 }
 
 // WriteEvent writes an event to the log
@@ -55,7 +67,7 @@ func (l *EventLog) WriteEvent(evt *protocol.Event) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	return l.encoder.Encode(evt)
+	return l.encoder.Encode(l.redactor.Event(evt))
 }
 
 // WriteHeartbeat writes a heartbeat to the log
@@ -71,7 +83,7 @@ func (l *EventLog) WriteLog(log *protocol.Log) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	return l.encoder.Encode(log)
+	return l.encoder.Encode(l.redactor.Log(log))
 }
 
 // Close closes the event log file
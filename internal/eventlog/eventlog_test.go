@@ -5,12 +5,14 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/google/uuid"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestEventLogWriteRead(t *testing.T) {
@@ -145,3 +147,66 @@ func TestEventLogDirectoryCreation(t *testing.T) {
 		t.Error("log directory was not created")
 	}
 }
+
+func TestEventLogRedactsCommandsKeepingIdempotencyKey(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events", "test-run.ndjson")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	eventLog, err := NewEventLog(logPath, logger)
+	if err != nil {
+		t.Fatalf("failed to create event log: %v", err)
+	}
+	red, err := redact.New(redact.Options{Env: []string{"DEPLOY_TOKEN=tok-1234567890"}})
+	if err != nil {
+		t.Fatalf("failed to create redactor: %v", err)
+	}
+	eventLog.SetRedactor(red)
+
+	cmd := &protocol.Command{
+		Kind:           protocol.MessageKindCommand,
+		MessageID:      uuid.New().String(),
+		CorrelationID:  "test-corr",
+		TaskID:         "T-001",
+		IdempotencyKey: "ik:original",
+		To:             protocol.AgentRef{AgentType: protocol.AgentTypeBuilder},
+		Action:         protocol.ActionImplement,
+		Inputs:         map[string]any{"goal": "deploy using tok-1234567890"},
+		Version:        protocol.Version{SnapshotID: "snap-test-0001"},
+		Deadline:       time.Now().Add(1 * time.Hour).UTC(),
+		Retry:          protocol.Retry{Attempt: 0, MaxAttempts: 3},
+	}
+	if err := eventLog.WriteCommand(cmd); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	if err := eventLog.Close(); err != nil {
+		t.Fatalf("failed to close event log: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if strings.Contains(string(data), "tok-1234567890") {
+		t.Fatalf("secret written to the ledger: %s", data)
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	defer file.Close()
+	msg, err := ndjson.NewDecoder(file, logger).DecodeEnvelope()
+	if err != nil {
+		t.Fatalf("failed to decode command: %v", err)
+	}
+	written := msg.(*protocol.Command)
+	if written.IdempotencyKey != "ik:original" {
+		t.Errorf("idempotency key changed to %q", written.IdempotencyKey)
+	}
+	if written.Inputs[redact.MarkerKey] == nil {
+		t.Error("expected the redaction marker in the inputs")
+	}
+	if cmd.Inputs["goal"] != "deploy using tok-1234567890" {
+		t.Error("the caller's command must not be modified")
+	}
+}
@@ -11,8 +11,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/iambrandonn/lorch/internal/agent/script"
-	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/agentsdk"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Options configures the behaviour of the fixture agent.
@@ -25,16 +25,7 @@ type Options struct {
 
 // Agent replays scripted responses for deterministic tests.
 type Agent struct {
-	role    protocol.AgentType
-	options Options
-	logger  *slog.Logger
-
-	agentID string
-
-	heartbeatSeq   int64
-	lastActivityAt time.Time
-	status         protocol.HeartbeatStatus
-	startedAt      time.Time
+	runtime *agentsdk.Agent
 }
 
 // New constructs a fixture agent for the given role and options.
@@ -51,170 +42,81 @@ func New(role string, opts Options) (*Agent, error) {
 		logger = slog.Default()
 	}
 
-	if opts.HeartbeatInterval == 0 {
-		opts.HeartbeatInterval = 10 * time.Second
+	runtime, err := agentsdk.New(agentsdk.Config{
+		Role:              agentType,
+		AgentID:           fmt.Sprintf("%s#fixture-%s", agentType, uuid.New().String()[:8]),
+		Logger:            logger,
+		HeartbeatInterval: opts.HeartbeatInterval,
+		DisableHeartbeat:  opts.DisableHeartbeat,
+		// Fixtures answer whatever snapshot the test sends
+		AllowVersionDrift: true,
+		// Scripted delays end early when lorch cancels the command
+		Capabilities: protocol.Capabilities{Cancellation: true},
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &Agent{
-		role:           agentType,
-		options:        opts,
-		logger:         logger,
-		agentID:        fmt.Sprintf("%s#fixture-%s", agentType, uuid.New().String()[:8]),
-		status:         protocol.HeartbeatStatusReady,
-		startedAt:      time.Now().UTC(),
-		lastActivityAt: time.Now().UTC(),
-	}, nil
+	a := &Agent{runtime: runtime}
+	for action, template := range opts.Script.Responses {
+		runtime.Handle(protocol.Action(action), a.replay(template))
+	}
+	return a, nil
 }
 
 // Run processes commands from stdin and writes scripted responses to stdout.
 func (a *Agent) Run(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
-	encoder := ndjson.NewEncoder(stdout, a.logger)
-	decoder := ndjson.NewDecoder(stdin, a.logger)
-
-	if !a.options.DisableHeartbeat {
-		if err := a.sendHeartbeat(encoder, protocol.HeartbeatStatusStarting, ""); err != nil {
-			return fmt.Errorf("send initial heartbeat: %w", err)
-		}
-	}
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	if !a.options.DisableHeartbeat {
-		go a.heartbeatLoop(ctx, encoder)
-	}
-
-	for {
-		msg, err := decoder.DecodeEnvelope()
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("decode envelope: %w", err)
-		}
-
-		cmd, ok := msg.(*protocol.Command)
-		if !ok {
-			a.logger.Warn("ignoring non-command message", "type", fmt.Sprintf("%T", msg))
-			continue
-		}
-
-		if err := a.handleCommand(ctx, cmd, encoder); err != nil {
-			return err
-		}
-	}
+	return a.runtime.Run(ctx, stdin, stdout)
 }
 
-func (a *Agent) heartbeatLoop(ctx context.Context, encoder *ndjson.Encoder) {
-	ticker := time.NewTicker(a.options.HeartbeatInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if err := a.sendHeartbeat(encoder, a.status, a.lastTaskID()); err != nil {
-				a.logger.Error("heartbeat error", "error", err)
-			}
+// replay returns a handler that emits the scripted events for one action
+func (a *Agent) replay(template script.ResponseTemplate) agentsdk.HandlerFunc {
+	return func(ctx context.Context, cmd *protocol.Command, e *agentsdk.Emitter) error {
+		// A scripted error simulates an agent crash
+		if template.Error != "" {
+			return agentsdk.Fatal(fmt.Errorf("scripted error: %s", template.Error))
 		}
-	}
-}
-
-func (a *Agent) handleCommand(ctx context.Context, cmd *protocol.Command, encoder *ndjson.Encoder) error {
-	a.lastActivityAt = time.Now().UTC()
 
-	if !a.options.DisableHeartbeat {
-		a.status = protocol.HeartbeatStatusBusy
-		if err := a.sendHeartbeat(encoder, a.status, cmd.TaskID); err != nil {
-			return err
-		}
-	}
-
-	template, ok := a.options.Script.Responses[string(cmd.Action)]
-	if !ok {
-		return fmt.Errorf("no scripted response for action %q", cmd.Action)
-	}
-
-	if template.Error != "" {
-		return fmt.Errorf("scripted error: %s", template.Error)
-	}
-
-	if template.DelayMs > 0 {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(time.Duration(template.DelayMs) * time.Millisecond):
-		}
-	}
-
-	for idx, evtTemplate := range template.Events {
-		if err := a.sendEvent(cmd, evtTemplate, encoder); err != nil {
-			return fmt.Errorf("send scripted event %d: %w", idx, err)
+		if template.DelayMs > 0 {
+			select {
+			case <-ctx.Done():
+				return agentsdk.Fatal(ctx.Err())
+			case <-time.After(time.Duration(template.DelayMs) * time.Millisecond):
+			}
 		}
-	}
 
-	if !a.options.DisableHeartbeat {
-		a.status = protocol.HeartbeatStatusReady
-		if err := a.sendHeartbeat(encoder, a.status, ""); err != nil {
-			return err
+		for idx, evtTemplate := range template.Events {
+			evt, err := buildEvent(e, cmd, evtTemplate)
+			if err != nil {
+				return err
+			}
+			if err := e.Emit(evt); err != nil {
+				return agentsdk.Fatal(fmt.Errorf("send scripted event %d: %w", idx, err))
+			}
 		}
+		return nil
 	}
-
-	return nil
 }
 
-func (a *Agent) sendEvent(cmd *protocol.Command, tmpl script.EventTemplate, encoder *ndjson.Encoder) error {
+// buildEvent builds a scripted event, writing any artifacts with content
+// under the working directory
+func buildEvent(e *agentsdk.Emitter, cmd *protocol.Command, tmpl script.EventTemplate) (protocol.Event, error) {
 	var artifacts []protocol.Artifact
 	for _, art := range tmpl.Artifacts {
-		artifacts = append(artifacts, protocol.Artifact{
-			Path:   art.Path,
-			SHA256: art.SHA256,
-			Size:   art.Size,
-		})
-	}
-
-	evt := protocol.Event{
-		Kind:          protocol.MessageKindEvent,
-		MessageID:     uuid.New().String(),
-		CorrelationID: cmd.CorrelationID,
-		TaskID:        cmd.TaskID,
-		From: protocol.AgentRef{
-			AgentType: a.role,
-			AgentID:   a.agentID,
-		},
-		Event:      tmpl.Type,
-		Status:     tmpl.Status,
-		Payload:    tmpl.Payload,
-		Artifacts:  artifacts,
-		OccurredAt: time.Now().UTC(),
-	}
-
-	return encoder.Encode(evt)
-}
-
-func (a *Agent) sendHeartbeat(encoder *ndjson.Encoder, status protocol.HeartbeatStatus, taskID string) error {
-	a.heartbeatSeq++
-	hb := protocol.Heartbeat{
-		Kind: protocol.MessageKindHeartbeat,
-		Agent: protocol.AgentRef{
-			AgentType: a.role,
-			AgentID:   a.agentID,
-		},
-		Seq:            a.heartbeatSeq,
-		Status:         status,
-		PID:            0,
-		PPID:           0,
-		UptimeS:        time.Since(a.startedAt).Seconds(),
-		LastActivityAt: a.lastActivityAt,
-		TaskID:         taskID,
+		artifact, err := art.Artifact(".")
+		if err != nil {
+			return protocol.Event{}, err
+		}
+		artifacts = append(artifacts, artifact)
 	}
-	return encoder.Encode(hb)
-}
 
-func (a *Agent) lastTaskID() string {
-	// Heartbeats only need to know the last task ID if status is busy; we default to empty string.
-	return ""
+	// Scripted events carry exactly what the fixture specifies
+	evt := e.NewEvent(cmd, tmpl.Type)
+	evt.ObservedVersion = nil
+	evt.Status = tmpl.Status
+	evt.Payload = tmpl.Payload
+	evt.Artifacts = artifacts
+	return evt, nil
 }
 
 func normalizeRole(role string) protocol.AgentType {
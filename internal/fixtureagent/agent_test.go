@@ -12,7 +12,7 @@ import (
 	"time"
 
 	"github.com/iambrandonn/lorch/internal/agent/script"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestAgentReplaysScriptedEvents(t *testing.T) {
@@ -58,13 +58,22 @@ func TestAgentReplaysScriptedEvents(t *testing.T) {
 		t.Fatalf("Run() error = %v", err)
 	}
 
+	// The agent opens with a hello, then answers the command
 	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
-	if len(lines) != 1 {
-		t.Fatalf("expected 1 event, got %d", len(lines))
+	if len(lines) != 2 {
+		t.Fatalf("expected hello and 1 event, got %d lines", len(lines))
+	}
+
+	var hello protocol.Hello
+	if err := json.Unmarshal([]byte(lines[0]), &hello); err != nil {
+		t.Fatalf("unmarshal hello: %v", err)
+	}
+	if hello.Kind != protocol.MessageKindHello {
+		t.Fatalf("expected first message to be hello, got %q", hello.Kind)
 	}
 
 	var event protocol.Event
-	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
 		t.Fatalf("unmarshal event: %v", err)
 	}
 
@@ -0,0 +1,228 @@
+// Package gitrepo drives git for lorch's opt-in git mode: a run works on its
+// own lorch/<run_id> branch, starts only from a clean workspace, and every
+// accepted step becomes a commit whose trailers link it to the
+// task, step, idempotency key and receipt.
+package gitrepo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// BranchPrefix starts the name of every run branch
+const BranchPrefix = "lorch/"
+
+// Commit identity used when the repository has none configured
+const (
+	fallbackName  = "lorch"
+	fallbackEmail = "lorch@localhost"
+)
+
+// Commit trailer keys
+const (
+	TrailerRun            = "Lorch-Run"
+	TrailerTask           = "Lorch-Task"
+	TrailerStep           = "Lorch-Step"
+	TrailerIdempotencyKey = "Lorch-Idempotency-Key"
+	TrailerReceipt        = "Lorch-Receipt"
+)
+
+// ErrNotRepository is returned when the workspace is not inside a git work
+// tree
+var ErrNotRepository = errors.New("workspace is not inside a git work tree")
+
+// BranchName returns the branch a run works on
+func BranchName(runID string) string {
+	return BranchPrefix + runID
+}
+
+// Repo is the git work tree holding a lorch workspace. Commands run in the
+// workspace root and only look at paths below it, leaving out lorch's own
+// files (state, events, receipts, logs, snapshots, transcripts, lorch.json).
+type Repo struct {
+	dir string
+}
+
+// Open returns the repository containing workspaceRoot
+func Open(workspaceRoot string) (*Repo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git mode needs the git command: %w", err)
+	}
+	r := &Repo{dir: workspaceRoot}
+	out, err := r.git("rev-parse", "--is-inside-work-tree")
+	if err != nil || strings.TrimSpace(out) != "true" {
+		return nil, fmt.Errorf("%w: %s", ErrNotRepository, workspaceRoot)
+	}
+	return r, nil
+}
+
+// Dir returns the workspace root the repository was opened at
+func (r *Repo) Dir() string {
+	return r.dir
+}
+
+// Changes lists the workspace paths with uncommitted changes, untracked
+// files included, in sorted order
+func (r *Repo) Changes() ([]string, error) {
+	out, err := r.git(append([]string{"status", "--porcelain", "--untracked-files=all", "--"}, workspacePathspec()...)...)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) > 3 {
+			paths = append(paths, line[3:])
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// CurrentBranch returns the checked-out branch, or "" on a detached HEAD
+func (r *Repo) CurrentBranch() (string, error) {
+	out, err := r.git("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		if _, headErr := r.git("rev-parse", "--verify", "--quiet", "HEAD"); headErr == nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// BranchExists reports whether a local branch exists
+func (r *Repo) BranchExists(name string) bool {
+	_, err := r.git("show-ref", "--verify", "--quiet", "refs/heads/"+name)
+	return err == nil
+}
+
+// CreateBranch creates name at HEAD and checks it out
+func (r *Repo) CreateBranch(name string) error {
+	_, err := r.git("checkout", "-q", "-b", name)
+	return err
+}
+
+// Checkout switches to an existing branch. Uncommitted changes are carried
+// over, as git allows.
+func (r *Repo) Checkout(name string) error {
+	_, err := r.git("checkout", "-q", name)
+	return err
+}
+
+// Head returns the commit HEAD points at
+func (r *Repo) Head() (string, error) {
+	out, err := r.git("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Step identifies the step a commit records
+type Step struct {
+	RunID          string
+	TaskID         string
+	Action         protocol.Action
+	Step           int
+	IdempotencyKey string
+	// Receipt is the receipt path relative to the workspace root
+	Receipt string
+}
+
+// Message returns the commit message for the step, with trailers linking it
+// to the run's records
+func (s Step) Message() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "lorch: %s %s (step %d)\n\n", s.Action, s.TaskID, s.Step)
+	fmt.Fprintf(&b, "%s: %s\n", TrailerRun, s.RunID)
+	fmt.Fprintf(&b, "%s: %s\n", TrailerTask, s.TaskID)
+	fmt.Fprintf(&b, "%s: %d\n", TrailerStep, s.Step)
+	fmt.Fprintf(&b, "%s: %s\n", TrailerIdempotencyKey, s.IdempotencyKey)
+	fmt.Fprintf(&b, "%s: %s\n", TrailerReceipt, filepath.ToSlash(s.Receipt))
+	return b.String()
+}
+
+// CommitStep stages every change in the workspace and commits it for step.
+// It returns the new commit, or "" when the step changed nothing.
+func (r *Repo) CommitStep(step Step) (string, error) {
+	return r.commitAll(step.Message())
+}
+
+// CommitTask commits whatever a task left uncommitted in the workspace, so
+// none of its work is lost when its worktree goes. It returns the new
+// commit, or "" when there was nothing left.
+func (r *Repo) CommitTask(runID, taskID string) (string, error) {
+	message := fmt.Sprintf("lorch: finish %s\n\n%s: %s\n%s: %s\n", taskID, TrailerRun, runID, TrailerTask, taskID)
+	return r.commitAll(message)
+}
+
+// commitAll stages every change in the workspace and commits it with
+// message, returning the new commit or "" when nothing changed
+func (r *Repo) commitAll(message string) (string, error) {
+	pathspec := workspacePathspec()
+	if _, err := r.git(append([]string{"add", "-A", "--"}, pathspec...)...); err != nil {
+		return "", err
+	}
+	if _, err := r.git(append([]string{"diff", "--cached", "--quiet", "--"}, pathspec...)...); err == nil {
+		return "", nil
+	}
+
+	args := append([]string{"commit", "-q", "--no-verify", "-F", "-", "--"}, pathspec...)
+	if _, err := r.run(message, r.identity(), args...); err != nil {
+		return "", err
+	}
+	return r.Head()
+}
+
+// identity supplies lorch's commit identity when the repository has none
+func (r *Repo) identity() []string {
+	if _, err := r.git("config", "user.email"); err == nil {
+		return nil
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=" + fallbackName, "GIT_AUTHOR_EMAIL=" + fallbackEmail,
+		"GIT_COMMITTER_NAME=" + fallbackName, "GIT_COMMITTER_EMAIL=" + fallbackEmail,
+	}
+}
+
+func (r *Repo) git(args ...string) (string, error) {
+	return r.run("", nil, args...)
+}
+
+// run runs git in the workspace with input on stdin and env added to the
+// environment, and returns its output; failures carry git's error message
+func (r *Repo) run(input string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Stdin = strings.NewReader(input)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// workspacePathspec selects the workspace without lorch's own files
+func workspacePathspec() []string {
+	pathspec := []string{"."}
+	for _, name := range snapshot.ReservedRoots() {
+		pathspec = append(pathspec, ":(exclude)"+name)
+	}
+	return pathspec
+}
@@ -0,0 +1,300 @@
+package gitrepo
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// initRepo creates a local repository with one commit holding src/main.go
+func initRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	run(t, dir, "init", "-q", "-b", "main")
+	run(t, dir, "config", "user.name", "Test")
+	run(t, dir, "config", "user.email", "test@example.com")
+	writeFile(t, dir, "src/main.go", "package src\n")
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-q", "-m", "initial")
+	return dir
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func writeFile(t *testing.T, dir, path, content string) {
+	t.Helper()
+	full := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenRejectsNonRepository(t *testing.T) {
+	_, err := Open(t.TempDir())
+	if !errors.Is(err, ErrNotRepository) {
+		t.Fatalf("expected ErrNotRepository, got %v", err)
+	}
+}
+
+func TestChangesIgnoresLorchFiles(t *testing.T) {
+	dir := initRepo(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, dir, "state/run.json", "{}")
+	writeFile(t, dir, "receipts/T-1/step-1.json", "{}")
+	writeFile(t, dir, "lorch.json", "{}")
+	changes, err := repo.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("lorch's own files reported as changes: %v", changes)
+	}
+
+	writeFile(t, dir, "src/main.go", "package src\n\n// edited\n")
+	writeFile(t, dir, "docs/notes.md", "notes\n")
+	changes, err = repo.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changes, ",") != "docs/notes.md,src/main.go" {
+		t.Errorf("changes = %v, want docs/notes.md and src/main.go", changes)
+	}
+}
+
+func TestCommitStep(t *testing.T) {
+	dir := initRepo(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch(BranchName("run-1")); err != nil {
+		t.Fatal(err)
+	}
+	if branch, err := repo.CurrentBranch(); err != nil || branch != "lorch/run-1" {
+		t.Fatalf("current branch = %q, %v", branch, err)
+	}
+
+	step := Step{
+		RunID:          "run-1",
+		TaskID:         "T-1",
+		Action:         protocol.ActionImplement,
+		Step:           1,
+		IdempotencyKey: "ik-abc",
+		Receipt:        "receipts/T-1/step-1.json",
+	}
+	writeFile(t, dir, "src/feature.go", "package src\n\nfunc Feature() {}\n")
+	writeFile(t, dir, "receipts/T-1/step-1.json", "{}")
+	commit, err := repo.CommitStep(step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit == "" {
+		t.Fatal("expected a commit")
+	}
+
+	files := strings.Fields(run(t, dir, "show", "--name-only", "--format=", commit))
+	if strings.Join(files, ",") != "src/feature.go" {
+		t.Errorf("commit contains %v, want only src/feature.go", files)
+	}
+	trailers := run(t, dir, "log", "-1", "--format=%(trailers:only,unfold)", commit)
+	for _, want := range []string{
+		"Lorch-Run: run-1",
+		"Lorch-Task: T-1",
+		"Lorch-Step: 1",
+		"Lorch-Idempotency-Key: ik-abc",
+		"Lorch-Receipt: receipts/T-1/step-1.json",
+	} {
+		if !strings.Contains(trailers, want) {
+			t.Errorf("trailers missing %q:\n%s", want, trailers)
+		}
+	}
+	if subject := strings.TrimSpace(run(t, dir, "log", "-1", "--format=%s", commit)); subject != "lorch: implement T-1 (step 1)" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	// A step that changed nothing is not committed
+	step.Step = 2
+	if commit, err := repo.CommitStep(step); err != nil || commit != "" {
+		t.Errorf("empty step committed as %q (%v)", commit, err)
+	}
+}
+
+func TestCommitTask(t *testing.T) {
+	dir := initRepo(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit, err := repo.CommitTask("run-1", "T-1"); err != nil || commit != "" {
+		t.Fatalf("clean workspace committed as %q (%v)", commit, err)
+	}
+
+	writeFile(t, dir, "SPEC.md", "# Spec\n")
+	writeFile(t, dir, "receipts/T-1/step-3.json", "{}")
+	commit, err := repo.CommitTask("run-1", "T-1")
+	if err != nil || commit == "" {
+		t.Fatalf("expected a commit, got %q (%v)", commit, err)
+	}
+	if files := strings.TrimSpace(run(t, dir, "show", "--name-only", "--format=", commit)); files != "SPEC.md" {
+		t.Errorf("commit contains %q, want only SPEC.md", files)
+	}
+	if subject := strings.TrimSpace(run(t, dir, "log", "-1", "--format=%s", commit)); subject != "lorch: finish T-1" {
+		t.Errorf("subject = %q", subject)
+	}
+	if trailers := run(t, dir, "log", "-1", "--format=%(trailers:only,unfold)", commit); !strings.Contains(trailers, "Lorch-Task: T-1") {
+		t.Errorf("trailers missing the task:\n%s", trailers)
+	}
+}
+
+func TestCommitStepWithoutIdentity(t *testing.T) {
+	dir := t.TempDir()
+	run(t, dir, "init", "-q", "-b", "main")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, dir, "src/main.go", "package src\n")
+	commit, err := repo.CommitStep(Step{RunID: "run-1", TaskID: "T-1", Action: protocol.ActionImplement, Step: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if author := strings.TrimSpace(run(t, dir, "log", "-1", "--format=%an <%ae>", commit)); author != "lorch <lorch@localhost>" {
+		t.Errorf("author = %q", author)
+	}
+}
+
+// taskWorktree adds a worktree for a task of run-1 and commits content to
+// path in it
+func taskWorktree(t *testing.T, repo *Repo, taskID, path, content string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), taskID)
+	if err := repo.AddWorktree(dir, TaskBranchName("run-1", taskID)); err != nil {
+		t.Fatal(err)
+	}
+	task, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, path, content)
+	if _, err := task.CommitStep(Step{RunID: "run-1", TaskID: taskID, Action: protocol.ActionImplement, Step: 1}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMergeTask(t *testing.T) {
+	dir := initRepo(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch(BranchName("run-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	first := taskWorktree(t, repo, "T-1", "src/a.go", "package src\n")
+	second := taskWorktree(t, repo, "T-2", "src/b.go", "package src\n")
+	for _, task := range []string{"T-1", "T-2"} {
+		conflicts, err := repo.MergeTask("run-1", task, TaskBranchName("run-1", task))
+		if err != nil || len(conflicts) > 0 {
+			t.Fatalf("merge %s: conflicts %v, err %v", task, conflicts, err)
+		}
+	}
+	if branch, _ := repo.CurrentBranch(); branch != "lorch/run-1" {
+		t.Errorf("merged onto %q", branch)
+	}
+	for _, path := range []string{"src/a.go", "src/b.go"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("%s not merged: %v", path, err)
+		}
+	}
+	trailers := run(t, dir, "log", "-1", "--format=%(trailers:only,unfold)")
+	if !strings.Contains(trailers, "Lorch-Task: T-2") || !strings.Contains(trailers, "Lorch-Run: run-1") {
+		t.Errorf("merge trailers:\n%s", trailers)
+	}
+
+	for _, wt := range []string{first, second} {
+		if err := repo.RemoveWorktree(wt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.DeleteBranch(TaskBranchName("run-1", "T-1")); err != nil {
+		t.Fatal(err)
+	}
+	if repo.BranchExists(TaskBranchName("run-1", "T-1")) {
+		t.Error("task branch not deleted")
+	}
+}
+
+func TestAddWorktreeReusesBranch(t *testing.T) {
+	dir := initRepo(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := taskWorktree(t, repo, "T-1", "src/a.go", "package src\n")
+	if err := repo.RemoveWorktree(first); err != nil {
+		t.Fatal(err)
+	}
+	again := filepath.Join(t.TempDir(), "T-1")
+	if err := repo.AddWorktree(again, TaskBranchName("run-1", "T-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(again, "src", "a.go")); err != nil {
+		t.Errorf("the existing branch's commits should be checked out: %v", err)
+	}
+}
+
+func TestMergeTaskConflict(t *testing.T) {
+	dir := initRepo(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskWorktree(t, repo, "T-1", "src/shared.go", "package src\n\n// T-1\n")
+	taskWorktree(t, repo, "T-2", "src/shared.go", "package src\n\n// T-2\n")
+	if conflicts, err := repo.MergeTask("run-1", "T-1", TaskBranchName("run-1", "T-1")); err != nil || len(conflicts) > 0 {
+		t.Fatalf("first merge: conflicts %v, err %v", conflicts, err)
+	}
+
+	conflicts, err := repo.MergeTask("run-1", "T-2", TaskBranchName("run-1", "T-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(conflicts, ",") != "src/shared.go" {
+		t.Fatalf("conflicts = %v, want src/shared.go", conflicts)
+	}
+	if !repo.Merging() {
+		t.Fatal("conflicted merge should stay in progress")
+	}
+	if err := repo.AbortMerge(); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Merging() {
+		t.Error("merge still in progress after abort")
+	}
+}
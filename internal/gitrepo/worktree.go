@@ -0,0 +1,91 @@
+package gitrepo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TaskBranchName returns the branch a task works on when the run's tasks
+// run in parallel, each in its own worktree
+func TaskBranchName(runID, taskID string) string {
+	return BranchName(runID) + "-" + taskID
+}
+
+// Toplevel returns the root of the work tree
+func (r *Repo) Toplevel() (string, error) {
+	out, err := r.git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// AddWorktree checks out branch in a new worktree at path. The branch is
+// created at HEAD unless it exists, in which case it keeps its commits.
+func (r *Repo) AddWorktree(path, branch string) error {
+	if r.BranchExists(branch) {
+		_, err := r.git("worktree", "add", "-q", path, branch)
+		return err
+	}
+	_, err := r.git("worktree", "add", "-q", "-b", branch, path)
+	return err
+}
+
+// RemoveWorktree deletes the worktree at path, discarding anything in it
+// that was not committed. Callers check the worktree's Changes first, so
+// only lorch's own files are ever discarded.
+func (r *Repo) RemoveWorktree(path string) error {
+	_, err := r.git("worktree", "remove", "--force", path)
+	return err
+}
+
+// DeleteBranch deletes a local branch, merged or not
+func (r *Repo) DeleteBranch(name string) error {
+	_, err := r.git("branch", "-q", "-D", name)
+	return err
+}
+
+// MergeTask merges a task branch into the current branch with a merge
+// commit carrying the run and task trailers. When the merge stops on
+// conflicts it returns the conflicted paths and leaves the merge in
+// progress, for the user to resolve or abort.
+func (r *Repo) MergeTask(runID, taskID, branch string) ([]string, error) {
+	subject := "lorch: merge " + taskID
+	trailers := fmt.Sprintf("%s: %s\n%s: %s", TrailerRun, runID, TrailerTask, taskID)
+	_, mergeErr := r.run("", r.identity(), "merge", "-q", "--no-ff", "--no-verify", "-m", subject, "-m", trailers, branch)
+	if mergeErr == nil {
+		return nil, nil
+	}
+	conflicts, err := r.Conflicts()
+	if err != nil || len(conflicts) == 0 {
+		return nil, mergeErr
+	}
+	return conflicts, nil
+}
+
+// Conflicts lists the paths with unresolved merge conflicts
+func (r *Repo) Conflicts() ([]string, error) {
+	out, err := r.git("diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// Merging reports whether a merge is in progress
+func (r *Repo) Merging() bool {
+	_, err := r.git("rev-parse", "--quiet", "--verify", "MERGE_HEAD")
+	return err == nil
+}
+
+// AbortMerge abandons the merge in progress and restores the work tree
+func (r *Repo) AbortMerge() error {
+	_, err := r.git("merge", "--abort")
+	return err
+}
+
+// HasMerged reports whether every commit of branch is reachable from HEAD
+func (r *Repo) HasMerged(branch string) bool {
+	_, err := r.git("merge-base", "--is-ancestor", branch, "HEAD")
+	return err == nil
+}
@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"sort"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // CanonicalJSON converts a value to deterministic JSON by recursively sorting map keys
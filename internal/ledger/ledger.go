@@ -3,11 +3,12 @@ package ledger
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Ledger represents a parsed event log with all messages categorized
@@ -18,7 +19,9 @@ type Ledger struct {
 	Logs       []*protocol.Log
 }
 
-// ReadLedger reads and parses an NDJSON ledger file
+// ReadLedger reads and parses an NDJSON ledger file. Lines may be as long
+// as the configured message size limit (ndjson.DefaultLimit), the same one
+// the supervisor and the event log apply.
 func ReadLedger(path string) (*Ledger, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -34,10 +37,10 @@ func ReadLedger(path string) (*Ledger, error) {
 	}
 
 	scanner := bufio.NewScanner(file)
-	// Set buffer size to match NDJSON protocol limit (256 KiB)
-	// Default scanner buffer is 64 KiB which would truncate larger messages
-	buf := make([]byte, ndjson.MaxMessageSize)
-	scanner.Buffer(buf, ndjson.MaxMessageSize)
+	// The default 64 KiB buffer grows as needed, up to the limit; a line
+	// terminator past the limit still fits
+	limit := ndjson.DefaultLimit()
+	scanner.Buffer(make([]byte, 64*1024), limit+1)
 
 	lineNum := 0
 
@@ -93,6 +96,9 @@ func ReadLedger(path string) (*Ledger, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d: message exceeds the %d byte size limit (policy.message_max_bytes): %w", lineNum+1, limit, err)
+		}
 		return nil, fmt.Errorf("error reading ledger: %w", err)
 	}
 
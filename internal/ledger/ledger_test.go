@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestReadLedger(t *testing.T) {
@@ -277,6 +279,31 @@ func TestLargeMessageHandling(t *testing.T) {
 	}
 }
 
+func TestReadLedgerUsesConfiguredLimit(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "large.ndjson")
+
+	// A 512 KiB line: over the 256 KiB default, under a raised limit
+	pad := strings.Repeat("x", 512*1024)
+	line := `{"kind":"event","message_id":"e-1","correlation_id":"corr-1","task_id":"T-1","from":{"agent_type":"builder"},"event":"builder.completed","status":"success","payload":{"pad":"` + pad + `"},"occurred_at":"2025-01-01T00:00:00Z"}` + "\n"
+	if err := os.WriteFile(ledgerPath, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer ndjson.SetDefaultLimit(0)
+	if _, err := ReadLedger(ledgerPath); err == nil || !strings.Contains(err.Error(), "policy.message_max_bytes") {
+		t.Fatalf("expected the line to exceed the default limit, got %v", err)
+	}
+
+	ndjson.SetDefaultLimit(1024 * 1024)
+	ledger, err := ReadLedger(ledgerPath)
+	if err != nil {
+		t.Fatalf("ReadLedger() error = %v", err)
+	}
+	if len(ledger.Events) != 1 || ledger.Events[0].Payload["pad"] != pad {
+		t.Error("the large event was not read back whole")
+	}
+}
+
 // Helper function to write test ledger
 func writeTestLedger(path string, messages []interface{}) error {
 	dir := filepath.Dir(path)
@@ -2,21 +2,105 @@ package ndjson
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"regexp"
+	"sync/atomic"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
-// MaxMessageSize is the maximum NDJSON message size (256 KiB)
+// MaxMessageSize is the default NDJSON message size limit (256 KiB), used
+// when policy.message_max_bytes is not set
 const MaxMessageSize = 256 * 1024
 
+// Bounds on a configured message size limit
+const (
+	MinMessageSizeLimit = 4 * 1024
+	MaxMessageSizeLimit = 16 * 1024 * 1024
+)
+
+var defaultLimit atomic.Int64
+
+// SetDefaultLimit sets the size limit of encoders and decoders created
+// afterwards, from policy.message_max_bytes. Values outside
+// (0, MaxMessageSizeLimit] restore MaxMessageSize.
+func SetDefaultLimit(n int) {
+	if n <= 0 || n > MaxMessageSizeLimit {
+		n = 0
+	}
+	defaultLimit.Store(int64(n))
+}
+
+// DefaultLimit returns the size limit new encoders and decoders start with
+func DefaultLimit() int {
+	if n := defaultLimit.Load(); n > 0 {
+		return int(n)
+	}
+	return MaxMessageSize
+}
+
+// ErrStreamBroken wraps read failures after which the decoder cannot make
+// progress (closed pipe, I/O error). Callers should stop reading.
+var ErrStreamBroken = errors.New("ndjson stream broken")
+
+// oversizeHeadBytes is how much of an oversize line is searched for the
+// fields that identify it
+const oversizeHeadBytes = 4 * 1024
+
+// OversizeError reports a line over the decoder's limit. The line has been
+// skipped, so the decoder can go on reading. Kind, MessageID, CorrelationID
+// and TaskID are recovered from the start of the line when present.
+type OversizeError struct {
+	Line          int
+	Size          int
+	Limit         int
+	Kind          string
+	MessageID     string
+	CorrelationID string
+	TaskID        string
+}
+
+func (e *OversizeError) Error() string {
+	msg := fmt.Sprintf("line %d size %d exceeds limit %d", e.Line, e.Size, e.Limit)
+	if e.MessageID != "" {
+		msg += fmt.Sprintf(" (%s %s)", e.Kind, e.MessageID)
+	}
+	return msg
+}
+
+var headFields = map[string]*regexp.Regexp{}
+
+func init() {
+	for _, field := range []string{"kind", "message_id", "correlation_id", "task_id"} {
+		headFields[field] = regexp.MustCompile(`"` + field + `"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+	}
+}
+
+// headField returns the first string value of field in an oversize line's
+// head. The line is not valid JSON once cut, so this is a best effort: it
+// relies on encoders writing the envelope fields before the payload.
+func headField(head []byte, field string) string {
+	m := headFields[field].FindSubmatch(head)
+	if m == nil {
+		return ""
+	}
+	var value string
+	if err := json.Unmarshal(append(append([]byte{'"'}, m[1]...), '"'), &value); err != nil {
+		return string(m[1])
+	}
+	return value
+}
+
 // Encoder writes NDJSON messages to an output stream
 type Encoder struct {
 	writer *bufio.Writer
 	logger *slog.Logger
+	limit  int
 }
 
 // NewEncoder creates a new NDJSON encoder
@@ -24,6 +108,16 @@ func NewEncoder(w io.Writer, logger *slog.Logger) *Encoder {
 	return &Encoder{
 		writer: bufio.NewWriter(w),
 		logger: logger,
+		limit:  DefaultLimit(),
+	}
+}
+
+// SetLimit changes the maximum encoded message size, e.g. to the configured
+// limit or the size an agent declared during the handshake. Values outside
+// (0, MaxMessageSizeLimit] are ignored.
+func (e *Encoder) SetLimit(n int) {
+	if n > 0 && n <= MaxMessageSizeLimit {
+		e.limit = n
 	}
 }
 
@@ -36,12 +130,12 @@ func (e *Encoder) Encode(v any) error {
 	}
 
 	// Check size limit
-	if len(data) > MaxMessageSize {
+	if len(data) > e.limit {
 		e.logger.Error("message exceeds size limit",
 			"size", len(data),
-			"limit", MaxMessageSize,
-			"overflow", len(data)-MaxMessageSize)
-		return fmt.Errorf("message size %d exceeds limit %d", len(data), MaxMessageSize)
+			"limit", e.limit,
+			"overflow", len(data)-e.limit)
+		return fmt.Errorf("message size %d exceeds limit %d", len(data), e.limit)
 	}
 
 	// Write JSON + newline
@@ -62,45 +156,98 @@ func (e *Encoder) Encode(v any) error {
 
 // Decoder reads NDJSON messages from an input stream
 type Decoder struct {
-	scanner *bufio.Scanner
+	reader  *bufio.Reader
 	logger  *slog.Logger
 	lineNum int
+	limit   int
+	line    []byte
 }
 
 // NewDecoder creates a new NDJSON decoder
 func NewDecoder(r io.Reader, logger *slog.Logger) *Decoder {
-	scanner := bufio.NewScanner(r)
-
-	// Set custom buffer with max size enforcement
-	buf := make([]byte, MaxMessageSize)
-	scanner.Buffer(buf, MaxMessageSize)
-
 	return &Decoder{
-		scanner: scanner,
+		reader:  bufio.NewReaderSize(r, 64*1024),
 		logger:  logger,
 		lineNum: 0,
+		limit:   DefaultLimit(),
 	}
 }
 
-// Decode reads the next NDJSON message
-func (d *Decoder) Decode(v any) error {
-	if !d.scanner.Scan() {
-		if err := d.scanner.Err(); err != nil {
-			return fmt.Errorf("scanner error at line %d: %w", d.lineNum, err)
+// SetLimit changes the maximum line size. Values outside
+// (0, MaxMessageSizeLimit] are ignored.
+func (d *Decoder) SetLimit(n int) {
+	if n > 0 && n <= MaxMessageSizeLimit {
+		d.limit = n
+	}
+}
+
+// readLine reads the next line without its line ending. Lines over the
+// limit are consumed but only their start is kept; the returned size is the
+// full length.
+func (d *Decoder) readLine() ([]byte, int, error) {
+	d.line = d.line[:0]
+	size := 0
+	newline := false
+	for {
+		chunk, err := d.reader.ReadSlice('\n')
+		size += len(chunk)
+		if len(d.line) <= d.limit {
+			d.line = append(d.line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
 		}
-		return io.EOF
+		if err == io.EOF {
+			if size == 0 {
+				return nil, 0, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("read error at line %d: %w: %w", d.lineNum+1, ErrStreamBroken, err)
+		}
+		newline = true
+		break
+	}
+
+	if newline {
+		size--
+	}
+	if size > d.limit {
+		return d.line, size, nil
+	}
+	d.line = bytes.TrimSuffix(d.line[:size], []byte("\r"))
+	return d.line, len(d.line), nil
+}
+
+// Decode reads the next NDJSON message. A line over the limit is skipped
+// and reported as an *OversizeError; decoding can continue after it.
+func (d *Decoder) Decode(v any) error {
+	data, size, err := d.readLine()
+	if err != nil {
+		return err
 	}
 
 	d.lineNum++
-	data := d.scanner.Bytes()
 
-	// Check size (should be caught by scanner buffer, but double-check)
-	if len(data) > MaxMessageSize {
+	if size > d.limit {
+		head := data[:min(oversizeHeadBytes, len(data))]
+		oversize := &OversizeError{
+			Line:          d.lineNum,
+			Size:          size,
+			Limit:         d.limit,
+			Kind:          headField(head, "kind"),
+			MessageID:     headField(head, "message_id"),
+			CorrelationID: headField(head, "correlation_id"),
+			TaskID:        headField(head, "task_id"),
+		}
 		d.logger.Error("line exceeds size limit",
 			"line", d.lineNum,
-			"size", len(data),
-			"limit", MaxMessageSize)
-		return fmt.Errorf("line %d size %d exceeds limit %d", d.lineNum, len(data), MaxMessageSize)
+			"size", size,
+			"limit", d.limit,
+			"kind", oversize.Kind,
+			"message_id", oversize.MessageID)
+		return oversize
 	}
 
 	// Skip empty lines
@@ -120,6 +267,12 @@ func (d *Decoder) Decode(v any) error {
 	return nil
 }
 
+// Raw returns the bytes of the most recently decoded line. The slice is only
+// valid until the next call to Decode or DecodeEnvelope.
+func (d *Decoder) Raw() []byte {
+	return d.line
+}
+
 // DecodeEnvelope reads and routes a message based on its kind
 func (d *Decoder) DecodeEnvelope() (any, error) {
 	// First decode into a map to peek at the "kind" field
@@ -168,6 +321,27 @@ func (d *Decoder) DecodeEnvelope() (any, error) {
 		}
 		return &log, nil
 
+	case protocol.MessageKindHello:
+		var hello protocol.Hello
+		if err := json.Unmarshal(data, &hello); err != nil {
+			return nil, fmt.Errorf("line %d: failed to decode hello: %w", d.lineNum, err)
+		}
+		return &hello, nil
+
+	case protocol.MessageKindHelloAck:
+		var ack protocol.HelloAck
+		if err := json.Unmarshal(data, &ack); err != nil {
+			return nil, fmt.Errorf("line %d: failed to decode hello_ack: %w", d.lineNum, err)
+		}
+		return &ack, nil
+
+	case protocol.MessageKindCancel:
+		var cancel protocol.Cancel
+		if err := json.Unmarshal(data, &cancel); err != nil {
+			return nil, fmt.Errorf("line %d: failed to decode cancel: %w", d.lineNum, err)
+		}
+		return &cancel, nil
+
 	default:
 		d.logger.Warn("unknown message kind",
 			"line", d.lineNum,
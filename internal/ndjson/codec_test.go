@@ -2,6 +2,7 @@ package ndjson
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,7 +10,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestEncoderDecoder(t *testing.T) {
@@ -190,6 +191,36 @@ func TestDecodeEnvelope(t *testing.T) {
 			},
 			wantType: "*protocol.Heartbeat",
 		},
+		{
+			name: "hello",
+			message: protocol.Hello{
+				Kind:             protocol.MessageKindHello,
+				Agent:            protocol.AgentRef{AgentType: protocol.AgentTypeBuilder},
+				ProtocolVersions: []int{1},
+				SupportedActions: []protocol.Action{protocol.ActionImplement},
+			},
+			wantType: "*protocol.Hello",
+		},
+		{
+			name: "hello_ack",
+			message: protocol.HelloAck{
+				Kind:            protocol.MessageKindHelloAck,
+				Accepted:        true,
+				ProtocolVersion: 1,
+			},
+			wantType: "*protocol.HelloAck",
+		},
+		{
+			name: "cancel",
+			message: protocol.Cancel{
+				Kind:          protocol.MessageKindCancel,
+				MessageID:     "cancel-001",
+				CorrelationID: "corr-001",
+				TaskID:        "T-001",
+				IssuedAt:      time.Now().UTC(),
+			},
+			wantType: "*protocol.Cancel",
+		},
 	}
 
 	for _, tt := range tests {
@@ -360,3 +391,77 @@ func TestMultipleMessages(t *testing.T) {
 		t.Errorf("expected EOF after all messages, got %v", err)
 	}
 }
+
+func TestEncoderSetLimit(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	encoder := NewEncoder(&buf, logger)
+	encoder.SetLimit(64)
+
+	err := encoder.Encode(map[string]string{"data": strings.Repeat("x", 64)})
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit 64") {
+		t.Errorf("expected the lowered limit to apply, got: %v", err)
+	}
+
+	// Limits above the largest configurable limit are ignored
+	encoder.SetLimit(MaxMessageSizeLimit + 1)
+	if err := encoder.Encode(map[string]string{"data": strings.Repeat("x", 64)}); err == nil {
+		t.Error("expected the previous limit to remain in force")
+	}
+}
+
+func TestDecoderSkipsOversizeLine(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	oversize := `{"kind":"event","message_id":"e-big","correlation_id":"c-1","task_id":"T-1","payload":{"data":"` +
+		strings.Repeat("x", 8192) + `"}}`
+	next := `{"kind":"log","level":"info","message":"after","timestamp":"2025-10-19T12:00:00Z"}`
+
+	decoder := NewDecoder(strings.NewReader(oversize+"\n"+next+"\n"), logger)
+	decoder.SetLimit(4096)
+
+	_, err := decoder.DecodeEnvelope()
+	var oe *OversizeError
+	if !errors.As(err, &oe) {
+		t.Fatalf("expected an OversizeError, got %v", err)
+	}
+	if oe.Size != len(oversize) || oe.Limit != 4096 || oe.Line != 1 {
+		t.Errorf("unexpected size details: %+v", oe)
+	}
+	if oe.Kind != "event" || oe.MessageID != "e-big" || oe.CorrelationID != "c-1" || oe.TaskID != "T-1" {
+		t.Errorf("expected the message to be identified, got %+v", oe)
+	}
+	if errors.Is(err, ErrStreamBroken) {
+		t.Error("an oversize line must not break the stream")
+	}
+
+	msg, err := decoder.DecodeEnvelope()
+	if err != nil {
+		t.Fatalf("expected decoding to continue, got %v", err)
+	}
+	if log, ok := msg.(*protocol.Log); !ok || log.Message != "after" {
+		t.Errorf("unexpected message after the oversize line: %#v", msg)
+	}
+	if string(decoder.Raw()) != next {
+		t.Errorf("Raw returned %q", decoder.Raw())
+	}
+	if _, err := decoder.DecodeEnvelope(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestDecoderRaisedLimit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	line := `{"data":"` + strings.Repeat("x", MaxMessageSize) + `"}`
+
+	decoder := NewDecoder(strings.NewReader(line+"\r\n"), logger)
+	decoder.SetLimit(2 * MaxMessageSize)
+
+	var msg map[string]any
+	if err := decoder.Decode(&msg); err != nil {
+		t.Fatalf("expected a line under the raised limit to decode, got %v", err)
+	}
+	if len(msg["data"].(string)) != MaxMessageSize {
+		t.Error("line was not decoded whole")
+	}
+}
@@ -0,0 +1,114 @@
+package receipt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+	"github.com/iambrandonn/lorch/internal/fsutil"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Reasons an artifact fails verification
+const (
+	ArtifactOutsideWorkspace = "outside_workspace"
+	ArtifactMissing          = "missing"
+	ArtifactTooLarge         = "too_large"
+	ArtifactInvalidChecksum  = "invalid_checksum"
+	ArtifactSizeMismatch     = "size_mismatch"
+	ArtifactChecksumMismatch = "checksum_mismatch"
+)
+
+// ArtifactFailure records a reported artifact that did not match the
+// workspace
+type ArtifactFailure struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// PartialWrite reports whether the failure looks like a write that had not
+// finished (or was interrupted) when the agent reported it. Sending the
+// command again with the same idempotency key can repair it; the other
+// failures are policy violations that a retry would repeat.
+func (f ArtifactFailure) PartialWrite() bool {
+	switch f.Reason {
+	case ArtifactMissing, ArtifactSizeMismatch, ArtifactChecksumMismatch:
+		return true
+	}
+	return false
+}
+
+func (f ArtifactFailure) String() string {
+	if f.Detail == "" {
+		return fmt.Sprintf("%s: %s", f.Path, f.Reason)
+	}
+	return fmt.Sprintf("%s: %s (%s)", f.Path, f.Reason, f.Detail)
+}
+
+// VerifyArtifacts checks reported artifacts against the workspace: each
+// path must resolve inside it, the file must exist, be no larger than
+// maxBytes (zero means no cap) and match the reported size and checksum.
+// An artifact reported more than once is checked as last reported. It
+// returns the failures in report order.
+func VerifyArtifacts(workspaceRoot string, artifacts []protocol.Artifact, maxBytes int64) []ArtifactFailure {
+	latest := make(map[string]int, len(artifacts))
+	for i, artifact := range artifacts {
+		latest[artifact.Path] = i
+	}
+
+	var failures []ArtifactFailure
+	for i, artifact := range artifacts {
+		if latest[artifact.Path] != i {
+			continue
+		}
+		if failure := verifyArtifact(workspaceRoot, artifact, maxBytes); failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+	return failures
+}
+
+func verifyArtifact(workspaceRoot string, artifact protocol.Artifact, maxBytes int64) *ArtifactFailure {
+	fail := func(reason, format string, args ...any) *ArtifactFailure {
+		return &ArtifactFailure{Path: artifact.Path, Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	path, err := fsutil.ResolveWorkspacePath(workspaceRoot, artifact.Path)
+	if err != nil {
+		return fail(ArtifactOutsideWorkspace, "%v", err)
+	}
+	if maxBytes > 0 && artifact.Size > maxBytes {
+		return fail(ArtifactTooLarge, "reported %d bytes, cap is %d", artifact.Size, maxBytes)
+	}
+	if !strings.HasPrefix(artifact.SHA256, "sha256:") || len(artifact.SHA256) != 71 {
+		return fail(ArtifactInvalidChecksum, "%q is not a sha256:<hex> checksum", artifact.SHA256)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fail(ArtifactMissing, "file does not exist")
+		}
+		return fail(ArtifactMissing, "%v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fail(ArtifactMissing, "not a regular file")
+	}
+	if maxBytes > 0 && info.Size() > maxBytes {
+		return fail(ArtifactTooLarge, "file is %d bytes, cap is %d", info.Size(), maxBytes)
+	}
+	if info.Size() != artifact.Size {
+		return fail(ArtifactSizeMismatch, "reported %d bytes, file is %d", artifact.Size, info.Size())
+	}
+
+	sum, err := checksum.SHA256File(path)
+	if err != nil {
+		return fail(ArtifactMissing, "%v", err)
+	}
+	if sum != artifact.SHA256 {
+		return fail(ArtifactChecksumMismatch, "file is %s", sum)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package receipt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func TestVerifyArtifacts(t *testing.T) {
+	workspace := t.TempDir()
+	content := []byte("package main\n")
+	if err := os.MkdirAll(filepath.Join(workspace, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "src", "main.go"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	good := protocol.Artifact{Path: "src/main.go", SHA256: checksum.SHA256Bytes(content), Size: int64(len(content))}
+
+	if failures := VerifyArtifacts(workspace, []protocol.Artifact{good}, 0); len(failures) != 0 {
+		t.Fatalf("expected no failures, got %v", failures)
+	}
+
+	otherSum := checksum.SHA256Bytes([]byte("other"))
+	tests := []struct {
+		name     string
+		artifact protocol.Artifact
+		maxBytes int64
+		reason   string
+		partial  bool
+	}{
+		{"escapes workspace", protocol.Artifact{Path: "../outside.go", SHA256: good.SHA256, Size: good.Size}, 0, ArtifactOutsideWorkspace, false},
+		{"missing", protocol.Artifact{Path: "src/absent.go", SHA256: good.SHA256, Size: good.Size}, 0, ArtifactMissing, true},
+		{"over cap", good, 4, ArtifactTooLarge, false},
+		{"bad checksum format", protocol.Artifact{Path: good.Path, SHA256: "md5:abc", Size: good.Size}, 0, ArtifactInvalidChecksum, false},
+		{"size mismatch", protocol.Artifact{Path: good.Path, SHA256: good.SHA256, Size: good.Size + 1}, 0, ArtifactSizeMismatch, true},
+		{"checksum mismatch", protocol.Artifact{Path: good.Path, SHA256: otherSum, Size: good.Size}, 0, ArtifactChecksumMismatch, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := VerifyArtifacts(workspace, []protocol.Artifact{tt.artifact}, tt.maxBytes)
+			if len(failures) != 1 {
+				t.Fatalf("expected one failure, got %v", failures)
+			}
+			if failures[0].Reason != tt.reason {
+				t.Errorf("reason = %s, want %s (%s)", failures[0].Reason, tt.reason, failures[0].Detail)
+			}
+			if failures[0].PartialWrite() != tt.partial {
+				t.Errorf("PartialWrite() = %v, want %v", failures[0].PartialWrite(), tt.partial)
+			}
+		})
+	}
+
+	// An artifact reported again is checked as last reported
+	stale := protocol.Artifact{Path: good.Path, SHA256: otherSum, Size: 1}
+	if failures := VerifyArtifacts(workspace, []protocol.Artifact{stale, good}, 0); len(failures) != 0 {
+		t.Errorf("expected the later report to win, got %v", failures)
+	}
+}
+
+func TestReconcileOutputs(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "README.md"), []byte("hi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected := []protocol.ExpectedOutput{
+		{Path: "src/a.go", Required: true},
+		{Path: "specs/SPEC.md", Required: true},
+		{Path: "README.md", Required: true},
+		{Path: "docs/optional.md"},
+		{Path: "src/b.go", Required: true},
+	}
+	artifacts := []protocol.Artifact{{Path: "./src/a.go", SHA256: "sha256:aa", Size: 1}}
+	snap := &snapshot.Manifest{Files: []snapshot.FileInfo{{Path: "specs/SPEC.md", SHA256: "sha256:bb", Size: 2}}}
+
+	got := ReconcileOutputs(workspace, expected, artifacts, snap)
+	want := []string{OutputReported, OutputPresent, OutputPresent, OutputMissing, OutputMissing}
+	for i, status := range got {
+		if status.Status != want[i] {
+			t.Errorf("%s: status %s, want %s", status.Path, status.Status, want[i])
+		}
+	}
+	if got[3].Failed() || !got[4].Failed() {
+		t.Error("only missing required outputs count as failed")
+	}
+}
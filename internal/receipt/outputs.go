@@ -0,0 +1,95 @@
+package receipt
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+	"github.com/iambrandonn/lorch/internal/fsutil"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Status of an expected output after its command completed
+const (
+	// OutputReported: the agent reported the output as an artifact
+	OutputReported = "reported"
+	// OutputPresent: not reported, but the file is in the workspace
+	OutputPresent = "present"
+	// OutputMissing: the file was not produced
+	OutputMissing = "missing"
+)
+
+// OutputStatus records whether one of a command's expected outputs was
+// produced
+type OutputStatus struct {
+	Path     string `json:"path"`
+	Required bool   `json:"required"`
+	Status   string `json:"status"`
+	SHA256   string `json:"sha256,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// Failed reports whether a required output was not produced
+func (o OutputStatus) Failed() bool {
+	return o.Required && o.Status == OutputMissing
+}
+
+// ReconcileOutputs checks each expected output against the artifacts the
+// agent reported and, for outputs it did not report, the workspace after the
+// command: the snapshot when one is given, then the file itself for paths
+// the snapshot does not track.
+func ReconcileOutputs(workspaceRoot string, expected []protocol.ExpectedOutput, artifacts []protocol.Artifact, snap *snapshot.Manifest) []OutputStatus {
+	if len(expected) == 0 {
+		return nil
+	}
+
+	reported := make(map[string]protocol.Artifact, len(artifacts))
+	for _, artifact := range artifacts {
+		reported[cleanPath(artifact.Path)] = artifact
+	}
+	tracked := make(map[string]snapshot.FileInfo)
+	if snap != nil {
+		for _, file := range snap.Files {
+			tracked[file.Path] = file
+		}
+	}
+
+	statuses := make([]OutputStatus, 0, len(expected))
+	for _, output := range expected {
+		status := OutputStatus{Path: output.Path, Required: output.Required, Status: OutputMissing}
+		key := cleanPath(output.Path)
+		if artifact, ok := reported[key]; ok {
+			status.Status, status.SHA256, status.Size = OutputReported, artifact.SHA256, artifact.Size
+		} else if file, ok := tracked[key]; ok {
+			status.Status, status.SHA256, status.Size = OutputPresent, file.SHA256, file.Size
+		} else if sum, size, ok := workspaceFile(workspaceRoot, output.Path); ok {
+			status.Status, status.SHA256, status.Size = OutputPresent, sum, size
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// workspaceFile returns the checksum and size of a regular file inside the
+// workspace
+func workspaceFile(workspaceRoot, relative string) (string, int64, bool) {
+	path, err := fsutil.ResolveWorkspacePath(workspaceRoot, relative)
+	if err != nil {
+		return "", 0, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", 0, false
+	}
+	sum, err := checksum.SHA256File(path)
+	if err != nil {
+		return "", 0, false
+	}
+	return sum, info.Size(), true
+}
+
+// cleanPath normalizes a workspace-relative path the way snapshots record it
+func cleanPath(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/iambrandonn/lorch/internal/fsutil"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Receipt represents a record of completed work for a command
@@ -27,6 +29,35 @@ type Receipt struct {
 	Events           []string             `json:"events"`
 	CreatedAt        time.Time            `json:"created_at"`
 
+	// Usage aggregates LLM consumption reported by the step's events
+	Usage *protocol.Usage `json:"usage,omitempty"`
+
+	// Cancellation records how the command was stopped when it did not
+	// complete: whether the agent acknowledged the cancel, or was signalled
+	Cancellation *protocol.CancelOutcome `json:"cancellation,omitempty"`
+
+	// Resources is what the agent's processes consumed during the step, as
+	// measured by lorch, and any resource limit it was killed for
+	Resources *protocol.ResourceUsage `json:"resources,omitempty"`
+
+	// ArtifactFailures lists the reported artifacts that did not match the
+	// workspace when lorch verified them
+	ArtifactFailures []ArtifactFailure `json:"artifact_failures,omitempty"`
+
+	// Outputs records whether each of the command's expected outputs was
+	// produced. OutputsAccepted is set when a human accepted the step even
+	// though required outputs were missing.
+	Outputs         []OutputStatus `json:"outputs,omitempty"`
+	OutputsAccepted bool           `json:"outputs_accepted,omitempty"`
+
+	// PostSnapshotID is the snapshot of the workspace captured after the
+	// step, for builder steps; SnapshotID is the one before it
+	PostSnapshotID string `json:"post_snapshot_id,omitempty"`
+
+	// VersionMismatches lists the step's events that observed a different
+	// snapshot than the one the command was pinned to
+	VersionMismatches []VersionMismatch `json:"version_mismatches,omitempty"`
+
 	// Intake traceability metadata (P2.4 Task C)
 	// These fields link receipts back to their natural language intake origins
 	TaskTitle           string   `json:"task_title,omitempty"`            // Human-readable task description from orchestration
@@ -35,6 +66,52 @@ type Receipt struct {
 	IntakeCorrelationID string   `json:"intake_correlation_id,omitempty"` // Links back to intake conversation
 	Clarifications      []string `json:"clarifications,omitempty"`        // User clarifications from intake negotiation
 	ConflictResolutions []string `json:"conflict_resolutions,omitempty"`  // Conflict resolution choices
+
+	// Redacted is set when secrets were removed from the fields above
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// VersionMismatch is an event whose observed_version did not match the
+// snapshot its command was pinned to
+type VersionMismatch struct {
+	MessageID string `json:"message_id"`
+	Event     string `json:"event"`
+	Expected  string `json:"expected_snapshot"`
+	Observed  string `json:"observed_snapshot"`
+}
+
+func (m VersionMismatch) String() string {
+	return fmt.Sprintf("%s observed %s, expected %s", m.Event, m.Observed, m.Expected)
+}
+
+// Redact removes secrets from the receipt's free-text intake fields. The
+// idempotency key is left alone.
+func (r *Receipt) Redact(red *redact.Redactor) {
+	if red == nil {
+		return
+	}
+	changed := false
+	redactString := func(s *string) {
+		if out, ok := red.String(*s); ok {
+			*s = out
+			changed = true
+		}
+	}
+	redactString(&r.TaskTitle)
+	redactString(&r.Instruction)
+	redactString(&r.ApprovedPlan)
+	// The slices may share storage with the command's inputs
+	r.Clarifications = append([]string(nil), r.Clarifications...)
+	for i := range r.Clarifications {
+		redactString(&r.Clarifications[i])
+	}
+	r.ConflictResolutions = append([]string(nil), r.ConflictResolutions...)
+	for i := range r.ConflictResolutions {
+		redactString(&r.ConflictResolutions[i])
+	}
+	if changed {
+		r.Redacted = true
+	}
 }
 
 // extractString safely extracts a string value from the inputs map.
@@ -108,8 +185,9 @@ func extractIntakeCorrelationID(correlationID string) string {
 // NewReceipt creates a new receipt from a command and its resulting events.
 // Extracts intake traceability metadata from command inputs if present (P2.4 Task C).
 func NewReceipt(cmd *protocol.Command, step int, events []*protocol.Event) *Receipt {
-	// Collect all artifacts from events
-	var artifacts []protocol.Artifact
+	// Collect all artifacts from events; the schema requires an array even when empty
+	artifacts := []protocol.Artifact{}
+	var usage *protocol.Usage
 	eventIDs := make([]string, 0, len(events))
 
 	for _, evt := range events {
@@ -117,6 +195,12 @@ func NewReceipt(cmd *protocol.Command, step int, events []*protocol.Event) *Rece
 		if evt.Artifacts != nil {
 			artifacts = append(artifacts, evt.Artifacts...)
 		}
+		if evt.Usage != nil {
+			if usage == nil {
+				usage = &protocol.Usage{}
+			}
+			usage.Add(*evt.Usage)
+		}
 	}
 
 	// Extract intake traceability metadata from command inputs
@@ -147,6 +231,7 @@ func NewReceipt(cmd *protocol.Command, step int, events []*protocol.Event) *Rece
 		Artifacts:        artifacts,
 		Events:           eventIDs,
 		CreatedAt:        time.Now().UTC(),
+		Usage:            usage,
 
 		// Intake traceability (P2.4 Task C)
 		TaskTitle:           taskTitle,
@@ -158,8 +243,12 @@ func NewReceipt(cmd *protocol.Command, step int, events []*protocol.Event) *Rece
 	}
 }
 
-// WriteReceipt writes a receipt to disk atomically
+// WriteReceipt validates a receipt against schemas/v1 and writes it to disk
+// atomically. In strict mode a receipt with violations is not written.
 func WriteReceipt(receipt *Receipt, path string) error {
+	if err := schema.DefaultEnforcer().CheckValue("receipt", schema.Receipt, receipt); err != nil {
+		return fmt.Errorf("refusing to write receipt: %w", err)
+	}
 	return fsutil.AtomicWriteJSON(path, receipt)
 }
 
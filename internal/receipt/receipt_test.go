@@ -1,12 +1,17 @@
 package receipt
 
 import (
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestWriteAndReadReceipt(t *testing.T) {
@@ -479,3 +484,215 @@ func TestExtractIntakeCorrelationID(t *testing.T) {
 		})
 	}
 }
+
+func TestNewReceiptAggregatesUsage(t *testing.T) {
+	cmd := &protocol.Command{
+		TaskID:    "T-0042",
+		Action:    protocol.ActionImplement,
+		MessageID: "msg-cmd-001",
+	}
+
+	events := []*protocol.Event{
+		{
+			MessageID: "msg-e1",
+			Event:     protocol.EventBuilderProgress,
+			Usage:     &protocol.Usage{Model: "m1", InputTokens: 100, OutputTokens: 20, EstimatedCostUSD: 0.5},
+		},
+		{
+			MessageID: "msg-e2",
+			Event:     protocol.EventBuilderCompleted,
+			Usage:     &protocol.Usage{Model: "m1", InputTokens: 50, OutputTokens: 10, EstimatedCostUSD: 0.25},
+		},
+	}
+
+	receipt := NewReceipt(cmd, 1, events)
+	if receipt.Usage == nil {
+		t.Fatal("Usage = nil, want aggregated usage")
+	}
+	if receipt.Usage.InputTokens != 150 || receipt.Usage.OutputTokens != 30 {
+		t.Errorf("tokens = %d/%d, want 150/30", receipt.Usage.InputTokens, receipt.Usage.OutputTokens)
+	}
+	if receipt.Usage.EstimatedCostUSD != 0.75 {
+		t.Errorf("EstimatedCostUSD = %v, want 0.75", receipt.Usage.EstimatedCostUSD)
+	}
+	if receipt.Usage.Model != "m1" {
+		t.Errorf("Model = %s, want m1", receipt.Usage.Model)
+	}
+
+	// No usage reported means no usage block
+	receipt = NewReceipt(cmd, 2, []*protocol.Event{{MessageID: "msg-e3"}})
+	if receipt.Usage != nil {
+		t.Errorf("Usage = %+v, want nil", receipt.Usage)
+	}
+}
+
+func TestWriteReceiptStrictSchema(t *testing.T) {
+	validator, err := schema.Default()
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+	schema.SetDefaultEnforcer(schema.NewEnforcer(validator, schema.ModeStrict, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	t.Cleanup(func() { schema.SetDefaultEnforcer(nil) })
+
+	receipt := &Receipt{
+		TaskID:           "T-0042",
+		Step:             1,
+		Action:           string(protocol.ActionImplement),
+		IdempotencyKey:   "not-an-ik",
+		SnapshotID:       "snap-0123456789ab",
+		CommandMessageID: "cmd-0123abcd",
+		CorrelationID:    "corr-001",
+		Artifacts:        []protocol.Artifact{},
+		Events:           []string{"evt-0123abcd"},
+		CreatedAt:        time.Now().UTC(),
+	}
+
+	receiptPath := filepath.Join(t.TempDir(), "step-1.json")
+	err = WriteReceipt(receipt, receiptPath)
+	if err == nil {
+		t.Fatal("expected strict mode to reject the receipt")
+	}
+	if !strings.Contains(err.Error(), "$.idempotency_key") {
+		t.Errorf("error should name the offending field, got %v", err)
+	}
+	if _, statErr := os.Stat(receiptPath); !os.IsNotExist(statErr) {
+		t.Error("rejected receipt should not be written")
+	}
+
+	receipt.IdempotencyKey = "ik:" + strings.Repeat("a", 64)
+	if err := WriteReceipt(receipt, receiptPath); err != nil {
+		t.Fatalf("WriteReceipt() error = %v", err)
+	}
+}
+
+func TestWriteReceiptWithCancellationMatchesSchema(t *testing.T) {
+	validator, err := schema.Default()
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+	schema.SetDefaultEnforcer(schema.NewEnforcer(validator, schema.ModeStrict, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	t.Cleanup(func() { schema.SetDefaultEnforcer(nil) })
+
+	now := time.Now().UTC()
+	receipt := &Receipt{
+		TaskID:           "T-0042",
+		Step:             1,
+		Action:           string(protocol.ActionImplement),
+		IdempotencyKey:   "ik:" + strings.Repeat("a", 64),
+		SnapshotID:       "snap-0123456789ab",
+		CommandMessageID: "cmd-0123abcd",
+		CorrelationID:    "corr-001",
+		Artifacts:        []protocol.Artifact{},
+		Events:           []string{},
+		Cancellation: &protocol.CancelOutcome{
+			CorrelationID: "corr-001",
+			Reason:        "interrupt",
+			Escalation:    protocol.EscalationSIGTERM,
+			RequestedAt:   now,
+			CompletedAt:   now.Add(10 * time.Second),
+		},
+		CreatedAt: now,
+	}
+
+	receiptPath := filepath.Join(t.TempDir(), "step-1.json")
+	if err := WriteReceipt(receipt, receiptPath); err != nil {
+		t.Fatalf("WriteReceipt() error = %v", err)
+	}
+
+	loaded, err := ReadReceipt(receiptPath)
+	if err != nil {
+		t.Fatalf("ReadReceipt() error = %v", err)
+	}
+	if loaded.Cancellation == nil || loaded.Cancellation.Escalation != protocol.EscalationSIGTERM {
+		t.Errorf("Cancellation = %+v, want sigterm escalation", loaded.Cancellation)
+	}
+}
+
+func TestWriteReceiptWithResourcesMatchesSchema(t *testing.T) {
+	validator, err := schema.Default()
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+	schema.SetDefaultEnforcer(schema.NewEnforcer(validator, schema.ModeStrict, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	t.Cleanup(func() { schema.SetDefaultEnforcer(nil) })
+
+	receipt := &Receipt{
+		TaskID:           "T-0042",
+		Step:             1,
+		Action:           string(protocol.ActionImplement),
+		IdempotencyKey:   "ik:" + strings.Repeat("a", 64),
+		SnapshotID:       "snap-0123456789ab",
+		CommandMessageID: "cmd-0123abcd",
+		CorrelationID:    "corr-001",
+		Artifacts:        []protocol.Artifact{},
+		Events:           []string{},
+		Resources: &protocol.ResourceUsage{
+			Source:       protocol.ResourceSourceCgroup,
+			CPUSeconds:   12.5,
+			PeakRSSBytes: 512 << 20,
+			PeakProcs:    4,
+			LimitKill: &protocol.LimitKill{
+				Limit:  protocol.LimitMemory,
+				Detail: "killed by the kernel OOM killer at the 536870912 byte cgroup memory limit",
+				At:     time.Now().UTC(),
+			},
+		},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	receiptPath := filepath.Join(t.TempDir(), "step-1.json")
+	if err := WriteReceipt(receipt, receiptPath); err != nil {
+		t.Fatalf("WriteReceipt() error = %v", err)
+	}
+
+	loaded, err := ReadReceipt(receiptPath)
+	if err != nil {
+		t.Fatalf("ReadReceipt() error = %v", err)
+	}
+	if loaded.Resources == nil || loaded.Resources.LimitKill == nil || loaded.Resources.LimitKill.Limit != protocol.LimitMemory {
+		t.Errorf("Resources = %+v, want memory limit kill", loaded.Resources)
+	}
+}
+
+func TestReceiptRedact(t *testing.T) {
+	clarifications := []string{"use key sk-live-12345678", "keep the API stable"}
+	cmd := &protocol.Command{
+		TaskID:         "T-0042",
+		Action:         protocol.ActionImplement,
+		IdempotencyKey: "ik:test123",
+		Inputs: map[string]any{
+			"task_title":     "Rotate credentials",
+			"instruction":    "Replace sk-live-12345678 everywhere",
+			"clarifications": clarifications,
+		},
+	}
+	red, err := redact.New(redact.Options{Env: []string{"STRIPE_KEY=sk-live-12345678"}})
+	if err != nil {
+		t.Fatalf("failed to create redactor: %v", err)
+	}
+
+	receipt := NewReceipt(cmd, 1, nil)
+	receipt.Redact(red)
+
+	if !receipt.Redacted {
+		t.Error("expected the receipt to be marked as redacted")
+	}
+	if receipt.Instruction != "Replace "+redact.Marker+" everywhere" {
+		t.Errorf("Instruction = %q", receipt.Instruction)
+	}
+	if receipt.Clarifications[0] != "use key "+redact.Marker || receipt.Clarifications[1] != "keep the API stable" {
+		t.Errorf("Clarifications = %v", receipt.Clarifications)
+	}
+	if receipt.TaskTitle != "Rotate credentials" || receipt.IdempotencyKey != "ik:test123" {
+		t.Errorf("unexpected changes: title %q, key %q", receipt.TaskTitle, receipt.IdempotencyKey)
+	}
+	if clarifications[0] != "use key sk-live-12345678" {
+		t.Error("the command's inputs must not be modified")
+	}
+
+	clean := NewReceipt(&protocol.Command{TaskID: "T-1", Action: protocol.ActionImplement}, 1, nil)
+	clean.Redact(red)
+	if clean.Redacted {
+		t.Error("a receipt without secrets must not be marked as redacted")
+	}
+}
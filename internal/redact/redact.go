@@ -0,0 +1,324 @@
+// Package redact removes secrets from what lorch writes to disk or the
+// console: the values of secret environment variables, strings matching
+// configured patterns and, optionally, strings that look like random tokens.
+// Field names play no part: protocol fields such as idempotency_key are not
+// secrets.
+//
+// A nil *Redactor is valid and leaves everything unchanged, so callers can
+// hold one whether or not redaction is enabled.
+package redact
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Marker replaces every redacted value
+const Marker = "[REDACTED]"
+
+// MarkerKey is added to a redacted message's inputs, payload or fields. It
+// lists the paths of the redacted values, so readers know the message
+// differs from what was sent, and why its idempotency key cannot be
+// recomputed from the stored inputs.
+const MarkerKey = "_redacted"
+
+// minSecretLength keeps short environment values such as "1" or "true"
+// from being treated as secrets
+const minSecretLength = 8
+
+// High-entropy detection: runs of token characters at least
+// entropyMinLength long whose Shannon entropy reaches entropyThreshold bits
+// per character. Hex strings (checksums, IDs) stay below the threshold.
+const (
+	entropyMinLength = 24
+	entropyThreshold = 4.2
+)
+
+// tokenRun matches candidate tokens. "=", "_" and "-" end a token rather
+// than belong to it, so a key=value pair, a UUID or one of lorch's
+// dash-separated IDs (corr-T-0042-implement-3f9a2b1c) is scored piece by
+// piece instead of as one varied string.
+var tokenRun = regexp.MustCompile(`[A-Za-z0-9+/]{24,}`)
+
+// Options configures a Redactor
+type Options struct {
+	// Env is scanned for variables named *_TOKEN, *_KEY or *_SECRET, whose
+	// values are redacted wherever they appear (typically os.Environ()
+	// plus the agents' configured env)
+	Env []string
+	// Patterns are regular expressions whose matches are redacted
+	Patterns []string
+	// HighEntropy redacts long random-looking tokens
+	HighEntropy bool
+}
+
+// Redactor removes secrets from strings and structured messages
+type Redactor struct {
+	secrets     []string
+	patterns    []*regexp.Regexp
+	highEntropy bool
+}
+
+// New builds a Redactor. It fails if a pattern is not a valid regular
+// expression.
+func New(opts Options) (*Redactor, error) {
+	r := &Redactor{highEntropy: opts.HighEntropy}
+
+	seen := make(map[string]bool)
+	for _, kv := range opts.Env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !SecretName(name) || len(value) < minSecretLength || seen[value] {
+			continue
+		}
+		seen[value] = true
+		r.secrets = append(r.secrets, value)
+	}
+	// Longer secrets first, so one containing another is replaced whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+
+	for _, p := range opts.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// SecretName reports whether an environment variable's name marks its value
+// as a secret: it ends in _TOKEN, _KEY or _SECRET, in any case
+func SecretName(name string) bool {
+	upper := strings.ToUpper(name)
+	return strings.HasSuffix(upper, "_TOKEN") || strings.HasSuffix(upper, "_KEY") || strings.HasSuffix(upper, "_SECRET")
+}
+
+// String returns s with secrets replaced by Marker, and whether anything
+// was replaced
+func (r *Redactor) String(s string) (string, bool) {
+	if r == nil || s == "" {
+		return s, false
+	}
+	out := s
+	for _, secret := range r.secrets {
+		out = strings.ReplaceAll(out, secret, Marker)
+	}
+	for _, re := range r.patterns {
+		out = re.ReplaceAllString(out, Marker)
+	}
+	if r.highEntropy {
+		out = tokenRun.ReplaceAllStringFunc(out, func(token string) string {
+			if looksRandom(token) {
+				return Marker
+			}
+			return token
+		})
+	}
+	return out, out != s
+}
+
+// Text returns s with secrets replaced by Marker
+func (r *Redactor) Text(s string) string {
+	out, _ := r.String(s)
+	return out
+}
+
+// Fields returns a copy of m with secrets redacted, descending into nested
+// objects and arrays, and the dotted paths (under prefix) of the values it
+// changed. It returns m itself when nothing changed.
+func (r *Redactor) Fields(m map[string]any, prefix string) (map[string]any, []string) {
+	if r == nil || len(m) == 0 {
+		return m, nil
+	}
+	var paths []string
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		redacted, changed := r.value(v, path)
+		out[k] = redacted
+		paths = append(paths, changed...)
+	}
+	if len(paths) == 0 {
+		return m, nil
+	}
+	sort.Strings(paths)
+	return out, paths
+}
+
+func (r *Redactor) value(v any, path string) (any, []string) {
+	switch t := v.(type) {
+	case string:
+		if out, changed := r.String(t); changed {
+			return out, []string{path}
+		}
+		return t, nil
+	case map[string]any:
+		out, paths := r.Fields(t, path)
+		return out, paths
+	case []any:
+		var paths []string
+		var out []any
+		for i, item := range t {
+			redacted, changed := r.value(item, fmt.Sprintf("%s.%d", path, i))
+			if len(changed) > 0 && out == nil {
+				out = append([]any(nil), t...)
+			}
+			if out != nil {
+				out[i] = redacted
+			}
+			paths = append(paths, changed...)
+		}
+		if out == nil {
+			return t, nil
+		}
+		return out, paths
+	case []string:
+		var paths []string
+		out := make([]string, len(t))
+		for i, item := range t {
+			var changed bool
+			out[i], changed = r.String(item)
+			if changed {
+				paths = append(paths, fmt.Sprintf("%s.%d", path, i))
+			}
+		}
+		if len(paths) == 0 {
+			return t, nil
+		}
+		return out, paths
+	}
+	return v, nil
+}
+
+// marked returns m with the redacted paths recorded under MarkerKey
+func marked(m map[string]any, paths []string) map[string]any {
+	if len(paths) == 0 {
+		return m
+	}
+	m[MarkerKey] = paths
+	return m
+}
+
+// Command returns cmd with secrets removed from its inputs. The
+// idempotency key is kept: it was computed from the original inputs and
+// identifies the command across retries and resumes.
+func (r *Redactor) Command(cmd *protocol.Command) *protocol.Command {
+	if r == nil || cmd == nil {
+		return cmd
+	}
+	inputs, paths := r.Fields(cmd.Inputs, "")
+	if len(paths) == 0 {
+		return cmd
+	}
+	out := *cmd
+	out.Inputs = marked(inputs, paths)
+	return &out
+}
+
+// Event returns evt with secrets removed from its payload
+func (r *Redactor) Event(evt *protocol.Event) *protocol.Event {
+	if r == nil || evt == nil {
+		return evt
+	}
+	payload, paths := r.Fields(evt.Payload, "")
+	if len(paths) == 0 {
+		return evt
+	}
+	out := *evt
+	out.Payload = marked(payload, paths)
+	return &out
+}
+
+// Log returns msg with secrets removed from its message and fields
+func (r *Redactor) Log(msg *protocol.Log) *protocol.Log {
+	if r == nil || msg == nil {
+		return msg
+	}
+	message, messageChanged := r.String(msg.Message)
+	fields, paths := r.Fields(msg.Fields, "")
+	fieldsChanged := len(paths) > 0
+	if !messageChanged && !fieldsChanged {
+		return msg
+	}
+	if !fieldsChanged {
+		fields = copyMap(msg.Fields)
+	}
+	if messageChanged {
+		paths = append([]string{"message"}, paths...)
+	}
+	out := *msg
+	out.Message = message
+	out.Fields = marked(fields, paths)
+	return &out
+}
+
+func copyMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// Writer returns a writer that redacts each write before passing it on to
+// w. Secrets split across writes are not detected, so write whole lines.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	out, changed := w.r.String(string(p))
+	if !changed {
+		return w.w.Write(p)
+	}
+	if _, err := io.WriteString(w.w, out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// looksRandom reports whether a token's characters are as varied as a
+// random secret's, mixing letters and digits
+func looksRandom(token string) bool {
+	if len(token) < entropyMinLength {
+		return false
+	}
+	var letters, digits bool
+	counts := make(map[rune]int)
+	for _, c := range token {
+		counts[c]++
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			letters = true
+		}
+	}
+	if !letters || !digits {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len(token))
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= entropyThreshold
+}
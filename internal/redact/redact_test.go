@@ -0,0 +1,202 @@
+package redact
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func TestStringRedactsSecretEnvValues(t *testing.T) {
+	r, err := New(Options{Env: []string{
+		"GITHUB_TOKEN=ghp_example_value",
+		"ANTHROPIC_API_KEY=sk-ant-example",
+		"DEBUG=true",
+		"SHORT_KEY=abc",
+		"HOME=/home/someone",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, changed := r.String("push with ghp_example_value and sk-ant-example from /home/someone")
+	if !changed {
+		t.Fatal("expected the secrets to be redacted")
+	}
+	if want := "push with " + Marker + " and " + Marker + " from /home/someone"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, changed := r.String("debug=true key=abc"); changed {
+		t.Error("non-secret and short values must be left alone")
+	}
+}
+
+func TestStringRedactsPatterns(t *testing.T) {
+	r, err := New(Options{Patterns: []string{`password=\S+`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Text("login password=hunter2 ok"); got != "login "+Marker+" ok" {
+		t.Errorf("unexpected result %q", got)
+	}
+
+	if _, err := New(Options{Patterns: []string{"("}}); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+func TestStringRedactsHighEntropyTokens(t *testing.T) {
+	r, err := New(Options{HighEntropy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := "aK9xQ2mZ7vR4tB8wL1nC6pD3sF5gH0jY"
+	if got := r.Text("token " + token); got != "token "+Marker {
+		t.Errorf("expected the random token to be redacted, got %q", got)
+	}
+	for _, keep := range []string{
+		"sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"3fa85f64-5717-4562-b3fc-2c963f66afa6",
+		"implement_the_authentication_middleware",
+		"snap-20251019-141233-abcdef12",
+	} {
+		if _, changed := r.String(keep); changed {
+			t.Errorf("expected %q to be left alone", keep)
+		}
+	}
+}
+
+func TestHighEntropyKeepsLorchIDs(t *testing.T) {
+	r, err := New(Options{HighEntropy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("sending command",
+		"correlation_id", "corr-T-0042-implement-3f9a2b1c",
+		"changes_id", "corr-T-0042-implement_changes-9c4e7d1a",
+		"spec_id", "corr-T-0042-update_spec-5b8f2e6d",
+		"snapshot_id", "snap-4f2a9c1b7e3d",
+		"idempotency_key", "ik:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"message_id", "3fa85f64-5717-4562-b3fc-2c963f66afa6")
+	line := buf.String()
+	if got, changed := r.String(line); changed {
+		t.Errorf("expected the log line to be left alone, got %q", got)
+	}
+
+	// A secret logged the same way is still found
+	buf.Reset()
+	logger.Info("agent env", "api_token", "aK9xQ2mZ7vR4tB8wL1nC6pD3sF5gH0jY")
+	if got := r.Text(buf.String()); !strings.Contains(got, "api_token="+Marker) {
+		t.Errorf("expected the token to be redacted, got %q", got)
+	}
+}
+
+func TestHighEntropyKeepsDigestsAndUUIDs(t *testing.T) {
+	r, err := New(Options{HighEntropy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, keep := range []string{
+		"sha256=9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"checksum=sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"run_uuid=3fa85f64-5717-4562-b3fc-2c963f66afa6",
+		`{"message_id":"3fa85f64-5717-4562-b3fc-2c963f66afa6"}`,
+		"id=3fa85f6457174562b3fc2c963f66afa6",
+	} {
+		if got, changed := r.String(keep); changed {
+			t.Errorf("expected %q to be left alone, got %q", keep, got)
+		}
+	}
+}
+
+func TestCommandKeepsIdempotencyKey(t *testing.T) {
+	r, err := New(Options{Env: []string{"DEPLOY_TOKEN=tok-1234567890"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &protocol.Command{
+		Kind:           protocol.MessageKindCommand,
+		MessageID:      "m-1",
+		IdempotencyKey: "ik:abc",
+		Inputs: map[string]any{
+			"goal":            "deploy with tok-1234567890",
+			"idempotency_key": "ik:abc",
+			"primary_key":     "user_id",
+			"steps":           []any{"build", "tok-1234567890"},
+		},
+	}
+
+	out := r.Command(cmd)
+	if out.IdempotencyKey != "ik:abc" {
+		t.Errorf("idempotency key changed to %q", out.IdempotencyKey)
+	}
+	if out.Inputs["goal"] != "deploy with "+Marker {
+		t.Errorf("unexpected inputs %v", out.Inputs)
+	}
+	if steps := out.Inputs["steps"].([]any); steps[0] != "build" || steps[1] != Marker {
+		t.Errorf("unexpected steps %v", steps)
+	}
+	paths, _ := out.Inputs[MarkerKey].([]string)
+	if out.Inputs["idempotency_key"] != "ik:abc" || out.Inputs["primary_key"] != "user_id" {
+		t.Errorf("fields named like secrets must keep their values, got %v", out.Inputs)
+	}
+	if strings.Join(paths, ",") != "goal,steps.1" {
+		t.Errorf("unexpected marker %v", out.Inputs[MarkerKey])
+	}
+	if cmd.Inputs["goal"] != "deploy with tok-1234567890" {
+		t.Error("redaction must not modify the original command")
+	}
+	if _, ok := cmd.Inputs[MarkerKey]; ok {
+		t.Error("the marker must not be added to the original command")
+	}
+
+	clean := &protocol.Command{Inputs: map[string]any{"goal": "build"}}
+	if r.Command(clean) != clean {
+		t.Error("a command without secrets should be returned as is")
+	}
+}
+
+func TestLogRedactsMessageAndFields(t *testing.T) {
+	r, err := New(Options{Env: []string{"DB_SECRET=s3cr3t-value"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &protocol.Log{Message: "connecting with s3cr3t-value", Fields: map[string]any{"attempt": 1}}
+
+	out := r.Log(msg)
+	if out.Message != "connecting with "+Marker {
+		t.Errorf("unexpected message %q", out.Message)
+	}
+	if paths, _ := out.Fields[MarkerKey].([]string); len(paths) != 1 || paths[0] != "message" {
+		t.Errorf("unexpected marker %v", out.Fields[MarkerKey])
+	}
+	if _, ok := msg.Fields[MarkerKey]; ok {
+		t.Error("the marker must not be added to the original fields")
+	}
+}
+
+func TestWriterAndNilRedactor(t *testing.T) {
+	r, err := New(Options{Env: []string{"NPM_TOKEN=npm_abcdefgh"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := r.Writer(&buf).Write([]byte("token npm_abcdefgh\n"))
+	if err != nil || n != len("token npm_abcdefgh\n") {
+		t.Fatalf("write returned %d, %v", n, err)
+	}
+	if buf.String() != "token "+Marker+"\n" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	var none *Redactor
+	if none.Text("npm_abcdefgh") != "npm_abcdefgh" || none.Writer(&buf) != &buf {
+		t.Error("a nil redactor must leave everything unchanged")
+	}
+}
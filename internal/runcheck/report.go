@@ -0,0 +1,91 @@
+package runcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Check outcomes
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	// StatusSkip marks a criterion that could not be checked with what the
+	// run left on disk; it does not fail the run
+	StatusSkip = "skip"
+)
+
+// Report is the outcome of verifying one run
+type Report struct {
+	RunID  string  `json:"run_id"`
+	Passed bool    `json:"passed"`
+	Checks []Check `json:"checks"`
+}
+
+// Check is the result of one MASTER-SPEC §11.1 criterion
+type Check struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Failures counts checks that failed
+func (r *Report) Failures() int {
+	return r.count(StatusFail)
+}
+
+func (r *Report) count(status string) int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText renders a human-readable pass/fail summary
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Verify: run %s\n\n", r.RunID)
+	for _, c := range r.Checks {
+		fmt.Fprintf(&b, "  %-4s  %-17s %s\n", strings.ToUpper(c.Status), c.Name, c.Message)
+		for _, d := range c.Details {
+			fmt.Fprintf(&b, "          - %s\n", d)
+		}
+	}
+
+	result := "PASSED"
+	if !r.Passed {
+		result = "FAILED"
+	}
+	fmt.Fprintf(&b, "\n%s: %d/%d checks passed", result, r.count(StatusPass), len(r.Checks))
+	if skipped := r.count(StatusSkip); skipped > 0 {
+		fmt.Fprintf(&b, ", %d skipped", skipped)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON renders the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func passed(name, format string, args ...any) Check {
+	return Check{Name: name, Status: StatusPass, Message: fmt.Sprintf(format, args...)}
+}
+
+func failed(name string, details []string, format string, args ...any) Check {
+	return Check{Name: name, Status: StatusFail, Message: fmt.Sprintf(format, args...), Details: details}
+}
+
+func skipped(name, format string, args ...any) Check {
+	return Check{Name: name, Status: StatusSkip, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,301 @@
+// Package runcheck verifies a finished run against the passing-run criteria
+// of MASTER-SPEC §11.1, using what the run left in the workspace: the
+// ledger, receipts, snapshot manifest and run state.
+package runcheck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+	"github.com/iambrandonn/lorch/internal/ledger"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Check names, in the order they are reported
+const (
+	CheckArtifacts       = "artifacts"
+	CheckReviewApproved  = "review_approved"
+	CheckSpecMaintenance = "spec_maintenance"
+	CheckSpecSections    = "spec_sections"
+	CheckTerminalEvents  = "terminal_events"
+	CheckRunState        = "run_state"
+)
+
+// Options configures a verification
+type Options struct {
+	WorkspaceRoot string
+	RunID         string
+	// Baseline returns the content a file had when the run's snapshot was
+	// taken, given its path and checksum, or false when it is not known.
+	// Spec documents edited during the run can only be checked against
+	// their baseline.
+	Baseline func(path, sha256 string) ([]byte, bool)
+}
+
+// Verify checks the run against every criterion. It returns an error only
+// when the run cannot be found; unmet criteria are reported in the Report.
+func Verify(opts Options) (*Report, error) {
+	ledgerPath := filepath.Join(opts.WorkspaceRoot, "events", opts.RunID+".ndjson")
+	if _, err := os.Stat(ledgerPath); err != nil {
+		return nil, fmt.Errorf("no ledger for run %s: %w", opts.RunID, err)
+	}
+	lg, err := ledger.ReadLedger(ledgerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run state describes the latest run only
+	state, err := runstate.LoadRunState(runstate.GetRunStatePath(opts.WorkspaceRoot))
+	if err != nil || state.RunID != opts.RunID {
+		state = nil
+	}
+
+	v := &verifier{opts: opts, ledger: lg, state: state, tasks: taskIDs(lg)}
+	report := &Report{RunID: opts.RunID}
+	report.Checks = []Check{
+		v.checkArtifacts(),
+		v.checkReviewApproved(),
+		v.checkSpecMaintenance(),
+		v.checkSpecSections(),
+		v.checkTerminalEvents(),
+		v.checkRunState(),
+	}
+	report.Passed = report.Failures() == 0
+	return report, nil
+}
+
+type verifier struct {
+	opts   Options
+	ledger *ledger.Ledger
+	// state is nil when state/run.json belongs to another run
+	state *runstate.RunState
+	tasks []string
+}
+
+// checkArtifacts verifies the artifacts recorded in the run's receipts
+// against the workspace. An artifact reported by several steps is checked
+// as last reported.
+func (v *verifier) checkArtifacts() Check {
+	receipts, err := v.receipts()
+	if err != nil {
+		return failed(CheckArtifacts, nil, "cannot read receipts: %v", err)
+	}
+	var artifacts []protocol.Artifact
+	for _, rec := range receipts {
+		artifacts = append(artifacts, rec.Artifacts...)
+	}
+
+	failures := receipt.VerifyArtifacts(v.opts.WorkspaceRoot, artifacts, 0)
+	if len(failures) > 0 {
+		details := make([]string, len(failures))
+		for i, f := range failures {
+			details[i] = f.String()
+		}
+		return failed(CheckArtifacts, details, "%d artifact(s) do not match their receipts", len(failures))
+	}
+	return passed(CheckArtifacts, "%d artifact(s) in %d receipt(s) match the workspace", len(uniquePaths(artifacts)), len(receipts))
+}
+
+// checkReviewApproved requires each task's final review to be approved
+func (v *verifier) checkReviewApproved() Check {
+	var details []string
+	for _, taskID := range v.tasks {
+		evt := v.lastEvent(taskID, protocol.EventReviewCompleted)
+		switch {
+		case evt == nil:
+			details = append(details, fmt.Sprintf("%s: no review.completed", taskID))
+		case evt.Status != protocol.ReviewStatusApproved:
+			details = append(details, fmt.Sprintf("%s: final review is %s", taskID, evt.Status))
+		}
+	}
+	if len(details) > 0 {
+		return failed(CheckReviewApproved, details, "%d task(s) without an approved final review", len(details))
+	}
+	return passed(CheckReviewApproved, "final review approved for %d task(s)", len(v.tasks))
+}
+
+// checkSpecMaintenance requires each task's spec maintenance to have ended
+// with spec.updated or spec.no_changes_needed
+func (v *verifier) checkSpecMaintenance() Check {
+	var details []string
+	for _, taskID := range v.tasks {
+		evt := v.lastEvent(taskID, protocol.EventSpecUpdated, protocol.EventSpecNoChangesNeeded, protocol.EventSpecChangesRequested)
+		switch {
+		case evt == nil:
+			details = append(details, fmt.Sprintf("%s: spec maintenance did not run", taskID))
+		case evt.Event == protocol.EventSpecChangesRequested:
+			details = append(details, fmt.Sprintf("%s: last spec outcome is %s", taskID, evt.Event))
+		}
+	}
+	if len(details) > 0 {
+		return failed(CheckSpecMaintenance, details, "%d task(s) without finished spec maintenance", len(details))
+	}
+	return passed(CheckSpecMaintenance, "spec maintenance finished for %d task(s)", len(v.tasks))
+}
+
+// checkSpecSections compares each spec document in the run's snapshot with
+// the workspace and requires edits to stay in the allowed sections
+// (MASTER-SPEC §10.5)
+func (v *verifier) checkSpecSections() Check {
+	snapshotID := v.snapshotID()
+	if snapshotID == "" {
+		return skipped(CheckSpecSections, "the run's snapshot is not known")
+	}
+	manifest, err := snapshot.LoadSnapshot(filepath.Join(v.opts.WorkspaceRoot, "snapshots", snapshotID+".manifest.json"))
+	if err != nil {
+		return skipped(CheckSpecSections, "snapshot %s is not available: %v", snapshotID, err)
+	}
+
+	var details, unverified []string
+	checked := 0
+	for _, file := range manifest.Files {
+		if !isSpecDocument(file.Path) {
+			continue
+		}
+		checked++
+		path := filepath.Join(v.opts.WorkspaceRoot, filepath.FromSlash(file.Path))
+		current, err := os.ReadFile(path)
+		if err != nil {
+			details = append(details, fmt.Sprintf("%s: %v", file.Path, err))
+			continue
+		}
+		if checksum.SHA256Bytes(current) == file.SHA256 {
+			continue
+		}
+
+		var before []byte
+		ok := false
+		if v.opts.Baseline != nil {
+			before, ok = v.opts.Baseline(file.Path, file.SHA256)
+		}
+		if !ok {
+			unverified = append(unverified, file.Path)
+			continue
+		}
+		for _, violation := range SpecEditViolations(before, current) {
+			details = append(details, fmt.Sprintf("%s: %s", file.Path, violation))
+		}
+	}
+
+	switch {
+	case len(details) > 0:
+		return failed(CheckSpecSections, details, "spec documents edited outside the allowed sections")
+	case len(unverified) > 0:
+		return skipped(CheckSpecSections, "no baseline content to compare edits to %s", strings.Join(unverified, ", "))
+	}
+	return passed(CheckSpecSections, "%d spec document(s) unchanged or edited only in allowed sections", checked)
+}
+
+// checkTerminalEvents requires a terminal event for every command in the
+// ledger
+func (v *verifier) checkTerminalEvents() Check {
+	pending := v.ledger.GetPendingCommands()
+	if len(pending) > 0 {
+		details := make([]string, len(pending))
+		for i, cmd := range pending {
+			details[i] = fmt.Sprintf("%s %s (correlation %s)", cmd.TaskID, cmd.Action, cmd.CorrelationID)
+		}
+		return failed(CheckTerminalEvents, details, "%d command(s) without a terminal event", len(pending))
+	}
+	return passed(CheckTerminalEvents, "all %d command(s) have a terminal event", len(v.ledger.Commands))
+}
+
+// checkRunState requires state/run.json to show the run completed
+func (v *verifier) checkRunState() Check {
+	if v.state == nil {
+		return skipped(CheckRunState, "state/run.json is missing or belongs to another run")
+	}
+	if v.state.Status != runstate.StatusCompleted {
+		return failed(CheckRunState, nil, "run is %s (stage %s)", v.state.Status, v.state.CurrentStage)
+	}
+	return passed(CheckRunState, "run is completed")
+}
+
+// receipts returns the receipts written for the run's commands, in step
+// order per task
+func (v *verifier) receipts() ([]*receipt.Receipt, error) {
+	commands := make(map[string]bool, len(v.ledger.Commands))
+	for _, cmd := range v.ledger.Commands {
+		commands[cmd.MessageID] = true
+	}
+
+	var receipts []*receipt.Receipt
+	for _, taskID := range v.tasks {
+		all, err := receipt.ListReceipts(v.opts.WorkspaceRoot, taskID)
+		if err != nil {
+			return nil, err
+		}
+		var own []*receipt.Receipt
+		for _, rec := range all {
+			if commands[rec.CommandMessageID] {
+				own = append(own, rec)
+			}
+		}
+		sort.SliceStable(own, func(i, j int) bool { return own[i].Step < own[j].Step })
+		receipts = append(receipts, own...)
+	}
+	return receipts, nil
+}
+
+// lastEvent returns the task's last event of one of the given types
+func (v *verifier) lastEvent(taskID string, types ...string) *protocol.Event {
+	for i := len(v.ledger.Events) - 1; i >= 0; i-- {
+		evt := v.ledger.Events[i]
+		if evt.TaskID != taskID {
+			continue
+		}
+		for _, t := range types {
+			if evt.Event == t {
+				return evt
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotID is the snapshot the run started from
+func (v *verifier) snapshotID() string {
+	if v.state != nil && v.state.SnapshotID != "" {
+		return v.state.SnapshotID
+	}
+	for _, cmd := range v.ledger.Commands {
+		if cmd.Version.SnapshotID != "" {
+			return cmd.Version.SnapshotID
+		}
+	}
+	return ""
+}
+
+// taskIDs lists the tasks the run sent commands for, in order
+func taskIDs(lg *ledger.Ledger) []string {
+	var tasks []string
+	seen := make(map[string]bool)
+	for _, cmd := range lg.Commands {
+		if cmd.TaskID != "" && !seen[cmd.TaskID] {
+			seen[cmd.TaskID] = true
+			tasks = append(tasks, cmd.TaskID)
+		}
+	}
+	return tasks
+}
+
+// isSpecDocument reports whether a snapshot path is a markdown document
+// under specs/
+func isSpecDocument(path string) bool {
+	return strings.HasPrefix(path, "specs/") && strings.EqualFold(filepath.Ext(path), ".md")
+}
+
+func uniquePaths(artifacts []protocol.Artifact) map[string]bool {
+	paths := make(map[string]bool, len(artifacts))
+	for _, artifact := range artifacts {
+		paths[artifact.Path] = true
+	}
+	return paths
+}
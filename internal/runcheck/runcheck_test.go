@@ -0,0 +1,241 @@
+package runcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/runstate"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSpec = `# Spec
+
+## Requirements
+- The widget must render.
+
+## Status
+| Task | State |
+| T-1  | todo  |
+
+## Changelog
+- 2025-10-01: created
+`
+
+// completedRun lays out a workspace with a run that implemented, reviewed
+// and spec-maintained task T-1
+type completedRun struct {
+	root  string
+	runID string
+	lines [][]byte
+}
+
+func newCompletedRun(t *testing.T) *completedRun {
+	t.Helper()
+	r := &completedRun{root: t.TempDir(), runID: "run-verify"}
+
+	r.write(t, "specs/SPEC.md", testSpec)
+	snap, err := snapshot.CaptureSnapshot(r.root)
+	require.NoError(t, err)
+	require.NoError(t, snapshot.SaveSnapshot(snap, filepath.Join(r.root, "snapshots", snap.SnapshotID+".manifest.json")))
+
+	code := r.write(t, "src/widget.go", "package src\n")
+	r.step(t, snap.SnapshotID, 1, protocol.ActionImplement, protocol.EventBuilderCompleted, "success", []protocol.Artifact{code})
+	r.step(t, snap.SnapshotID, 2, protocol.ActionReview, protocol.EventReviewCompleted, protocol.ReviewStatusApproved, nil)
+	r.step(t, snap.SnapshotID, 3, protocol.ActionUpdateSpec, protocol.EventSpecUpdated, "success", nil)
+	r.saveLedger(t)
+
+	state := runstate.NewRunState(r.runID, "T-1", snap.SnapshotID)
+	state.MarkCompleted()
+	require.NoError(t, runstate.SaveRunState(state, runstate.GetRunStatePath(r.root)))
+	return r
+}
+
+func (r *completedRun) write(t *testing.T, rel, content string) protocol.Artifact {
+	t.Helper()
+	path := filepath.Join(r.root, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return protocol.Artifact{Path: rel, SHA256: checksum.SHA256Bytes([]byte(content)), Size: int64(len(content))}
+}
+
+// step records a command, its terminal event and its receipt
+func (r *completedRun) step(t *testing.T, snapshotID string, step int, action protocol.Action, event, status string, artifacts []protocol.Artifact) {
+	t.Helper()
+	cmd := protocol.Command{
+		Kind:           protocol.MessageKindCommand,
+		MessageID:      "cmd-" + string(action),
+		CorrelationID:  "corr-" + string(action),
+		TaskID:         "T-1",
+		IdempotencyKey: "ik-" + string(action),
+		Action:         action,
+		Version:        protocol.Version{SnapshotID: snapshotID},
+	}
+	evt := protocol.Event{
+		Kind:          protocol.MessageKindEvent,
+		MessageID:     "evt-" + string(action),
+		CorrelationID: cmd.CorrelationID,
+		TaskID:        "T-1",
+		Event:         event,
+		Status:        status,
+		Artifacts:     artifacts,
+		OccurredAt:    time.Now().UTC(),
+	}
+	r.add(t, cmd)
+	r.add(t, evt)
+
+	rec := &receipt.Receipt{
+		TaskID:           "T-1",
+		Step:             step,
+		Action:           string(action),
+		IdempotencyKey:   cmd.IdempotencyKey,
+		SnapshotID:       snapshotID,
+		CommandMessageID: cmd.MessageID,
+		CorrelationID:    cmd.CorrelationID,
+		Artifacts:        artifacts,
+		Events:           []string{evt.MessageID},
+		CreatedAt:        time.Now().UTC(),
+	}
+	if rec.Artifacts == nil {
+		rec.Artifacts = []protocol.Artifact{}
+	}
+	require.NoError(t, receipt.WriteReceipt(rec, receipt.GetReceiptPath(r.root, "T-1", step)))
+}
+
+func (r *completedRun) add(t *testing.T, msg any) {
+	t.Helper()
+	line, err := json.Marshal(msg)
+	require.NoError(t, err)
+	r.lines = append(r.lines, line)
+}
+
+func (r *completedRun) saveLedger(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(r.root, "events", r.runID+".ndjson")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, append(bytes.Join(r.lines, []byte("\n")), '\n'), 0o644))
+}
+
+func checkByName(t *testing.T, report *Report, name string) Check {
+	t.Helper()
+	for _, c := range report.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no check %q in report", name)
+	return Check{}
+}
+
+func TestVerifyCompletedRunPasses(t *testing.T) {
+	r := newCompletedRun(t)
+
+	report, err := Verify(Options{WorkspaceRoot: r.root, RunID: r.runID})
+	require.NoError(t, err)
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	require.True(t, report.Passed, text.String())
+	for _, c := range report.Checks {
+		assert.Equal(t, StatusPass, c.Status, "%s: %s", c.Name, c.Message)
+	}
+	assert.Contains(t, text.String(), "PASSED: 6/6 checks passed")
+}
+
+func TestVerifyReportsFailures(t *testing.T) {
+	r := newCompletedRun(t)
+
+	// The builder's file changed after its receipt was written
+	r.write(t, "src/widget.go", "package src // edited\n")
+	// The spec maintainer rewrote a requirement
+	r.write(t, "specs/SPEC.md", strings.Replace(testSpec, "must render", "may render", 1))
+	// A review command never completed
+	r.add(t, protocol.Command{Kind: protocol.MessageKindCommand, MessageID: "cmd-late", CorrelationID: "corr-late", TaskID: "T-1", Action: protocol.ActionReview})
+	r.saveLedger(t)
+
+	baseline := func(path, sha string) ([]byte, bool) {
+		if sha != checksum.SHA256Bytes([]byte(testSpec)) {
+			return nil, false
+		}
+		return []byte(testSpec), true
+	}
+	report, err := Verify(Options{WorkspaceRoot: r.root, RunID: r.runID, Baseline: baseline})
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+
+	artifacts := checkByName(t, report, CheckArtifacts)
+	assert.Equal(t, StatusFail, artifacts.Status)
+	require.Len(t, artifacts.Details, 1)
+	assert.Contains(t, artifacts.Details[0], "src/widget.go: size_mismatch")
+
+	sections := checkByName(t, report, CheckSpecSections)
+	assert.Equal(t, StatusFail, sections.Status)
+	assert.Equal(t, []string{"specs/SPEC.md: ## Requirements: changed outside the allowed sections"}, sections.Details)
+
+	terminal := checkByName(t, report, CheckTerminalEvents)
+	assert.Equal(t, StatusFail, terminal.Status)
+	assert.Equal(t, []string{"T-1 review (correlation corr-late)"}, terminal.Details)
+
+	assert.Equal(t, StatusPass, checkByName(t, report, CheckReviewApproved).Status)
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteJSON(&out))
+	var decoded Report
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, report.Checks, decoded.Checks)
+}
+
+func TestVerifySkipsWhatCannotBeChecked(t *testing.T) {
+	r := newCompletedRun(t)
+	r.write(t, "specs/SPEC.md", testSpec+"- 2025-10-02: T-1 done\n")
+
+	// A later run replaced state/run.json
+	other := runstate.NewRunState("run-later", "T-2", "snap-other")
+	require.NoError(t, runstate.SaveRunState(other, runstate.GetRunStatePath(r.root)))
+
+	report, err := Verify(Options{WorkspaceRoot: r.root, RunID: r.runID})
+	require.NoError(t, err)
+	assert.True(t, report.Passed, "skipped checks must not fail the run")
+	assert.Equal(t, StatusSkip, checkByName(t, report, CheckRunState).Status)
+	assert.Equal(t, StatusSkip, checkByName(t, report, CheckSpecSections).Status)
+
+	_, err = Verify(Options{WorkspaceRoot: r.root, RunID: "run-unknown"})
+	assert.ErrorContains(t, err, "no ledger for run run-unknown")
+}
+
+func TestSpecEditViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		after string
+		want  []string
+	}{
+		{"unchanged", testSpec, nil},
+		{"status edited", strings.Replace(testSpec, "| T-1  | todo  |", "| T-1  | done  |", 1), nil},
+		{"changelog appended", testSpec + "- 2025-10-02: T-1 done\n", nil},
+		{"changelog prepended", strings.Replace(testSpec, "## Changelog\n", "## Changelog\n- 2025-10-02: T-1 done\n", 1), nil},
+		{"allowed section added", testSpec + "\n## Open Questions\n- Colour?\n", nil},
+		{"requirement edited", strings.Replace(testSpec, "must render", "may render", 1),
+			[]string{"## Requirements: changed outside the allowed sections"}},
+		{"changelog rewritten", strings.Replace(testSpec, "created", "started", 1),
+			[]string{"## Changelog: existing entries changed (append only)"}},
+		{"title edited", strings.Replace(testSpec, "# Spec", "# The Spec", 1),
+			[]string{"text before the first section: changed outside the allowed sections"}},
+		{"section added", testSpec + "\n## Notes\n- extra\n", []string{"## Notes: section added"}},
+		{"section removed", strings.Replace(testSpec, "## Requirements\n- The widget must render.\n", "", 1),
+			[]string{"## Requirements: section removed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SpecEditViolations([]byte(testSpec), []byte(tt.after)))
+		})
+	}
+}
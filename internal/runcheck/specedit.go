@@ -0,0 +1,131 @@
+package runcheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sectionRule is how a SPEC.md section may be edited by the spec maintainer
+type sectionRule int
+
+const (
+	// frozen sections must not change
+	frozen sectionRule = iota
+	// appendOnly sections may gain lines; existing lines must stay, in order
+	appendOnly
+	// editable sections may change freely
+	editable
+)
+
+// allowedSections are the SPEC.md sections the spec maintainer may edit
+// (MASTER-SPEC §10.5), keyed by lower-case heading
+var allowedSections = map[string]sectionRule{
+	"status":         editable,
+	"completion":     editable,
+	"changelog":      appendOnly,
+	"open questions": appendOnly,
+}
+
+// specSection is the text under one "## " heading; the text before the
+// first heading is a section with an empty title
+type specSection struct {
+	title string
+	lines []string
+}
+
+// SpecEditViolations compares two versions of a spec document and describes
+// each edit made outside the allowed sections, or that rewrote existing
+// entries of an append-only section. It returns nil when the edits are
+// allowed.
+func SpecEditViolations(before, after []byte) []string {
+	oldSections := indexSections(parseSections(before))
+	newSections := parseSections(after)
+
+	var violations []string
+	seen := make(map[string]bool)
+	for key, section := range indexSections(newSections) {
+		seen[key] = true
+		rule := allowedSections[strings.ToLower(section.title)]
+		old, existed := oldSections[key]
+		switch {
+		case !existed:
+			if rule == frozen {
+				violations = append(violations, fmt.Sprintf("%s: section added", describe(section.title)))
+			}
+		case rule == editable:
+		case rule == appendOnly:
+			if !keepsLines(old.lines, section.lines) {
+				violations = append(violations, fmt.Sprintf("%s: existing entries changed (append only)", describe(section.title)))
+			}
+		default:
+			if trimmed(old.lines) != trimmed(section.lines) {
+				violations = append(violations, fmt.Sprintf("%s: changed outside the allowed sections", describe(section.title)))
+			}
+		}
+	}
+	for key, section := range oldSections {
+		if !seen[key] {
+			violations = append(violations, fmt.Sprintf("%s: section removed", describe(section.title)))
+		}
+	}
+
+	sort.Strings(violations)
+	return violations
+}
+
+// parseSections splits a markdown document at its "## " headings
+func parseSections(doc []byte) []specSection {
+	sections := []specSection{{}}
+	for _, line := range strings.Split(strings.ReplaceAll(string(doc), "\r\n", "\n"), "\n") {
+		if title, ok := strings.CutPrefix(line, "## "); ok {
+			sections = append(sections, specSection{title: strings.TrimSpace(title)})
+			continue
+		}
+		last := &sections[len(sections)-1]
+		last.lines = append(last.lines, line)
+	}
+	return sections
+}
+
+// indexSections keys sections by heading, numbering repeated headings
+func indexSections(sections []specSection) map[string]specSection {
+	index := make(map[string]specSection, len(sections))
+	occurrences := make(map[string]int)
+	for _, section := range sections {
+		title := strings.ToLower(section.title)
+		occurrences[title]++
+		index[fmt.Sprintf("%s#%d", title, occurrences[title])] = section
+	}
+	return index
+}
+
+// keepsLines reports whether every non-blank line of old appears in new, in
+// the same order
+func keepsLines(old, new []string) bool {
+	i := 0
+	for _, line := range old {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		for i < len(new) && strings.TrimRight(new[i], " \t") != strings.TrimRight(line, " \t") {
+			i++
+		}
+		if i == len(new) {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+func trimmed(lines []string) string {
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func describe(title string) string {
+	if title == "" {
+		return "text before the first section"
+	}
+	return "## " + title
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/iambrandonn/lorch/internal/fsutil"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Status represents the overall state of a run
@@ -48,6 +50,58 @@ type RunState struct {
 	Intake           *IntakeState      `json:"intake,omitempty"`
 	ActivatedTaskIDs []string          `json:"activated_task_ids,omitempty"`     // P2.4: tracks completed intake-derived tasks
 	CurrentTaskInputs map[string]any   `json:"current_task_inputs,omitempty"` // P2.4: stores full command inputs for idempotent resume
+	Usage            *UsageState       `json:"usage,omitempty"`
+	// Negotiations holds the handshake outcome per agent type
+	Negotiations map[string]*protocol.Negotiation `json:"negotiations,omitempty"`
+	// Processes holds the agent processes this run started, so a resume can
+	// find survivors after lorch itself died
+	Processes map[string]*AgentProcess `json:"processes,omitempty"`
+	// Tasks holds the status of every task of a multi-task run, so a resume
+	// continues exactly the unfinished part of the dependency graph;
+	// TaskOrder is the order the tasks were given in
+	Tasks     map[string]*TaskState `json:"tasks,omitempty"`
+	TaskOrder []string              `json:"task_order,omitempty"`
+}
+
+// TaskStatus represents the state of one task of a run
+type TaskStatus string
+
+const (
+	TaskPending   TaskStatus = "pending"
+	TaskRunning   TaskStatus = "running"
+	TaskCompleted TaskStatus = "completed"
+	TaskFailed    TaskStatus = "failed"
+	// TaskSkipped tasks did not run because a prerequisite did not complete
+	TaskSkipped TaskStatus = "skipped"
+)
+
+// TaskState tracks one task of a multi-task run
+type TaskState struct {
+	Status    TaskStatus     `json:"status"`
+	Title     string         `json:"title,omitempty"`
+	DependsOn []string       `json:"depends_on,omitempty"`
+	Inputs    map[string]any `json:"inputs,omitempty"`
+	// Error says why the task failed or was skipped
+	Error string `json:"error,omitempty"`
+	// Worktree is set when the task ran in a git worktree of its own,
+	// whose ledger steps cannot be resumed in the workspace
+	Worktree bool `json:"worktree,omitempty"`
+}
+
+// AgentProcess identifies an agent process group started by lorch
+type AgentProcess struct {
+	PID  int `json:"pid"`
+	PGID int `json:"pgid"`
+	// StartTicks is the kernel start time of PID (Linux only); it guards
+	// against terminating an unrelated process that reused the PID
+	StartTicks uint64    `json:"start_ticks,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// UsageState accumulates LLM usage across the run so budgets survive resume.
+type UsageState struct {
+	Run   protocol.Usage            `json:"run"`
+	Tasks map[string]protocol.Usage `json:"tasks,omitempty"`
 }
 
 // NewRunState creates a new run state
@@ -106,8 +160,17 @@ type IntakeDecision struct {
 	CorrelationID string    `json:"correlation_id,omitempty"`
 }
 
-// SaveRunState writes run state to disk atomically
+// SaveRunState validates run state against schemas/v1 and writes it to disk
+// atomically. In strict mode state with violations is not written.
+//
+// Run state is deliberately not redacted: the intake instruction and the
+// task inputs saved here are what resume resends, and they must be the
+// originals for agents to get the same work under the same idempotency
+// keys. The file is written 0600 and, in git mode, never committed.
 func SaveRunState(state *RunState, path string) error {
+	if err := schema.DefaultEnforcer().CheckValue("run-state", schema.RunState, state); err != nil {
+		return fmt.Errorf("refusing to save run state: %w", err)
+	}
 	return fsutil.AtomicWriteJSON(path, state)
 }
 
@@ -262,6 +325,87 @@ func (s *RunState) SetCurrentTaskInputs(inputs map[string]any) {
 	s.CurrentTaskInputs = cloneGenericMap(inputs)
 }
 
+// AddTask records a task of the run as pending, keeping the state of a
+// task that is already known
+func (s *RunState) AddTask(taskID, title string, dependsOn []string, inputs map[string]any) {
+	if s.Tasks == nil {
+		s.Tasks = make(map[string]*TaskState)
+	}
+	if _, ok := s.Tasks[taskID]; ok {
+		return
+	}
+	s.Tasks[taskID] = &TaskState{
+		Status:    TaskPending,
+		Title:     title,
+		DependsOn: append([]string(nil), dependsOn...),
+		Inputs:    cloneGenericMap(inputs),
+	}
+	s.TaskOrder = append(s.TaskOrder, taskID)
+}
+
+// SetTaskStatus updates the status of a known task. A failed or skipped
+// task keeps the reason in reason; other statuses clear it.
+func (s *RunState) SetTaskStatus(taskID string, status TaskStatus, reason string) {
+	task, ok := s.Tasks[taskID]
+	if !ok {
+		return
+	}
+	task.Status = status
+	task.Error = reason
+	if status == TaskCompleted {
+		s.MarkTaskActivated(taskID)
+	}
+}
+
+// UnfinishedTasks lists the tasks that have not completed, in task order
+func (s *RunState) UnfinishedTasks() []string {
+	var ids []string
+	for _, id := range s.TaskOrder {
+		if task, ok := s.Tasks[id]; ok && task.Status != TaskCompleted {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// RecordUsage adds an event's usage report to the task and run totals.
+func (s *RunState) RecordUsage(taskID string, u protocol.Usage) {
+	if s.Usage == nil {
+		s.Usage = &UsageState{}
+	}
+	if s.Usage.Tasks == nil {
+		s.Usage.Tasks = make(map[string]protocol.Usage)
+	}
+	s.Usage.Run.Add(u)
+	task := s.Usage.Tasks[taskID]
+	task.Add(u)
+	s.Usage.Tasks[taskID] = task
+}
+
+// RecordNegotiation stores the protocol version and capabilities agreed with
+// an agent. A nil negotiation (agent not started) is ignored.
+func (s *RunState) RecordNegotiation(agentType string, n *protocol.Negotiation) {
+	if n == nil {
+		return
+	}
+	if s.Negotiations == nil {
+		s.Negotiations = make(map[string]*protocol.Negotiation)
+	}
+	s.Negotiations[agentType] = n
+}
+
+// RecordProcess stores the process an agent is running as. A nil process
+// (agent not started) is ignored.
+func (s *RunState) RecordProcess(agentType string, p *AgentProcess) {
+	if p == nil {
+		return
+	}
+	if s.Processes == nil {
+		s.Processes = make(map[string]*AgentProcess)
+	}
+	s.Processes[agentType] = p
+}
+
 func cloneGenericMap(src map[string]any) map[string]any {
 	if src == nil {
 		return nil
@@ -3,8 +3,12 @@ package runstate
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestNewRunState(t *testing.T) {
@@ -303,3 +307,117 @@ func TestStageConstants(t *testing.T) {
 		t.Error("expected 4 stage constants")
 	}
 }
+
+func TestRecordUsage(t *testing.T) {
+	state := NewRunState("run-1", "T-0001", "snap-1")
+
+	state.RecordUsage("T-0001", protocol.Usage{Model: "m1", InputTokens: 10, OutputTokens: 5, EstimatedCostUSD: 0.1})
+	state.RecordUsage("T-0002", protocol.Usage{Model: "m2", InputTokens: 1, OutputTokens: 1, EstimatedCostUSD: 0.2})
+	state.RecordUsage("T-0001", protocol.Usage{Model: "m1", InputTokens: 10, OutputTokens: 5})
+
+	if state.Usage == nil {
+		t.Fatal("Usage = nil")
+	}
+	if got := state.Usage.Tasks["T-0001"].TotalTokens(); got != 30 {
+		t.Errorf("T-0001 tokens = %d, want 30", got)
+	}
+	if got := state.Usage.Run.TotalTokens(); got != 32 {
+		t.Errorf("run tokens = %d, want 32", got)
+	}
+	if state.Usage.Run.Model != "mixed" {
+		t.Errorf("run model = %s, want mixed", state.Usage.Run.Model)
+	}
+
+	// Totals survive a save/load round trip
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := SaveRunState(state, path); err != nil {
+		t.Fatalf("SaveRunState failed: %v", err)
+	}
+	loaded, err := LoadRunState(path)
+	if err != nil {
+		t.Fatalf("LoadRunState failed: %v", err)
+	}
+	if loaded.Usage == nil || loaded.Usage.Tasks["T-0002"].EstimatedCostUSD != 0.2 {
+		t.Errorf("loaded usage = %+v, want T-0002 cost 0.2", loaded.Usage)
+	}
+}
+
+func TestRunStateMatchesSchema(t *testing.T) {
+	validator, err := schema.Default()
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+
+	intake := NewIntakeState("intake-20251020-140818-0a1b2c3d", "snap-intake-20251020-140818-0a1b2c3d", "Implement auth", map[string]any{"instruction": "Implement auth"})
+	intake.RecordIntakeCommand("intake", map[string]any{"instruction": "Implement auth"}, "ik:"+strings.Repeat("a", 64), "corr-intake-1")
+	intake.RecordIntakeDecision(&IntakeDecision{Status: "approved", ApprovedPlan: "PLAN.md", ApprovedTasks: []string{"T-100"}})
+
+	run := NewRunState("run-20251020-140818-0a1b2c3d", "T-100", "snap-0123456789ab")
+	run.RecordCommand("1b4e28ba-2fa1-11d2-883f-0016d3cca427", "corr-T-100-implement-1")
+	run.RecordTerminalEvent("builder", "builder.completed")
+	run.MarkTaskActivated("T-100")
+	run.RecordUsage("T-100", protocol.Usage{Model: "claude-sonnet", InputTokens: 10, OutputTokens: 5})
+	run.RecordNegotiation("builder", &protocol.Negotiation{
+		ProtocolVersion:  1,
+		SupportedActions: []protocol.Action{protocol.ActionImplement},
+		MaxMessageBytes:  262144,
+		Capabilities:     protocol.Capabilities{StreamingProgress: true},
+	})
+	run.RecordNegotiation("reviewer", protocol.LegacyNegotiation(262144))
+	run.RecordNegotiation("spec_maintainer", nil)
+	run.AddTask("T-100", "Schema", nil, map[string]any{"goal": "Schema", "task_files": []string{"db/schema.sql"}})
+	run.AddTask("T-101", "Handlers", []string{"T-100"}, map[string]any{"goal": "Handlers"})
+	run.SetTaskStatus("T-100", TaskFailed, "review failed")
+	run.SetTaskStatus("T-101", TaskSkipped, "prerequisite T-100 did not complete")
+	run.RecordProcess("builder", &AgentProcess{PID: 4242, PGID: 4242, StartTicks: 123456, StartedAt: time.Now().UTC()})
+	run.RecordProcess("reviewer", nil)
+	run.MarkCompleted()
+
+	if len(run.Negotiations) != 2 {
+		t.Errorf("expected 2 negotiations recorded, got %d", len(run.Negotiations))
+	}
+	if len(run.Processes) != 1 {
+		t.Errorf("expected 1 process recorded, got %d", len(run.Processes))
+	}
+
+	for _, state := range []*RunState{intake, run} {
+		violations, err := validator.ValidateValue(schema.RunState, state)
+		if err != nil {
+			t.Fatalf("ValidateValue() error = %v", err)
+		}
+		if len(violations) != 0 {
+			t.Errorf("run state %s has schema violations: %v", state.RunID, violations)
+		}
+	}
+}
+
+func TestTaskStatusHelpers(t *testing.T) {
+	state := NewRunState("run-1", "", "snap-1")
+	state.AddTask("T-1", "First", nil, map[string]any{"goal": "First"})
+	state.AddTask("T-2", "Second", []string{"T-1"}, map[string]any{"goal": "Second"})
+	state.AddTask("T-1", "Again", nil, nil)
+
+	if len(state.TaskOrder) != 2 || state.Tasks["T-1"].Title != "First" {
+		t.Fatalf("re-adding a task should keep it: order %v, title %q", state.TaskOrder, state.Tasks["T-1"].Title)
+	}
+	if state.Tasks["T-2"].Status != TaskPending {
+		t.Errorf("new task status = %s, want pending", state.Tasks["T-2"].Status)
+	}
+
+	state.SetTaskStatus("T-1", TaskFailed, "boom")
+	if state.Tasks["T-1"].Error != "boom" || state.IsTaskActivated("T-1") {
+		t.Errorf("failed task should keep its error and not be activated")
+	}
+	state.SetTaskStatus("T-1", TaskCompleted, "")
+	if state.Tasks["T-1"].Error != "" || !state.IsTaskActivated("T-1") {
+		t.Errorf("completed task should clear its error and be activated")
+	}
+	state.SetTaskStatus("T-9", TaskCompleted, "")
+	if _, ok := state.Tasks["T-9"]; ok {
+		t.Errorf("unknown task should not be added")
+	}
+
+	if got := state.UnfinishedTasks(); len(got) != 1 || got[0] != "T-2" {
+		t.Errorf("UnfinishedTasks() = %v, want [T-2]", got)
+	}
+}
@@ -0,0 +1,303 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/internal/supervisor"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// ArtifactError reports artifacts that still failed verification once a
+// command's attempts were used up, or that violate policy
+type ArtifactError struct {
+	Action   protocol.Action
+	Attempts int
+	Failures []receipt.ArtifactFailure
+}
+
+func (e *ArtifactError) Error() string {
+	failures := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		failures[i] = f.String()
+	}
+	return fmt.Sprintf("%s reported artifacts that failed verification after %d attempt(s): %s",
+		e.Action, e.Attempts, strings.Join(failures, "; "))
+}
+
+// MissingOutputsError reports required outputs that were still missing once
+// a command's attempts were used up, and were not accepted by a human
+type MissingOutputsError struct {
+	Action   protocol.Action
+	Attempts int
+	Missing  []receipt.OutputStatus
+}
+
+func (e *MissingOutputsError) Error() string {
+	paths := make([]string, len(e.Missing))
+	for i, o := range e.Missing {
+		paths[i] = o.Path
+	}
+	return fmt.Sprintf("%s did not produce required outputs after %d attempt(s): %s",
+		e.Action, e.Attempts, strings.Join(paths, ", "))
+}
+
+// deliver sends cmd, waits for its terminal event and checks what the agent
+// produced: under strict version pinning its events must have observed the
+// command's snapshot, the reported artifacts must match the workspace, and
+// every required expected output must exist. Partial writes and missing
+// outputs are retried with the same idempotency key until cmd.Retry.MaxAttempts
+// attempts have been made (MASTER-SPEC §7.5); the receipt of each rejected
+// attempt records what was wrong. Outputs still missing after the last
+// attempt are put to the outputs approver.
+func (s *Scheduler) deliver(ctx context.Context, sup *supervisor.AgentSupervisor, cmd *protocol.Command, wait func() (*protocol.Event, error)) (*protocol.Event, error) {
+	for {
+		if err := s.sendCommand(sup, cmd); err != nil {
+			return nil, err
+		}
+		evt, err := wait()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.rejectVersionMismatches(cmd); err != nil {
+			return nil, err
+		}
+
+		failures := s.verifyArtifacts()
+		s.artifactFailures = failures
+		s.outputs = s.reconcileOutputs(cmd)
+		missing := failedOutputs(s.outputs)
+		if len(failures) == 0 && len(missing) == 0 {
+			return evt, nil
+		}
+
+		retryable := true
+		for _, f := range failures {
+			s.logger.Warn("artifact failed verification",
+				"task_id", cmd.TaskID,
+				"action", cmd.Action,
+				"attempt", cmd.Retry.Attempt,
+				"path", f.Path,
+				"reason", f.Reason,
+				"detail", f.Detail)
+			retryable = retryable && f.PartialWrite()
+		}
+		for _, o := range missing {
+			s.logger.Warn("required output missing",
+				"task_id", cmd.TaskID,
+				"action", cmd.Action,
+				"attempt", cmd.Retry.Attempt,
+				"path", o.Path)
+		}
+
+		attempts := cmd.Retry.Attempt + 1
+		if retryable && attempts < cmd.Retry.MaxAttempts {
+			if err := s.writeReceipt(); err != nil {
+				s.logger.Warn("failed to write receipt", "error", err)
+			}
+			cmd = retryCommand(cmd)
+			continue
+		}
+
+		if len(failures) > 0 {
+			if err := s.writeReceipt(); err != nil {
+				s.logger.Warn("failed to write receipt", "error", err)
+			}
+			return nil, &ArtifactError{Action: cmd.Action, Attempts: attempts, Failures: failures}
+		}
+		accepted, err := s.acceptMissingOutputs(ctx, cmd, missing)
+		if err != nil || !accepted {
+			if err := s.writeReceipt(); err != nil {
+				s.logger.Warn("failed to write receipt", "error", err)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, &MissingOutputsError{Action: cmd.Action, Attempts: attempts, Missing: missing}
+		}
+		s.outputsAccepted = true
+		return evt, nil
+	}
+}
+
+// acceptMissingOutputs escalates required outputs that are still missing to
+// the outputs approver
+func (s *Scheduler) acceptMissingOutputs(ctx context.Context, cmd *protocol.Command, missing []receipt.OutputStatus) (bool, error) {
+	if s.outputsApprover == nil {
+		return false, nil
+	}
+	accepted, err := s.outputsApprover(ctx, cmd.TaskID, cmd.Action, missing)
+	if err != nil {
+		return false, fmt.Errorf("missing outputs approval failed: %w", err)
+	}
+	if accepted {
+		s.logger.Warn("accepted step with missing required outputs", "task_id", cmd.TaskID, "action", cmd.Action)
+	}
+	return accepted, nil
+}
+
+// reportedArtifacts collects the artifacts reported for the current command
+func (s *Scheduler) reportedArtifacts() []protocol.Artifact {
+	var artifacts []protocol.Artifact
+	for _, evt := range s.currentEvents {
+		artifacts = append(artifacts, evt.Artifacts...)
+	}
+	return artifacts
+}
+
+// verifyArtifacts checks the artifacts reported for the current command
+// against the workspace. Nothing is checked without a workspace root.
+func (s *Scheduler) verifyArtifacts() []receipt.ArtifactFailure {
+	if s.workspaceRoot == "" {
+		return nil
+	}
+	artifacts := s.reportedArtifacts()
+	if len(artifacts) == 0 {
+		return nil
+	}
+	return receipt.VerifyArtifacts(s.workspaceRoot, artifacts, s.artifactMaxBytes)
+}
+
+// reconcileOutputs records whether each of cmd's expected outputs was
+// produced. Outputs the agent did not report are looked up in a snapshot
+// of the workspace taken after the command. Nothing is checked without a
+// workspace root.
+func (s *Scheduler) reconcileOutputs(cmd *protocol.Command) []receipt.OutputStatus {
+	if s.workspaceRoot == "" || len(cmd.ExpectedOutputs) == 0 {
+		return nil
+	}
+	artifacts := s.reportedArtifacts()
+
+	var snap *snapshot.Manifest
+	if !allReported(cmd.ExpectedOutputs, artifacts) {
+		var err error
+		if snap, err = s.captureSnapshot(); err != nil {
+			s.logger.Warn("failed to snapshot workspace for expected outputs", "error", err)
+		}
+	}
+	return receipt.ReconcileOutputs(s.workspaceRoot, cmd.ExpectedOutputs, artifacts, snap)
+}
+
+// captureSnapshot captures the workspace with the configured scope, reusing
+// and then updating the stat cache under state/
+func (s *Scheduler) captureSnapshot() (*snapshot.Manifest, error) {
+	cache := snapshot.LoadStatCache(snapshot.GetStatCachePath(s.workspaceRoot))
+	snap, err := snapshot.CaptureCached(s.workspaceRoot, s.snapshotScope, cache)
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.Save(); err != nil {
+		s.logger.Warn("failed to save snapshot stat cache", "error", err)
+	}
+	return snap, nil
+}
+
+// allReported reports whether every expected output was reported as an
+// artifact, in which case no snapshot is needed
+func allReported(expected []protocol.ExpectedOutput, artifacts []protocol.Artifact) bool {
+	reported := make(map[string]bool, len(artifacts))
+	for _, artifact := range artifacts {
+		reported[artifact.Path] = true
+	}
+	for _, output := range expected {
+		if !reported[output.Path] {
+			return false
+		}
+	}
+	return true
+}
+
+// failedOutputs returns the required outputs that were not produced
+func failedOutputs(outputs []receipt.OutputStatus) []receipt.OutputStatus {
+	var missing []receipt.OutputStatus
+	for _, o := range outputs {
+		if o.Failed() {
+			missing = append(missing, o)
+		}
+	}
+	return missing
+}
+
+// expectedOutputs declares the files a builder command must produce: the
+// task's files (inputs["task_files"]) for tasks derived during intake.
+// Other commands expect nothing.
+func expectedOutputs(taskID string, action protocol.Action, inputs map[string]any) []protocol.ExpectedOutput {
+	outputs := []protocol.ExpectedOutput{}
+	if action != protocol.ActionImplement && action != protocol.ActionImplementChanges {
+		return outputs
+	}
+
+	var files []string
+	switch v := inputs["task_files"].(type) {
+	case []string:
+		files = v
+	case []any:
+		for _, item := range v {
+			if path, ok := item.(string); ok {
+				files = append(files, path)
+			}
+		}
+	}
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+		outputs = append(outputs, protocol.ExpectedOutput{
+			Path:        path,
+			Description: fmt.Sprintf("task %s artifact: %s", taskID, path),
+			Required:    true,
+		})
+	}
+	return outputs
+}
+
+// retryCommand returns the next attempt of cmd. It keeps the idempotency
+// key and inputs, and gets new message and correlation IDs so the ledger
+// tells the attempts apart.
+func retryCommand(cmd *protocol.Command) *protocol.Command {
+	next := *cmd
+	next.MessageID = uuid.New().String()
+	next.CorrelationID = newCorrelationID(cmd.TaskID, cmd.Action)
+	next.Deadline = time.Now().Add(10 * time.Minute).UTC()
+	next.Retry.Attempt++
+	return &next
+}
+
+// snapshotStep captures the workspace after a step that may change it and
+// saves the manifest. The snapshot pins the commands that follow, and the
+// step can be diffed against the snapshot its command was pinned to; the
+// files it changed are printed. Failures are logged, and the following
+// commands stay pinned to the previous snapshot.
+func (s *Scheduler) snapshotStep(cmd *protocol.Command) {
+	if s.workspaceRoot == "" {
+		return
+	}
+	snap, err := s.saveSnapshot()
+	if err != nil {
+		s.logger.Warn("failed to snapshot workspace after step", "task_id", cmd.TaskID, "action", cmd.Action, "error", err)
+		return
+	}
+	s.postSnapshotID = snap.SnapshotID
+	if snap.SnapshotID != s.snapshotID {
+		s.logger.Info("workspace changed, pinning next commands to new snapshot",
+			"task_id", cmd.TaskID,
+			"action", cmd.Action,
+			"snapshot_id", snap.SnapshotID)
+	}
+	s.snapshotID = snap.SnapshotID
+
+	pre, err := snapshot.LoadSnapshot(filepath.Join(s.workspaceRoot, "snapshots", cmd.Version.SnapshotID+".manifest.json"))
+	if err != nil {
+		s.logger.Debug("no manifest for the step's pinned snapshot", "snapshot_id", cmd.Version.SnapshotID, "error", err)
+		return
+	}
+	if s.transcript != nil {
+		fmt.Println(s.transcript.FormatChanges(cmd.TaskID, snapshot.Diff(pre, snap)))
+	}
+}
@@ -0,0 +1,321 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/agent/script"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/internal/supervisor"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// startScriptedBuilder starts a mock builder that answers implement with a
+// builder.completed event reporting artifact, writing artifacts with content
+// under workspace
+func startScriptedBuilder(t *testing.T, workspace string, artifact script.ArtifactTemplate) *supervisor.AgentSupervisor {
+	t.Helper()
+	return startBuilderScript(t, workspace, script.EventTemplate{
+		Type:      protocol.EventBuilderCompleted,
+		Status:    "success",
+		Payload:   map[string]any{"tests": map[string]any{"status": "pass"}},
+		Artifacts: []script.ArtifactTemplate{artifact},
+	})
+}
+
+// startBuilderScript starts a mock builder that answers implement with
+// completed
+func startBuilderScript(t *testing.T, workspace string, completed script.EventTemplate) *supervisor.AgentSupervisor {
+	t.Helper()
+
+	mockAgentPath, err := buildMockAgent(t)
+	if err != nil {
+		t.Fatalf("failed to build mock agent: %v", err)
+	}
+
+	scr := script.Script{Responses: map[string]script.ResponseTemplate{
+		"implement": {Events: []script.EventTemplate{completed}},
+	}}
+	data, err := json.Marshal(scr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptPath := filepath.Join(t.TempDir(), "script.json")
+	if err := os.WriteFile(scriptPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	builder := supervisor.NewAgentSupervisor(
+		protocol.AgentTypeBuilder,
+		[]string{mockAgentPath, "-type", "builder", "-no-heartbeat", "-script", scriptPath, "-workspace", workspace},
+		map[string]string{},
+		logger,
+	)
+	if err := builder.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start builder: %v", err)
+	}
+	t.Cleanup(func() { builder.Stop(context.Background()) })
+	return builder
+}
+
+func newArtifactScheduler(builder *supervisor.AgentSupervisor, workspace string) *Scheduler {
+	sched := NewScheduler(builder, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	sched.SetWorkspaceRoot(workspace)
+	sched.SetSnapshotID("snap-test-artifacts")
+	sched.taskInputs = map[string]any{}
+	return sched
+}
+
+func TestSchedulerVerifiesArtifacts(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n"})
+	sched := newArtifactScheduler(builder, workspace)
+	sched.SetArtifactMaxBytes(1 << 20)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := sched.executeImplement(ctx, "T-ART-1", map[string]any{"goal": "verify"}); err != nil {
+		t.Fatalf("implement failed: %v", err)
+	}
+
+	rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-ART-1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Artifacts) != 1 || len(rec.ArtifactFailures) != 0 {
+		t.Errorf("expected one verified artifact, got %v (failures %v)", rec.Artifacts, rec.ArtifactFailures)
+	}
+}
+
+func TestSchedulerRetriesPartialWrites(t *testing.T) {
+	workspace := t.TempDir()
+	// The builder reports a file it never writes
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{
+		Path:   "src/feature.go",
+		SHA256: "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Size:   4,
+	})
+	sched := newArtifactScheduler(builder, workspace)
+
+	var commands []*protocol.Command
+	sched.SetEventLogger(commandRecorder{&commands})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := sched.executeImplement(ctx, "T-ART-2", map[string]any{"goal": "verify"})
+	var artErr *ArtifactError
+	if !errors.As(err, &artErr) {
+		t.Fatalf("expected an ArtifactError, got %v", err)
+	}
+	if artErr.Attempts != 3 || artErr.Failures[0].Reason != receipt.ArtifactMissing {
+		t.Errorf("unexpected error %v", artErr)
+	}
+
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(commands))
+	}
+	for i, cmd := range commands {
+		if cmd.IdempotencyKey != commands[0].IdempotencyKey {
+			t.Errorf("attempt %d changed the idempotency key", i)
+		}
+		if cmd.Retry.Attempt != i {
+			t.Errorf("attempt %d sent with retry.attempt %d", i, cmd.Retry.Attempt)
+		}
+		if i > 0 && cmd.CorrelationID == commands[i-1].CorrelationID {
+			t.Errorf("attempt %d reused the correlation ID", i)
+		}
+
+		rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-ART-2", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.ArtifactFailures) != 1 || rec.ArtifactFailures[0].Path != "src/feature.go" {
+			t.Errorf("receipt %d should flag the artifact, got %v", i+1, rec.ArtifactFailures)
+		}
+	}
+}
+
+func TestSchedulerRejectsOversizeArtifact(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "big.txt", Content: "more than eight bytes"})
+	sched := newArtifactScheduler(builder, workspace)
+	sched.SetArtifactMaxBytes(8)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := sched.executeImplement(ctx, "T-ART-3", map[string]any{"goal": "verify"})
+	var artErr *ArtifactError
+	if !errors.As(err, &artErr) {
+		t.Fatalf("expected an ArtifactError, got %v", err)
+	}
+	if artErr.Attempts != 1 || artErr.Failures[0].Reason != receipt.ArtifactTooLarge {
+		t.Errorf("an oversize artifact must fail without retrying, got %v", artErr)
+	}
+}
+
+// commandRecorder is an EventLogger that keeps the commands sent
+type commandRecorder struct {
+	commands *[]*protocol.Command
+}
+
+func (r commandRecorder) WriteCommand(cmd *protocol.Command) error {
+	*r.commands = append(*r.commands, cmd)
+	return nil
+}
+
+func (commandRecorder) WriteEvent(*protocol.Event) error         { return nil }
+func (commandRecorder) WriteHeartbeat(*protocol.Heartbeat) error { return nil }
+
+func TestSchedulerReconcilesExpectedOutputs(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n"})
+	sched := newArtifactScheduler(builder, workspace)
+
+	// Written before the command and not reported: found in the snapshot
+	if err := os.MkdirAll(filepath.Join(workspace, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "src", "existing.go"), []byte("package src\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inputs := map[string]any{"goal": "outputs", "task_files": []any{"src/feature.go", "src/existing.go"}}
+	if err := sched.executeImplement(ctx, "T-OUT-1", inputs); err != nil {
+		t.Fatalf("implement failed: %v", err)
+	}
+
+	rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-OUT-1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Outputs) != 2 {
+		t.Fatalf("expected 2 output statuses, got %v", rec.Outputs)
+	}
+	if rec.Outputs[0].Status != receipt.OutputReported || rec.Outputs[1].Status != receipt.OutputPresent {
+		t.Errorf("unexpected statuses %v", rec.Outputs)
+	}
+}
+
+func TestSchedulerEscalatesMissingOutputs(t *testing.T) {
+	for _, approve := range []bool{true, false} {
+		workspace := t.TempDir()
+		builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/other.go", Content: "package src\n"})
+		sched := newArtifactScheduler(builder, workspace)
+
+		var asked [][]receipt.OutputStatus
+		sched.SetOutputsApprover(func(ctx context.Context, taskID string, action protocol.Action, missing []receipt.OutputStatus) (bool, error) {
+			asked = append(asked, missing)
+			return approve, nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		inputs := map[string]any{"goal": "outputs", "task_files": []string{"src/feature.go"}}
+		err := sched.executeImplement(ctx, "T-OUT-2", inputs)
+		cancel()
+
+		if len(asked) != 1 || len(asked[0]) != 1 || asked[0][0].Path != "src/feature.go" {
+			t.Fatalf("expected one escalation for src/feature.go, got %v", asked)
+		}
+		rec, readErr := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-OUT-2", 3))
+		if readErr != nil {
+			t.Fatalf("expected a receipt for the third attempt: %v", readErr)
+		}
+		if len(rec.Outputs) != 1 || !rec.Outputs[0].Failed() {
+			t.Errorf("receipt should show the missing output, got %v", rec.Outputs)
+		}
+
+		if approve {
+			if err != nil {
+				t.Errorf("an accepted step should succeed, got %v", err)
+			}
+			if !rec.OutputsAccepted {
+				t.Error("receipt should record that the missing outputs were accepted")
+			}
+			continue
+		}
+		var missingErr *MissingOutputsError
+		if !errors.As(err, &missingErr) || missingErr.Attempts != 3 {
+			t.Errorf("expected a MissingOutputsError after 3 attempts, got %v", err)
+		}
+	}
+}
+
+// changesRecorder is a transcript formatter that keeps the changed-files
+// summaries it was asked for
+type changesRecorder struct {
+	changes *[][]snapshot.FileChange
+}
+
+func (changesRecorder) FormatEvent(*protocol.Event) string         { return "" }
+func (changesRecorder) FormatHeartbeat(*protocol.Heartbeat) string { return "" }
+func (changesRecorder) FormatCommand(*protocol.Command) string     { return "" }
+func (r changesRecorder) FormatChanges(taskID string, changes []snapshot.FileChange) string {
+	*r.changes = append(*r.changes, changes)
+	return ""
+}
+
+func TestSchedulerSnapshotsBuilderSteps(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "src", "main.go"), []byte("package src\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pre, err := snapshot.CaptureSnapshot(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.SaveSnapshot(pre, filepath.Join(workspace, "snapshots", pre.SnapshotID+".manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n\nfunc Feature() {}\n"})
+	sched := newArtifactScheduler(builder, workspace)
+	sched.SetSnapshotID(pre.SnapshotID)
+	sched.SetSnapshotBlobs(true)
+	var summaries [][]snapshot.FileChange
+	sched.SetTranscriptFormatter(changesRecorder{&summaries})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sched.executeImplement(ctx, "T-SNAP-1", map[string]any{"goal": "snapshot"}); err != nil {
+		t.Fatalf("implement failed: %v", err)
+	}
+
+	rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-SNAP-1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.SnapshotID != pre.SnapshotID || rec.PostSnapshotID == "" || rec.PostSnapshotID == pre.SnapshotID {
+		t.Fatalf("receipt snapshots = %s → %s, want %s → a new snapshot", rec.SnapshotID, rec.PostSnapshotID, pre.SnapshotID)
+	}
+	post, err := snapshot.LoadSnapshot(filepath.Join(workspace, "snapshots", rec.PostSnapshotID+".manifest.json"))
+	if err != nil {
+		t.Fatalf("post-step manifest not saved: %v", err)
+	}
+	for _, file := range post.Files {
+		if !snapshot.HasBlob(workspace, file.SHA256) {
+			t.Errorf("content of %s not stored", file.Path)
+		}
+	}
+
+	if len(summaries) != 1 || len(summaries[0]) != 1 || summaries[0][0].Path != "src/feature.go" || summaries[0][0].Change != snapshot.ChangeAdded {
+		t.Errorf("changed-files summary = %+v, want src/feature.go added", summaries)
+	}
+}
@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/agent/script"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/supervisor"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func TestSchedulerCommitsAcceptedBuilderSteps(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n"})
+	sched := newArtifactScheduler(builder, workspace)
+
+	type commit struct {
+		action  protocol.Action
+		step    int
+		receipt string
+	}
+	var commits []commit
+	sched.SetStepCommitter(func(cmd *protocol.Command, step int, receiptPath string) error {
+		// The receipt is written before the step is committed
+		if _, err := os.Stat(receiptPath); err != nil {
+			t.Errorf("receipt missing at commit time: %v", err)
+		}
+		commits = append(commits, commit{cmd.Action, step, receiptPath})
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sched.executeImplement(ctx, "T-GIT-1", map[string]any{"goal": "commit"}); err != nil {
+		t.Fatalf("implement failed: %v", err)
+	}
+	if err := sched.executeImplementChanges(ctx, "T-GIT-1"); err != nil {
+		t.Fatalf("implement_changes failed: %v", err)
+	}
+
+	want := []commit{
+		{protocol.ActionImplement, 1, receipt.GetReceiptPath(workspace, "T-GIT-1", 1)},
+		{protocol.ActionImplementChanges, 2, receipt.GetReceiptPath(workspace, "T-GIT-1", 2)},
+	}
+	if len(commits) != len(want) {
+		t.Fatalf("commits = %+v, want %+v", commits, want)
+	}
+	for i := range want {
+		if commits[i] != want[i] {
+			t.Errorf("commit %d = %+v, want %+v", i, commits[i], want[i])
+		}
+	}
+}
+
+// startMockAgent starts an unscripted mock agent of the given type
+func startMockAgent(t *testing.T, agentType protocol.AgentType) *supervisor.AgentSupervisor {
+	t.Helper()
+	mockAgentPath, err := buildMockAgent(t)
+	if err != nil {
+		t.Fatalf("failed to build mock agent: %v", err)
+	}
+	agent := supervisor.NewAgentSupervisor(
+		agentType,
+		[]string{mockAgentPath, "-type", string(agentType), "-no-heartbeat"},
+		map[string]string{},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err := agent.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start %s: %v", agentType, err)
+	}
+	t.Cleanup(func() { agent.Stop(context.Background()) })
+	return agent
+}
+
+func TestSchedulerCommitsReviewAndSpecSteps(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n"})
+	sched := newArtifactScheduler(builder, workspace)
+	sched.reviewer = startMockAgent(t, protocol.AgentTypeReviewer)
+	sched.specMaintainer = startMockAgent(t, protocol.AgentTypeSpecMaintainer)
+
+	var actions []protocol.Action
+	sched.SetStepCommitter(func(cmd *protocol.Command, step int, receiptPath string) error {
+		actions = append(actions, cmd.Action)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sched.executeImplement(ctx, "T-GIT-3", map[string]any{"goal": "commit"}); err != nil {
+		t.Fatalf("implement failed: %v", err)
+	}
+	if _, err := sched.executeReview(ctx, "T-GIT-3"); err != nil {
+		t.Fatalf("review failed: %v", err)
+	}
+	if _, err := sched.executeSpecMaintenance(ctx, "T-GIT-3"); err != nil {
+		t.Fatalf("update_spec failed: %v", err)
+	}
+
+	// Review files and spec edits are committed too, leaving the run clean
+	want := []protocol.Action{protocol.ActionImplement, protocol.ActionReview, protocol.ActionUpdateSpec}
+	if len(actions) != len(want) {
+		t.Fatalf("committed %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Errorf("commit %d = %s, want %s", i, actions[i], want[i])
+		}
+	}
+}
+
+func TestSchedulerFailsStepWhenCommitFails(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n"})
+	sched := newArtifactScheduler(builder, workspace)
+	commitErr := errors.New("index.lock exists")
+	sched.SetStepCommitter(func(*protocol.Command, int, string) error { return commitErr })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sched.executeImplement(ctx, "T-GIT-2", map[string]any{"goal": "commit"}); !errors.Is(err, commitErr) {
+		t.Fatalf("expected the commit error, got %v", err)
+	}
+}
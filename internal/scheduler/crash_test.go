@@ -11,11 +11,11 @@ import (
 
 	"github.com/iambrandonn/lorch/internal/eventlog"
 	"github.com/iambrandonn/lorch/internal/ledger"
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/runstate"
 	"github.com/iambrandonn/lorch/internal/snapshot"
 	"github.com/iambrandonn/lorch/internal/supervisor"
 	"github.com/iambrandonn/lorch/internal/transcript"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // TestCrashAndResumeAfterBuilderCompleted tests resuming after builder completes
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/agent/script"
+	"github.com/iambrandonn/lorch/internal/ledger"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func TestSchedulerFailsStepOnOversizeOutcome(t *testing.T) {
+	// lorch drops the builder's outcome for exceeding its message limit and
+	// reports an error event for the command in its place
+	ndjson.SetDefaultLimit(8192)
+	defer ndjson.SetDefaultLimit(0)
+
+	workspace := t.TempDir()
+	builder := startBuilderScript(t, workspace, script.EventTemplate{
+		Type:   protocol.EventBuilderCompleted,
+		Status: "success",
+		Payload: map[string]any{
+			"tests": map[string]any{"status": "pass"},
+			"pad":   strings.Repeat("x", 9000),
+		},
+	})
+	sched := newArtifactScheduler(builder, workspace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := sched.executeImplement(ctx, "T-ERR-1", map[string]any{"goal": "oversize"})
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected a command error, got %v", err)
+	}
+	if cmdErr.Code != protocol.ErrorMessageTooLarge || cmdErr.Action != protocol.ActionImplement {
+		t.Errorf("unexpected command error: %+v", cmdErr)
+	}
+	if ctx.Err() != nil {
+		t.Error("the step should fail as soon as the error event arrives")
+	}
+}
+
+func TestResumeRerunsImplementEndedByError(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n"})
+	sched := newArtifactScheduler(builder, workspace)
+	sched.reviewer = startMockAgent(t, protocol.AgentTypeReviewer)
+	sched.specMaintainer = startMockAgent(t, protocol.AgentTypeSpecMaintainer)
+	var commands []*protocol.Command
+	sched.SetEventLogger(commandRecorder{&commands})
+
+	// The interrupted run's implement ended with an error event only
+	inputs := map[string]any{"goal": "resume"}
+	failed := sched.makeCommand("T-ERR-2", protocol.AgentTypeBuilder, protocol.ActionImplement, inputs)
+	lg := &ledger.Ledger{
+		Commands: []*protocol.Command{failed},
+		Events: []*protocol.Event{{
+			Kind:          protocol.MessageKindEvent,
+			CorrelationID: failed.CorrelationID,
+			TaskID:        "T-ERR-2",
+			Event:         protocol.EventError,
+			Payload:       map[string]any{"code": protocol.ErrorMessageTooLarge},
+		}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sched.ResumeTask(ctx, "T-ERR-2", inputs, lg); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if len(commands) == 0 || commands[0].Action != protocol.ActionImplement {
+		t.Fatalf("expected implement to run again first, sent %d commands", len(commands))
+	}
+}
@@ -11,9 +11,9 @@ import (
 	"time"
 
 	"github.com/iambrandonn/lorch/internal/eventlog"
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/supervisor"
 	"github.com/iambrandonn/lorch/internal/transcript"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestSchedulerWithLoggingAndTranscripts(t *testing.T) {
@@ -11,9 +11,12 @@ import (
 	"github.com/google/uuid"
 	"github.com/iambrandonn/lorch/internal/idempotency"
 	"github.com/iambrandonn/lorch/internal/ledger"
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/internal/snapshot"
 	"github.com/iambrandonn/lorch/internal/supervisor"
+	"github.com/iambrandonn/lorch/internal/usage"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // EventLogger writes protocol messages to persistent storage
@@ -28,8 +31,22 @@ type TranscriptFormatter interface {
 	FormatEvent(*protocol.Event) string
 	FormatHeartbeat(*protocol.Heartbeat) string
 	FormatCommand(*protocol.Command) string
+	FormatChanges(taskID string, changes []snapshot.FileChange) string
 }
 
+// BudgetApprover asks a human whether to continue after a budget limit is
+// exceeded. Returning false (or an error) stops the task.
+type BudgetApprover func(ctx context.Context, exceeded *usage.BudgetExceeded) (bool, error)
+
+// OutputsApprover asks a human whether to accept a step whose required
+// outputs are still missing after its retries. Returning false (or an
+// error) fails the task.
+type OutputsApprover func(ctx context.Context, taskID string, action protocol.Action, missing []receipt.OutputStatus) (bool, error)
+
+// StepCommitter records an accepted step in version control, given the
+// step's command, its number and where its receipt was written
+type StepCommitter func(cmd *protocol.Command, step int, receiptPath string) error
+
 // Stage represents the current stage of task execution
 type Stage string
 
@@ -47,8 +64,11 @@ type Scheduler struct {
 	specMaintainer *supervisor.AgentSupervisor
 	logger         *slog.Logger
 
-	// Snapshot ID for version pinning
-	snapshotID string
+	// Snapshot ID for version pinning: the run's snapshot, then the one
+	// captured after the last step that changed the workspace. Strict
+	// pinning rejects events that observed another snapshot.
+	snapshotID           string
+	strictVersionPinning bool
 
 	// Workspace root for receipt writing
 	workspaceRoot string
@@ -63,14 +83,44 @@ type Scheduler struct {
 	// Optional logging/formatting (for CLI integration)
 	eventLog   EventLogger
 	transcript TranscriptFormatter
+	redactor   *redact.Redactor
 
 	// Tracking for current command execution
-	currentCommand *protocol.Command
-	currentEvents  []*protocol.Event
+	currentCommand    *protocol.Command
+	currentEvents     []*protocol.Event
+	currentSupervisor *supervisor.AgentSupervisor
 
 	// Task inputs to preserve across all commands (implement, review, spec)
 	// for traceability metadata (P2.4 Task C)
 	taskInputs map[string]any
+
+	// Optional LLM usage accounting and budget enforcement
+	usage          *usage.Tracker
+	budgetApprover BudgetApprover
+
+	// Size cap for reported artifacts (policy.artifact_max_bytes), and the
+	// artifacts of the current command that failed verification
+	artifactMaxBytes int64
+	artifactFailures []receipt.ArtifactFailure
+
+	// Expected output statuses of the current command, whether a human
+	// accepted missing ones, and who to ask
+	outputs         []receipt.OutputStatus
+	outputsAccepted bool
+	outputsApprover OutputsApprover
+
+	// Files tracked by the snapshots the scheduler captures, whether their
+	// content goes to the blob store, and the snapshot captured after the
+	// current command
+	snapshotScope  snapshot.Scope
+	snapshotBlobs  bool
+	postSnapshotID string
+
+	// Events of the current command that observed another snapshot
+	versionMismatches []receipt.VersionMismatch
+
+	// Optional version control of accepted builder steps (git mode)
+	stepCommitter StepCommitter
 }
 
 // NewScheduler creates a new scheduler
@@ -108,16 +158,70 @@ func (s *Scheduler) SetTranscriptFormatter(formatter TranscriptFormatter) {
 	s.transcript = formatter
 }
 
+// SetRedactor removes secrets from receipts before they are written
+func (s *Scheduler) SetRedactor(r *redact.Redactor) {
+	s.redactor = r
+}
+
 // SetSnapshotID sets the snapshot ID for version pinning
 func (s *Scheduler) SetSnapshotID(snapshotID string) {
 	s.snapshotID = snapshotID
 }
 
+// SetStrictVersionPinning makes events that observed a different snapshot
+// than their command fail the step; otherwise they are logged and recorded
+// in the step's receipt
+func (s *Scheduler) SetStrictVersionPinning(strict bool) {
+	s.strictVersionPinning = strict
+}
+
 // SetWorkspaceRoot sets the workspace root for receipt writing
 func (s *Scheduler) SetWorkspaceRoot(workspaceRoot string) {
 	s.workspaceRoot = workspaceRoot
 }
 
+// SetUsageTracker sets the tracker used to price and total event usage
+func (s *Scheduler) SetUsageTracker(tracker *usage.Tracker) {
+	s.usage = tracker
+}
+
+// SetArtifactMaxBytes caps the size of the artifacts agents report; zero
+// means no cap
+func (s *Scheduler) SetArtifactMaxBytes(maxBytes int64) {
+	s.artifactMaxBytes = maxBytes
+}
+
+// SetSnapshotScope selects the files tracked by the workspace snapshots the
+// scheduler captures after commands
+func (s *Scheduler) SetSnapshotScope(scope snapshot.Scope) {
+	s.snapshotScope = scope
+}
+
+// SetSnapshotBlobs keeps the content of the snapshots captured after
+// builder and spec maintainer steps in the blob store
+func (s *Scheduler) SetSnapshotBlobs(enabled bool) {
+	s.snapshotBlobs = enabled
+}
+
+// SetOutputsApprover sets the callback consulted when required outputs are
+// still missing after a command's retries. Without an approver, the task
+// fails.
+func (s *Scheduler) SetOutputsApprover(approver OutputsApprover) {
+	s.outputsApprover = approver
+}
+
+// SetStepCommitter sets the callback that records each accepted step, after
+// its receipt is written. A commit failure fails the task.
+func (s *Scheduler) SetStepCommitter(committer StepCommitter) {
+	s.stepCommitter = committer
+}
+
+// SetBudgetApprover sets the callback consulted when a budget is exceeded.
+// Without an approver, exceeding a budget fails the task.
+func (s *Scheduler) SetBudgetApprover(approver BudgetApprover) {
+	s.budgetApprover = approver
+}
+
 // ExecuteTask runs the full Implement → Review → Spec Maintenance flow
 // inputs should contain task-specific data (e.g., "goal" for legacy tasks,
 // or richer activation metadata for P2.4 intake-derived tasks)
@@ -268,6 +372,7 @@ func (s *Scheduler) detectMidSpecLoop(lg *ledger.Ledger, taskID string) (bool, s
 func (s *Scheduler) ResumeTask(ctx context.Context, taskID string, inputs map[string]any, lg *ledger.Ledger) error {
 	goal := extractGoal(inputs)
 	s.logger.Info("resuming task execution", "task_id", taskID, "goal", goal)
+	s.resumeSnapshot(lg, taskID)
 
 	// Get terminal events from ledger
 	terminals := lg.GetTerminalEvents()
@@ -276,7 +381,8 @@ func (s *Scheduler) ResumeTask(ctx context.Context, taskID string, inputs map[st
 	implementComplete := false
 	for _, cmd := range lg.Commands {
 		if cmd.TaskID == taskID && (cmd.Action == protocol.ActionImplement || cmd.Action == protocol.ActionImplementChanges) {
-			if _, hasTerminal := terminals[cmd.MessageID]; hasTerminal {
+			// An error event ends the command without completing the step
+			if evt, hasTerminal := terminals[cmd.MessageID]; hasTerminal && evt.Event != protocol.EventError {
 				implementComplete = true
 				s.logger.Info("implement step already complete, skipping", "task_id", taskID)
 				break
@@ -450,6 +556,12 @@ func (s *Scheduler) sendCommand(sup *supervisor.AgentSupervisor, cmd *protocol.C
 	// Track this command for receipt generation
 	s.currentCommand = cmd
 	s.currentEvents = make([]*protocol.Event, 0)
+	s.currentSupervisor = sup
+	s.artifactFailures = nil
+	s.outputs = nil
+	s.outputsAccepted = false
+	s.postSnapshotID = ""
+	s.versionMismatches = nil
 	s.stepCounter++
 
 	// Log command to event log
@@ -468,6 +580,12 @@ func (s *Scheduler) sendCommand(sup *supervisor.AgentSupervisor, cmd *protocol.C
 }
 
 func (s *Scheduler) writeReceipt() error {
+	return s.saveReceipt(nil)
+}
+
+// saveReceipt writes the receipt for the current command, recording how it
+// was cancelled when cancellation is non-nil
+func (s *Scheduler) saveReceipt(cancellation *protocol.CancelOutcome) error {
 	// Only write receipts if we have a workspace root and a command
 	if s.workspaceRoot == "" || s.currentCommand == nil {
 		return nil
@@ -475,6 +593,16 @@ func (s *Scheduler) writeReceipt() error {
 
 	// Create receipt from command and collected events
 	rec := receipt.NewReceipt(s.currentCommand, s.stepCounter, s.currentEvents)
+	rec.Cancellation = cancellation
+	rec.ArtifactFailures = s.artifactFailures
+	rec.Outputs = s.outputs
+	rec.OutputsAccepted = s.outputsAccepted
+	rec.PostSnapshotID = s.postSnapshotID
+	rec.VersionMismatches = s.versionMismatches
+	if s.currentSupervisor != nil {
+		rec.Resources = s.currentSupervisor.CommandResources()
+	}
+	rec.Redact(s.redactor)
 
 	// Determine receipt path
 	receiptPath := filepath.Join(s.workspaceRoot, "receipts", s.currentCommand.TaskID, fmt.Sprintf("step-%d.json", s.stepCounter))
@@ -492,6 +620,19 @@ func (s *Scheduler) writeReceipt() error {
 	return nil
 }
 
+// commitStep hands the accepted step to the step committer, if any
+func (s *Scheduler) commitStep() error {
+	if s.stepCommitter == nil || s.currentCommand == nil {
+		return nil
+	}
+	cmd := s.currentCommand
+	receiptPath := receipt.GetReceiptPath(s.workspaceRoot, cmd.TaskID, s.stepCounter)
+	if err := s.stepCommitter(cmd, s.stepCounter, receiptPath); err != nil {
+		return fmt.Errorf("failed to commit %s step: %w", cmd.Action, err)
+	}
+	return nil
+}
+
 // validateBuilderTestResults validates builder.completed events per PLAN.md P1.4
 // Per P1.4-ANSWERS A2: missing/invalid tests → task failure with clear error
 func (s *Scheduler) validateBuilderTestResults(evt *protocol.Event) error {
@@ -577,11 +718,9 @@ func (s *Scheduler) executeImplement(ctx context.Context, taskID string, inputs
 		}
 	}
 
-	if err := s.sendCommand(s.builder, cmd); err != nil {
-		return err
-	}
-
-	evt, err := s.waitForEventReturn(ctx, s.builder, protocol.EventBuilderCompleted, taskID)
+	evt, err := s.deliver(ctx, s.builder, cmd, func() (*protocol.Event, error) {
+		return s.waitForEventReturn(ctx, s.builder, protocol.EventBuilderCompleted, taskID)
+	})
 	if err != nil {
 		return err
 	}
@@ -590,13 +729,17 @@ func (s *Scheduler) executeImplement(ctx context.Context, taskID string, inputs
 	if err := s.validateBuilderTestResults(evt); err != nil {
 		return fmt.Errorf("builder test validation failed: %w", err)
 	}
+	s.snapshotStep(cmd)
 
 	// Write receipt after successful completion
 	if err := s.writeReceipt(); err != nil {
 		s.logger.Warn("failed to write receipt", "error", err)
 	}
+	if err := s.commitStep(); err != nil {
+		return err
+	}
 
-	return nil
+	return s.checkBudget(ctx, taskID)
 }
 
 func (s *Scheduler) executeImplementChanges(ctx context.Context, taskID string) error {
@@ -612,11 +755,9 @@ func (s *Scheduler) executeImplementChanges(ctx context.Context, taskID string)
 		inputs,
 	)
 
-	if err := s.sendCommand(s.builder, cmd); err != nil {
-		return err
-	}
-
-	evt, err := s.waitForEventReturn(ctx, s.builder, protocol.EventBuilderCompleted, taskID)
+	evt, err := s.deliver(ctx, s.builder, cmd, func() (*protocol.Event, error) {
+		return s.waitForEventReturn(ctx, s.builder, protocol.EventBuilderCompleted, taskID)
+	})
 	if err != nil {
 		return err
 	}
@@ -625,13 +766,17 @@ func (s *Scheduler) executeImplementChanges(ctx context.Context, taskID string)
 	if err := s.validateBuilderTestResults(evt); err != nil {
 		return fmt.Errorf("builder test validation failed: %w", err)
 	}
+	s.snapshotStep(cmd)
 
 	// Write receipt after successful completion
 	if err := s.writeReceipt(); err != nil {
 		s.logger.Warn("failed to write receipt", "error", err)
 	}
+	if err := s.commitStep(); err != nil {
+		return err
+	}
 
-	return nil
+	return s.checkBudget(ctx, taskID)
 }
 
 func (s *Scheduler) executeReview(ctx context.Context, taskID string) (string, error) {
@@ -647,11 +792,9 @@ func (s *Scheduler) executeReview(ctx context.Context, taskID string) (string, e
 		inputs,
 	)
 
-	if err := s.sendCommand(s.reviewer, cmd); err != nil {
-		return "", err
-	}
-
-	evt, err := s.waitForEventReturn(ctx, s.reviewer, protocol.EventReviewCompleted, taskID)
+	evt, err := s.deliver(ctx, s.reviewer, cmd, func() (*protocol.Event, error) {
+		return s.waitForEventReturn(ctx, s.reviewer, protocol.EventReviewCompleted, taskID)
+	})
 	if err != nil {
 		return "", err
 	}
@@ -660,6 +803,13 @@ func (s *Scheduler) executeReview(ctx context.Context, taskID string) (string, e
 	if err := s.writeReceipt(); err != nil {
 		s.logger.Warn("failed to write receipt", "error", err)
 	}
+	if err := s.commitStep(); err != nil {
+		return "", err
+	}
+
+	if err := s.checkBudget(ctx, taskID); err != nil {
+		return "", err
+	}
 
 	return evt.Status, nil
 }
@@ -677,22 +827,45 @@ func (s *Scheduler) executeSpecMaintenance(ctx context.Context, taskID string) (
 		inputs,
 	)
 
-	if err := s.sendCommand(s.specMaintainer, cmd); err != nil {
+	evt, err := s.deliver(ctx, s.specMaintainer, cmd, func() (*protocol.Event, error) {
+		return s.waitForSpecOutcome(ctx, taskID)
+	})
+	if err != nil {
+		return "", err
+	}
+	s.snapshotStep(cmd)
+
+	// Write receipt after successful completion
+	if err := s.writeReceipt(); err != nil {
+		s.logger.Warn("failed to write receipt", "error", err)
+	}
+	if err := s.commitStep(); err != nil {
+		return "", err
+	}
+
+	if err := s.checkBudget(ctx, taskID); err != nil {
 		return "", err
 	}
 
-	// Wait for one of the terminal spec events
-	var eventType string
+	return evt.Event, nil
+}
+
+// waitForSpecOutcome waits for one of the terminal spec events
+func (s *Scheduler) waitForSpecOutcome(ctx context.Context, taskID string) (*protocol.Event, error) {
 	for {
 		select {
 		case <-ctx.Done():
-			return "", ctx.Err()
+			s.cancelInFlight(ctx, s.specMaintainer)
+			return nil, ctx.Err()
 		case evt, ok := <-s.specMaintainer.Events():
 			if !ok {
-				return "", fmt.Errorf("spec maintainer events channel closed")
+				return nil, s.agentStopped(s.specMaintainer, fmt.Errorf("spec maintainer events channel closed"))
 			}
 
 			s.notifyEvent(evt)
+			if err := s.commandError(evt); err != nil {
+				return nil, err
+			}
 
 			if evt.TaskID != taskID {
 				continue
@@ -703,21 +876,12 @@ func (s *Scheduler) executeSpecMaintenance(ctx context.Context, taskID string) (
 			case protocol.EventSpecUpdated,
 				protocol.EventSpecNoChangesNeeded,
 				protocol.EventSpecChangesRequested:
-				eventType = evt.Event
-				goto done
+				return evt, nil
 			}
 		case hb := <-s.specMaintainer.Heartbeats():
 			s.notifyHeartbeat(hb)
 		}
 	}
-
-done:
-	// Write receipt after successful completion
-	if err := s.writeReceipt(); err != nil {
-		s.logger.Warn("failed to write receipt", "error", err)
-	}
-
-	return eventType, nil
 }
 
 func (s *Scheduler) makeCommand(
@@ -732,17 +896,11 @@ func (s *Scheduler) makeCommand(
 		snapshotID = "snap-test-0001" // Placeholder for tests
 	}
 
-	// Generate unique correlation ID for this command
-	correlationID := fmt.Sprintf("corr-%s-%s-%s",
-		taskID,
-		string(action),
-		uuid.New().String()[:8])
-
 	// Create command with all required fields
 	cmd := &protocol.Command{
 		Kind:           protocol.MessageKindCommand,
 		MessageID:      uuid.New().String(),
-		CorrelationID:  correlationID,
+		CorrelationID:  newCorrelationID(taskID, action),
 		TaskID:         taskID,
 		IdempotencyKey: "", // Will be set below
 		To: protocol.AgentRef{
@@ -750,7 +908,7 @@ func (s *Scheduler) makeCommand(
 		},
 		Action:          action,
 		Inputs:          inputs,
-		ExpectedOutputs: []protocol.ExpectedOutput{},
+		ExpectedOutputs: expectedOutputs(taskID, action, inputs),
 		Version: protocol.Version{
 			SnapshotID: snapshotID,
 		},
@@ -774,6 +932,14 @@ func (s *Scheduler) makeCommand(
 	return cmd
 }
 
+// newCorrelationID generates a unique correlation ID for a command
+func newCorrelationID(taskID string, action protocol.Action) string {
+	return fmt.Sprintf("corr-%s-%s-%s",
+		taskID,
+		string(action),
+		uuid.New().String()[:8])
+}
+
 func (s *Scheduler) waitForEvent(ctx context.Context, sup *supervisor.AgentSupervisor, eventType string, taskID string) error {
 	_, err := s.waitForEventReturn(ctx, sup, eventType, taskID)
 	return err
@@ -783,13 +949,17 @@ func (s *Scheduler) waitForEventReturn(ctx context.Context, sup *supervisor.Agen
 	for {
 		select {
 		case <-ctx.Done():
+			s.cancelInFlight(ctx, sup)
 			return nil, ctx.Err()
 		case evt, ok := <-sup.Events():
 			if !ok {
-				return nil, fmt.Errorf("agent events channel closed")
+				return nil, s.agentStopped(sup, fmt.Errorf("agent events channel closed"))
 			}
 
 			s.notifyEvent(evt)
+			if err := s.commandError(evt); err != nil {
+				return nil, err
+			}
 
 			if evt.TaskID == taskID && evt.Event == eventType {
 				return evt, nil
@@ -800,6 +970,72 @@ func (s *Scheduler) waitForEventReturn(ctx context.Context, sup *supervisor.Agen
 	}
 }
 
+// CommandError reports an error event that ended the current command in
+// place of its outcome, such as lorch dropping an oversized reply
+type CommandError struct {
+	Action  protocol.Action
+	Code    string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s error for %s: %s", e.Code, e.Action, e.Message)
+}
+
+// commandError fails the current command when evt is an error event for
+// it. An error event is terminal, so no outcome is coming after it.
+func (s *Scheduler) commandError(evt *protocol.Event) error {
+	if evt.Event != protocol.EventError || s.currentCommand == nil || evt.CorrelationID != s.currentCommand.CorrelationID {
+		return nil
+	}
+	code, _ := evt.Payload["code"].(string)
+	message, _ := evt.Payload["message"].(string)
+	if err := s.writeReceipt(); err != nil {
+		s.logger.Warn("failed to write receipt", "error", err)
+	}
+	return &CommandError{Action: s.currentCommand.Action, Code: code, Message: message}
+}
+
+// cancelInFlight stops the command sup is working on once ctx has ended and
+// records the cancellation in the step's receipt
+func (s *Scheduler) cancelInFlight(ctx context.Context, sup *supervisor.AgentSupervisor) {
+	outcome := sup.Cancel(context.Cause(ctx).Error())
+	if outcome == nil {
+		return
+	}
+
+	s.logger.Warn("cancelled in-flight command",
+		"correlation_id", outcome.CorrelationID,
+		"reason", outcome.Reason,
+		"acknowledged", outcome.Acknowledged,
+		"escalation", outcome.Escalation)
+
+	if err := s.saveReceipt(outcome); err != nil {
+		s.logger.Warn("failed to write cancellation receipt", "error", err)
+	}
+}
+
+// agentStopped explains why sup stopped sending events. When it was killed
+// for exceeding a resource limit the kill is recorded in the step's receipt
+// and reported instead of closed.
+func (s *Scheduler) agentStopped(sup *supervisor.AgentSupervisor, closed error) error {
+	if exited := sup.Exited(); exited != nil {
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	kill := sup.LimitKill()
+	if kill == nil {
+		return closed
+	}
+	if err := s.writeReceipt(); err != nil {
+		s.logger.Warn("failed to write receipt", "error", err)
+	}
+	return fmt.Errorf("agent was killed for exceeding its %s limit: %s", kill.Limit, kill.Detail)
+}
+
 // extractGoal extracts a goal string from inputs for logging purposes.
 // Falls back to reasonable defaults if "goal" key is missing.
 func extractGoal(inputs map[string]any) string {
@@ -838,10 +1074,53 @@ func extractIntakeCorrelationFromCommand(cmd *protocol.Command) string {
 	return ""
 }
 
+// checkBudget pauses for human approval when the task or run has exceeded
+// its configured budget. Approved limits are not asked about again.
+func (s *Scheduler) checkBudget(ctx context.Context, taskID string) error {
+	if s.usage == nil {
+		return nil
+	}
+
+	for {
+		exceeded := s.usage.Check(taskID)
+		if exceeded == nil {
+			return nil
+		}
+
+		s.logger.Warn("budget exceeded",
+			"task_id", taskID,
+			"scope", exceeded.Scope,
+			"metric", exceeded.Metric,
+			"limit", exceeded.Limit,
+			"actual", exceeded.Actual)
+
+		if s.budgetApprover == nil {
+			return exceeded
+		}
+
+		approved, err := s.budgetApprover(ctx, exceeded)
+		if err != nil {
+			return fmt.Errorf("budget approval failed: %w", err)
+		}
+		if !approved {
+			return exceeded
+		}
+
+		s.usage.Approve(exceeded)
+	}
+}
+
 func (s *Scheduler) notifyEvent(evt *protocol.Event) {
+	// Price and total usage before the event is persisted so the ledger
+	// records the estimated cost
+	if s.usage != nil && evt.Usage != nil {
+		s.usage.Record(evt.TaskID, evt.Usage)
+	}
+
 	// Track event for current command (if correlation IDs match)
 	if s.currentCommand != nil && evt.CorrelationID == s.currentCommand.CorrelationID {
 		s.currentEvents = append(s.currentEvents, evt)
+		s.checkObservedVersion(evt)
 	}
 
 	// Log event to event log
@@ -11,8 +11,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
 	"github.com/iambrandonn/lorch/internal/supervisor"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestSchedulerBasicFlow(t *testing.T) {
@@ -774,11 +774,13 @@ func TestSchedulerSpecNotesArtifacts(t *testing.T) {
 		logger,
 	)
 
-	// Use script that emits spec.changes_requested with spec_notes artifact
+	// Use script that emits spec.changes_requested with spec_notes artifact,
+	// written into the scheduler's workspace
 	scriptPath := "../../testdata/fixtures/spec-changes-requested.json"
+	workspace := t.TempDir()
 	specMaintainer := supervisor.NewAgentSupervisor(
 		protocol.AgentTypeSpecMaintainer,
-		[]string{mockAgentPath, "-type", "spec_maintainer", "-no-heartbeat", "-script", scriptPath},
+		[]string{mockAgentPath, "-type", "spec_maintainer", "-no-heartbeat", "-script", scriptPath, "-workspace", workspace},
 		map[string]string{},
 		logger,
 	)
@@ -804,7 +806,7 @@ func TestSchedulerSpecNotesArtifacts(t *testing.T) {
 
 	// Create scheduler with temporary workspace for receipts
 	scheduler := NewScheduler(builder, reviewer, specMaintainer, logger)
-	scheduler.SetWorkspaceRoot(t.TempDir())
+	scheduler.SetWorkspaceRoot(workspace)
 	scheduler.SetSnapshotID("snap-test-spec-notes")
 
 	// Track events
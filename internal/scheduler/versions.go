@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/ledger"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// VersionMismatchError reports events that observed a different snapshot
+// than the one their command was pinned to, under strict version pinning
+type VersionMismatchError struct {
+	Action     protocol.Action
+	Mismatches []receipt.VersionMismatch
+}
+
+func (e *VersionMismatchError) Error() string {
+	mismatches := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		mismatches[i] = m.String()
+	}
+	return fmt.Sprintf("%s was answered for another snapshot: %s", e.Action, strings.Join(mismatches, "; "))
+}
+
+// checkObservedVersion records an event of the current command whose
+// observed_version differs from the command's snapshot. Events that do not
+// report an observed version are not checked.
+func (s *Scheduler) checkObservedVersion(evt *protocol.Event) {
+	if evt.ObservedVersion == nil || evt.ObservedVersion.SnapshotID == "" {
+		return
+	}
+	expected := s.currentCommand.Version.SnapshotID
+	if evt.ObservedVersion.SnapshotID == expected {
+		return
+	}
+
+	mismatch := receipt.VersionMismatch{
+		MessageID: evt.MessageID,
+		Event:     evt.Event,
+		Expected:  expected,
+		Observed:  evt.ObservedVersion.SnapshotID,
+	}
+	s.versionMismatches = append(s.versionMismatches, mismatch)
+	s.logger.Warn("event observed a different snapshot than its command",
+		"task_id", evt.TaskID,
+		"event", evt.Event,
+		"expected_snapshot", mismatch.Expected,
+		"observed_snapshot", mismatch.Observed,
+		"strict", s.strictVersionPinning)
+}
+
+// rejectVersionMismatches fails the current command when its events
+// observed another snapshot and pinning is strict. Lenient pinning accepts
+// the step; the mismatches are recorded in its receipt either way.
+func (s *Scheduler) rejectVersionMismatches(cmd *protocol.Command) error {
+	if !s.strictVersionPinning || len(s.versionMismatches) == 0 {
+		return nil
+	}
+	if err := s.writeReceipt(); err != nil {
+		s.logger.Warn("failed to write receipt", "error", err)
+	}
+	return &VersionMismatchError{Action: cmd.Action, Mismatches: s.versionMismatches}
+}
+
+// saveSnapshot captures the workspace and saves its manifest under
+// snapshots/, keeping the content in the blob store when enabled. An
+// unchanged workspace keeps its snapshot ID, so an existing manifest is not
+// rewritten.
+func (s *Scheduler) saveSnapshot() (*snapshot.Manifest, error) {
+	snap, err := s.captureSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	manifestPath := filepath.Join(s.workspaceRoot, "snapshots", snap.SnapshotID+".manifest.json")
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		if err := snapshot.SaveSnapshot(snap, manifestPath); err != nil {
+			return nil, fmt.Errorf("failed to save snapshot %s: %w", snap.SnapshotID, err)
+		}
+	}
+	if s.snapshotBlobs {
+		if _, err := snapshot.StoreBlobs(s.workspaceRoot, snap); err != nil {
+			s.logger.Warn("failed to store snapshot content", "snapshot_id", snap.SnapshotID, "error", err)
+		}
+	}
+	return snap, nil
+}
+
+// resumeSnapshot pins the commands of a resumed task. A command the ledger
+// shows without a terminal event is resent for the snapshot it was sent
+// for, so it keeps its idempotency key (MASTER-SPEC §5.6); otherwise the
+// workspace is captured again, since completed steps may have changed it
+// after the snapshot the run state records.
+func (s *Scheduler) resumeSnapshot(lg *ledger.Ledger, taskID string) {
+	var last *protocol.Command
+	for _, cmd := range lg.Commands {
+		if cmd.TaskID == taskID {
+			last = cmd
+		}
+	}
+	if last == nil {
+		return
+	}
+
+	if _, done := lg.GetTerminalEvents()[last.MessageID]; !done {
+		if last.Version.SnapshotID != "" {
+			s.snapshotID = last.Version.SnapshotID
+		}
+		return
+	}
+	if s.workspaceRoot == "" {
+		return
+	}
+	snap, err := s.saveSnapshot()
+	if err != nil {
+		s.logger.Warn("failed to snapshot workspace for resume", "task_id", taskID, "error", err)
+		return
+	}
+	if snap.SnapshotID != s.snapshotID {
+		s.logger.Info("resuming from the current workspace snapshot", "task_id", taskID, "snapshot_id", snap.SnapshotID)
+	}
+	s.snapshotID = snap.SnapshotID
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/agent/script"
+	"github.com/iambrandonn/lorch/internal/ledger"
+	"github.com/iambrandonn/lorch/internal/receipt"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func TestSchedulerPinsCommandsToStepSnapshots(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "src", "main.go"), []byte("package src\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pre, err := snapshot.CaptureSnapshot(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := startScriptedBuilder(t, workspace, script.ArtifactTemplate{Path: "src/feature.go", Content: "package src\n\nfunc Feature() {}\n"})
+	sched := newArtifactScheduler(builder, workspace)
+	sched.SetSnapshotID(pre.SnapshotID)
+	sched.SetStrictVersionPinning(true)
+	var commands []*protocol.Command
+	sched.SetEventLogger(commandRecorder{&commands})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sched.executeImplement(ctx, "T-PIN-1", map[string]any{"goal": "pin"}); err != nil {
+		t.Fatalf("implement failed: %v", err)
+	}
+	if err := sched.executeImplementChanges(ctx, "T-PIN-1"); err != nil {
+		t.Fatalf("implement_changes failed: %v", err)
+	}
+
+	rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-PIN-1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(commands))
+	}
+	if commands[0].Version.SnapshotID != pre.SnapshotID {
+		t.Errorf("first command pinned to %s, want %s", commands[0].Version.SnapshotID, pre.SnapshotID)
+	}
+	if commands[1].Version.SnapshotID != rec.PostSnapshotID || rec.PostSnapshotID == pre.SnapshotID {
+		t.Errorf("second command pinned to %s, want the post-step snapshot %s", commands[1].Version.SnapshotID, rec.PostSnapshotID)
+	}
+	if commands[0].IdempotencyKey == commands[1].IdempotencyKey {
+		t.Error("commands for different snapshots share an idempotency key")
+	}
+}
+
+func TestSchedulerRejectsVersionMismatchWhenStrict(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startBuilderScript(t, workspace, script.EventTemplate{
+		Type:               protocol.EventBuilderCompleted,
+		Status:             "success",
+		Payload:            map[string]any{"tests": map[string]any{"status": "pass"}},
+		ObservedSnapshotID: "snap-stale",
+	})
+	sched := newArtifactScheduler(builder, workspace)
+	sched.SetStrictVersionPinning(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := sched.executeImplement(ctx, "T-PIN-2", map[string]any{"goal": "pin"})
+	var mismatchErr *VersionMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("expected a VersionMismatchError, got %v", err)
+	}
+	if len(mismatchErr.Mismatches) != 1 || mismatchErr.Mismatches[0].Observed != "snap-stale" {
+		t.Errorf("unexpected mismatches %v", mismatchErr.Mismatches)
+	}
+
+	rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-PIN-2", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.VersionMismatches) != 1 || rec.VersionMismatches[0].Expected != "snap-test-artifacts" {
+		t.Errorf("receipt mismatches = %v", rec.VersionMismatches)
+	}
+	if rec.PostSnapshotID != "" {
+		t.Errorf("rejected step was snapshotted as %s", rec.PostSnapshotID)
+	}
+}
+
+func TestSchedulerRecordsVersionMismatchWhenLenient(t *testing.T) {
+	workspace := t.TempDir()
+	builder := startBuilderScript(t, workspace, script.EventTemplate{
+		Type:               protocol.EventBuilderCompleted,
+		Status:             "success",
+		Payload:            map[string]any{"tests": map[string]any{"status": "pass"}},
+		ObservedSnapshotID: "snap-stale",
+	})
+	sched := newArtifactScheduler(builder, workspace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := sched.executeImplement(ctx, "T-PIN-3", map[string]any{"goal": "pin"}); err != nil {
+		t.Fatalf("lenient pinning rejected the step: %v", err)
+	}
+
+	rec, err := receipt.ReadReceipt(receipt.GetReceiptPath(workspace, "T-PIN-3", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.VersionMismatches) != 1 || rec.VersionMismatches[0].Observed != "snap-stale" || rec.VersionMismatches[0].Event != protocol.EventBuilderCompleted {
+		t.Errorf("receipt mismatches = %v", rec.VersionMismatches)
+	}
+}
+
+func TestResumeSnapshot(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "src", "main.go"), []byte("package src\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	current, err := snapshot.CaptureSnapshot(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	implement := &protocol.Command{MessageID: "m-1", CorrelationID: "corr-1", TaskID: "T-1", Action: protocol.ActionImplement, Version: protocol.Version{SnapshotID: "snap-start"}}
+	review := &protocol.Command{MessageID: "m-2", CorrelationID: "corr-2", TaskID: "T-1", Action: protocol.ActionReview, Version: protocol.Version{SnapshotID: "snap-built"}}
+	completed := &protocol.Event{CorrelationID: "corr-1", TaskID: "T-1", Event: protocol.EventBuilderCompleted}
+
+	newSched := func() *Scheduler {
+		sched := NewScheduler(nil, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		sched.SetWorkspaceRoot(workspace)
+		sched.SetSnapshotID("snap-start")
+		return sched
+	}
+
+	// The review never finished: it is resent for its own snapshot
+	sched := newSched()
+	sched.resumeSnapshot(&ledger.Ledger{Commands: []*protocol.Command{implement, review}, Events: []*protocol.Event{completed}}, "T-1")
+	if sched.snapshotID != "snap-built" {
+		t.Errorf("pending command: pinned to %s, want snap-built", sched.snapshotID)
+	}
+
+	// The last command finished: the workspace is captured again
+	sched = newSched()
+	sched.resumeSnapshot(&ledger.Ledger{Commands: []*protocol.Command{implement}, Events: []*protocol.Event{completed}}, "T-1")
+	if sched.snapshotID != current.SnapshotID {
+		t.Errorf("completed command: pinned to %s, want %s", sched.snapshotID, current.SnapshotID)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "snapshots", current.SnapshotID+".manifest.json")); err != nil {
+		t.Errorf("resume snapshot manifest not saved: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Mode selects what happens when a document does not match its schema
+type Mode string
+
+const (
+	// ModeOff skips validation entirely
+	ModeOff Mode = "off"
+	// ModeWarn logs and records violations but lets the document through
+	ModeWarn Mode = "warn"
+	// ModeStrict rejects documents with violations
+	ModeStrict Mode = "strict"
+)
+
+// ParseMode converts a config value to a Mode; empty means warn
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeWarn:
+		return ModeWarn, nil
+	case ModeOff:
+		return ModeOff, nil
+	case ModeStrict:
+		return ModeStrict, nil
+	default:
+		return "", fmt.Errorf("unknown schema validation mode %q (expected off, warn or strict)", s)
+	}
+}
+
+// Finding describes one document that failed validation
+type Finding struct {
+	Schema string
+	// Source names where the document came from: an agent type for IPC
+	// messages, or the state file kind for receipts and run state
+	Source     string
+	Violations []Violation
+	Rejected   bool
+}
+
+// ViolationError is returned in strict mode for a document with violations
+type ViolationError struct {
+	Schema     string
+	Source     string
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.String())
+	}
+	return fmt.Sprintf("%s %s violates schema: %s", e.Source, e.Schema, strings.Join(parts, "; "))
+}
+
+// Enforcer applies a validation mode to documents and reports what it finds.
+// A nil Enforcer accepts everything.
+type Enforcer struct {
+	validator *Validator
+	mode      Mode
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	recorder func(Finding)
+}
+
+// NewEnforcer creates an enforcer; logger may be nil
+func NewEnforcer(v *Validator, mode Mode, logger *slog.Logger) *Enforcer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Enforcer{validator: v, mode: mode, logger: logger}
+}
+
+// Mode returns the enforcement mode
+func (e *Enforcer) Mode() Mode {
+	if e == nil {
+		return ModeOff
+	}
+	return e.mode
+}
+
+// SetRecorder registers a callback for every finding, typically one that
+// appends it to the run's event ledger. Pass nil to stop recording.
+func (e *Enforcer) SetRecorder(fn func(Finding)) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.recorder = fn
+}
+
+// Check validates raw JSON against the named schema. It returns a
+// *ViolationError only in strict mode; in warn mode violations are logged
+// and recorded and the document is accepted.
+func (e *Enforcer) Check(source, name string, data []byte) error {
+	if e == nil || e.mode == ModeOff || e.validator == nil {
+		return nil
+	}
+
+	violations, err := e.validator.Validate(name, data)
+	if err != nil {
+		if _, known := e.validator.schemas[name]; !known {
+			return err
+		}
+		violations = []Violation{{Path: "$", Message: err.Error()}}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	finding := Finding{
+		Schema:     name,
+		Source:     source,
+		Violations: violations,
+		Rejected:   e.mode == ModeStrict,
+	}
+	for _, v := range violations {
+		e.logger.Warn("schema violation",
+			"schema", name,
+			"source", source,
+			"path", v.Path,
+			"message", v.Message,
+			"rejected", finding.Rejected)
+	}
+
+	e.mu.Lock()
+	recorder := e.recorder
+	e.mu.Unlock()
+	if recorder != nil {
+		recorder(finding)
+	}
+
+	if finding.Rejected {
+		return &ViolationError{Schema: name, Source: source, Violations: violations}
+	}
+	return nil
+}
+
+// CheckValue marshals value and checks it like Check
+func (e *Enforcer) CheckValue(source, name string, value any) error {
+	if e == nil || e.mode == ModeOff || e.validator == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal %s for validation: %w", name, err)
+	}
+	return e.Check(source, name, data)
+}
+
+var defaultEnforcer atomic.Pointer[Enforcer]
+
+// SetDefaultEnforcer replaces the process-wide enforcer used by the
+// supervisor, receipt and runstate packages
+func SetDefaultEnforcer(e *Enforcer) {
+	defaultEnforcer.Store(e)
+}
+
+// DefaultEnforcer returns the process-wide enforcer. Until one is set it is a
+// warn-mode enforcer over the embedded v1 schemas.
+func DefaultEnforcer() *Enforcer {
+	if e := defaultEnforcer.Load(); e != nil {
+		return e
+	}
+	v, err := Default()
+	if err != nil {
+		return nil
+	}
+	defaultEnforcer.CompareAndSwap(nil, NewEnforcer(v, ModeWarn, nil))
+	return defaultEnforcer.Load()
+}
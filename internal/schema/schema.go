@@ -0,0 +1,362 @@
+// Package schema validates JSON documents against the embedded schemas/v1
+// definitions. It implements the subset of JSON Schema draft-07 those files
+// use: type, required, properties, additionalProperties, items, enum, const,
+// pattern, minLength, minimum, maximum and the date-time format.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/iambrandonn/lorch/schemas"
+)
+
+// Schema names for the protocol messages and state files
+const (
+	Cancel           = "cancel"
+	Command          = "command"
+	Event            = "event"
+	Heartbeat        = "heartbeat"
+	Hello            = "hello"
+	HelloAck         = "hello-ack"
+	Log              = "log"
+	Receipt          = "receipt"
+	RunState         = "run-state"
+	SnapshotManifest = "snapshot-manifest"
+)
+
+// ForKind returns the schema name for an NDJSON message kind
+func ForKind(kind string) (string, bool) {
+	switch kind {
+	case "cancel", "command", "event", "heartbeat", "log", "hello":
+		return kind, true
+	case "hello_ack":
+		return HelloAck, true
+	}
+	return "", false
+}
+
+// Violation describes one place where a document does not match its schema
+type Violation struct {
+	// Path locates the offending value, e.g. "$.from.agent_type" or "$.artifacts[0].sha256"
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// Validator checks documents against a set of named schemas
+type Validator struct {
+	schemas map[string]map[string]any
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+var (
+	defaultOnce      sync.Once
+	defaultValidator *Validator
+	defaultErr       error
+)
+
+// Default returns a validator for the embedded v1 schemas
+func Default() (*Validator, error) {
+	defaultOnce.Do(func() {
+		defaultValidator, defaultErr = Load(schemas.V1, "v1")
+	})
+	return defaultValidator, defaultErr
+}
+
+// Load reads every "<name>.v1.json" file in dir of fsys
+func Load(fsys fs.FS, dir string) (*Validator, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read schema dir: %w", err)
+	}
+
+	v := &Validator{
+		schemas:  make(map[string]map[string]any),
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read schema %s: %w", entry.Name(), err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parse schema %s: %w", entry.Name(), err)
+		}
+		// "run-state.v1.json" is registered as "run-state"
+		name := entry.Name()
+		if i := strings.Index(name, "."); i >= 0 {
+			name = name[:i]
+		}
+		v.schemas[name] = doc
+	}
+	return v, nil
+}
+
+// Names returns the loaded schema names in sorted order
+func (v *Validator) Names() []string {
+	names := make([]string, 0, len(v.schemas))
+	for name := range v.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks raw JSON against the named schema. The error is non-nil only
+// when the schema is unknown or data is not JSON; schema mismatches are
+// reported as violations.
+func (v *Validator) Validate(name string, data []byte) ([]Violation, error) {
+	doc, ok := v.schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q", name)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("decode document: %w", err)
+	}
+
+	var out []Violation
+	v.check(doc, value, "$", &out)
+	return out, nil
+}
+
+// ValidateValue marshals value and validates it against the named schema
+func (v *Validator) ValidateValue(name string, value any) ([]Violation, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("marshal document: %w", err)
+	}
+	return v.Validate(name, data)
+}
+
+func (v *Validator) check(s map[string]any, value any, at string, out *[]Violation) {
+	add := func(format string, args ...any) {
+		*out = append(*out, Violation{Path: at, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := s["type"]; ok && !matchesType(t, value) {
+		add("expected %s, got %s", describeType(t), jsonType(value))
+		return
+	}
+
+	if c, ok := s["const"]; ok && !equal(c, value) {
+		add("must equal %v", c)
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if equal(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("value %v not in enum %v", display(value), enum)
+		}
+	}
+
+	switch val := value.(type) {
+	case string:
+		if min, ok := s["minLength"].(float64); ok && float64(utf8.RuneCountInString(val)) < min {
+			add("length %d is below minLength %v", utf8.RuneCountInString(val), min)
+		}
+		if p, ok := s["pattern"].(string); ok {
+			re, err := v.pattern(p)
+			if err != nil {
+				add("invalid schema pattern %q: %v", p, err)
+			} else if !re.MatchString(val) {
+				add("value %q does not match pattern %q", val, p)
+			}
+		}
+		if f, ok := s["format"].(string); ok && f == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, val); err != nil {
+				add("value %q is not an RFC3339 date-time", val)
+			}
+		}
+
+	case json.Number:
+		n, _ := val.Float64()
+		if min, ok := s["minimum"].(float64); ok && n < min {
+			add("value %v is below minimum %v", val, min)
+		}
+		if max, ok := s["maximum"].(float64); ok && n > max {
+			add("value %v is above maximum %v", val, max)
+		}
+
+	case map[string]any:
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				key, _ := r.(string)
+				if _, present := val[key]; !present {
+					*out = append(*out, Violation{Path: at + "." + key, Message: "required field missing"})
+				}
+			}
+		}
+
+		props, _ := s["properties"].(map[string]any)
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := at + "." + key
+			if ps, ok := props[key].(map[string]any); ok {
+				v.check(ps, val[key], child, out)
+				continue
+			}
+			switch extra := s["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					*out = append(*out, Violation{Path: child, Message: "unexpected field"})
+				}
+			case map[string]any:
+				v.check(extra, val[key], child, out)
+			}
+		}
+
+	case []any:
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range val {
+				v.check(items, item, fmt.Sprintf("%s[%d]", at, i), out)
+			}
+		}
+	}
+}
+
+func (v *Validator) pattern(p string) (*regexp.Regexp, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if re, ok := v.patterns[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	v.patterns[p] = re
+	return re, nil
+}
+
+func matchesType(t any, value any) bool {
+	switch tt := t.(type) {
+	case string:
+		return isType(tt, value)
+	case []any:
+		for _, candidate := range tt {
+			if name, ok := candidate.(string); ok && isType(name, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func isType(name string, value any) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	default:
+		return true
+	}
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func describeType(t any) string {
+	if list, ok := t.([]any); ok {
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// equal compares a schema literal with a document value decoded with UseNumber
+func equal(schemaValue, value any) bool {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return false
+		}
+		sf, ok := schemaValue.(float64)
+		return ok && sf == f
+	}
+	return reflect.DeepEqual(schemaValue, value)
+}
+
+func display(value any) any {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return value
+}
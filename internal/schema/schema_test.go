@@ -0,0 +1,187 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validator(t *testing.T) *Validator {
+	t.Helper()
+	v, err := Default()
+	require.NoError(t, err)
+	return v
+}
+
+func paths(violations []Violation) []string {
+	out := make([]string, 0, len(violations))
+	for _, v := range violations {
+		out = append(out, v.Path)
+	}
+	return out
+}
+
+func TestDefaultLoadsAllSchemas(t *testing.T) {
+	v := validator(t)
+	assert.Equal(t, []string{
+		Cancel, Command, Event, Heartbeat, Hello, HelloAck, Log, Receipt, RunState, SnapshotManifest,
+	}, v.Names())
+}
+
+func TestValidateHeartbeat(t *testing.T) {
+	v := validator(t)
+
+	hb := protocol.Heartbeat{
+		Kind:           protocol.MessageKindHeartbeat,
+		Agent:          protocol.AgentRef{AgentType: protocol.AgentTypeBuilder, AgentID: "builder#1"},
+		Seq:            3,
+		Status:         protocol.HeartbeatStatusBusy,
+		PID:            4242,
+		UptimeS:        1.5,
+		LastActivityAt: time.Now().UTC(),
+		TaskID:         "T-0042",
+	}
+	violations, err := v.ValidateValue(Heartbeat, hb)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+
+	hb.Status = "sleeping"
+	hb.Agent.AgentType = "wizard"
+	violations, err = v.ValidateValue(Heartbeat, hb)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"$.status", "$.agent.agent_type"}, paths(violations))
+}
+
+func TestValidateEventViolations(t *testing.T) {
+	v := validator(t)
+
+	raw := `{
+		"kind": "event",
+		"message_id": "evt-1",
+		"correlation_id": "corr-1",
+		"task_id": "T-0001",
+		"from": {"agent_type": "wizard"},
+		"event": "builder.completed",
+		"status": "success",
+		"artifacts": [{"path": "a.go", "sha256": "md5:abc", "size": -1}],
+		"occurred_at": "yesterday",
+		"extra": true
+	}`
+	violations, err := v.Validate(Event, []byte(raw))
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		"$.payload",
+		"$.from.agent_type",
+		"$.artifacts[0].sha256",
+		"$.artifacts[0].size",
+		"$.occurred_at",
+		"$.extra",
+	}, paths(violations))
+}
+
+func TestValidateIntegerType(t *testing.T) {
+	v := validator(t)
+
+	hb := map[string]any{
+		"kind":             "heartbeat",
+		"agent":            map[string]any{"agent_type": "builder"},
+		"seq":              1.5,
+		"status":           "ready",
+		"pid":              1,
+		"uptime_s":         0,
+		"last_activity_at": "2025-10-20T14:08:18Z",
+	}
+	violations, err := v.ValidateValue(Heartbeat, hb)
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	assert.Equal(t, "$.seq", violations[0].Path)
+	assert.Contains(t, violations[0].Message, "expected integer")
+}
+
+func TestValidateErrors(t *testing.T) {
+	v := validator(t)
+
+	_, err := v.Validate("nope", []byte(`{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown schema")
+
+	_, err = v.Validate(Log, []byte(`{not json`))
+	require.Error(t, err)
+}
+
+func TestViolationString(t *testing.T) {
+	violation := Violation{Path: "$.kind", Message: "must equal log"}
+	assert.Equal(t, "$.kind: must equal log", violation.String())
+
+	data, err := json.Marshal(violation)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), `"path":"$.kind"`))
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": ModeWarn, "warn": ModeWarn, "STRICT": ModeStrict, "off": ModeOff} {
+		got, err := ParseMode(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseMode("loud")
+	assert.Error(t, err)
+}
+
+func TestEnforcerModes(t *testing.T) {
+	v := validator(t)
+	bad := []byte(`{"kind":"log","level":"loud","message":"x","timestamp":"2025-10-20T14:08:18Z"}`)
+	good := []byte(`{"kind":"log","level":"info","message":"x","timestamp":"2025-10-20T14:08:18Z"}`)
+
+	var findings []Finding
+	record := func(f Finding) { findings = append(findings, f) }
+
+	warn := NewEnforcer(v, ModeWarn, nil)
+	warn.SetRecorder(record)
+	assert.NoError(t, warn.Check("builder", Log, good))
+	assert.NoError(t, warn.Check("builder", Log, bad))
+	require.Len(t, findings, 1)
+	assert.False(t, findings[0].Rejected)
+	assert.Equal(t, "builder", findings[0].Source)
+	assert.Equal(t, []string{"$.level"}, paths(findings[0].Violations))
+
+	findings = nil
+	strict := NewEnforcer(v, ModeStrict, nil)
+	strict.SetRecorder(record)
+	err := strict.Check("builder", Log, bad)
+	var violationErr *ViolationError
+	require.ErrorAs(t, err, &violationErr)
+	assert.Contains(t, err.Error(), "$.level")
+	require.Len(t, findings, 1)
+	assert.True(t, findings[0].Rejected)
+
+	findings = nil
+	off := NewEnforcer(v, ModeOff, nil)
+	off.SetRecorder(record)
+	assert.NoError(t, off.Check("builder", Log, bad))
+	assert.Empty(t, findings)
+
+	var nilEnforcer *Enforcer
+	assert.NoError(t, nilEnforcer.Check("builder", Log, bad))
+	assert.Equal(t, ModeOff, nilEnforcer.Mode())
+}
+
+func TestEnforcerMalformedDocument(t *testing.T) {
+	strict := NewEnforcer(validator(t), ModeStrict, nil)
+
+	err := strict.Check("builder", Event, []byte(`{not json`))
+	var violationErr *ViolationError
+	require.ErrorAs(t, err, &violationErr)
+	assert.Equal(t, "$", violationErr.Violations[0].Path)
+
+	err = strict.Check("builder", "nope", []byte(`{}`))
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &violationErr))
+}
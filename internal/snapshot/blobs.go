@@ -0,0 +1,140 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+)
+
+// GetBlobDir returns the directory of the content-addressed blob store
+func GetBlobDir(workspaceRoot string) string {
+	return filepath.Join(workspaceRoot, "snapshots", "blobs")
+}
+
+// GetBlobPath returns where the content with the given "sha256:<hex>"
+// checksum is stored, fanned out by the first two hex digits
+func GetBlobPath(workspaceRoot, sha256 string) (string, error) {
+	digest, ok := strings.CutPrefix(sha256, "sha256:")
+	if !ok || len(digest) != 64 {
+		return "", fmt.Errorf("invalid checksum %q", sha256)
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("invalid checksum %q", sha256)
+	}
+	return filepath.Join(GetBlobDir(workspaceRoot), digest[:2], digest[2:]), nil
+}
+
+// HasBlob reports whether the content with the given checksum is stored
+func HasBlob(workspaceRoot, sha256 string) bool {
+	path, err := GetBlobPath(workspaceRoot, sha256)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// StoreBlobs copies the content of every file in the manifest into the blob
+// store. Content already stored is not copied again. A file that no longer
+// matches its checksum is an error; the blobs stored before it are kept.
+func StoreBlobs(workspaceRoot string, manifest *Manifest) (int, error) {
+	stored := 0
+	for _, file := range manifest.Files {
+		if HasBlob(workspaceRoot, file.SHA256) {
+			continue
+		}
+		dst, err := GetBlobPath(workspaceRoot, file.SHA256)
+		if err != nil {
+			return stored, fmt.Errorf("failed to store %s: %w", file.Path, err)
+		}
+		src := filepath.Join(workspaceRoot, filepath.FromSlash(file.Path))
+		if err := copyVerified(src, dst, file.SHA256, 0600, 0700); err != nil {
+			return stored, fmt.Errorf("failed to store %s: %w", file.Path, err)
+		}
+		stored++
+	}
+	return stored, nil
+}
+
+// ReadBlob returns the stored content with the given checksum, verifying it
+func ReadBlob(workspaceRoot, sha256 string) ([]byte, error) {
+	path, err := GetBlobPath(workspaceRoot, sha256)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if got := checksum.SHA256Bytes(data); got != sha256 {
+		return nil, fmt.Errorf("blob %s is corrupt (content hashes to %s)", sha256, got)
+	}
+	return data, nil
+}
+
+// copyVerified copies src to dst through a temporary file in dst's
+// directory, renaming it into place only if the content has the expected
+// checksum
+func copyVerified(src, dst, want string, perm, dirPerm os.FileMode) error {
+	tmpPath, err := stageVerified(src, dst, want, perm, dirPerm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// stageVerified copies src to a temporary file next to dst and returns its
+// path, creating dst's missing parent directories with dirPerm: 0700 in the
+// blob store, 0755 in the workspace. Nothing is left behind when the content
+// does not have the expected checksum.
+func stageVerified(src, dst, want string, perm, dirPerm os.FileMode) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), dirPerm); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp.*")
+	if err != nil {
+		return "", err
+	}
+	success := false
+	defer func() {
+		tmp.Close()
+		if !success {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), in); err != nil {
+		return "", err
+	}
+	if got := "sha256:" + hex.EncodeToString(hash.Sum(nil)); got != want {
+		return "", fmt.Errorf("content hashes to %s, expected %s", got, want)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	success = true
+	return tmp.Name(), nil
+}
@@ -0,0 +1,47 @@
+package snapshot
+
+import "sort"
+
+// Change kinds between two manifests
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// FileChange is a file that differs between two manifests. From is nil for
+// added files and To for removed ones.
+type FileChange struct {
+	Path   string    `json:"path"`
+	Change string    `json:"change"`
+	From   *FileInfo `json:"from,omitempty"`
+	To     *FileInfo `json:"to,omitempty"`
+}
+
+// Diff lists the files added, removed or modified going from one manifest
+// to another, sorted by path. Files are compared by checksum.
+func Diff(from, to *Manifest) []FileChange {
+	before := make(map[string]*FileInfo, len(from.Files))
+	for i := range from.Files {
+		before[from.Files[i].Path] = &from.Files[i]
+	}
+
+	var changes []FileChange
+	for i := range to.Files {
+		after := &to.Files[i]
+		old, ok := before[after.Path]
+		delete(before, after.Path)
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: after.Path, Change: ChangeAdded, To: after})
+		case old.SHA256 != after.SHA256:
+			changes = append(changes, FileChange{Path: after.Path, Change: ChangeModified, From: old, To: after})
+		}
+	}
+	for path, old := range before {
+		changes = append(changes, FileChange{Path: path, Change: ChangeRemoved, From: old})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
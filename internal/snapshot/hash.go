@@ -0,0 +1,80 @@
+package snapshot
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/checksum"
+)
+
+// hashWorkers bounds how many files are hashed at once
+var hashWorkers = min(runtime.GOMAXPROCS(0), 8)
+
+// hashFiles checksums the candidates on a bounded pool of workers, taking
+// unchanged files from the cache, and returns them in candidate order
+func hashFiles(candidates []candidate, cache *StatCache, started time.Time) ([]FileInfo, error) {
+	files := make([]FileInfo, len(candidates))
+	if cache != nil {
+		cache.begin()
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	next := make(chan int)
+	workers := min(hashWorkers, len(candidates))
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				c := candidates[i]
+				sum, err := hashFile(c, cache, started)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					continue
+				}
+				files[i] = FileInfo{
+					Path:   c.rel,
+					SHA256: sum,
+					Size:   c.info.Size(),
+					Mtime:  c.info.ModTime().UTC(),
+				}
+			}
+		}()
+	}
+	for i := range candidates {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return files, nil
+}
+
+func hashFile(c candidate, cache *StatCache, started time.Time) (string, error) {
+	if cache != nil {
+		if sum, ok := cache.lookup(c.rel, c.info); ok {
+			return sum, nil
+		}
+	}
+	sum, err := checksum.SHA256File(c.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute checksum for %s: %w", c.rel, err)
+	}
+	if cache != nil {
+		cache.store(c.rel, c.info, sum, started)
+	}
+	return sum, nil
+}
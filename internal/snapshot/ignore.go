@@ -0,0 +1,161 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// pattern is one gitignore-style exclude rule
+type pattern struct {
+	// base is the directory the rule was declared in ("" for the root)
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored rules match the path relative to base; the others match the
+	// last path element at any depth
+	anchored bool
+}
+
+// parsePattern parses one line of a .gitignore-style file. It returns false
+// for blank lines and comments.
+func parsePattern(base, line string) (pattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+	p := pattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+	p.segments = strings.Split(line, "/")
+	return p, true
+}
+
+// parsePatterns parses the content of an ignore file, returning the rules
+// and the lines they came from
+func parsePatterns(base string, content []byte) ([]pattern, []string) {
+	var patterns []pattern
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if p, ok := parsePattern(base, scanner.Text()); ok {
+			patterns = append(patterns, p)
+			lines = append(lines, strings.TrimRight(scanner.Text(), " \t\r"))
+		}
+	}
+	return patterns, lines
+}
+
+// match reports whether the rule applies to a slash-separated path relative
+// to the workspace root
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	parts := strings.Split(rel, "/")
+	if !p.anchored {
+		parts = parts[len(parts)-1:]
+	}
+	return matchSegments(p.segments, parts)
+}
+
+// excluded applies the rules in order; the last matching rule wins
+func excluded(patterns []pattern, rel string, isDir bool) bool {
+	result := false
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			result = !p.negate
+		}
+	}
+	return result
+}
+
+// matchSegments matches path elements against glob segments, where "**"
+// matches any number of elements
+func matchSegments(segments, parts []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(segments[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(segments[0], parts[0]); !ok {
+			return false
+		}
+		segments, parts = segments[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// included reports whether an include glob matches the path or one of its
+// parent directories
+func included(segments, parts []string) bool {
+	for i := 1; i <= len(parts); i++ {
+		if matchSegments(segments, parts[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayInclude reports whether files below the directory could match an
+// include glob, so directories outside every include are not walked
+func mayInclude(segments, dir []string) bool {
+	for len(dir) > 0 && len(segments) > 0 {
+		if segments[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(segments[0], dir[0]); !ok {
+			return false
+		}
+		segments, dir = segments[1:], dir[1:]
+	}
+	return true
+}
+
+// ValidatePattern reports whether a glob is usable as a snapshot include or
+// exclude rule
+func ValidatePattern(glob string) error {
+	trimmed := strings.Trim(strings.TrimPrefix(glob, "!"), "/")
+	if trimmed == "" {
+		return errEmptyPattern
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == ".." {
+			return errParentPattern
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package snapshot
+
+import "os"
+
+// inode is unavailable here; cache entries then match on size and mtime
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
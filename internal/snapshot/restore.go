@@ -0,0 +1,134 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/iambrandonn/lorch/internal/fsutil"
+)
+
+// RestorePlan is what restoring a snapshot would change in the workspace
+type RestorePlan struct {
+	SnapshotID string
+	// Changes go from the workspace to the snapshot: added files are
+	// recreated, modified files rewritten and removed files deleted
+	Changes []FileChange
+	// Missing lists the files to write whose content is not in the blob
+	// store
+	Missing []string
+}
+
+// Scope returns a scope selecting the files these rules selected. Ignore
+// files are read again from the workspace.
+func (r *Rules) Scope() Scope {
+	if r == nil {
+		return Scope{}
+	}
+	exclude := r.Exclude
+	if len(exclude) >= len(defaultExclude) && slices.Equal(exclude[:len(defaultExclude)], defaultExclude) {
+		exclude = exclude[len(defaultExclude):]
+	}
+	return Scope{Include: r.Include, Exclude: exclude}
+}
+
+// PlanRestore compares the workspace with a snapshot. Only files selected
+// by scope are considered, and when paths are given, only those matching
+// one of them; like include globs, a path matches the file itself or any
+// file below it.
+func PlanRestore(workspaceRoot string, target *Manifest, scope Scope, paths []string) (*RestorePlan, error) {
+	var filters [][]string
+	for _, p := range paths {
+		if err := ValidatePattern(p); err != nil {
+			return nil, fmt.Errorf("invalid restore path %q: %w", p, err)
+		}
+		filters = append(filters, strings.Split(strings.Trim(filepath.ToSlash(p), "/"), "/"))
+	}
+
+	current, err := CaptureScope(workspaceRoot, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &RestorePlan{SnapshotID: target.SnapshotID}
+	for _, change := range Diff(current, target) {
+		if len(filters) > 0 && !matchesAny(filters, change.Path) {
+			continue
+		}
+		plan.Changes = append(plan.Changes, change)
+		if change.To != nil && !HasBlob(workspaceRoot, change.To.SHA256) {
+			plan.Missing = append(plan.Missing, change.Path)
+		}
+	}
+	return plan, nil
+}
+
+// Restore applies a plan. Every file to write is first staged from the blob
+// store next to its destination and verified, so a missing or corrupt blob
+// leaves the workspace untouched. The staged files are then renamed into
+// place and the files the snapshot does not have are deleted.
+func Restore(workspaceRoot string, plan *RestorePlan) error {
+	if len(plan.Missing) > 0 {
+		return fmt.Errorf("snapshot %s: content of %d file(s) is not in the blob store: %s",
+			plan.SnapshotID, len(plan.Missing), strings.Join(plan.Missing, ", "))
+	}
+
+	type staged struct{ tmp, dst string }
+	var writes []staged
+	var removals []string
+	defer func() {
+		for _, w := range writes {
+			os.Remove(w.tmp)
+		}
+	}()
+
+	for _, change := range plan.Changes {
+		dst, err := fsutil.ResolveWorkspacePath(workspaceRoot, filepath.FromSlash(change.Path))
+		if err != nil {
+			return err
+		}
+		if change.To == nil {
+			removals = append(removals, filepath.Join(workspaceRoot, filepath.FromSlash(change.Path)))
+			continue
+		}
+
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(dst); err == nil {
+			perm = info.Mode().Perm()
+		}
+		blob, err := GetBlobPath(workspaceRoot, change.To.SHA256)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", change.Path, err)
+		}
+		tmp, err := stageVerified(blob, dst, change.To.SHA256, perm, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", change.Path, err)
+		}
+		writes = append(writes, staged{tmp: tmp, dst: dst})
+	}
+
+	for len(writes) > 0 {
+		if err := os.Rename(writes[0].tmp, writes[0].dst); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", writes[0].dst, err)
+		}
+		writes = writes[1:]
+	}
+	for _, path := range removals {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func matchesAny(filters [][]string, path string) bool {
+	parts := strings.Split(path, "/")
+	for _, filter := range filters {
+		if included(filter, parts) {
+			return true
+		}
+	}
+	return false
+}
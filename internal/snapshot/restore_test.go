@@ -0,0 +1,195 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from := &Manifest{Files: []FileInfo{
+		{Path: "a.go", SHA256: "sha256:a"},
+		{Path: "b.go", SHA256: "sha256:b"},
+		{Path: "c.go", SHA256: "sha256:c"},
+	}}
+	to := &Manifest{Files: []FileInfo{
+		{Path: "a.go", SHA256: "sha256:a"},
+		{Path: "b.go", SHA256: "sha256:b2"},
+		{Path: "d.go", SHA256: "sha256:d"},
+	}}
+
+	var got []string
+	for _, change := range Diff(from, to) {
+		got = append(got, change.Change+" "+change.Path)
+	}
+	want := []string{"modified b.go", "removed c.go", "added d.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+}
+
+func TestStoreBlobs(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTestWorkspace(t, tmpDir)
+	writeFiles(t, tmpDir, map[string]string{"docs/copy.md": "# Documentation\n"})
+
+	snap, err := CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() error = %v", err)
+	}
+	stored, err := StoreBlobs(tmpDir, snap)
+	if err != nil {
+		t.Fatalf("StoreBlobs() error = %v", err)
+	}
+	if stored != len(snap.Files)-1 {
+		t.Errorf("stored %d blobs for %d files, want identical content stored once", stored, len(snap.Files))
+	}
+	if stored, _ := StoreBlobs(tmpDir, snap); stored != 0 {
+		t.Errorf("second StoreBlobs() stored %d blobs, want 0", stored)
+	}
+
+	for _, file := range snap.Files {
+		content, err := ReadBlob(tmpDir, file.SHA256)
+		if err != nil {
+			t.Fatalf("ReadBlob(%s) error = %v", file.Path, err)
+		}
+		if want, _ := os.ReadFile(filepath.Join(tmpDir, file.Path)); string(content) != string(want) {
+			t.Errorf("blob of %s = %q, want %q", file.Path, content, want)
+		}
+	}
+
+	// Blobs are verified on read
+	path, _ := GetBlobPath(tmpDir, snap.Files[0].SHA256)
+	if err := os.WriteFile(path, []byte("tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBlob(tmpDir, snap.Files[0].SHA256); err == nil {
+		t.Error("ReadBlob() accepted a corrupt blob")
+	}
+	if _, err := GetBlobPath(tmpDir, "sha256:../../etc/passwd"); err == nil {
+		t.Error("GetBlobPath() accepted an invalid checksum")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTestWorkspace(t, tmpDir)
+	snap, err := CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() error = %v", err)
+	}
+	if _, err := StoreBlobs(tmpDir, snap); err != nil {
+		t.Fatalf("StoreBlobs() error = %v", err)
+	}
+
+	// A builder rewrites one file, deletes another and adds a third
+	writeFiles(t, tmpDir, map[string]string{
+		"src/main.go":   "package broken\n",
+		"src/extra.go":  "package main\n",
+		"docs/notes.md": "notes\n",
+	})
+	if err := os.RemoveAll(filepath.Join(tmpDir, "tests")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only src is restored
+	plan, err := PlanRestore(tmpDir, snap, snap.Rules.Scope(), []string{"src"})
+	if err != nil {
+		t.Fatalf("PlanRestore() error = %v", err)
+	}
+	var got []string
+	for _, change := range plan.Changes {
+		got = append(got, change.Change+" "+change.Path)
+	}
+	if want := []string{"removed src/extra.go", "modified src/main.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("plan = %v, want %v", got, want)
+	}
+	if err := Restore(tmpDir, plan); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	// Then the rest of the workspace
+	plan, err = PlanRestore(tmpDir, snap, snap.Rules.Scope(), nil)
+	if err != nil {
+		t.Fatalf("PlanRestore() error = %v", err)
+	}
+	if len(plan.Changes) != 2 {
+		t.Errorf("plan has %d changes, want 2", len(plan.Changes))
+	}
+	if err := Restore(tmpDir, plan); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	restored, err := CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() error = %v", err)
+	}
+	if restored.SnapshotID != snap.SnapshotID {
+		t.Errorf("restored workspace is %s, want %s", restored.SnapshotID, snap.SnapshotID)
+	}
+	// Recreated directories are as open as the ones they replace
+	if info, err := os.Stat(filepath.Join(tmpDir, "tests")); err != nil {
+		t.Errorf("tests: %v", err)
+	} else if perm := info.Mode().Perm(); perm&0055 != 0055 {
+		t.Errorf("tests was recreated with mode %o, want 0755", perm)
+	}
+	// lorch's own files are left alone
+	if _, err := os.Stat(filepath.Join(tmpDir, "state", "run.json")); err != nil {
+		t.Errorf("state/run.json: %v", err)
+	}
+}
+
+func TestRestoreMissingBlobLeavesWorkspaceUntouched(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTestWorkspace(t, tmpDir)
+	snap, err := CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() error = %v", err)
+	}
+	if _, err := StoreBlobs(tmpDir, snap); err != nil {
+		t.Fatalf("StoreBlobs() error = %v", err)
+	}
+
+	writeFiles(t, tmpDir, map[string]string{
+		"src/main.go":   "package broken\n",
+		"specs/SPEC.md": "# Rewritten\n",
+	})
+	// A corrupt blob is only noticed while staging
+	for _, file := range snap.Files {
+		if file.Path == "src/main.go" {
+			path, _ := GetBlobPath(tmpDir, file.SHA256)
+			if err := os.WriteFile(path, []byte("tampered"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	plan, err := PlanRestore(tmpDir, snap, snap.Rules.Scope(), nil)
+	if err != nil {
+		t.Fatalf("PlanRestore() error = %v", err)
+	}
+	if err := Restore(tmpDir, plan); err == nil {
+		t.Fatal("Restore() succeeded with a corrupt blob")
+	}
+	for path, want := range map[string]string{"src/main.go": "package broken\n", "specs/SPEC.md": "# Rewritten\n"} {
+		if got, _ := os.ReadFile(filepath.Join(tmpDir, path)); string(got) != want {
+			t.Errorf("%s = %q after a failed restore, want it untouched", path, got)
+		}
+	}
+
+	// Without stored content the plan reports what is missing
+	if err := os.RemoveAll(GetBlobDir(tmpDir)); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = PlanRestore(tmpDir, snap, snap.Rules.Scope(), nil)
+	if err != nil {
+		t.Fatalf("PlanRestore() error = %v", err)
+	}
+	if want := []string{"specs/SPEC.md", "src/main.go"}; !reflect.DeepEqual(plan.Missing, want) {
+		t.Errorf("Missing = %v, want %v", plan.Missing, want)
+	}
+	if err := Restore(tmpDir, plan); err == nil {
+		t.Error("Restore() succeeded without stored content")
+	}
+}
@@ -2,6 +2,7 @@ package snapshot
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -27,111 +28,140 @@ type Manifest struct {
 	SnapshotID    string     `json:"snapshot_id"`
 	CreatedAt     time.Time  `json:"created_at"`
 	WorkspaceRoot string     `json:"workspace_root"`
+	Rules         *Rules     `json:"rules,omitempty"`
 	Files         []FileInfo `json:"files"`
 }
 
-// includedDirs are the directories that should be tracked
-var includedDirs = []string{"specs", "src", "tests", "docs"}
+// Rules is the resolved rule set a snapshot was captured with
+type Rules struct {
+	// Include globs select files by path, or by a parent directory
+	Include []string `json:"include"`
+	// Exclude holds gitignore-style patterns: the defaults followed by
+	// those from lorch.json. IgnoreFiles are applied between the two.
+	Exclude     []string     `json:"exclude"`
+	IgnoreFiles []IgnoreFile `json:"ignore_files,omitempty"`
+}
+
+// IgnoreFile records the patterns read from a .gitignore or .lorchignore
+type IgnoreFile struct {
+	Path     string   `json:"path"`
+	Patterns []string `json:"patterns"`
+}
+
+// Scope configures which files a snapshot tracks. The zero value tracks
+// DefaultInclude with the default exclusions and .gitignore files honoured.
+type Scope struct {
+	// Include replaces DefaultInclude when set
+	Include []string
+	// Exclude adds gitignore-style patterns, applied after every other rule
+	Exclude []string
+	// IgnoreGitignore stops .gitignore files from being read; .lorchignore
+	// files are always honoured
+	IgnoreGitignore bool
+}
+
+// DefaultInclude are the directories tracked when no include globs are
+// configured
+var DefaultInclude = []string{"specs", "src", "tests", "docs"}
+
+// defaultExclude are excluded unless a later rule re-includes them
+var defaultExclude = []string{"node_modules/", ".cache/", ".*"}
 
-// excludedDirs are directories that should never be tracked
-var excludedDirs = map[string]bool{
-	".git":        true,
-	"node_modules": true,
-	".cache":      true,
+// reservedRoot are lorch's own files and directories at the workspace
+// root; they are never tracked, whatever the rules say
+var reservedRoot = map[string]bool{
 	"state":       true,
 	"events":      true,
 	"receipts":    true,
 	"logs":        true,
 	"snapshots":   true,
 	"transcripts": true,
+	"lorch.json":  true,
 }
 
-// excludedFiles are specific files that should never be tracked
-var excludedFiles = map[string]bool{
-	"lorch.json": true,
+// ReservedRoots returns lorch's own files and directories at the workspace
+// root, which are never tracked, in sorted order
+func ReservedRoots() []string {
+	names := make([]string, 0, len(reservedRoot))
+	for name := range reservedRoot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-// CaptureSnapshot walks the workspace and creates a snapshot manifest
-func CaptureSnapshot(workspaceRoot string) (*Manifest, error) {
-	var files []FileInfo
-
-	// Scan included directories
-	for _, dir := range includedDirs {
-		dirPath := filepath.Join(workspaceRoot, dir)
-
-		// Skip if directory doesn't exist
-		if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-			continue
-		}
-
-		// Walk directory
-		err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			// Skip directories
-			if info.IsDir() {
-				// Check if this directory should be excluded
-				dirName := filepath.Base(path)
-				if excludedDirs[dirName] {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-
-			// Skip hidden files (starting with .)
-			if strings.HasPrefix(filepath.Base(path), ".") {
-				return nil
-			}
-
-			// Compute relative path
-			relPath, err := filepath.Rel(workspaceRoot, path)
-			if err != nil {
-				return fmt.Errorf("failed to compute relative path: %w", err)
-			}
+// Names of the ignore files read in each walked directory, in the order
+// their rules apply
+const (
+	GitignoreFile   = ".gitignore"
+	LorchignoreFile = ".lorchignore"
+)
 
-			// Normalize path separators for cross-platform consistency
-			relPath = filepath.ToSlash(relPath)
+var (
+	errEmptyPattern  = errors.New("pattern is empty")
+	errParentPattern = errors.New("pattern must not refer to a parent directory")
+)
 
-			// Check if file is excluded
-			if excludedFiles[relPath] {
-				return nil
-			}
+// CaptureSnapshot walks the workspace and creates a snapshot manifest with
+// the default scope
+func CaptureSnapshot(workspaceRoot string) (*Manifest, error) {
+	return CaptureScope(workspaceRoot, Scope{})
+}
 
-			// Compute checksum
-			hash, err := checksum.SHA256File(path)
-			if err != nil {
-				return fmt.Errorf("failed to compute checksum for %s: %w", relPath, err)
-			}
+// CaptureScope walks the workspace and creates a snapshot manifest of the
+// files the scope selects
+func CaptureScope(workspaceRoot string, scope Scope) (*Manifest, error) {
+	return CaptureCached(workspaceRoot, scope, nil)
+}
 
-			// Add to file list
-			files = append(files, FileInfo{
-				Path:   relPath,
-				SHA256: hash,
-				Size:   info.Size(),
-				Mtime:  info.ModTime().UTC(),
-			})
+// CaptureCached is CaptureScope reusing the checksums in cache for files
+// whose size, mtime and inode are unchanged. The cache is updated with the
+// files hashed; saving it is up to the caller. A nil cache hashes every
+// file.
+func CaptureCached(workspaceRoot string, scope Scope, cache *StatCache) (*Manifest, error) {
+	started := time.Now()
+	include := scope.Include
+	if len(include) == 0 {
+		include = DefaultInclude
+	}
+	for _, glob := range append(append([]string{}, include...), scope.Exclude...) {
+		if err := ValidatePattern(glob); err != nil {
+			return nil, fmt.Errorf("invalid snapshot pattern %q: %w", glob, err)
+		}
+	}
 
-			return nil
-		})
+	w := &walker{
+		root:       workspaceRoot,
+		scope:      scope,
+		rules:      &Rules{Include: include, Exclude: append(append([]string{}, defaultExclude...), scope.Exclude...)},
+		configured: compile("", scope.Exclude),
+		patterns:   compile("", defaultExclude),
+	}
+	for _, glob := range include {
+		w.include = append(w.include, strings.Split(strings.Trim(glob, "/"), "/"))
+	}
 
-		if err != nil {
-			return nil, fmt.Errorf("failed to walk directory %s: %w", dir, err)
-		}
+	if err := w.walk("", w.patterns); err != nil {
+		return nil, err
 	}
 
 	// Sort files by path for deterministic snapshot IDs
 	// This ensures consistent hashing regardless of filesystem iteration order
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Path < files[j].Path
+	sort.Slice(w.candidates, func(i, j int) bool {
+		return w.candidates[i].rel < w.candidates[j].rel
 	})
 
+	files, err := hashFiles(w.candidates, cache, started)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create manifest (without snapshot_id yet)
 	manifest := &Manifest{
 		SnapshotID:    "", // Will be computed below
 		CreatedAt:     time.Now().UTC(),
 		WorkspaceRoot: "./",
+		Rules:         w.rules,
 		Files:         files,
 	}
 
@@ -146,18 +176,165 @@ func CaptureSnapshot(workspaceRoot string) (*Manifest, error) {
 	return manifest, nil
 }
 
+// walker collects the files a scope selects
+type walker struct {
+	root    string
+	scope   Scope
+	rules   *Rules
+	include [][]string
+	// patterns are the default exclusions; configured are the lorch.json
+	// exclusions, applied after the ignore files
+	patterns   []pattern
+	configured []pattern
+	candidates []candidate
+}
+
+// candidate is a file selected for the snapshot, not yet hashed
+type candidate struct {
+	rel  string
+	path string
+	info os.FileInfo
+}
+
+// walk visits a directory (slash-separated, relative to the root) with the
+// ignore rules in effect above it
+func (w *walker) walk(dir string, inherited []pattern) error {
+	dirPath := filepath.Join(w.root, filepath.FromSlash(dir))
+	patterns, err := w.readIgnoreFiles(dir, dirPath, inherited)
+	if err != nil {
+		return err
+	}
+	rules := append(append([]pattern{}, patterns...), w.configured...)
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %w", dirPath, err)
+	}
+	for _, entry := range entries {
+		rel := entry.Name()
+		if dir != "" {
+			rel = dir + "/" + rel
+		}
+		if (dir == "" && reservedRoot[rel]) || entry.Name() == ".git" {
+			continue
+		}
+
+		// Symlinks to files are tracked with the target's content
+		info, err := os.Stat(filepath.Join(dirPath, entry.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to stat %s: %w", rel, err)
+		}
+		if excluded(rules, rel, info.IsDir()) {
+			continue
+		}
+
+		parts := strings.Split(rel, "/")
+		if info.IsDir() {
+			// Symlinked directories are not followed
+			if entry.Type()&os.ModeSymlink != 0 || !w.mayInclude(parts) {
+				continue
+			}
+			if err := w.walk(rel, patterns); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() || !w.included(parts) {
+			continue
+		}
+
+		w.candidates = append(w.candidates, candidate{
+			rel:  rel,
+			path: filepath.Join(dirPath, entry.Name()),
+			info: info,
+		})
+	}
+	return nil
+}
+
+// readIgnoreFiles adds the rules of the directory's .gitignore and
+// .lorchignore, which apply to everything below it, and records them
+func (w *walker) readIgnoreFiles(dir, dirPath string, inherited []pattern) ([]pattern, error) {
+	patterns := inherited
+	for _, name := range []string{GitignoreFile, LorchignoreFile} {
+		if name == GitignoreFile && w.scope.IgnoreGitignore {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dirPath, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		parsed, lines := parsePatterns(dir, content)
+		if len(parsed) == 0 {
+			continue
+		}
+		patterns = append(append([]pattern{}, patterns...), parsed...)
+
+		path := name
+		if dir != "" {
+			path = dir + "/" + name
+		}
+		w.rules.IgnoreFiles = append(w.rules.IgnoreFiles, IgnoreFile{Path: path, Patterns: lines})
+	}
+	return patterns, nil
+}
+
+func (w *walker) included(parts []string) bool {
+	for _, segments := range w.include {
+		if included(segments, parts) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *walker) mayInclude(dir []string) bool {
+	for _, segments := range w.include {
+		if mayInclude(segments, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile parses patterns declared in dir
+func compile(dir string, globs []string) []pattern {
+	var patterns []pattern
+	for _, glob := range globs {
+		if p, ok := parsePattern(dir, glob); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
 // computeSnapshotID generates the snapshot ID from the manifest content
-// Format: "snap-" + first 12 hex chars of SHA256(canonical_json(manifest))
+// Format: "snap-" + first 12 hex chars of SHA256(canonical_json(content))
+// The content is the rule set and each file's path, checksum and size;
+// capture time and mtimes are left out so that capturing an unchanged
+// workspace with the same rules yields the same ID.
 func computeSnapshotID(manifest *Manifest) (string, error) {
-	// Temporarily clear snapshot_id for hashing
-	originalID := manifest.SnapshotID
-	manifest.SnapshotID = ""
-	defer func() {
-		manifest.SnapshotID = originalID
-	}()
-
-	// Serialize manifest canonically
-	manifestJSON, err := idempotency.CanonicalJSON(manifest)
+	type fileContent struct {
+		Path   string `json:"path"`
+		SHA256 string `json:"sha256"`
+		Size   int64  `json:"size"`
+	}
+	content := struct {
+		Rules *Rules        `json:"rules,omitempty"`
+		Files []fileContent `json:"files"`
+	}{Rules: manifest.Rules, Files: make([]fileContent, len(manifest.Files))}
+	for i, f := range manifest.Files {
+		content.Files[i] = fileContent{Path: f.Path, SHA256: f.SHA256, Size: f.Size}
+	}
+
+	// Serialize content canonically
+	manifestJSON, err := idempotency.CanonicalJSON(content)
 	if err != nil {
 		return "", fmt.Errorf("failed to canonicalize manifest: %w", err)
 	}
@@ -3,6 +3,7 @@ package snapshot
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -194,6 +195,131 @@ func TestEmptyWorkspace(t *testing.T) {
 	}
 }
 
+func TestSnapshotIDReproducible(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTestWorkspace(t, tmpDir)
+
+	snap1, err := CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() error = %v", err)
+	}
+
+	// Touching a file changes its mtime but not its content
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(tmpDir, "src", "main.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	snap2, err := CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() second error = %v", err)
+	}
+	if snap1.SnapshotID != snap2.SnapshotID {
+		t.Errorf("SnapshotID changed without a content change: %s != %s", snap1.SnapshotID, snap2.SnapshotID)
+	}
+
+	// The same files under different rules are a different snapshot
+	snap3, err := CaptureScope(tmpDir, Scope{Exclude: []string{"*.tmp"}})
+	if err != nil {
+		t.Fatalf("CaptureScope() error = %v", err)
+	}
+	if len(snap3.Files) != len(snap1.Files) || snap3.SnapshotID == snap1.SnapshotID {
+		t.Errorf("expected the same files under a new ID, got %d files with ID %s", len(snap3.Files), snap3.SnapshotID)
+	}
+}
+
+func TestCaptureScope(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"go.mod":                    "module example\n",
+		"cmd/tool/main.go":          "package main\n",
+		"cmd/tool/debug.log":        "log\n",
+		"internal/core/core.go":     "package core\n",
+		"internal/core/core.pb.go":  "package core\n",
+		"internal/core/keep.pb.go":  "package core\n",
+		"internal/gen/gen.go":       "package gen\n",
+		"internal/gen/.gitignore":   "*.go\n!gen.go\n",
+		"internal/gen/other.go":     "package gen\n",
+		"internal/logs/logs.go":     "package logs\n",
+		"internal/vendor/dep.go":    "package dep\n",
+		".gitignore":                "# build output\n*.log\n",
+		".lorchignore":              "internal/vendor/\n",
+		"logs/builder.ndjson":       "{}\n",
+		"node_modules/pkg/index.js": "\n",
+		"internal/.github/ci.yml":   "on: push\n",
+	})
+
+	scope := Scope{
+		Include: []string{"cmd/**", "internal", "go.mod"},
+		Exclude: []string{"*.pb.go", "!keep.pb.go"},
+	}
+	snap, err := CaptureScope(tmpDir, scope)
+	if err != nil {
+		t.Fatalf("CaptureScope() error = %v", err)
+	}
+
+	want := []string{
+		"cmd/tool/main.go",
+		"go.mod",
+		"internal/core/core.go",
+		"internal/core/keep.pb.go",
+		"internal/gen/gen.go",
+		"internal/logs/logs.go",
+	}
+	var got []string
+	for _, f := range snap.Files {
+		got = append(got, f.Path)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+
+	if snap.Rules == nil {
+		t.Fatal("manifest does not record its rules")
+	}
+	if strings.Join(snap.Rules.Include, ",") != "cmd/**,internal,go.mod" {
+		t.Errorf("rules.include = %v", snap.Rules.Include)
+	}
+	if last := snap.Rules.Exclude[len(snap.Rules.Exclude)-1]; last != "!keep.pb.go" {
+		t.Errorf("configured excludes should come last, got %v", snap.Rules.Exclude)
+	}
+	var ignoreFiles []string
+	for _, f := range snap.Rules.IgnoreFiles {
+		ignoreFiles = append(ignoreFiles, f.Path+"="+strings.Join(f.Patterns, "|"))
+	}
+	wantIgnore := ".gitignore=*.log,.lorchignore=internal/vendor/,internal/gen/.gitignore=*.go|!gen.go"
+	if strings.Join(ignoreFiles, ",") != wantIgnore {
+		t.Errorf("rules.ignore_files = %v, want %s", ignoreFiles, wantIgnore)
+	}
+
+	// Without .gitignore files the log and generated files are tracked
+	scope.IgnoreGitignore = true
+	snap2, err := CaptureScope(tmpDir, scope)
+	if err != nil {
+		t.Fatalf("CaptureScope() error = %v", err)
+	}
+	if len(snap2.Files) != len(want)+2 {
+		t.Errorf("expected %d files without .gitignore, got %d", len(want)+2, len(snap2.Files))
+	}
+
+	if _, err := CaptureScope(tmpDir, Scope{Include: []string{"../outside"}}); err == nil {
+		t.Error("expected an error for a pattern outside the workspace")
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", path, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write file %s: %v", path, err)
+		}
+	}
+}
+
 // Helper to create test workspace
 func createTestWorkspace(t *testing.T, root string) {
 	t.Helper()
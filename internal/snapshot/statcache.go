@@ -0,0 +1,113 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/fsutil"
+)
+
+// racyWindow is how old a file's mtime must be, relative to the start of a
+// capture, for its checksum to be cached. A file written again within the
+// same mtime tick would otherwise keep a stale entry.
+const racyWindow = 2 * time.Second
+
+// StatCache remembers the checksums of files whose size, mtime and inode
+// have not changed since they were last hashed, so captures only hash what
+// changed. It is safe for concurrent use.
+type StatCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]statEntry
+	// seen holds the entries used or added by the latest capture; only
+	// those are saved, which drops files that no longer exist
+	seen map[string]statEntry
+}
+
+type statEntry struct {
+	Size   int64  `json:"size"`
+	Mtime  int64  `json:"mtime_ns"`
+	Inode  uint64 `json:"inode,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+type statCacheFile struct {
+	Version int                  `json:"version"`
+	Entries map[string]statEntry `json:"entries"`
+}
+
+const statCacheVersion = 1
+
+// GetStatCachePath returns the standard path for the stat cache
+func GetStatCachePath(workspaceRoot string) string {
+	return filepath.Join(workspaceRoot, "state", "snapshot-cache.json")
+}
+
+// LoadStatCache reads the stat cache at path. A missing, unreadable or
+// outdated cache yields an empty one: the cache only saves work.
+func LoadStatCache(path string) *StatCache {
+	cache := &StatCache{path: path, entries: map[string]statEntry{}, seen: map[string]statEntry{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var file statCacheFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != statCacheVersion {
+		return cache
+	}
+	if file.Entries != nil {
+		cache.entries = file.Entries
+	}
+	return cache
+}
+
+// Save writes the entries of the latest capture atomically
+func (c *StatCache) Save() error {
+	c.mu.Lock()
+	file := statCacheFile{Version: statCacheVersion, Entries: c.seen}
+	c.mu.Unlock()
+	if err := fsutil.AtomicWriteJSON(c.path, file); err != nil {
+		return fmt.Errorf("failed to save stat cache: %w", err)
+	}
+	return nil
+}
+
+// begin starts a capture
+func (c *StatCache) begin() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen = make(map[string]statEntry, len(c.entries))
+}
+
+// lookup returns the cached checksum of a file that has not changed
+func (c *StatCache) lookup(rel string, info os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[rel]
+	if !ok || entry != newStatEntry(info, entry.SHA256) {
+		return "", false
+	}
+	c.seen[rel] = entry
+	return entry.SHA256, true
+}
+
+// store records a file's checksum, unless it was modified too recently
+// before the capture started to be trusted later
+func (c *StatCache) store(rel string, info os.FileInfo, sum string, started time.Time) {
+	if !info.ModTime().Before(started.Add(-racyWindow)) {
+		return
+	}
+	entry := newStatEntry(info, sum)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[rel] = entry
+	c.seen[rel] = entry
+}
+
+func newStatEntry(info os.FileInfo, sum string) statEntry {
+	return statEntry{Size: info.Size(), Mtime: info.ModTime().UnixNano(), Inode: inode(info), SHA256: sum}
+}
@@ -0,0 +1,156 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ageFiles moves every file's mtime back so captures may cache it
+func ageFiles(t testing.TB, root string) {
+	t.Helper()
+	old := time.Now().Add(-time.Hour)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCaptureCachedMatchesColdCapture(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTestWorkspace(t, tmpDir)
+	ageFiles(t, tmpDir)
+	cachePath := GetStatCachePath(tmpDir)
+
+	cold, err := CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() error = %v", err)
+	}
+
+	cache := LoadStatCache(cachePath)
+	first, err := CaptureCached(tmpDir, Scope{}, cache)
+	if err != nil {
+		t.Fatalf("CaptureCached() error = %v", err)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	cache = LoadStatCache(cachePath)
+	if len(cache.entries) != len(cold.Files) {
+		t.Fatalf("cache has %d entries, want %d", len(cache.entries), len(cold.Files))
+	}
+	warm, err := CaptureCached(tmpDir, Scope{}, cache)
+	if err != nil {
+		t.Fatalf("CaptureCached() warm error = %v", err)
+	}
+	if first.SnapshotID != cold.SnapshotID || warm.SnapshotID != cold.SnapshotID {
+		t.Errorf("snapshot IDs differ: cold %s, first %s, warm %s", cold.SnapshotID, first.SnapshotID, warm.SnapshotID)
+	}
+
+	// A changed file is hashed again and a removed one leaves the cache
+	if err := os.WriteFile(filepath.Join(tmpDir, "src", "main.go"), []byte("package main\n\n// changed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ageFiles(t, tmpDir)
+	if err := os.Remove(filepath.Join(tmpDir, "docs", "README.md")); err != nil {
+		t.Fatal(err)
+	}
+	cold, err = CaptureSnapshot(tmpDir)
+	if err != nil {
+		t.Fatalf("CaptureSnapshot() error = %v", err)
+	}
+	warm, err = CaptureCached(tmpDir, Scope{}, cache)
+	if err != nil {
+		t.Fatalf("CaptureCached() error = %v", err)
+	}
+	if warm.SnapshotID != cold.SnapshotID {
+		t.Errorf("cached capture %s differs from cold capture %s after a change", warm.SnapshotID, cold.SnapshotID)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, ok := LoadStatCache(cachePath).entries["docs/README.md"]; ok {
+		t.Error("removed file is still cached")
+	}
+}
+
+func TestStatCacheSkipsRecentFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTestWorkspace(t, tmpDir)
+
+	cache := LoadStatCache(GetStatCachePath(tmpDir))
+	if _, err := CaptureCached(tmpDir, Scope{}, cache); err != nil {
+		t.Fatalf("CaptureCached() error = %v", err)
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("files written just now must not be cached, got %d entries", len(cache.entries))
+	}
+}
+
+func TestLoadStatCacheIgnoresBadFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot-cache.json")
+	for _, content := range []string{"not json", `{"version":99,"entries":{"a":{"sha256":"x"}}}`} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if cache := LoadStatCache(path); len(cache.entries) != 0 {
+			t.Errorf("expected an empty cache for %q", content)
+		}
+	}
+}
+
+// benchmarkWorkspace writes files files of size bytes each
+func benchmarkWorkspace(b *testing.B, files, size int) string {
+	b.Helper()
+	root := b.TempDir()
+	content := bytes.Repeat([]byte("x"), size)
+	for i := range files {
+		path := filepath.Join(root, "src", fmt.Sprintf("pkg%02d", i%20), fmt.Sprintf("file%04d.go", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			b.Fatal(err)
+		}
+	}
+	ageFiles(b, root)
+	return root
+}
+
+func benchmarkCapture(b *testing.B, workers int, cached bool) {
+	root := benchmarkWorkspace(b, 2000, 64<<10)
+	defer func(n int) { hashWorkers = n }(hashWorkers)
+	hashWorkers = workers
+
+	var cache *StatCache
+	if cached {
+		cache = LoadStatCache(GetStatCachePath(root))
+		if _, err := CaptureCached(root, Scope{}, cache); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := CaptureCached(root, Scope{}, cache); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Cold captures hash every file; compare with the cached and sequential
+// variants to see the speedup:
+//
+//	go test ./internal/snapshot -run '^$' -bench Capture
+func BenchmarkCaptureSequential(b *testing.B) { benchmarkCapture(b, 1, false) }
+func BenchmarkCaptureParallel(b *testing.B)   { benchmarkCapture(b, 8, false) }
+func BenchmarkCaptureCached(b *testing.B)     { benchmarkCapture(b, 8, true) }
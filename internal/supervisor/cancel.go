@@ -0,0 +1,250 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// cancelOp is a cancellation in progress. done is closed once outcome is set.
+type cancelOp struct {
+	correlationID string
+	ack           chan *protocol.Event
+	done          chan struct{}
+	outcome       *protocol.CancelOutcome
+}
+
+// SetCancelGracePeriod changes how long Cancel waits for an acknowledgement
+// before sending SIGTERM
+func (s *AgentSupervisor) SetCancelGracePeriod(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d > 0 {
+		s.cancelGrace = d
+	}
+}
+
+// SetTerminateGracePeriod changes how long the agent has to exit after
+// SIGTERM before it is killed
+func (s *AgentSupervisor) SetTerminateGracePeriod(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d > 0 {
+		s.terminateGrace = d
+	}
+}
+
+// Cancel stops the command in flight: the most recently sent one, unless
+// its terminal event has arrived. Agents that negotiated the
+// cancellation capability are sent a cancel message and given the grace
+// period to acknowledge it; otherwise, or if no acknowledgement arrives, the
+// process is sent SIGTERM and then SIGKILL. Concurrent calls share one
+// outcome. It returns nil when no command is in flight.
+func (s *AgentSupervisor) Cancel(reason string) *protocol.CancelOutcome {
+	s.mu.Lock()
+	if op := s.cancelling; op != nil {
+		s.mu.Unlock()
+		<-op.done
+		return op.outcome
+	}
+	cmd := s.inflight
+	if cmd == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	op := &cancelOp{
+		correlationID: cmd.CorrelationID,
+		ack:           make(chan *protocol.Event, 1),
+		done:          make(chan struct{}),
+	}
+	s.cancelling = op
+	negotiation := s.negotiation
+	encoder := s.encoder
+	exited := s.exited
+	grace := s.cancelGrace
+	s.mu.Unlock()
+
+	outcome := &protocol.CancelOutcome{
+		CorrelationID: cmd.CorrelationID,
+		Reason:        reason,
+		RequestedAt:   time.Now().UTC(),
+	}
+	defer func() {
+		outcome.CompletedAt = time.Now().UTC()
+		s.mu.Lock()
+		s.cancelling = nil
+		if s.inflight == cmd {
+			s.inflight = nil
+		}
+		s.mu.Unlock()
+		op.outcome = outcome
+		close(op.done)
+	}()
+
+	if negotiation != nil && negotiation.Capabilities.Cancellation && encoder != nil {
+		msg := protocol.Cancel{
+			Kind:          protocol.MessageKindCancel,
+			MessageID:     uuid.New().String(),
+			CorrelationID: cmd.CorrelationID,
+			TaskID:        cmd.TaskID,
+			Reason:        reason,
+			IssuedAt:      outcome.RequestedAt,
+		}
+		s.logger.Info("cancelling agent command",
+			"type", s.agentType,
+			"correlation_id", cmd.CorrelationID,
+			"reason", reason)
+
+		s.encMu.Lock()
+		err := encoder.Encode(msg)
+		s.encMu.Unlock()
+		if err != nil {
+			s.logger.Warn("failed to send cancel", "type", s.agentType, "error", err)
+		} else {
+			timer := time.NewTimer(grace)
+			defer timer.Stop()
+			select {
+			case ack := <-op.ack:
+				outcome.Acknowledged = true
+				outcome.AckStatus = ack.Status
+				outcome.AckMessageID = ack.MessageID
+				return outcome
+			case <-exited:
+				return outcome
+			case <-timer.C:
+				s.logger.Warn("agent did not acknowledge cancel within grace period",
+					"type", s.agentType,
+					"correlation_id", cmd.CorrelationID,
+					"grace", grace)
+			}
+		}
+	}
+
+	outcome.Escalation = s.terminate()
+	return outcome
+}
+
+// settle clears the command in flight once an event ends it, so a later
+// Cancel has nothing left to stop
+func (s *AgentSupervisor) settle(evt *protocol.Event) {
+	if !isTerminal(evt) {
+		return
+	}
+	s.mu.Lock()
+	if cmd := s.inflight; cmd != nil && cmd.CorrelationID == evt.CorrelationID {
+		s.inflight = nil
+	}
+	s.mu.Unlock()
+}
+
+// isTerminal reports whether an event ends the command it answers
+func isTerminal(evt *protocol.Event) bool {
+	switch evt.Event {
+	case protocol.EventBuilderCompleted,
+		protocol.EventReviewCompleted,
+		protocol.EventSpecUpdated,
+		protocol.EventSpecNoChangesNeeded,
+		protocol.EventSpecChangesRequested,
+		protocol.EventOrchestrationProposedTasks,
+		protocol.EventOrchestrationNeedsClarification,
+		protocol.EventOrchestrationPlanConflict,
+		protocol.EventError:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliverCancelAck hands an acknowledgement to the cancel waiting for it. It
+// reports false for acknowledgements nobody is waiting for.
+func (s *AgentSupervisor) deliverCancelAck(evt *protocol.Event) bool {
+	s.mu.Lock()
+	op := s.cancelling
+	s.mu.Unlock()
+
+	if op == nil || op.correlationID != evt.CorrelationID {
+		return false
+	}
+	select {
+	case op.ack <- evt:
+	default:
+	}
+	return true
+}
+
+// terminate sends SIGTERM, then SIGKILL once the terminate grace period
+// passes. It returns the strongest signal sent, or "" if the process had
+// already exited. An agent lorch did not start is hung up on instead.
+func (s *AgentSupervisor) terminate() string {
+	s.mu.Lock()
+	proc := s.process
+	exited := s.exited
+	grace := s.terminateGrace
+	s.mu.Unlock()
+
+	if exited == nil {
+		return ""
+	}
+	select {
+	case <-exited:
+		return ""
+	default:
+	}
+	if proc == nil || proc.Process == nil {
+		s.logger.Warn("disconnecting agent", "type", s.agentType)
+		s.hangUp()
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			s.logger.Warn("agent connection did not close", "type", s.agentType)
+		}
+		return ""
+	}
+
+	s.logger.Warn("sending SIGTERM to agent", "type", s.agentType, "pid", proc.Process.Pid)
+	if err := signalGroup(proc.Process.Pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return ""
+		}
+		s.logger.Warn("failed to send SIGTERM", "type", s.agentType, "error", err)
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-exited:
+		return protocol.EscalationSIGTERM
+	case <-timer.C:
+	}
+
+	s.logger.Warn("agent ignored SIGTERM, killing", "type", s.agentType, "grace", grace)
+	signalGroup(proc.Process.Pid, syscall.SIGKILL)
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		s.logger.Warn("agent did not exit after kill", "type", s.agentType)
+	}
+	return protocol.EscalationSIGKILL
+}
+
+// watchContext stops the agent when the context Start was called with ends:
+// the in-flight command is cancelled first, then the process is terminated
+func (s *AgentSupervisor) watchContext(ctx context.Context) {
+	s.mu.Lock()
+	exited := s.exited
+	s.mu.Unlock()
+
+	select {
+	case <-exited:
+		return
+	case <-ctx.Done():
+	}
+
+	s.Cancel(context.Cause(ctx).Error())
+	s.terminate()
+}
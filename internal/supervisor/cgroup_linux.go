@@ -0,0 +1,214 @@
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Where cgroup v2 is mounted and where lorch finds its own cgroup; tests
+// point these at a fake tree
+var (
+	cgroupRoot     = "/sys/fs/cgroup"
+	selfCgroupFile = "/proc/self/cgroup"
+)
+
+// cgroupCPUPeriod is the cpu.max period in microseconds
+const cgroupCPUPeriod = 100000
+
+// cgroup is a cgroup v2 directory lorch created for one agent
+type cgroup struct {
+	path string
+}
+
+// newCgroup creates a cgroup named name under lorch's own cgroup and writes
+// limits into it. It fails when the unified hierarchy is not mounted or the
+// needed controllers cannot be delegated to lorch's sub-tree.
+func newCgroup(name string, limits Limits) (*cgroup, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is not mounted at %s", cgroupRoot)
+	}
+	self, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Join(cgroupRoot, self)
+
+	var controllers []string
+	if limits.MemoryBytes > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if limits.CPUPercent > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if limits.MaxProcs > 0 {
+		controllers = append(controllers, "pids")
+	}
+	if err := enableControllers(parent, controllers); err != nil {
+		return nil, err
+	}
+
+	cg := &cgroup{path: filepath.Join(parent, name)}
+	if err := os.Mkdir(cg.path, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+
+	writes := map[string]string{}
+	if limits.MemoryBytes > 0 {
+		writes["memory.max"] = strconv.FormatInt(limits.MemoryBytes, 10)
+		writes["memory.swap.max"] = "0"
+	}
+	if limits.CPUPercent > 0 {
+		quota := cgroupCPUPeriod * limits.CPUPercent / 100
+		writes["cpu.max"] = fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)
+	}
+	if limits.MaxProcs > 0 {
+		writes["pids.max"] = strconv.Itoa(limits.MaxProcs)
+	}
+	for file, value := range writes {
+		err := os.WriteFile(filepath.Join(cg.path, file), []byte(value), 0o644)
+		if err != nil && file != "memory.swap.max" { // swap accounting is optional
+			cg.remove()
+			return nil, fmt.Errorf("failed to set %s: %w", file, err)
+		}
+	}
+	return cg, nil
+}
+
+// ownCgroup returns lorch's cgroup v2 path relative to the mount point
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile(selfCgroupFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read own cgroup: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("lorch is not in a cgroup v2 hierarchy")
+}
+
+// enableControllers turns on controllers for the children of parent
+func enableControllers(parent string, controllers []string) error {
+	available, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("failed to read available controllers: %w", err)
+	}
+	enabled, _ := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+
+	for _, c := range controllers {
+		if !hasField(available, c) {
+			return fmt.Errorf("cgroup controller %q is not delegated to lorch", c)
+		}
+		if hasField(enabled, c) {
+			continue
+		}
+		err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+c), 0o644)
+		if errors.Is(err, syscall.EBUSY) {
+			// A cgroup with member processes cannot hand controllers to its
+			// children; move lorch into a leaf of its own and retry
+			if err = moveSelfToLeaf(parent); err == nil {
+				err = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+c), 0o644)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to enable cgroup controller %q: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// moveSelfToLeaf moves lorch from parent into parent/lorch
+func moveSelfToLeaf(parent string) error {
+	leaf := filepath.Join(parent, "lorch")
+	if err := os.Mkdir(leaf, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644)
+}
+
+func hasField(data []byte, field string) bool {
+	for _, f := range strings.Fields(string(data)) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// add moves pid into the cgroup
+func (cg *cgroup) add(pid int) error {
+	return os.WriteFile(filepath.Join(cg.path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644)
+}
+
+// sample reads the cgroup's CPU time, memory and process count
+func (cg *cgroup) sample() (resourceSample, bool) {
+	sample := resourceSample{source: protocol.ResourceSourceCgroup}
+
+	usec, ok := cg.keyedValue("cpu.stat", "usage_usec")
+	if !ok {
+		return resourceSample{}, false
+	}
+	sample.cpuSeconds = float64(usec) / 1e6
+
+	if current, err := cg.readInt("memory.current"); err == nil {
+		sample.rssBytes = current
+	}
+	if pids, err := cg.readInt("pids.current"); err == nil {
+		sample.procs = int(pids)
+	} else if procs, err := os.ReadFile(filepath.Join(cg.path, "cgroup.procs")); err == nil {
+		sample.procs = len(strings.Fields(string(procs)))
+	}
+	return sample, true
+}
+
+// oomKills returns how many processes the kernel OOM killer stopped in the
+// cgroup
+func (cg *cgroup) oomKills() int64 {
+	n, _ := cg.keyedValue("memory.events", "oom_kill")
+	return n
+}
+
+// kill stops every process left in the cgroup (Linux 5.14+)
+func (cg *cgroup) kill() {
+	os.WriteFile(filepath.Join(cg.path, "cgroup.kill"), []byte("1"), 0o644)
+}
+
+// remove deletes the cgroup; it must be empty
+func (cg *cgroup) remove() error {
+	return os.Remove(cg.path)
+}
+
+func (cg *cgroup) readInt(file string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(cg.path, file))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// keyedValue reads key from a "key value" per line file such as cpu.stat
+func (cg *cgroup) keyedValue(file, key string) (int64, bool) {
+	data, err := os.ReadFile(filepath.Join(cg.path, file))
+	if err != nil {
+		return 0, false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package supervisor
+
+import "errors"
+
+// cgroup is unavailable outside Linux
+type cgroup struct {
+	path string
+}
+
+func newCgroup(name string, limits Limits) (*cgroup, error) {
+	return nil, errors.New("cgroups require Linux")
+}
+
+func (cg *cgroup) add(pid int) error              { return nil }
+func (cg *cgroup) sample() (resourceSample, bool) { return resourceSample{}, false }
+func (cg *cgroup) oomKills() int64                { return 0 }
+func (cg *cgroup) kill()                          {}
+func (cg *cgroup) remove() error                  { return nil }
@@ -0,0 +1,308 @@
+package supervisor
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// DefaultResourceSampleInterval is how often lorch measures an agent's
+// resource use
+const DefaultResourceSampleInterval = time.Second
+
+// Limits caps the resources an agent's process group may use. Zero values
+// mean unlimited.
+//
+// Memory, CPU and process limits are written to a cgroup v2 sub-tree when
+// one can be created. Without cgroups, memory and process limits are
+// enforced by sampling /proc and killing the agent when it goes over, and
+// CPU is not limited. Open files are limited with setrlimit and wall time by
+// lorch itself.
+type Limits struct {
+	MemoryBytes  int64
+	CPUPercent   int // 100 is one core
+	MaxProcs     int
+	MaxOpenFiles int
+	// WallTime is how long the agent process may run in total
+	WallTime time.Duration
+}
+
+// needsCgroup reports whether any limit is best enforced by a cgroup
+func (l Limits) needsCgroup() bool {
+	return l.MemoryBytes > 0 || l.CPUPercent > 0 || l.MaxProcs > 0
+}
+
+// resourceSample is one measurement of an agent's process group
+type resourceSample struct {
+	source     string
+	cpuSeconds float64
+	rssBytes   int64
+	procs      int
+}
+
+// resourceWindow accumulates samples taken while one command runs
+type resourceWindow struct {
+	source     string
+	cpuStart   float64
+	cpuLatest  float64
+	peakRSS    int64
+	peakProcs  int
+	lastSample time.Time
+	sampled    bool
+}
+
+// SetLimits sets the resource limits applied to the agent. Call it before
+// Start.
+func (s *AgentSupervisor) SetLimits(l Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = l
+}
+
+// SetResourceSampleInterval changes how often resource use is measured.
+// Call it before Start.
+func (s *AgentSupervisor) SetResourceSampleInterval(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d > 0 {
+		s.sampleInterval = d
+	}
+}
+
+// LimitKill reports the resource limit the agent was killed for, or nil.
+// Kernel OOM kills are known once Exited is closed.
+func (s *AgentSupervisor) LimitKill() *protocol.LimitKill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limitKill
+}
+
+// CommandResources returns what the agent consumed since the last command
+// was sent, or nil when nothing could be measured on this platform
+func (s *AgentSupervisor) CommandResources() *protocol.ResourceUsage {
+	s.sampleNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.window
+	if !w.sampled {
+		return nil
+	}
+	return &protocol.ResourceUsage{
+		Source:       w.source,
+		CPUSeconds:   max(w.cpuLatest-w.cpuStart, 0),
+		PeakRSSBytes: w.peakRSS,
+		PeakProcs:    w.peakProcs,
+		LimitKill:    s.limitKill,
+	}
+}
+
+// applyLimits puts the just-started agent under its configured limits
+func (s *AgentSupervisor) applyLimits(pid int) {
+	s.mu.Lock()
+	limits := s.limits
+	s.mu.Unlock()
+
+	if err := applyRlimits(pid, limits); err != nil {
+		s.logger.Warn("failed to set agent rlimits", "type", s.agentType, "error", err)
+	}
+	if !limits.needsCgroup() {
+		return
+	}
+
+	cg, err := newCgroup(fmt.Sprintf("lorch-%s-%d", s.agentType, pid), limits)
+	if err == nil {
+		if err = cg.add(pid); err != nil {
+			cg.remove()
+		}
+	}
+	if err != nil {
+		s.logger.Warn("cgroup v2 unavailable, enforcing memory and process limits by sampling",
+			"type", s.agentType, "error", err)
+		if limits.CPUPercent > 0 {
+			s.logger.Warn("CPU limit needs cgroup v2 and will not be enforced", "type", s.agentType)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	s.cgroup = cg
+	s.mu.Unlock()
+	s.logger.Info("agent placed in cgroup", "type", s.agentType, "path", cg.path)
+}
+
+// sample measures the agent, preferring its cgroup over /proc
+func (s *AgentSupervisor) sample() (resourceSample, bool) {
+	s.mu.Lock()
+	cg := s.cgroup
+	pgid := s.procInfo.PGID
+	running := s.running
+	s.mu.Unlock()
+
+	if !running || pgid == 0 {
+		return resourceSample{}, false
+	}
+	if cg != nil {
+		if sample, ok := cg.sample(); ok {
+			return sample, true
+		}
+	}
+	return sampleProcessGroup(pgid)
+}
+
+// sampleNow takes a measurement and folds it into the current window and
+// the stats reported with heartbeats. It returns the sample.
+func (s *AgentSupervisor) sampleNow() (resourceSample, bool) {
+	sample, ok := s.sample()
+	if !ok {
+		return sample, false
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := &s.window
+	stats := &protocol.HeartbeatStats{RSSBytes: sample.rssBytes, Procs: sample.procs}
+	if w.sampled && now.After(w.lastSample) {
+		cpu := (sample.cpuSeconds - w.cpuLatest) / now.Sub(w.lastSample).Seconds() * 100
+		stats.CPUPercent = max(cpu, 0)
+	} else if !w.sampled {
+		w.cpuStart = sample.cpuSeconds
+	}
+	w.source = sample.source
+	w.cpuLatest = sample.cpuSeconds
+	w.peakRSS = max(w.peakRSS, sample.rssBytes)
+	w.peakProcs = max(w.peakProcs, sample.procs)
+	w.lastSample = now
+	w.sampled = true
+	s.stats = stats
+	return sample, true
+}
+
+// resetWindow starts accounting for a new command
+func (s *AgentSupervisor) resetWindow() {
+	s.mu.Lock()
+	w := &s.window
+	if w.sampled {
+		w.cpuStart = w.cpuLatest
+		w.peakRSS = 0
+		w.peakProcs = 0
+	}
+	s.mu.Unlock()
+	s.sampleNow()
+}
+
+// annotateHeartbeat replaces the agent's self-reported stats with lorch's
+// latest measurement of its whole process group
+func (s *AgentSupervisor) annotateHeartbeat(hb *protocol.Heartbeat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats != nil {
+		stats := *s.stats
+		hb.Stats = &stats
+	}
+}
+
+// monitorResources samples the agent until it exits, enforcing the limits
+// that have no kernel mechanism behind them
+func (s *AgentSupervisor) monitorResources(exited <-chan struct{}) {
+	s.mu.Lock()
+	limits := s.limits
+	interval := s.sampleInterval
+	enforceBySampling := s.cgroup == nil
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var wallTime <-chan time.Time
+	if limits.WallTime > 0 {
+		timer := time.NewTimer(limits.WallTime)
+		defer timer.Stop()
+		wallTime = timer.C
+	}
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-wallTime:
+			s.killForLimit(protocol.LimitWallTime, fmt.Sprintf("ran longer than the %s wall time limit", limits.WallTime), false)
+		case <-ticker.C:
+			sample, ok := s.sampleNow()
+			if !ok || !enforceBySampling {
+				continue
+			}
+			if limits.MemoryBytes > 0 && sample.rssBytes > limits.MemoryBytes {
+				s.killForLimit(protocol.LimitMemory, fmt.Sprintf("used %d bytes of memory, over the %d byte limit", sample.rssBytes, limits.MemoryBytes), true)
+			}
+			if limits.MaxProcs > 0 && sample.procs > limits.MaxProcs {
+				s.killForLimit(protocol.LimitMaxProcs, fmt.Sprintf("ran %d processes, over the limit of %d", sample.procs, limits.MaxProcs), true)
+			}
+		}
+	}
+}
+
+// killForLimit records why the agent is being stopped and stops it: at once
+// for runaway memory or processes, gracefully for wall time
+func (s *AgentSupervisor) killForLimit(limit, detail string, immediate bool) {
+	s.mu.Lock()
+	if s.limitKill != nil || s.process == nil || s.process.Process == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.limitKill = &protocol.LimitKill{Limit: limit, Detail: detail, At: time.Now().UTC()}
+	pid := s.process.Process.Pid
+	s.mu.Unlock()
+
+	s.logger.Error("agent exceeded a resource limit, stopping it",
+		"type", s.agentType,
+		"limit", limit,
+		"detail", detail)
+
+	if immediate {
+		signalGroup(pid, syscall.SIGKILL)
+		return
+	}
+	s.terminate()
+}
+
+// noteOOMKill records a kernel OOM kill in the agent's cgroup as a memory
+// limit kill. It runs once the agent has exited.
+func (s *AgentSupervisor) noteOOMKill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cgroup == nil || s.limitKill != nil || s.cgroup.oomKills() == 0 {
+		return
+	}
+	s.limitKill = &protocol.LimitKill{
+		Limit:  protocol.LimitMemory,
+		Detail: fmt.Sprintf("killed by the kernel OOM killer at the %d byte cgroup memory limit", s.limits.MemoryBytes),
+		At:     time.Now().UTC(),
+	}
+	s.logger.Error("agent was killed for exceeding its memory limit", "type", s.agentType, "limit_bytes", s.limits.MemoryBytes)
+}
+
+// releaseResources removes the agent's cgroup once it and its stragglers
+// have exited
+func (s *AgentSupervisor) releaseResources() {
+	s.mu.Lock()
+	cg := s.cgroup
+	s.cgroup = nil
+	s.mu.Unlock()
+
+	if cg == nil {
+		return
+	}
+
+	cg.kill()
+	for attempt := 0; attempt < 10; attempt++ {
+		if err := cg.remove(); err == nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	s.logger.Warn("failed to remove agent cgroup", "type", s.agentType, "path", cg.path)
+}
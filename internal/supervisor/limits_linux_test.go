@@ -0,0 +1,224 @@
+package supervisor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// withoutCgroups makes the supervisor fall back to /proc sampling, so tests
+// behave the same on hosts with and without delegated cgroup v2
+func withoutCgroups(t *testing.T) {
+	t.Helper()
+	old := cgroupRoot
+	cgroupRoot = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { cgroupRoot = old })
+}
+
+func startLimitedAgent(t *testing.T, script string, limits Limits) *AgentSupervisor {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+	sup.SetHandshakeTimeout(50 * time.Millisecond)
+	sup.SetTerminateGracePeriod(200 * time.Millisecond)
+	sup.SetResourceSampleInterval(20 * time.Millisecond)
+	sup.SetLimits(limits)
+
+	if err := sup.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	t.Cleanup(func() { sup.Stop(context.Background()) })
+	return sup
+}
+
+func waitForLimitKill(t *testing.T, sup *AgentSupervisor) *protocol.LimitKill {
+	t.Helper()
+	select {
+	case <-sup.Exited():
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent was not stopped")
+	}
+	kill := sup.LimitKill()
+	if kill == nil {
+		t.Fatal("expected a limit kill to be recorded")
+	}
+	return kill
+}
+
+func TestWallTimeLimitStopsAgent(t *testing.T) {
+	withoutCgroups(t)
+	sup := startLimitedAgent(t, "cat", Limits{WallTime: 200 * time.Millisecond})
+
+	kill := waitForLimitKill(t, sup)
+	if kill.Limit != protocol.LimitWallTime {
+		t.Errorf("expected wall_time kill, got %+v", kill)
+	}
+}
+
+func TestMemoryLimitEnforcedBySampling(t *testing.T) {
+	withoutCgroups(t)
+	// Hold ~64 MiB in a shell variable
+	script := `sleep 0.2; x=$(head -c 67108864 /dev/zero | tr '\0' a); cat`
+	sup := startLimitedAgent(t, script, Limits{MemoryBytes: 16 << 20})
+
+	kill := waitForLimitKill(t, sup)
+	if kill.Limit != protocol.LimitMemory {
+		t.Errorf("expected memory kill, got %+v", kill)
+	}
+}
+
+func TestMaxProcsEnforcedBySampling(t *testing.T) {
+	withoutCgroups(t)
+	script := `sleep 0.2; sleep 30 & sleep 30 & sleep 30 & cat`
+	sup := startLimitedAgent(t, script, Limits{MaxProcs: 2})
+
+	kill := waitForLimitKill(t, sup)
+	if kill.Limit != protocol.LimitMaxProcs {
+		t.Errorf("expected max_procs kill, got %+v", kill)
+	}
+	if !strings.Contains(kill.Detail, "limit of 2") {
+		t.Errorf("detail should name the limit, got %q", kill.Detail)
+	}
+}
+
+func TestOpenFilesLimitAppliedWithRlimit(t *testing.T) {
+	withoutCgroups(t)
+	sup := startLimitedAgent(t, "cat", Limits{MaxOpenFiles: 64})
+
+	info, ok := sup.Process()
+	if !ok {
+		t.Fatal("agent not running")
+	}
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(info.PID), "limits"))
+	if err != nil {
+		t.Skipf("cannot read process limits: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "Max open files") {
+			if fields := strings.Fields(line); fields[3] != "64" || fields[4] != "64" {
+				t.Errorf("expected open files limited to 64, got %q", line)
+			}
+			return
+		}
+	}
+	t.Error("no open files limit found")
+}
+
+func TestResourceUsageSampled(t *testing.T) {
+	withoutCgroups(t)
+	// Report a heartbeat once lorch has had time to sample
+	script := `sleep 0.2
+echo '{"kind":"heartbeat","agent":{"agent_type":"builder"},"seq":1,"status":"ready","pid":1,"uptime_s":0.2,"last_activity_at":"2025-10-20T14:08:18Z"}'
+cat`
+	sup := startLimitedAgent(t, script, Limits{})
+
+	select {
+	case hb := <-sup.Heartbeats():
+		if hb.Stats == nil || hb.Stats.Procs < 1 || hb.Stats.RSSBytes <= 0 {
+			t.Errorf("heartbeat should carry measured stats, got %+v", hb.Stats)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no heartbeat received")
+	}
+
+	if err := sup.SendCommand(cancelTestCommand()); err != nil {
+		t.Fatalf("failed to send command: %v", err)
+	}
+	usage := sup.CommandResources()
+	if usage == nil {
+		t.Fatal("expected resource usage")
+	}
+	if usage.Source != protocol.ResourceSourceProc || usage.PeakProcs < 1 || usage.PeakRSSBytes <= 0 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+	if usage.LimitKill != nil {
+		t.Errorf("no limit was exceeded, got %+v", usage.LimitKill)
+	}
+}
+
+func TestCgroupV2(t *testing.T) {
+	root := t.TempDir()
+	parent := filepath.Join(root, "user.slice", "lorch-test")
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(root, "cgroup.controllers"), "cpu memory pids")
+	writeFile(filepath.Join(parent, "cgroup.controllers"), "cpu memory pids")
+	writeFile(filepath.Join(parent, "cgroup.subtree_control"), "")
+	selfFile := filepath.Join(t.TempDir(), "cgroup")
+	writeFile(selfFile, "0::/user.slice/lorch-test\n")
+
+	oldRoot, oldSelf := cgroupRoot, selfCgroupFile
+	cgroupRoot, selfCgroupFile = root, selfFile
+	t.Cleanup(func() { cgroupRoot, selfCgroupFile = oldRoot, oldSelf })
+
+	cg, err := newCgroup("lorch-builder-42", Limits{MemoryBytes: 1 << 30, CPUPercent: 150, MaxProcs: 64})
+	if err != nil {
+		t.Fatalf("newCgroup failed: %v", err)
+	}
+	if cg.path != filepath.Join(parent, "lorch-builder-42") {
+		t.Errorf("unexpected cgroup path %s", cg.path)
+	}
+
+	for file, want := range map[string]string{
+		"memory.max": "1073741824",
+		"cpu.max":    "150000 100000",
+		"pids.max":   "64",
+	} {
+		got, err := os.ReadFile(filepath.Join(cg.path, file))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q (%v), want %q", file, got, err, want)
+		}
+	}
+
+	writeFile(filepath.Join(cg.path, "cpu.stat"), "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n")
+	writeFile(filepath.Join(cg.path, "memory.current"), "104857600\n")
+	writeFile(filepath.Join(cg.path, "pids.current"), "3\n")
+	writeFile(filepath.Join(cg.path, "memory.events"), "low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n")
+
+	sample, ok := cg.sample()
+	if !ok {
+		t.Fatal("expected a cgroup sample")
+	}
+	if sample.source != protocol.ResourceSourceCgroup || sample.cpuSeconds != 2.5 || sample.rssBytes != 104857600 || sample.procs != 3 {
+		t.Errorf("unexpected sample %+v", sample)
+	}
+	if cg.oomKills() != 1 {
+		t.Errorf("expected one OOM kill, got %d", cg.oomKills())
+	}
+}
+
+func TestCgroupV2UnavailableWithoutDelegation(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	selfFile := filepath.Join(t.TempDir(), "cgroup")
+	if err := os.WriteFile(selfFile, []byte("0::/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldRoot, oldSelf := cgroupRoot, selfCgroupFile
+	cgroupRoot, selfCgroupFile = root, selfFile
+	t.Cleanup(func() { cgroupRoot, selfCgroupFile = oldRoot, oldSelf })
+
+	_, err := newCgroup("lorch-builder-42", Limits{MemoryBytes: 1 << 30})
+	if err == nil || !strings.Contains(err.Error(), `"memory" is not delegated`) {
+		t.Errorf("expected missing memory controller error, got %v", err)
+	}
+}
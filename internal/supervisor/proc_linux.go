@@ -0,0 +1,123 @@
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat. It
+// is 100 on every architecture Linux supports.
+const clockTicks = 100
+
+// procStat holds the fields of /proc/<pid>/stat lorch cares about
+type procStat struct {
+	state      byte
+	pgrp       int
+	startTicks uint64
+	// cpuTicks is user and system time, including that of reaped children
+	cpuTicks uint64
+	rssPages int64
+}
+
+// readProcStat parses /proc/<pid>/stat
+func readProcStat(pid int) (procStat, bool) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, false
+	}
+	// The command name may contain spaces and parentheses; fields resume
+	// after the last ')' starting with field 3 (state)
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return procStat{}, false
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 || len(fields[0]) == 0 {
+		return procStat{}, false
+	}
+	pgrp, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return procStat{}, false
+	}
+	ticks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, false
+	}
+	stat := procStat{state: fields[0][0], pgrp: pgrp, startTicks: ticks}
+	// utime, stime, cutime and cstime are fields 14-17; rss is field 24
+	for _, f := range fields[11:15] {
+		n, _ := strconv.ParseInt(f, 10, 64)
+		if n > 0 {
+			stat.cpuTicks += uint64(n)
+		}
+	}
+	if len(fields) > 21 {
+		stat.rssPages, _ = strconv.ParseInt(fields[21], 10, 64)
+	}
+	return stat, true
+}
+
+// processStartTicks returns when pid started, in clock ticks since boot.
+// Together with the PID it identifies a process even after the PID has been
+// reused.
+func processStartTicks(pid int) (uint64, bool) {
+	stat, ok := readProcStat(pid)
+	return stat.startTicks, ok
+}
+
+// processAlive reports whether pid is running. Zombies do not count: in
+// containers without an init process nobody reaps them.
+func processAlive(pid int) bool {
+	stat, ok := readProcStat(pid)
+	return ok && stat.state != 'Z'
+}
+
+// groupAlive reports whether any non-zombie process belongs to group pgid
+func groupAlive(pgid int) bool {
+	if !sysGroupAlive(pgid) {
+		return false
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return true
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, ok := readProcStat(pid); ok && stat.pgrp == pgid && stat.state != 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleProcessGroup adds up the CPU time, resident memory and process count
+// of every live process in group pgid
+func sampleProcessGroup(pgid int) (resourceSample, bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return resourceSample{}, false
+	}
+	pageSize := int64(os.Getpagesize())
+	sample := resourceSample{source: protocol.ResourceSourceProc}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, ok := readProcStat(pid)
+		if !ok || stat.pgrp != pgid || stat.state == 'Z' {
+			continue
+		}
+		sample.cpuSeconds += float64(stat.cpuTicks) / clockTicks
+		sample.rssBytes += stat.rssPages * pageSize
+		sample.procs++
+	}
+	return sample, sample.procs > 0
+}
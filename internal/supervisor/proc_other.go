@@ -0,0 +1,24 @@
+//go:build !linux
+
+package supervisor
+
+// processStartTicks is unavailable without /proc; callers fall back to
+// matching the process group
+func processStartTicks(pid int) (uint64, bool) {
+	return 0, false
+}
+
+// processAlive reports whether pid exists
+func processAlive(pid int) bool {
+	return sysAlive(pid)
+}
+
+// groupAlive reports whether group pgid has members
+func groupAlive(pgid int) bool {
+	return sysGroupAlive(pgid)
+}
+
+// sampleProcessGroup is unavailable without /proc
+func sampleProcessGroup(pgid int) (resourceSample, bool) {
+	return resourceSample{}, false
+}
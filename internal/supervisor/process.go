@@ -0,0 +1,120 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// ProcessInfo identifies an agent process well enough for a later lorch to
+// find it again after a crash
+type ProcessInfo struct {
+	PID  int
+	PGID int
+	// StartTicks is the kernel's start time for PID (Linux only, 0
+	// elsewhere); it tells a survivor apart from a process that reused the PID
+	StartTicks uint64
+	StartedAt  time.Time
+}
+
+// Process describes the running agent process. ok is false when the agent
+// is not running.
+func (s *AgentSupervisor) Process() (info ProcessInfo, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running || s.process == nil || s.process.Process == nil {
+		return ProcessInfo{}, false
+	}
+	return s.procInfo, true
+}
+
+// Survives reports whether anything from the process group described by info
+// is still running. A leader PID that now belongs to another process does
+// not count.
+func Survives(info ProcessInfo) bool {
+	if info.PID <= 0 {
+		return false
+	}
+	if processAlive(info.PID) {
+		return sameProcess(info)
+	}
+	// The leader is gone but children it spawned may still hold the group
+	return groupAlive(info.PGID)
+}
+
+// sameProcess reports whether the live info.PID is the process info was
+// recorded for
+func sameProcess(info ProcessInfo) bool {
+	if ticks, ok := processStartTicks(info.PID); ok && info.StartTicks != 0 {
+		return ticks == info.StartTicks
+	}
+	pgid, err := processGroup(info.PID)
+	return err == nil && pgid == info.PGID
+}
+
+// ReapOrphan terminates a surviving agent process group left behind by an
+// earlier lorch: SIGTERM to the group, then SIGKILL once grace has passed. It
+// returns the escalation that was needed, or "" when nothing was running.
+func ReapOrphan(ctx context.Context, info ProcessInfo, grace time.Duration, logger *slog.Logger) string {
+	if !Survives(info) {
+		return ""
+	}
+
+	logger.Warn("terminating orphaned agent process group", "pid", info.PID, "pgid", info.PGID)
+	if err := signalGroup(info.PGID, syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return ""
+		}
+		logger.Warn("failed to send SIGTERM to orphan", "pgid", info.PGID, "error", err)
+	}
+	if waitForGroupExit(ctx, info, grace) {
+		return protocol.EscalationSIGTERM
+	}
+
+	logger.Warn("orphan ignored SIGTERM, killing", "pgid", info.PGID, "grace", grace)
+	signalGroup(info.PGID, syscall.SIGKILL)
+	if !waitForGroupExit(ctx, info, 5*time.Second) {
+		logger.Warn("orphan did not exit after kill", "pgid", info.PGID)
+	}
+	return protocol.EscalationSIGKILL
+}
+
+// waitForGroupExit polls until nothing from info's group survives or timeout
+// passes, reporting whether the group is gone
+func waitForGroupExit(ctx context.Context, info ProcessInfo, timeout time.Duration) bool {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for Survives(info) {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// stopStragglers terminates whatever is left of the agent's process group
+// once the agent itself has exited, so grandchildren such as LLM CLIs or
+// test runners do not outlive it
+func (s *AgentSupervisor) stopStragglers(pgid int) {
+	if !groupAlive(pgid) {
+		return
+	}
+	s.mu.Lock()
+	grace := s.terminateGrace
+	s.mu.Unlock()
+
+	s.logger.Warn("agent left processes behind, terminating its process group", "type", s.agentType, "pgid", pgid)
+	ReapOrphan(context.Background(), ProcessInfo{PGID: pgid, PID: pgid}, grace, s.logger)
+}
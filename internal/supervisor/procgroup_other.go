@@ -0,0 +1,44 @@
+//go:build !unix
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op where process groups are unavailable
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup signals only the process itself where process groups are
+// unavailable; anything other than SIGTERM kills it
+func signalGroup(pid int, sig syscall.Signal) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return os.ErrProcessDone
+	}
+	if sig == 0 {
+		return nil
+	}
+	if sig == syscall.SIGTERM {
+		return proc.Signal(sig)
+	}
+	return proc.Kill()
+}
+
+// sysAlive reports whether pid exists
+func sysAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
+
+// sysGroupAlive reports whether pid exists, as there are no groups to check
+func sysGroupAlive(pid int) bool {
+	return sysAlive(pid)
+}
+
+// processGroup returns pid itself where process groups are unavailable
+func processGroup(pid int) (int, error) {
+	return pid, nil
+}
@@ -0,0 +1,44 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd as the leader of a new process group, so the
+// agent and everything it spawns can be signalled together and terminal
+// signals meant for lorch do not reach it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup sends sig to every process in group pgid. It returns
+// os.ErrProcessDone when the group no longer exists.
+func signalGroup(pgid int, sig syscall.Signal) error {
+	err := syscall.Kill(-pgid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// sysAlive reports whether pid exists, zombies included
+func sysAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// sysGroupAlive reports whether group pgid has members, zombies included
+func sysGroupAlive(pgid int) bool {
+	err := syscall.Kill(-pgid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processGroup returns the process group of pid
+func processGroup(pid int) (int, error) {
+	return syscall.Getpgid(pid)
+}
@@ -0,0 +1,298 @@
+package supervisor
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// queueMemoryLimit is how many messages a queue keeps in memory before
+// spilling further ones to disk
+const queueMemoryLimit = 256
+
+// queueStallThreshold is how long a delivery may wait for the consumer
+// before it is reported as a stall
+const queueStallThreshold = time.Second
+
+// queueDepthReport is the first depth reported; each report doubles it
+const queueDepthReport = 16
+
+// queueStats describes a queue's traffic since it was started
+type queueStats struct {
+	Depth        int
+	MaxDepth     int
+	Delivered    int
+	Coalesced    int
+	Spilled      int
+	Stalls       int
+	LongestStall time.Duration
+}
+
+// messageQueue decouples reading an agent's output from consuming it: push
+// never blocks, so a slow consumer cannot stall the reader and nothing is
+// dropped. Messages beyond queueMemoryLimit are spilled to a temporary file
+// and read back in order. A coalescing queue keeps only the latest message,
+// which is all heartbeats need.
+type messageQueue[T any] struct {
+	name     string
+	agent    string
+	coalesce bool
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	mem    []T
+	closed bool
+	notify chan struct{}
+
+	// Spill file: messages are appended through spillW and read back through
+	// spillR; onDisk counts the ones not read back yet
+	spillFile *os.File
+	spillW    *bufio.Writer
+	spillR    *bufio.Reader
+	spillIn   *os.File
+	onDisk    int
+
+	stats      queueStats
+	nextReport int
+}
+
+func newMessageQueue[T any](name, agent string, coalesce bool, logger *slog.Logger) *messageQueue[T] {
+	return &messageQueue[T]{
+		name:       name,
+		agent:      agent,
+		coalesce:   coalesce,
+		logger:     logger,
+		notify:     make(chan struct{}, 1),
+		nextReport: queueDepthReport,
+	}
+}
+
+// push queues v for delivery
+func (q *messageQueue[T]) push(v T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+
+	switch {
+	case q.coalesce && len(q.mem) > 0:
+		q.mem[len(q.mem)-1] = v
+		q.stats.Coalesced++
+	case q.onDisk > 0 || len(q.mem) >= queueMemoryLimit:
+		if err := q.spill(v); err != nil {
+			// Without a spill file the queue can only grow in memory
+			q.logger.Warn("agent queue cannot spill to disk, keeping messages in memory",
+				"type", q.agent, "queue", q.name, "error", err)
+			q.mem = append(q.mem, v)
+		}
+	default:
+		q.mem = append(q.mem, v)
+	}
+
+	q.stats.Depth = len(q.mem) + q.onDisk
+	if q.stats.Depth > q.stats.MaxDepth {
+		q.stats.MaxDepth = q.stats.Depth
+	}
+	if q.stats.Depth >= q.nextReport {
+		q.logger.Debug("agent queue growing",
+			"type", q.agent, "queue", q.name,
+			"depth", q.stats.Depth, "on_disk", q.onDisk)
+		q.nextReport *= 2
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// spill appends v to the spill file, creating it on first use. The caller
+// holds q.mu.
+func (q *messageQueue[T]) spill(v T) error {
+	if q.spillFile == nil {
+		f, err := os.CreateTemp("", "lorch-queue-*.ndjson")
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(f.Name())
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		q.spillFile, q.spillIn = f, in
+		q.spillW = bufio.NewWriter(f)
+		q.spillR = bufio.NewReader(in)
+		q.logger.Debug("agent queue spilling to disk",
+			"type", q.agent, "queue", q.name, "path", f.Name())
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	q.spillW.Write(data)
+	if err := q.spillW.WriteByte('\n'); err != nil {
+		return err
+	}
+	q.onDisk++
+	q.stats.Spilled++
+	return nil
+}
+
+// refill reads spilled messages back into memory, and rewinds the spill
+// file once it has been read to the end. The caller holds q.mu.
+func (q *messageQueue[T]) refill() {
+	if err := q.spillW.Flush(); err != nil {
+		q.logger.Error("failed to flush agent queue spill file",
+			"type", q.agent, "queue", q.name, "error", err)
+	}
+	for q.onDisk > 0 && len(q.mem) < queueMemoryLimit {
+		line, err := q.spillR.ReadBytes('\n')
+		if err != nil {
+			q.logger.Error("lost spilled agent messages",
+				"type", q.agent, "queue", q.name, "count", q.onDisk, "error", err)
+			q.onDisk = 0
+			break
+		}
+		q.onDisk--
+		var v T
+		if err := json.Unmarshal(line, &v); err != nil {
+			q.logger.Error("failed to read back spilled agent message",
+				"type", q.agent, "queue", q.name, "error", err)
+			continue
+		}
+		q.mem = append(q.mem, v)
+	}
+	if q.onDisk == 0 {
+		q.spillFile.Truncate(0)
+		q.spillFile.Seek(0, 0)
+		q.spillIn.Seek(0, 0)
+		q.spillW.Reset(q.spillFile)
+		q.spillR.Reset(q.spillIn)
+	}
+}
+
+// next waits for the next message. It returns false once the queue is
+// closed and empty, or when done is closed.
+func (q *messageQueue[T]) next(done <-chan struct{}) (T, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.mem) == 0 && q.onDisk > 0 {
+			q.refill()
+		}
+		if len(q.mem) > 0 {
+			v := q.mem[0]
+			var zero T
+			q.mem[0] = zero
+			q.mem = q.mem[1:]
+			q.stats.Depth = len(q.mem) + q.onDisk
+			q.mu.Unlock()
+			return v, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+
+		var zero T
+		if closed {
+			return zero, false
+		}
+		select {
+		case <-q.notify:
+		case <-done:
+			return zero, false
+		}
+	}
+}
+
+// deliver feeds out from the queue until the queue is closed and drained or
+// done is closed, then closes out
+func (q *messageQueue[T]) deliver(out chan<- T, done <-chan struct{}) {
+	defer close(out)
+	defer q.release()
+
+	for {
+		v, ok := q.next(done)
+		if !ok {
+			return
+		}
+
+		select {
+		case out <- v:
+		default:
+			waitStart := time.Now()
+			select {
+			case out <- v:
+			case <-done:
+				return
+			}
+			q.recordWait(time.Since(waitStart))
+		}
+
+		q.mu.Lock()
+		q.stats.Delivered++
+		q.mu.Unlock()
+	}
+}
+
+// recordWait counts a delivery that had to wait for the consumer
+func (q *messageQueue[T]) recordWait(waited time.Duration) {
+	if waited < queueStallThreshold {
+		return
+	}
+	q.mu.Lock()
+	q.stats.Stalls++
+	if waited > q.stats.LongestStall {
+		q.stats.LongestStall = waited
+	}
+	depth := q.stats.Depth
+	q.mu.Unlock()
+
+	q.logger.Debug("agent queue stalled waiting for consumer",
+		"type", q.agent, "queue", q.name,
+		"waited", waited, "depth", depth)
+}
+
+// close stops accepting messages; those already queued are still delivered
+func (q *messageQueue[T]) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// release removes the spill file and reports the queue's traffic
+func (q *messageQueue[T]) release() {
+	q.mu.Lock()
+	stats := q.stats
+	if q.spillFile != nil {
+		q.spillIn.Close()
+		q.spillFile.Close()
+		os.Remove(q.spillFile.Name())
+		q.spillFile = nil
+	}
+	q.mu.Unlock()
+
+	q.logger.Debug("agent queue finished",
+		"type", q.agent, "queue", q.name,
+		"delivered", stats.Delivered,
+		"undelivered", stats.Depth,
+		"max_depth", stats.MaxDepth,
+		"coalesced", stats.Coalesced,
+		"spilled", stats.Spilled,
+		"stalls", stats.Stalls,
+		"longest_stall", stats.LongestStall)
+}
+
+// snapshot returns the queue's current statistics
+func (q *messageQueue[T]) snapshot() queueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
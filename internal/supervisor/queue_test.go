@@ -0,0 +1,117 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func TestMessageQueueSpillsInOrder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	q := newMessageQueue[int]("test", "builder", false, logger)
+
+	total := 3*queueMemoryLimit + 7
+	for i := 0; i < total; i++ {
+		q.push(i)
+	}
+	stats := q.snapshot()
+	if stats.Depth != total || stats.Spilled != total-queueMemoryLimit {
+		t.Fatalf("expected %d queued with %d spilled, got %+v", total, total-queueMemoryLimit, stats)
+	}
+	spillPath := q.spillFile.Name()
+
+	out := make(chan int)
+	go q.deliver(out, nil)
+
+	// Pushes made while the spill is read back stay behind it
+	for i := 0; i < total; i++ {
+		if i == queueMemoryLimit+1 {
+			q.push(total)
+			q.close()
+		}
+		if v := <-out; v != i {
+			t.Fatalf("expected message %d, got %d", i, v)
+		}
+	}
+	if v := <-out; v != total {
+		t.Fatalf("expected the late message %d last, got %d", total, v)
+	}
+	if _, ok := <-out; ok {
+		t.Fatal("expected the channel to close once the queue is drained")
+	}
+	if _, err := os.Stat(spillPath); !os.IsNotExist(err) {
+		t.Errorf("expected the spill file to be removed, got %v", err)
+	}
+}
+
+func TestMessageQueueCoalesces(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	q := newMessageQueue[int]("heartbeats", "builder", true, logger)
+	for i := 1; i <= 5; i++ {
+		q.push(i)
+	}
+	q.close()
+
+	out := make(chan int, 5)
+	q.deliver(out, nil)
+	var got []int
+	for v := range out {
+		got = append(got, v)
+	}
+	if len(got) != 1 || got[0] != 5 {
+		t.Fatalf("expected only the latest message, got %v", got)
+	}
+	if stats := q.snapshot(); stats.Coalesced != 4 {
+		t.Errorf("expected 4 coalesced messages, got %+v", stats)
+	}
+}
+
+func TestSupervisorChattyAgentLosesNothing(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// A legacy agent that floods logs and heartbeats, which nobody reads,
+	// before its event
+	const logCount = 600
+	script := fmt.Sprintf(`i=0
+while [ $i -lt %d ]; do
+  echo '{"kind":"log","level":"info","message":"line","timestamp":"2025-10-20T14:08:18Z"}'
+  echo '{"kind":"heartbeat","agent":{"agent_type":"builder"},"seq":1,"status":"busy","pid":1,"ppid":1,"uptime_s":0,"last_activity_at":"2025-10-20T14:08:18Z"}'
+  i=$((i+1))
+done
+echo '{"kind":"event","message_id":"e-1","correlation_id":"c-1","task_id":"T-1","from":{"agent_type":"builder"},"event":"builder.completed","status":"success","payload":{},"occurred_at":"2025-10-20T14:08:18Z"}'
+cat >/dev/null`, logCount)
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	select {
+	case evt := <-sup.Events():
+		if evt.MessageID != "e-1" {
+			t.Errorf("unexpected event %s", evt.MessageID)
+		}
+	case <-ctx.Done():
+		t.Fatal("event never arrived behind the unread logs")
+	}
+
+	for i := 0; i < logCount; i++ {
+		select {
+		case <-sup.Logs():
+		case <-ctx.Done():
+			t.Fatalf("only %d of %d logs delivered", i, logCount)
+		}
+	}
+	if stats := sup.heartbeatQueue.snapshot(); stats.Depth > 1 {
+		t.Errorf("expected heartbeats to be coalesced, got depth %d", stats.Depth)
+	}
+}
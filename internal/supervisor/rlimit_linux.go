@@ -0,0 +1,27 @@
+package supervisor
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// applyRlimits sets the rlimits in limits on the already running pid
+func applyRlimits(pid int, limits Limits) error {
+	if limits.MaxOpenFiles > 0 {
+		n := uint64(limits.MaxOpenFiles)
+		if err := prlimit(pid, syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: n, Max: n}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prlimit sets a resource limit of another process (prlimit(2))
+func prlimit(pid int, resource int, limit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package supervisor
+
+import "errors"
+
+// applyRlimits needs prlimit(2), which only Linux has
+func applyRlimits(pid int, limits Limits) error {
+	if limits.MaxOpenFiles > 0 {
+		return errors.New("setting rlimits on a running agent requires Linux")
+	}
+	return nil
+}
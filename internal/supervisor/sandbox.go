@@ -0,0 +1,69 @@
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// sandboxSetupTimeout bounds how long the sandbox init process may take to
+// set up namespaces and mounts before the agent is exec'd
+const sandboxSetupTimeout = 10 * time.Second
+
+// sandboxBaseEnv is passed through to every sandboxed agent, in addition to
+// its allowlist and configured env
+var sandboxBaseEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_ALL", "TERM", "TZ"}
+
+// Sandbox isolates an agent in unprivileged Linux user, mount and network
+// namespaces. Inside, the agent runs as root of its own user namespace
+// (files it creates belong to lorch's user), the filesystem is read-only
+// apart from the workspace, WritablePaths and a private /tmp, and only a
+// loopback interface exists unless Network is set.
+//
+// Sandboxing fails closed: where the kernel cannot provide it, Start fails
+// instead of running the agent unconfined.
+type Sandbox struct {
+	// Workspace is bind-mounted into the sandbox, read-only if ReadOnly
+	Workspace string
+	ReadOnly  bool
+	// Network keeps the host network; otherwise the agent only has loopback
+	Network bool
+	// EnvAllowlist names variables passed through from lorch's environment
+	EnvAllowlist []string
+	// WritablePaths stay writable, e.g. an agent CLI's config directory
+	WritablePaths []string
+}
+
+// SetSandbox runs the agent in sb. Call it before Start.
+func (s *AgentSupervisor) SetSandbox(sb Sandbox) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sandbox = &sb
+}
+
+// environ builds the agent's environment: lorch's own, or only the allowed
+// part of it when sandboxed, plus AGENT_TYPE and the configured env
+func (s *AgentSupervisor) environ() []string {
+	s.mu.Lock()
+	sb := s.sandbox
+	s.mu.Unlock()
+
+	var env []string
+	if sb == nil {
+		env = os.Environ()
+	} else {
+		for _, names := range [][]string{sandboxBaseEnv, sb.EnvAllowlist} {
+			for _, name := range names {
+				if value, ok := os.LookupEnv(name); ok {
+					env = append(env, name+"="+value)
+				}
+			}
+		}
+	}
+
+	env = append(env, fmt.Sprintf("AGENT_TYPE=%s", s.agentType))
+	for k, v := range s.env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	return env
+}
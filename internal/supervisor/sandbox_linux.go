@@ -0,0 +1,339 @@
+package supervisor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// sandboxInitName is argv[0] of lorch re-executed as a sandbox init process
+const sandboxInitName = "lorch-sandbox-init"
+
+// sandboxStatusFD carries a set-up error from the init process to lorch. It
+// is close-on-exec, so EOF without a message means the agent was exec'd.
+const sandboxStatusFD = 3
+
+// oPath is O_PATH, which package syscall does not define
+const oPath = 0x200000
+
+// Mount flags a remount must carry over: the kernel refuses to clear them
+// on mounts inherited from a more privileged namespace
+const lockedMountFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+	syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+
+// sandboxSpec tells the init process how to set up the sandbox and what to
+// exec afterwards; it travels as argv[1]
+type sandboxSpec struct {
+	Workspace     string   `json:"workspace"`
+	ReadOnly      bool     `json:"read_only"`
+	Network       bool     `json:"network"`
+	WritablePaths []string `json:"writable_paths,omitempty"`
+	Path          string   `json:"path"`
+	Args          []string `json:"args"`
+}
+
+// SandboxInit turns the process into a sandbox init process when lorch was
+// re-executed as one: it finishes setting up the namespaces it was started
+// in and execs the agent, never returning. Otherwise it returns at once.
+// Call it first thing in main (and TestMain).
+func SandboxInit() {
+	if filepath.Base(os.Args[0]) != sandboxInitName {
+		return
+	}
+	syscall.CloseOnExec(sandboxStatusFD)
+	status := os.NewFile(sandboxStatusFD, "sandbox-status")
+
+	err := runSandboxInit(os.Args[1:])
+	// runSandboxInit only returns on failure
+	fmt.Fprint(status, err)
+	os.Exit(1)
+}
+
+// checkSandboxSupport fails when the kernel will not create unprivileged
+// user namespaces
+func checkSandboxSupport() error {
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		return errors.New("kernel does not support user namespaces")
+	}
+	if data, err := os.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil && strings.TrimSpace(string(data)) == "0" {
+		return errors.New("user namespaces are disabled (user.max_user_namespaces is 0)")
+	}
+	if data, err := os.ReadFile("/proc/sys/kernel/unprivileged_userns_clone"); err == nil && strings.TrimSpace(string(data)) == "0" && os.Geteuid() != 0 {
+		return errors.New("unprivileged user namespaces are disabled (kernel.unprivileged_userns_clone is 0)")
+	}
+	return nil
+}
+
+// prepareSandbox rewrites cmd to start lorch's sandbox init process in new
+// namespaces, which then execs the agent. The returned function must be
+// called once cmd has been started (or failed to start); it reports whether
+// the sandbox was set up.
+func prepareSandbox(cmd *exec.Cmd, sb Sandbox) (func() error, error) {
+	if err := checkSandboxSupport(); err != nil {
+		return nil, err
+	}
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	workspace, err := filepath.Abs(sb.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace: %w", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate lorch executable: %w", err)
+	}
+
+	spec, err := json.Marshal(sandboxSpec{
+		Workspace:     workspace,
+		ReadOnly:      sb.ReadOnly,
+		Network:       sb.Network,
+		WritablePaths: sb.WritablePaths,
+		Path:          cmd.Path,
+		Args:          cmd.Args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox status pipe: %w", err)
+	}
+
+	cmd.Path = exe
+	cmd.Args = []string{sandboxInitName, string(spec)}
+	cmd.ExtraFiles = []*os.File{w}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	if !sb.Network {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	// Root inside is needed to set up mounts and maps back to lorch's user
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+
+	return func() error {
+		w.Close()
+		defer r.Close()
+		r.SetReadDeadline(time.Now().Add(sandboxSetupTimeout))
+		msg, err := io.ReadAll(r)
+		if len(msg) > 0 {
+			return errors.New(string(msg))
+		}
+		if err != nil {
+			return fmt.Errorf("sandbox set-up did not finish: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// runSandboxInit sets up the mount and network namespaces it runs in and
+// execs the agent
+func runSandboxInit(args []string) error {
+	if len(args) != 1 {
+		return errors.New("sandbox init expects one argument")
+	}
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+		return fmt.Errorf("invalid sandbox spec: %w", err)
+	}
+	cwd, _ := os.Getwd()
+
+	// Hold on to the paths that stay writable before /tmp is replaced, in
+	// case they live under it
+	type bind struct {
+		path     string
+		fd       int
+		readOnly bool
+	}
+	binds := []bind{{path: spec.Workspace, readOnly: spec.ReadOnly}}
+	for _, p := range spec.WritablePaths {
+		binds = append(binds, bind{path: p})
+	}
+	for i := range binds {
+		fd, err := syscall.Open(binds[i].path, oPath|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			if i > 0 && errors.Is(err, syscall.ENOENT) {
+				binds[i].fd = -1 // a writable path that does not exist yet
+				continue
+			}
+			return fmt.Errorf("cannot open %s: %w", binds[i].path, err)
+		}
+		binds[i].fd = fd
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+
+	for _, mp := range mounts {
+		if under(mp, "/proc") || under(mp, "/sys") || under(mp, "/dev") {
+			continue
+		}
+		if err := remount(mp, true); err != nil {
+			if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EACCES) {
+				continue // not reachable by the agent either
+			}
+			return fmt.Errorf("failed to make %s read-only: %w", mp, err)
+		}
+	}
+
+	if _, err := os.Stat("/tmp"); err == nil {
+		if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("failed to mount private /tmp: %w", err)
+		}
+	}
+
+	for _, b := range binds {
+		if b.fd < 0 {
+			continue
+		}
+		if err := bindMount(b.fd, b.path, b.readOnly); err != nil {
+			return fmt.Errorf("failed to bind %s: %w", b.path, err)
+		}
+		syscall.Close(b.fd)
+	}
+
+	if !spec.Network {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("failed to bring up loopback: %w", err)
+		}
+	}
+
+	// Re-enter the working directory so it resolves to the new mounts
+	if cwd == "" || os.Chdir(cwd) != nil {
+		if err := os.Chdir(spec.Workspace); err != nil {
+			return fmt.Errorf("failed to enter workspace: %w", err)
+		}
+	}
+
+	err = syscall.Exec(spec.Path, spec.Args, os.Environ())
+	return fmt.Errorf("failed to exec agent: %w", err)
+}
+
+// mountPoints lists the current mount points from /proc/self/mountinfo
+func mountPoints() ([]string, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount table: %w", err)
+	}
+	seen := make(map[string]bool)
+	var mounts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		mp := unescapeMountPath(fields[4])
+		if !seen[mp] {
+			seen[mp] = true
+			mounts = append(mounts, mp)
+		}
+	}
+	return mounts, nil
+}
+
+// unescapeMountPath decodes the octal escapes (\040 etc.) mountinfo uses
+func unescapeMountPath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func under(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// remount changes whether the mount at path is read-only, keeping its
+// locked flags
+func remount(path string, readOnly bool) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return err
+	}
+	flags := uintptr(st.Flags) & lockedMountFlags
+	if readOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	return syscall.Mount("", path, "", syscall.MS_BIND|syscall.MS_REMOUNT|flags, "")
+}
+
+// bindMount mounts the file or directory open as fd at path, creating the
+// mount point if a tmpfs hid it
+func bindMount(fd int, path string, readOnly bool) error {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		if st.Mode&syscall.S_IFMT == syscall.S_IFDIR {
+			err = os.MkdirAll(path, 0o755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			err = os.WriteFile(path, nil, 0o644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	source := "/proc/self/fd/" + strconv.Itoa(fd)
+	if err := syscall.Mount(source, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	return remount(path, readOnly)
+}
+
+// loopbackUp brings up lo, the only interface in a new network namespace
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq: interface name, then flags as a short
+	var ifr [40]byte
+	copy(ifr[:], "lo")
+	if err := ioctl(fd, syscall.SIOCGIFFLAGS, &ifr); err != nil {
+		return err
+	}
+	flags := binary.NativeEndian.Uint16(ifr[syscall.IFNAMSIZ:])
+	binary.NativeEndian.PutUint16(ifr[syscall.IFNAMSIZ:], flags|syscall.IFF_UP)
+	return ioctl(fd, syscall.SIOCSIFFLAGS, &ifr)
+}
+
+func ioctl(fd int, req uintptr, ifr *[40]byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
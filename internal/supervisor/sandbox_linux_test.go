@@ -0,0 +1,131 @@
+package supervisor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// sandboxDirs returns a workspace and a sibling directory outside it. They
+// are kept out of /tmp, which the sandbox replaces.
+func sandboxDirs(t *testing.T) (workspace, outside string) {
+	t.Helper()
+	if err := checkSandboxSupport(); err != nil {
+		t.Skipf("sandbox unsupported: %v", err)
+	}
+	root, err := os.MkdirTemp(".", ".sandbox-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	root, _ = filepath.Abs(root)
+
+	workspace = filepath.Join(root, "workspace")
+	outside = filepath.Join(root, "outside")
+	for _, dir := range []string{workspace, outside} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return workspace, outside
+}
+
+// runSandboxed runs script in sb and waits for it to write "done" to
+// report
+func runSandboxed(t *testing.T, sb Sandbox, env map[string]string, script, report string) string {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, env, logger)
+	sup.SetHandshakeTimeout(50 * time.Millisecond)
+	sup.SetSandbox(sb)
+
+	if err := sup.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start sandboxed agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(report)
+		if strings.Contains(string(data), "done") {
+			return string(data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("sandboxed agent did not finish its checks")
+	return ""
+}
+
+func TestSandboxConfinesAgent(t *testing.T) {
+	workspace, outside := sandboxDirs(t)
+	t.Setenv("LORCH_TEST_SECRET", "hunter2")
+	t.Setenv("LORCH_TEST_ALLOWED", "yes")
+
+	script := `
+cd "$WS"
+echo ok > inside || echo "workspace-not-writable" >> report
+echo x > "$OUTSIDE/escaped" 2>/dev/null && echo "outside-writable" >> report
+echo x > /tmp/scratch || echo "tmp-not-writable" >> report
+[ -n "$LORCH_TEST_SECRET" ] && echo "secret-leaked" >> report
+[ "$LORCH_TEST_ALLOWED" = yes ] || echo "allowlist-ignored" >> report
+[ "$(grep -c : /proc/self/net/dev)" = 1 ] || echo "network-visible" >> report
+echo done >> report
+exec cat`
+	sb := Sandbox{Workspace: workspace, EnvAllowlist: []string{"LORCH_TEST_ALLOWED"}}
+	env := map[string]string{"WS": workspace, "OUTSIDE": outside}
+
+	report := runSandboxed(t, sb, env, script, filepath.Join(workspace, "report"))
+	if report != "done\n" {
+		t.Errorf("sandbox checks failed:\n%s", report)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "escaped")); err == nil {
+		t.Error("agent wrote outside the workspace")
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "inside")); err != nil {
+		t.Errorf("agent could not write the workspace: %v", err)
+	}
+}
+
+func TestSandboxReadOnlyWorkspace(t *testing.T) {
+	workspace, outside := sandboxDirs(t)
+
+	script := `
+echo x > "$WS/file" 2>/dev/null && echo "workspace-writable" >> "$OUT/report"
+ls "$WS" > /dev/null || echo "workspace-unreadable" >> "$OUT/report"
+echo done >> "$OUT/report"
+exec cat`
+	// outside doubles as a writable path to report through
+	sb := Sandbox{Workspace: workspace, ReadOnly: true, Network: true, WritablePaths: []string{outside}}
+	env := map[string]string{"WS": workspace, "OUT": outside}
+
+	report := runSandboxed(t, sb, env, script, filepath.Join(outside, "report"))
+	if report != "done\n" {
+		t.Errorf("sandbox checks failed:\n%s", report)
+	}
+}
+
+func TestSandboxFailsClosed(t *testing.T) {
+	workspace, _ := sandboxDirs(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"cat"}, nil, logger)
+	sup.SetSandbox(Sandbox{Workspace: filepath.Join(workspace, "missing")})
+
+	err := sup.Start(context.Background())
+	if err == nil {
+		sup.Stop(context.Background())
+		t.Fatal("expected the agent not to start")
+	}
+	if !strings.Contains(err.Error(), "cannot sandbox builder agent") || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if sup.IsRunning() {
+		t.Error("agent should not be running")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package supervisor
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// SandboxInit does nothing outside Linux, where agents cannot be sandboxed
+func SandboxInit() {}
+
+// prepareSandbox fails: namespaces are Linux-only and sandboxing fails
+// closed
+func prepareSandbox(cmd *exec.Cmd, sb Sandbox) (func() error, error) {
+	return nil, errors.New("agent sandboxing requires Linux namespaces")
+}
@@ -0,0 +1,300 @@
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// DefaultConnectTimeout is how long a socket transport waits for its agent
+// to connect
+const DefaultConnectTimeout = 30 * time.Second
+
+// maxSocketPath is the longest path a Unix socket address can hold
+const maxSocketPath = 107
+
+// socketHelloTimeout bounds how long a new connection may take to send its
+// hello, which names the agent type it serves
+const socketHelloTimeout = 10 * time.Second
+
+// SocketListener accepts agents that connect to lorch over a Unix socket
+// instead of being started by it. Each connection is handed to the
+// supervisor for the agent type its hello names, so long-running agent
+// daemons can reconnect when lorch restarts and be reattached.
+type SocketListener struct {
+	path   string
+	ln     *net.UnixListener
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	waiting map[protocol.AgentType]chan *Conn // supervisors waiting for an agent
+	parked  map[protocol.AgentType]*Conn      // agents waiting for a supervisor
+	closed  chan struct{}
+}
+
+// ListenSocket listens for agents on a Unix socket at path. A socket left
+// behind by a lorch that died is replaced; one still being served by a
+// running lorch is an error.
+func ListenSocket(path string, logger *slog.Logger) (*SocketListener, error) {
+	if len(path) > maxSocketPath {
+		return nil, fmt.Errorf("agent socket path %s is too long (%d bytes, the limit is %d); use a shorter workspace path", path, len(path), maxSocketPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("agent socket %s is in use by another lorch", path)
+		}
+		os.Remove(path)
+	}
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on agent socket: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict agent socket: %w", err)
+	}
+
+	l := &SocketListener{
+		path:    path,
+		ln:      ln,
+		logger:  logger,
+		waiting: make(map[protocol.AgentType]chan *Conn),
+		parked:  make(map[protocol.AgentType]*Conn),
+		closed:  make(chan struct{}),
+	}
+	go l.accept()
+	logger.Info("listening for agents", "socket", path)
+	return l, nil
+}
+
+// Path returns the socket path agents connect to
+func (l *SocketListener) Path() string {
+	return l.path
+}
+
+// Close stops accepting agents and drops connections no supervisor took.
+// Attached agents stay connected until their supervisors stop.
+func (l *SocketListener) Close() error {
+	l.mu.Lock()
+	select {
+	case <-l.closed:
+		l.mu.Unlock()
+		return nil
+	default:
+	}
+	close(l.closed)
+	parked := l.parked
+	l.parked = make(map[protocol.AgentType]*Conn)
+	l.mu.Unlock()
+
+	for _, conn := range parked {
+		conn.Reader.Close()
+	}
+	return l.ln.Close()
+}
+
+// Transport returns a transport that waits up to timeout for an agent of
+// agentType to connect
+func (l *SocketListener) Transport(agentType protocol.AgentType, timeout time.Duration) Transport {
+	if timeout <= 0 {
+		timeout = DefaultConnectTimeout
+	}
+	return &socketTransport{listener: l, agentType: agentType, timeout: timeout}
+}
+
+func (l *SocketListener) accept() {
+	for {
+		conn, err := l.ln.AcceptUnix()
+		if err != nil {
+			select {
+			case <-l.closed:
+			default:
+				l.logger.Error("agent socket stopped accepting", "error", err)
+			}
+			return
+		}
+		go l.admit(conn)
+	}
+}
+
+// admit reads a new connection's hello and hands it to the supervisor for
+// its agent type, or parks it until one asks
+func (l *SocketListener) admit(uc *net.UnixConn) {
+	reader := bufio.NewReaderSize(uc, 64*1024)
+	uc.SetReadDeadline(time.Now().Add(socketHelloTimeout))
+	line, err := reader.ReadSlice('\n')
+	uc.SetReadDeadline(time.Time{})
+	if err != nil {
+		l.logger.Warn("dropping agent connection without a hello", "error", err)
+		uc.Close()
+		return
+	}
+
+	var hello struct {
+		Kind  protocol.MessageKind `json:"kind"`
+		Agent protocol.AgentRef    `json:"agent"`
+	}
+	if err := json.Unmarshal(line, &hello); err != nil || hello.Kind != protocol.MessageKindHello || hello.Agent.AgentType == "" {
+		l.logger.Warn("dropping agent connection: first message must be a hello naming the agent type")
+		uc.Close()
+		return
+	}
+	agentType := hello.Agent.AgentType
+
+	// The supervisor performs the handshake itself, so the hello is replayed
+	sc := &socketConn{
+		uc:     uc,
+		reader: io.MultiReader(bytes.NewReader(bytes.Clone(line)), reader),
+		done:   make(chan struct{}),
+	}
+	conn := &Conn{Writer: socketWriter{sc}, Reader: sc, Wait: sc.wait}
+
+	l.mu.Lock()
+	select {
+	case <-l.closed:
+		l.mu.Unlock()
+		uc.Close()
+		return
+	default:
+	}
+	if ch, ok := l.waiting[agentType]; ok {
+		delete(l.waiting, agentType)
+		l.mu.Unlock()
+		ch <- conn
+		l.logger.Info("agent connected over socket", "type", agentType, "agent_id", hello.Agent.AgentID)
+		return
+	}
+	previous := l.parked[agentType]
+	l.parked[agentType] = conn
+	l.mu.Unlock()
+
+	if previous != nil {
+		previous.Reader.Close()
+	}
+	l.logger.Info("agent connected over socket, waiting for lorch to attach it", "type", agentType, "agent_id", hello.Agent.AgentID)
+}
+
+// socketTransport attaches a supervisor to the next agent of its type that
+// connects to the listener
+type socketTransport struct {
+	listener  *SocketListener
+	agentType protocol.AgentType
+	timeout   time.Duration
+}
+
+// Connect implements Transport
+func (t *socketTransport) Connect(ctx context.Context) (*Conn, error) {
+	l := t.listener
+	l.mu.Lock()
+	if conn := l.parked[t.agentType]; conn != nil {
+		delete(l.parked, t.agentType)
+		l.mu.Unlock()
+		return conn, nil
+	}
+	if _, ok := l.waiting[t.agentType]; ok {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("another supervisor is already waiting for a %s agent", t.agentType)
+	}
+	ch := make(chan *Conn, 1)
+	l.waiting[t.agentType] = ch
+	l.mu.Unlock()
+
+	l.logger.Info("waiting for agent to connect", "type", t.agentType, "socket", l.path, "timeout", t.timeout)
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case conn := <-ch:
+		return conn, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = fmt.Errorf("no %s agent connected to %s within %s", t.agentType, l.path, t.timeout)
+	case <-l.closed:
+		err = errors.New("agent socket closed")
+	}
+
+	l.mu.Lock()
+	if l.waiting[t.agentType] == ch {
+		delete(l.waiting, t.agentType)
+	}
+	l.mu.Unlock()
+	// An agent may have been handed over while giving up
+	select {
+	case conn := <-ch:
+		conn.Reader.Close()
+	default:
+	}
+	return nil, err
+}
+
+// socketConn is the agent's side of a socket connection as lorch reads it.
+// The connection is over once reading fails or lorch closes it.
+type socketConn struct {
+	uc     *net.UnixConn
+	reader io.Reader
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (c *socketConn) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	if err != nil {
+		c.finish(err)
+	}
+	return n, err
+}
+
+// Close drops the connection
+func (c *socketConn) Close() error {
+	c.finish(nil)
+	return nil
+}
+
+func (c *socketConn) finish(err error) {
+	c.once.Do(func() {
+		if err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+			c.err = err
+		}
+		c.uc.Close()
+		close(c.done)
+	})
+}
+
+func (c *socketConn) wait() error {
+	<-c.done
+	return c.err
+}
+
+// socketWriter carries lorch's messages; closing it half-closes the
+// connection so the agent sees EOF but can still finish and say goodbye
+type socketWriter struct{ c *socketConn }
+
+func (w socketWriter) Write(p []byte) (int, error) {
+	return w.c.uc.Write(p)
+}
+
+func (w socketWriter) Close() error {
+	return w.c.uc.CloseWrite()
+}
@@ -0,0 +1,134 @@
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/pkg/agentsdk"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+func TestSocketTransportReattachesDaemon(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "run.sock")
+
+	agent, err := agentsdk.New(agentsdk.Config{
+		Role:              protocol.AgentTypeBuilder,
+		Logger:            logger,
+		DisableHeartbeat:  true,
+		ReconnectInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handled atomic.Int32
+	agent.HandleFunc(protocol.ActionImplement, func(ctx context.Context, cmd *protocol.Command, e *agentsdk.Emitter) error {
+		handled.Add(1)
+		evt := e.NewEvent(cmd, protocol.EventBuilderCompleted)
+		evt.Status = "success"
+		evt.Payload = map[string]any{}
+		return e.Emit(evt)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- agent.Serve(ctx, path) }()
+
+	// Each iteration is one lorch process: the daemon outlives the first
+	// and is reattached by the second
+	for attach := 1; attach <= 2; attach++ {
+		listener, err := ListenSocket(path, logger)
+		if err != nil {
+			t.Fatalf("attach %d: failed to listen: %v", attach, err)
+		}
+
+		sup := NewAgentSupervisor(protocol.AgentTypeBuilder, nil, nil, logger)
+		sup.SetTransport(listener.Transport(protocol.AgentTypeBuilder, 5*time.Second))
+		if err := sup.Start(ctx); err != nil {
+			t.Fatalf("attach %d: failed to start: %v", attach, err)
+		}
+		if n := sup.Negotiation(); n == nil || n.Legacy {
+			t.Errorf("attach %d: expected a negotiated handshake, got %+v", attach, n)
+		}
+		if _, ok := sup.Process(); ok {
+			t.Errorf("attach %d: socket agent should have no local process", attach)
+		}
+
+		cmd := cancelTestCommand()
+		cmd.Version.SnapshotID = "snap-socket-test"
+		if err := sup.SendCommand(cmd); err != nil {
+			t.Fatalf("attach %d: failed to send command: %v", attach, err)
+		}
+		select {
+		case evt := <-sup.Events():
+			if evt.Event != protocol.EventBuilderCompleted {
+				t.Errorf("attach %d: unexpected event %s", attach, evt.Event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("attach %d: no event received", attach)
+		}
+
+		if err := sup.Stop(context.Background()); err != nil {
+			t.Errorf("attach %d: stop failed: %v", attach, err)
+		}
+		listener.Close()
+	}
+
+	if handled.Load() != 2 {
+		t.Errorf("expected the daemon to handle 2 commands, handled %d", handled.Load())
+	}
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
+
+func TestSocketTransportTimesOut(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	listener, err := ListenSocket(filepath.Join(t.TempDir(), "run.sock"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sup := NewAgentSupervisor(protocol.AgentTypeReviewer, nil, nil, logger)
+	sup.SetTransport(listener.Transport(protocol.AgentTypeReviewer, 100*time.Millisecond))
+	err = sup.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no reviewer agent connected") {
+		t.Errorf("expected connect timeout, got %v", err)
+	}
+}
+
+func TestSocketListenerRequiresHello(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "run.sock")
+	listener, err := ListenSocket(path, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if _, err := ListenSocket(path, logger); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("expected a second listener to be refused, got %v", err)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(`{"kind":"heartbeat","agent":{"agent_type":"builder"},"seq":1}` + "\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := bufio.NewReader(conn).ReadByte(); err != io.EOF {
+		t.Errorf("expected the connection to be dropped, got %v", err)
+	}
+}
@@ -3,18 +3,32 @@ package supervisor
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
 	"os/exec"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
+// DefaultHandshakeTimeout bounds how long Start waits for an agent's first
+// message. Agents that stay silent that long are treated as legacy v1 agents.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// DefaultCancelGracePeriod is how long Cancel waits for an agent to
+// acknowledge a cancel before signalling the process
+const DefaultCancelGracePeriod = 10 * time.Second
+
+// DefaultTerminateGracePeriod is how long an agent has to exit after SIGTERM
+// before it is killed
+const DefaultTerminateGracePeriod = 5 * time.Second
+
 // AgentSupervisor manages a single agent subprocess
 type AgentSupervisor struct {
 	agentType protocol.AgentType
@@ -29,15 +43,73 @@ type AgentSupervisor struct {
 	stdin         io.WriteCloser
 	stdout        io.ReadCloser
 	stderr        io.ReadCloser
+	wait          func() error // Conn.Wait of the current connection
 	running       bool
 	lastHeartbeat time.Time
-	exitChan      chan error // Receives the result of proc.Wait() from waitForExit
+	exitChan      chan error    // Receives the result of proc.Wait() from waitForExit
+	exited        chan struct{} // Closed once the process has exited
+	procInfo      ProcessInfo
+
+	// encMu serializes writes to the agent's stdin
+	encMu sync.Mutex
 
 	// Channels for messages
 	events     chan *protocol.Event
 	heartbeats chan *protocol.Heartbeat
 	logs       chan *protocol.Log
 	stderrLines chan string
+
+	// Queues feeding the channels above: the readers never block on a slow
+	// consumer, so no event, log or stderr line is lost. Heartbeats are
+	// coalesced to the latest.
+	eventQueue     *messageQueue[*protocol.Event]
+	heartbeatQueue *messageQueue[*protocol.Heartbeat]
+	logQueue       *messageQueue[*protocol.Log]
+	stderrQueue    *messageQueue[string]
+
+	// observer, when set, sees the raw bytes of every decoded message
+	observer func(kind protocol.MessageKind, raw []byte)
+
+	// enforcer validates every inbound message against schemas/v1
+	enforcer *schema.Enforcer
+
+	// Protocol handshake: greeted is set once the agent's first message has
+	// been seen (or the wait timed out); handshake carries the outcome to Start
+	handshakeTimeout time.Duration
+	greeted          bool
+	handshake        chan error
+	negotiation      *protocol.Negotiation
+
+	// messageLimit is the size limit of messages in both directions, taken
+	// from ndjson.DefaultLimit at Start; the handshake may lower the outbound
+	// limit to what the agent declared
+	messageLimit int
+
+	// Cancellation: inflight is the last command sent until its terminal
+	// event arrives, cancelling is the cancel in progress (concurrent
+	// callers join it)
+	cancelGrace    time.Duration
+	terminateGrace time.Duration
+	inflight       *protocol.Command
+	cancelling     *cancelOp
+
+	// Resource limits and accounting: window covers the current command,
+	// stats is the latest measurement reported with heartbeats
+	limits         Limits
+	sampleInterval time.Duration
+	cgroup         *cgroup
+	window         resourceWindow
+	stats          *protocol.HeartbeatStats
+	limitKill      *protocol.LimitKill
+
+	// sandbox, when set, confines the agent in Linux namespaces
+	sandbox *Sandbox
+
+	// workDir, when set, is the agent's working directory
+	workDir string
+
+	// transport, when set, reaches an agent lorch does not start itself
+	transport Transport
 }
 
 // NewAgentSupervisor creates a new agent supervisor
@@ -56,6 +128,12 @@ func NewAgentSupervisor(
 		heartbeats:  make(chan *protocol.Heartbeat, 10),
 		logs:        make(chan *protocol.Log, 50),
 		stderrLines: make(chan string, 100),
+		enforcer:    schema.DefaultEnforcer(),
+
+		handshakeTimeout: DefaultHandshakeTimeout,
+		cancelGrace:      DefaultCancelGracePeriod,
+		terminateGrace:   DefaultTerminateGracePeriod,
+		sampleInterval:   DefaultResourceSampleInterval,
 	}
 }
 
@@ -70,63 +148,213 @@ func (s *AgentSupervisor) Start(ctx context.Context) error {
 
 	s.logger.Info("starting agent", "type", s.agentType, "cmd", s.cmd)
 
-	// Create command
-	proc := exec.CommandContext(ctx, s.cmd[0], s.cmd[1:]...)
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	proc := conn.process
+
+	s.mu.Lock()
+	s.process = proc
+	s.procInfo = ProcessInfo{}
+	if proc != nil {
+		s.procInfo = ProcessInfo{PID: proc.Process.Pid, PGID: proc.Process.Pid, StartedAt: time.Now().UTC()}
+		s.procInfo.StartTicks, _ = processStartTicks(proc.Process.Pid)
+	}
+	s.stdin = conn.Writer
+	s.stdout = conn.Reader
+	s.stderr = conn.Stderr
+	s.wait = conn.Wait
+	s.encoder = ndjson.NewEncoder(conn.Writer, s.logger)
+	s.decoder = ndjson.NewDecoder(conn.Reader, s.logger)
+	s.messageLimit = ndjson.DefaultLimit()
+	s.running = true
+	s.lastHeartbeat = time.Now()
+	s.exitChan = make(chan error, 1) // Buffered to prevent goroutine leak
+	s.exited = make(chan struct{})
+	s.inflight = nil
+	s.cancelling = nil
+	s.greeted = false
+	s.handshake = make(chan error, 1)
+	s.negotiation = nil
+	s.window = resourceWindow{}
+	s.stats = nil
+	s.limitKill = nil
+	exited := s.exited
+	s.mu.Unlock()
 
-	// Set environment - inherit parent environment first, then add custom vars
-	proc.Env = os.Environ()
-	proc.Env = append(proc.Env, fmt.Sprintf("AGENT_TYPE=%s", s.agentType))
-	for k, v := range s.env {
-		proc.Env = append(proc.Env, fmt.Sprintf("%s=%s", k, v))
+	if proc != nil {
+		s.applyLimits(proc.Process.Pid)
+		s.logger.Info("agent started", "type", s.agentType, "pid", proc.Process.Pid)
+		go s.monitorResources(exited)
+	} else {
+		s.logger.Info("agent connected", "type", s.agentType)
 	}
 
-	// Setup pipes
-	stdin, err := proc.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	// Start IO goroutines
+	s.startQueues(ctx)
+	go s.readStdout(ctx)
+	go s.readStderr(ctx)
+	go s.waitForExit(ctx)
+	go s.watchContext(ctx)
+
+	if err := s.awaitHandshake(ctx); err != nil {
+		s.kill()
+		return err
+	}
+
+	return nil
+}
+
+// awaitHandshake blocks until the agent's hello has been negotiated, the
+// agent has shown it predates the handshake, or the timeout passes
+func (s *AgentSupervisor) awaitHandshake(ctx context.Context) error {
+	s.mu.Lock()
+	handshake := s.handshake
+	timeout := s.handshakeTimeout
+	s.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-handshake:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	s.mu.Lock()
+	if s.greeted {
+		// The first message raced the timer; its outcome is already queued
+		s.mu.Unlock()
+		return <-handshake
+	}
+	s.greeted = true
+	s.negotiation = protocol.LegacyNegotiation(s.messageLimit)
+	s.mu.Unlock()
+
+	s.logger.Warn("agent sent no hello within the handshake timeout, assuming protocol v1",
+		"type", s.agentType,
+		"timeout", timeout)
+	return nil
+}
+
+// greet settles the handshake from the agent's first message. A hello is
+// negotiated and acknowledged; anything else marks the agent as predating
+// the handshake. It reports whether msg was the first message.
+func (s *AgentSupervisor) greet(msg any) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.greeted {
+		return false
+	}
+	s.greeted = true
+
+	hello, ok := msg.(*protocol.Hello)
+	if !ok {
+		s.negotiation = protocol.LegacyNegotiation(s.messageLimit)
+		s.logger.Warn("agent sent no hello, assuming protocol v1", "type", s.agentType)
+		s.handshake <- nil
+		return true
 	}
 
-	stdout, err := proc.StdoutPipe()
+	n, err := s.negotiate(hello)
 	if err != nil {
-		stdin.Close()
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+		s.handshake <- fmt.Errorf("protocol handshake with %s agent failed: %w", s.agentType, err)
+		return true
+	}
+	s.negotiation = n
+	s.logger.Info("negotiated agent protocol",
+		"type", s.agentType,
+		"version", n.ProtocolVersion,
+		"max_message_bytes", n.MaxMessageBytes,
+		"streaming_progress", n.Capabilities.StreamingProgress,
+		"cancellation", n.Capabilities.Cancellation)
+	s.handshake <- nil
+	return true
+}
+
+// negotiate picks a protocol version for hello and answers the agent. The
+// caller holds s.mu.
+func (s *AgentSupervisor) negotiate(hello *protocol.Hello) (*protocol.Negotiation, error) {
+	n, err := protocol.Negotiate(hello, protocol.SupportedProtocolVersions, s.messageLimit)
+	if err == nil && hello.Agent.AgentType != s.agentType {
+		n, err = nil, fmt.Errorf("agent declared role %s but was launched as %s", hello.Agent.AgentType, s.agentType)
 	}
 
-	stderr, err := proc.StderrPipe()
+	ack := protocol.HelloAck{Kind: protocol.MessageKindHelloAck, Accepted: err == nil}
 	if err != nil {
-		stdin.Close()
-		stdout.Close()
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
+		ack.Reason = err.Error()
+	} else {
+		ack.ProtocolVersion = n.ProtocolVersion
+		ack.MaxMessageBytes = n.MaxMessageBytes
+	}
+	s.encMu.Lock()
+	encErr := s.encoder.Encode(ack)
+	s.encMu.Unlock()
+	if encErr != nil && err == nil {
+		return nil, fmt.Errorf("failed to acknowledge hello: %w", encErr)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Start process
-	if err := proc.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		stderr.Close()
-		return fmt.Errorf("failed to start process: %w", err)
+	s.encoder.SetLimit(n.MaxMessageBytes)
+	return n, nil
+}
+
+// failHandshake settles a pending handshake with err
+func (s *AgentSupervisor) failHandshake(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.greeted {
+		return
 	}
+	s.greeted = true
+	s.handshake <- err
+}
 
+// kill force-stops an agent whose startup failed and waits for it to exit
+func (s *AgentSupervisor) kill() {
 	s.mu.Lock()
-	s.process = proc
-	s.stdin = stdin
-	s.stdout = stdout
-	s.stderr = stderr
-	s.encoder = ndjson.NewEncoder(stdin, s.logger)
-	s.decoder = ndjson.NewDecoder(stdout, s.logger)
-	s.running = true
-	s.lastHeartbeat = time.Now()
-	s.exitChan = make(chan error, 1) // Buffered to prevent goroutine leak
+	exitChan := s.exitChan
 	s.mu.Unlock()
 
-	s.logger.Info("agent started", "type", s.agentType, "pid", proc.Process.Pid)
+	s.forceStop()
+	select {
+	case <-exitChan:
+	case <-time.After(5 * time.Second):
+		s.logger.Warn("agent did not exit after kill", "type", s.agentType)
+	}
+}
 
-	// Start IO goroutines
-	go s.readStdout(ctx)
-	go s.readStderr(ctx)
-	go s.waitForExit(ctx)
+// SetHandshakeTimeout changes how long Start waits for the agent's first
+// message. Call it before Start.
+func (s *AgentSupervisor) SetHandshakeTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d > 0 {
+		s.handshakeTimeout = d
+	}
+}
 
-	return nil
+// SetWorkDir starts the agent in dir instead of lorch's working directory.
+// A relative command path is still resolved against lorch's. Call it before
+// Start.
+func (s *AgentSupervisor) SetWorkDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workDir = dir
+}
+
+// Negotiation returns the outcome of the protocol handshake, or nil before
+// Start has completed
+func (s *AgentSupervisor) Negotiation() *protocol.Negotiation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.negotiation
 }
 
 // Stop gracefully stops the agent
@@ -137,7 +365,6 @@ func (s *AgentSupervisor) Stop(ctx context.Context) error {
 		return nil
 	}
 
-	proc := s.process
 	stdin := s.stdin
 	exitChan := s.exitChan
 	s.mu.Unlock()
@@ -154,9 +381,7 @@ func (s *AgentSupervisor) Stop(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		// Context cancelled, force kill
-		if proc.Process != nil {
-			proc.Process.Kill()
-		}
+		s.forceStop()
 		return ctx.Err()
 	case err := <-exitChan:
 		// Process exited - waitForExit already set running=false
@@ -169,9 +394,7 @@ func (s *AgentSupervisor) Stop(ctx context.Context) error {
 	case <-time.After(5 * time.Second):
 		// Timeout, force kill
 		s.logger.Warn("agent did not stop gracefully, killing", "type", s.agentType)
-		if proc.Process != nil {
-			proc.Process.Kill()
-		}
+		s.forceStop()
 		return fmt.Errorf("agent stop timeout")
 	}
 }
@@ -181,6 +404,7 @@ func (s *AgentSupervisor) SendCommand(cmd *protocol.Command) error {
 	s.mu.Lock()
 	encoder := s.encoder
 	running := s.running
+	negotiation := s.negotiation
 	s.mu.Unlock()
 
 	if !running {
@@ -191,9 +415,70 @@ func (s *AgentSupervisor) SendCommand(cmd *protocol.Command) error {
 		return fmt.Errorf("encoder not initialized")
 	}
 
+	if !negotiation.Supports(cmd.Action) {
+		return fmt.Errorf("%s agent does not support action %s (declared: %v)", s.agentType, cmd.Action, negotiation.SupportedActions)
+	}
+
 	s.logger.Debug("sending command", "type", s.agentType, "action", cmd.Action, "task_id", cmd.TaskID)
 
-	return encoder.Encode(cmd)
+	s.resetWindow()
+
+	// Recorded before writing, so a terminal event that arrives at once
+	// still finds the command to settle
+	s.mu.Lock()
+	previous := s.inflight
+	s.inflight = cmd
+	s.mu.Unlock()
+
+	s.encMu.Lock()
+	err := encoder.Encode(cmd)
+	s.encMu.Unlock()
+	if err != nil {
+		s.mu.Lock()
+		if s.inflight == cmd {
+			s.inflight = previous
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// SendRaw writes a pre-encoded line to the agent's stdin, bypassing the
+// encoder's size cap. Conformance tests use it to send malformed input.
+func (s *AgentSupervisor) SendRaw(line []byte) error {
+	s.mu.Lock()
+	stdin := s.stdin
+	running := s.running
+	s.mu.Unlock()
+
+	if !running || stdin == nil {
+		return fmt.Errorf("agent not running")
+	}
+
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	_, err := stdin.Write(line)
+	return err
+}
+
+// SetMessageObserver registers a callback that receives a copy of the raw
+// bytes of every message decoded from the agent. Call it before Start.
+func (s *AgentSupervisor) SetMessageObserver(fn func(kind protocol.MessageKind, raw []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+// SetSchemaEnforcer replaces the enforcer applied to inbound messages.
+// Call it before Start.
+func (s *AgentSupervisor) SetSchemaEnforcer(e *schema.Enforcer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enforcer = e
 }
 
 // Events returns the channel for receiving events from the agent
@@ -216,6 +501,14 @@ func (s *AgentSupervisor) StderrLines() <-chan string {
 	return s.stderrLines
 }
 
+// Exited returns a channel closed once the agent process has exited, or nil
+// before Start
+func (s *AgentSupervisor) Exited() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exited
+}
+
 // IsRunning returns true if the agent is running
 func (s *AgentSupervisor) IsRunning() bool {
 	s.mu.Lock()
@@ -231,9 +524,10 @@ func (s *AgentSupervisor) LastHeartbeat() time.Time {
 }
 
 func (s *AgentSupervisor) readStdout(ctx context.Context) {
-	defer close(s.events)
-	defer close(s.heartbeats)
-	defer close(s.logs)
+	defer s.eventQueue.close()
+	defer s.heartbeatQueue.close()
+	defer s.logQueue.close()
+	defer s.failHandshake(fmt.Errorf("%s agent exited before completing the protocol handshake", s.agentType))
 
 	for {
 		select {
@@ -247,6 +541,17 @@ func (s *AgentSupervisor) readStdout(ctx context.Context) {
 			s.logger.Info("agent stdout closed", "type", s.agentType)
 			return
 		}
+		var oversize *ndjson.OversizeError
+		if errors.As(err, &oversize) {
+			s.reportOversize(oversize)
+			continue
+		}
+		if errors.Is(err, ndjson.ErrStreamBroken) {
+			s.logger.Error("agent stdout unreadable, stopping reader",
+				"type", s.agentType,
+				"error", err)
+			return
+		}
 		if err != nil {
 			s.logger.Error("failed to decode message from agent",
 				"type", s.agentType,
@@ -254,37 +559,53 @@ func (s *AgentSupervisor) readStdout(ctx context.Context) {
 			continue
 		}
 
+		kind := messageKind(msg)
+		s.observe(kind)
+
+		if err := s.validate(kind); err != nil {
+			s.logger.Error("rejecting message that violates schema",
+				"type", s.agentType,
+				"error", err)
+			if kind == protocol.MessageKindHello {
+				s.failHandshake(fmt.Errorf("protocol handshake with %s agent failed: %w", s.agentType, err))
+			}
+			if evt, ok := msg.(*protocol.Event); ok {
+				s.reportRejected(evt, err)
+			}
+			continue
+		}
+
+		if s.greet(msg) && kind == protocol.MessageKindHello {
+			continue
+		}
+
 		// Route message to appropriate channel
 		switch v := msg.(type) {
 		case *protocol.Event:
-			select {
-			case s.events <- v:
-			case <-ctx.Done():
-				return
+			if v.Event == protocol.EventCancelAcknowledged && s.deliverCancelAck(v) {
+				continue
 			}
+			s.settle(v)
+			s.eventQueue.push(v)
 
 		case *protocol.Heartbeat:
 			s.mu.Lock()
 			s.lastHeartbeat = time.Now()
 			s.mu.Unlock()
+			s.annotateHeartbeat(v)
 
 			s.logger.Debug("received heartbeat",
 				"type", s.agentType,
 				"seq", v.Seq,
 				"status", v.Status)
 
-			select {
-			case s.heartbeats <- v:
-			case <-ctx.Done():
-				return
-			}
+			s.heartbeatQueue.push(v)
 
 		case *protocol.Log:
-			select {
-			case s.logs <- v:
-			case <-ctx.Done():
-				return
-			}
+			s.logQueue.push(v)
+
+		case *protocol.Hello:
+			s.logger.Warn("ignoring hello sent after the handshake", "type", s.agentType)
 
 		default:
 			s.logger.Warn("unexpected message type from agent",
@@ -294,17 +615,148 @@ func (s *AgentSupervisor) readStdout(ctx context.Context) {
 	}
 }
 
+// startQueues creates the message queues and starts delivering them to the
+// channels until ctx ends
+func (s *AgentSupervisor) startQueues(ctx context.Context) {
+	agent := string(s.agentType)
+	s.eventQueue = newMessageQueue[*protocol.Event]("events", agent, false, s.logger)
+	s.heartbeatQueue = newMessageQueue[*protocol.Heartbeat]("heartbeats", agent, true, s.logger)
+	s.logQueue = newMessageQueue[*protocol.Log]("logs", agent, false, s.logger)
+	s.stderrQueue = newMessageQueue[string]("stderr", agent, false, s.logger)
+
+	go s.eventQueue.deliver(s.events, ctx.Done())
+	go s.heartbeatQueue.deliver(s.heartbeats, ctx.Done())
+	go s.logQueue.deliver(s.logs, ctx.Done())
+	go s.stderrQueue.deliver(s.stderrLines, ctx.Done())
+}
+
+// observe hands the raw bytes of the current message to the registered
+// observer, if any
+func (s *AgentSupervisor) observe(kind protocol.MessageKind) {
+	s.mu.Lock()
+	observer := s.observer
+	s.mu.Unlock()
+	if observer == nil {
+		return
+	}
+
+	raw := append([]byte(nil), s.decoder.Raw()...)
+	observer(kind, raw)
+}
+
+// validate checks the raw bytes of the current message against the schema
+// for its kind. It returns an error only when the enforcer is strict.
+func (s *AgentSupervisor) validate(kind protocol.MessageKind) error {
+	s.mu.Lock()
+	enforcer := s.enforcer
+	s.mu.Unlock()
+	name, ok := schema.ForKind(string(kind))
+	if !ok {
+		return nil
+	}
+	return enforcer.Check(string(s.agentType), name, s.decoder.Raw())
+}
+
+// reportOversize stands in for a message that was skipped for exceeding the
+// size limit with an error event naming it, so the ledger records what was
+// lost. Messages that carry no correlation, such as logs, are attributed to
+// the command in flight.
+func (s *AgentSupervisor) reportOversize(e *ndjson.OversizeError) {
+	s.logger.Error("agent sent a message over the size limit",
+		"type", s.agentType,
+		"kind", e.Kind,
+		"message_id", e.MessageID,
+		"size", e.Size,
+		"limit", e.Limit)
+
+	correlationID, taskID := e.CorrelationID, e.TaskID
+	s.mu.Lock()
+	if cmd := s.inflight; cmd != nil && correlationID == "" {
+		correlationID, taskID = cmd.CorrelationID, cmd.TaskID
+	}
+	s.mu.Unlock()
+
+	s.pushError(correlationID, taskID, map[string]any{
+		"code":         protocol.ErrorMessageTooLarge,
+		"message":      fmt.Sprintf("%s agent sent a %d byte message over the %d byte limit; it was dropped", s.agentType, e.Size, e.Limit),
+		"message_kind": e.Kind,
+		"message_id":   e.MessageID,
+		"size":         e.Size,
+		"limit":        e.Limit,
+	})
+}
+
+// reportRejected stands in for an event that strict schema validation
+// rejected with an error event for its command, naming the violating
+// fields, so the command fails instead of waiting for an outcome that was
+// dropped. Events without a correlation ID answer no command and are only
+// logged.
+func (s *AgentSupervisor) reportRejected(evt *protocol.Event, err error) {
+	if evt.CorrelationID == "" {
+		return
+	}
+	var violations []any
+	var violation *schema.ViolationError
+	if errors.As(err, &violation) {
+		for _, v := range violation.Violations {
+			violations = append(violations, map[string]any{"path": v.Path, "message": v.Message})
+		}
+	}
+	s.pushError(evt.CorrelationID, evt.TaskID, map[string]any{
+		"code":         protocol.ErrorSchemaViolation,
+		"message":      fmt.Sprintf("%s agent sent a %s event that violates the schema; it was dropped: %v", s.agentType, evt.Event, err),
+		"message_kind": protocol.MessageKindEvent,
+		"message_id":   evt.MessageID,
+		"violations":   violations,
+	})
+}
+
+// pushError delivers an error event raised by lorch on the agent's behalf
+func (s *AgentSupervisor) pushError(correlationID, taskID string, payload map[string]any) {
+	evt := &protocol.Event{
+		Kind:          protocol.MessageKindEvent,
+		MessageID:     uuid.New().String(),
+		CorrelationID: correlationID,
+		TaskID:        taskID,
+		From:          protocol.AgentRef{AgentType: s.agentType},
+		Event:         protocol.EventError,
+		Status:        "failed",
+		Payload:       payload,
+		OccurredAt:    time.Now().UTC(),
+	}
+	s.settle(evt)
+	s.eventQueue.push(evt)
+}
+
+func messageKind(msg any) protocol.MessageKind {
+	switch msg.(type) {
+	case *protocol.Command:
+		return protocol.MessageKindCommand
+	case *protocol.Event:
+		return protocol.MessageKindEvent
+	case *protocol.Heartbeat:
+		return protocol.MessageKindHeartbeat
+	case *protocol.Log:
+		return protocol.MessageKindLog
+	case *protocol.Hello:
+		return protocol.MessageKindHello
+	case *protocol.HelloAck:
+		return protocol.MessageKindHelloAck
+	}
+	return ""
+}
+
 func (s *AgentSupervisor) readStderr(ctx context.Context) {
 	s.mu.Lock()
 	stderr := s.stderr
 	s.mu.Unlock()
 
+	defer s.stderrQueue.close()
+
 	if stderr == nil {
 		return
 	}
 
-	defer close(s.stderrLines)
-
 	// Use a scanner to read line-by-line
 	scanner := bufio.NewScanner(stderr)
 	// Set a larger buffer size to handle long lines
@@ -324,15 +776,8 @@ func (s *AgentSupervisor) readStderr(ctx context.Context) {
 			"type", s.agentType,
 			"line", line)
 
-		// Send line to channel for CLI consumption
-		select {
-		case s.stderrLines <- line:
-		case <-ctx.Done():
-			return
-		default:
-			// If channel is full, skip (shouldn't happen with buffered channel)
-			s.logger.Warn("stderr channel full, dropping line", "type", s.agentType)
-		}
+		// Queue line for CLI consumption
+		s.stderrQueue.push(line)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -345,18 +790,24 @@ func (s *AgentSupervisor) readStderr(ctx context.Context) {
 func (s *AgentSupervisor) waitForExit(ctx context.Context) {
 	s.mu.Lock()
 	proc := s.process
+	wait := s.wait
 	exitChan := s.exitChan
+	exited := s.exited
 	s.mu.Unlock()
 
-	if proc == nil {
+	if wait == nil {
 		return
 	}
 
-	err := proc.Wait()
+	err := wait()
+	s.noteOOMKill()
 
 	s.mu.Lock()
 	s.running = false
 	s.mu.Unlock()
+	if exited != nil {
+		close(exited)
+	}
 
 	// Send the exit result to the channel for Stop() to receive
 	if exitChan != nil {
@@ -371,4 +822,9 @@ func (s *AgentSupervisor) waitForExit(ctx context.Context) {
 		s.logger.Info("agent process exited cleanly",
 			"type", s.agentType)
 	}
+
+	if proc != nil {
+		s.stopStragglers(proc.Process.Pid)
+	}
+	s.releaseResources()
 }
@@ -5,15 +5,26 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/internal/schema"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
+func TestMain(m *testing.M) {
+	// Sandbox tests start agents through this test binary
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
 func TestSupervisorStartStop(t *testing.T) {
 	// Build mock agent if not already built
 	mockAgentPath, err := buildMockAgent(t)
@@ -285,3 +296,644 @@ func buildMockAgent(t *testing.T) (string, error) {
 
 	return mockAgentPath, nil
 }
+
+func TestSupervisorStrictSchemaRejectsInvalidMessages(t *testing.T) {
+	validator, err := schema.Default()
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The first log has an unknown level; the second is valid
+	script := `echo '{"kind":"log","level":"loud","message":"bad","timestamp":"2025-10-20T14:08:18Z"}'
+echo '{"kind":"log","level":"info","message":"good","timestamp":"2025-10-20T14:08:18Z"}'
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	enforcer := schema.NewEnforcer(validator, schema.ModeStrict, logger)
+	var findings []schema.Finding
+	var mu sync.Mutex
+	enforcer.SetRecorder(func(f schema.Finding) {
+		mu.Lock()
+		defer mu.Unlock()
+		findings = append(findings, f)
+	})
+	sup.SetSchemaEnforcer(enforcer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	select {
+	case log := <-sup.Logs():
+		if log.Message != "good" {
+			t.Fatalf("expected only the valid log to be delivered, got %q", log.Message)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for log")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(findings) != 1 {
+		t.Fatalf("expected 1 finding, got %d", len(findings))
+	}
+	f := findings[0]
+	if f.Schema != schema.Log || f.Source != "builder" || !f.Rejected {
+		t.Errorf("unexpected finding: %+v", f)
+	}
+	if len(f.Violations) != 1 || f.Violations[0].Path != "$.level" {
+		t.Errorf("expected a $.level violation, got %v", f.Violations)
+	}
+}
+
+func TestSupervisorStrictSchemaFailsRejectedEventsCommand(t *testing.T) {
+	validator, err := schema.Default()
+	if err != nil {
+		t.Fatalf("failed to load schemas: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The builder's outcome for c-1 names an unknown agent type
+	script := `echo '{"kind":"hello","agent":{"agent_type":"builder"},"protocol_versions":[1],"max_message_bytes":4096,"capabilities":{"streaming_progress":false,"cancellation":false}}'
+read ack
+echo '{"kind":"event","message_id":"e-bad","correlation_id":"c-1","task_id":"T-1","from":{"agent_type":"wizard"},"event":"builder.completed","status":"success","payload":{},"occurred_at":"2025-10-20T14:08:18Z"}'
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+	sup.SetSchemaEnforcer(schema.NewEnforcer(validator, schema.ModeStrict, logger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	select {
+	case evt := <-sup.Events():
+		if evt.Event != protocol.EventError || evt.CorrelationID != "c-1" || evt.TaskID != "T-1" {
+			t.Fatalf("expected an error event for c-1, got %+v", evt)
+		}
+		if evt.Payload["code"] != protocol.ErrorSchemaViolation || evt.Payload["message_id"] != "e-bad" {
+			t.Errorf("unexpected error payload: %v", evt.Payload)
+		}
+		violations, _ := evt.Payload["violations"].([]any)
+		if len(violations) != 1 || violations[0].(map[string]any)["path"] != "$.from.agent_type" {
+			t.Errorf("expected a $.from.agent_type violation, got %v", evt.Payload["violations"])
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the error event")
+	}
+}
+
+func TestSupervisorHandshake(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Send a hello, then echo whatever lorch answers as a log message
+	script := `echo '{"kind":"hello","agent":{"agent_type":"builder"},"protocol_versions":[1],"supported_actions":["implement"],"max_message_bytes":4096,"capabilities":{"streaming_progress":true,"cancellation":false}}'
+read ack
+echo "{\"kind\":\"log\",\"level\":\"info\",\"message\":\"ack\",\"fields\":{\"ack\":$ack},\"timestamp\":\"2025-10-20T14:08:18Z\"}"
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	n := sup.Negotiation()
+	if n == nil {
+		t.Fatal("expected a negotiation after Start")
+	}
+	if n.ProtocolVersion != 1 || n.MaxMessageBytes != 4096 || n.Legacy {
+		t.Errorf("unexpected negotiation: %+v", n)
+	}
+	if !n.Capabilities.StreamingProgress || n.Capabilities.Cancellation {
+		t.Errorf("unexpected capabilities: %+v", n.Capabilities)
+	}
+
+	select {
+	case log := <-sup.Logs():
+		ack, ok := log.Fields["ack"].(map[string]any)
+		if !ok {
+			t.Fatalf("expected the agent to echo a hello_ack, got %v", log.Fields)
+		}
+		if ack["kind"] != "hello_ack" || ack["accepted"] != true || ack["protocol_version"] != float64(1) {
+			t.Errorf("unexpected hello_ack: %v", ack)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for hello_ack echo")
+	}
+
+	err := sup.SendCommand(&protocol.Command{
+		Kind:   protocol.MessageKindCommand,
+		TaskID: "T-1",
+		Action: protocol.ActionReview,
+	})
+	if err == nil {
+		t.Error("expected SendCommand to refuse an undeclared action")
+	}
+}
+
+func TestSupervisorConfiguredMessageLimit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ndjson.SetDefaultLimit(8192)
+	defer ndjson.SetDefaultLimit(0)
+
+	// The agent would accept 1 MiB, then sends an event over lorch's limit
+	// followed by one under it
+	script := `echo '{"kind":"hello","agent":{"agent_type":"builder"},"protocol_versions":[1],"max_message_bytes":1048576,"capabilities":{"streaming_progress":false,"cancellation":false}}'
+read ack
+pad=$(head -c 9000 /dev/zero | tr '\0' x)
+echo "{\"kind\":\"event\",\"message_id\":\"e-big\",\"correlation_id\":\"c-1\",\"task_id\":\"T-1\",\"from\":{\"agent_type\":\"builder\"},\"event\":\"builder.completed\",\"status\":\"success\",\"payload\":{\"pad\":\"$pad\"},\"occurred_at\":\"2025-10-20T14:08:18Z\"}"
+echo '{"kind":"event","message_id":"e-2","correlation_id":"c-2","task_id":"T-1","from":{"agent_type":"builder"},"event":"builder.progress","status":"success","payload":{},"occurred_at":"2025-10-20T14:08:18Z"}'
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	if n := sup.Negotiation(); n == nil || n.MaxMessageBytes != 8192 {
+		t.Fatalf("expected the configured limit to be negotiated, got %+v", n)
+	}
+
+	next := func() *protocol.Event {
+		select {
+		case evt := <-sup.Events():
+			return evt
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+			return nil
+		}
+	}
+
+	evt := next()
+	if evt.Event != protocol.EventError || evt.CorrelationID != "c-1" || evt.TaskID != "T-1" {
+		t.Fatalf("expected an error event for the oversize message, got %+v", evt)
+	}
+	if evt.Payload["code"] != protocol.ErrorMessageTooLarge || evt.Payload["message_id"] != "e-big" || evt.Payload["limit"] != 8192 {
+		t.Errorf("unexpected error payload: %v", evt.Payload)
+	}
+
+	if evt := next(); evt.MessageID != "e-2" {
+		t.Errorf("expected the stream to continue with e-2, got %s", evt.MessageID)
+	}
+}
+
+func TestSupervisorHandshakeRefusesIncompatibleAgent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	script := `echo '{"kind":"hello","agent":{"agent_type":"builder"},"protocol_versions":[99],"capabilities":{"streaming_progress":false,"cancellation":false}}'
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := sup.Start(ctx)
+	if err == nil {
+		sup.Stop(context.Background())
+		t.Fatal("expected Start to fail for an agent with no common protocol version")
+	}
+	if !strings.Contains(err.Error(), "protocol versions [99]") {
+		t.Errorf("error should name the agent's versions, got: %v", err)
+	}
+	if sup.IsRunning() {
+		t.Error("refused agent should not be left running")
+	}
+}
+
+func TestSupervisorHandshakeRoleMismatch(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	script := `echo '{"kind":"hello","agent":{"agent_type":"reviewer"},"protocol_versions":[1],"capabilities":{"streaming_progress":false,"cancellation":false}}'
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := sup.Start(ctx)
+	if err == nil {
+		sup.Stop(context.Background())
+		t.Fatal("expected Start to fail when the agent declares another role")
+	}
+	if !strings.Contains(err.Error(), "declared role reviewer") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSupervisorLegacyAgent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// An agent that predates the handshake opens with a heartbeat
+	script := `echo '{"kind":"heartbeat","agent":{"agent_type":"builder"},"seq":1,"status":"starting","pid":1,"ppid":1,"uptime_s":0,"last_activity_at":"2025-10-20T14:08:18Z"}'
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start legacy agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	n := sup.Negotiation()
+	if n == nil || !n.Legacy || n.ProtocolVersion != 1 {
+		t.Fatalf("expected a legacy v1 negotiation, got %+v", n)
+	}
+
+	select {
+	case hb := <-sup.Heartbeats():
+		if hb.Seq != 1 {
+			t.Errorf("expected the opening heartbeat to be delivered, got seq %d", hb.Seq)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for heartbeat")
+	}
+}
+
+func TestSupervisorSilentAgentAssumedLegacy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"cat"}, nil, logger)
+	sup.SetHandshakeTimeout(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start silent agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	if n := sup.Negotiation(); n == nil || !n.Legacy {
+		t.Fatalf("expected a legacy negotiation after the handshake timeout, got %+v", n)
+	}
+}
+
+// cancellableHello is a hello from a builder that declares cancellation
+const cancellableHello = `{"kind":"hello","agent":{"agent_type":"builder"},"protocol_versions":[1],"capabilities":{"streaming_progress":false,"cancellation":true}}`
+
+func cancelTestCommand() *protocol.Command {
+	return &protocol.Command{
+		Kind:          protocol.MessageKindCommand,
+		MessageID:     uuid.New().String(),
+		CorrelationID: "corr-cancel-1",
+		TaskID:        "T-1",
+		Action:        protocol.ActionImplement,
+	}
+}
+
+func TestSupervisorCancelAcknowledged(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Read the hello_ack, the command and the cancel, then acknowledge
+	script := `echo '` + cancellableHello + `'
+read ack
+read cmd
+read cancel
+case "$cancel" in *'"kind":"cancel"'*) ;; *) exit 1 ;; esac
+echo '{"kind":"event","message_id":"e-ack","correlation_id":"corr-cancel-1","task_id":"T-1","from":{"agent_type":"builder"},"event":"cancel.acknowledged","status":"cancelled","payload":{},"occurred_at":"2025-10-20T14:08:18Z"}'
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	if err := sup.SendCommand(cancelTestCommand()); err != nil {
+		t.Fatalf("failed to send command: %v", err)
+	}
+
+	outcome := sup.Cancel("interrupted")
+	if outcome == nil {
+		t.Fatal("expected a cancel outcome")
+	}
+	if !outcome.Acknowledged || outcome.AckStatus != protocol.CancelStatusCancelled || outcome.AckMessageID != "e-ack" {
+		t.Errorf("expected an acknowledged cancel, got %+v", outcome)
+	}
+	if outcome.Escalation != "" {
+		t.Errorf("acknowledged cancel should not escalate, got %q", outcome.Escalation)
+	}
+	if outcome.CorrelationID != "corr-cancel-1" || outcome.Reason != "interrupted" {
+		t.Errorf("unexpected outcome: %+v", outcome)
+	}
+	if !sup.IsRunning() {
+		t.Error("agent should keep running after acknowledging a cancel")
+	}
+
+	select {
+	case evt := <-sup.Events():
+		t.Errorf("acknowledgement should not be delivered as an event, got %s", evt.Event)
+	default:
+	}
+
+	if again := sup.Cancel("interrupted"); again != nil {
+		t.Errorf("nothing should be left to cancel, got %+v", again)
+	}
+}
+
+func TestSupervisorCancelEscalatesToSIGKILL(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Ignore SIGTERM and never acknowledge
+	script := `trap '' TERM
+echo '` + cancellableHello + `'
+exec cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+	sup.SetCancelGracePeriod(100 * time.Millisecond)
+	sup.SetTerminateGracePeriod(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	if err := sup.SendCommand(cancelTestCommand()); err != nil {
+		t.Fatalf("failed to send command: %v", err)
+	}
+
+	outcome := sup.Cancel("deadline exceeded")
+	if outcome == nil {
+		t.Fatal("expected a cancel outcome")
+	}
+	if outcome.Acknowledged {
+		t.Error("agent never acknowledged")
+	}
+	if outcome.Escalation != protocol.EscalationSIGKILL {
+		t.Errorf("expected escalation to SIGKILL, got %q", outcome.Escalation)
+	}
+	if sup.IsRunning() {
+		t.Error("agent should have been killed")
+	}
+}
+
+func TestSupervisorCancelAfterTerminalEventIsNoop(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Complete the command, then exit on anything else (such as a cancel)
+	script := `echo '` + cancellableHello + `'
+read ack
+read cmd
+echo '{"kind":"event","message_id":"e-done","correlation_id":"corr-cancel-1","task_id":"T-1","from":{"agent_type":"builder"},"event":"builder.completed","status":"success","payload":{},"occurred_at":"2025-10-20T14:08:18Z"}'
+read extra
+exit 1`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	if err := sup.SendCommand(cancelTestCommand()); err != nil {
+		t.Fatalf("failed to send command: %v", err)
+	}
+
+	select {
+	case evt := <-sup.Events():
+		if evt.Event != protocol.EventBuilderCompleted {
+			t.Fatalf("expected builder.completed, got %s", evt.Event)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the terminal event")
+	}
+
+	if outcome := sup.Cancel("interrupted"); outcome != nil {
+		t.Errorf("a completed command should not be cancelled, got %+v", outcome)
+	}
+	if !sup.IsRunning() {
+		t.Error("agent should keep running when there is nothing to cancel")
+	}
+}
+
+func TestSupervisorCancelWithoutCapabilitySendsSIGTERM(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// A legacy agent: no hello, so no cancellation capability
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"cat"}, nil, logger)
+	sup.SetHandshakeTimeout(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	if err := sup.SendCommand(cancelTestCommand()); err != nil {
+		t.Fatalf("failed to send command: %v", err)
+	}
+
+	outcome := sup.Cancel("interrupted")
+	if outcome == nil || outcome.Acknowledged || outcome.Escalation != protocol.EscalationSIGTERM {
+		t.Fatalf("expected SIGTERM without a cancel message, got %+v", outcome)
+	}
+}
+
+func TestSupervisorContextCancelStopsAgent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"cat"}, nil, logger)
+	sup.SetHandshakeTimeout(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sup.IsRunning() {
+		if time.Now().After(deadline) {
+			t.Fatal("agent still running after its context was cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitGone polls until check reports false or the deadline passes
+func waitGone(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s still running", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSupervisorRunsAgentInOwnProcessGroup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The agent leaves a grandchild behind when its stdin closes
+	script := `sleep 300 &
+echo "child $!" >&2
+cat >/dev/null`
+
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"sh", "-c", script}, nil, logger)
+	sup.SetHandshakeTimeout(50 * time.Millisecond)
+	sup.SetTerminateGracePeriod(500 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+
+	info, ok := sup.Process()
+	if !ok {
+		t.Fatal("expected process info for a running agent")
+	}
+	if info.PID <= 0 || info.PGID != info.PID {
+		t.Errorf("agent should lead its own process group, got %+v", info)
+	}
+	if !Survives(info) {
+		t.Error("running agent should be reported as surviving")
+	}
+
+	var child int
+	select {
+	case line := <-sup.StderrLines():
+		if _, err := fmt.Sscanf(line, "child %d", &child); err != nil {
+			t.Fatalf("unexpected stderr line %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent never reported its child")
+	}
+
+	if err := sup.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if _, ok := sup.Process(); ok {
+		t.Error("stopped agent should report no process")
+	}
+
+	waitGone(t, "grandchild", func() bool { return processAlive(child) })
+	waitGone(t, "process group", func() bool { return Survives(info) })
+}
+
+func TestReapOrphan(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	orphan := exec.Command("sh", "-c", "sleep 300 & wait")
+	setProcessGroup(orphan)
+	if err := orphan.Start(); err != nil {
+		t.Fatalf("failed to start orphan: %v", err)
+	}
+	go orphan.Wait()
+
+	info := ProcessInfo{PID: orphan.Process.Pid, PGID: orphan.Process.Pid}
+	info.StartTicks, _ = processStartTicks(info.PID)
+
+	if !Survives(info) {
+		t.Fatal("orphan should survive until reaped")
+	}
+
+	if got := ReapOrphan(context.Background(), info, 2*time.Second, logger); got != protocol.EscalationSIGTERM {
+		t.Errorf("expected orphan to stop on SIGTERM, got %q", got)
+	}
+	if Survives(info) {
+		t.Error("orphan group still running after reap")
+	}
+	if got := ReapOrphan(context.Background(), info, time.Second, logger); got != "" {
+		t.Errorf("reaping a finished group should do nothing, got %q", got)
+	}
+}
+
+func TestSurvivesIgnoresReusedPID(t *testing.T) {
+	self := ProcessInfo{PID: os.Getpid(), PGID: os.Getpid()}
+	if ticks, ok := processStartTicks(self.PID); ok {
+		self.StartTicks = ticks + 1
+	} else {
+		pgid, err := processGroup(self.PID)
+		if err != nil {
+			t.Fatalf("processGroup failed: %v", err)
+		}
+		self.PGID = pgid + 1
+	}
+	if Survives(self) {
+		t.Error("a live PID with a different identity is not a survivor")
+	}
+}
+
+func TestSupervisorWorkDir(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The agent reports its working directory; its command path is relative
+	// to lorch's working directory, not the agent's
+	lorchDir := t.TempDir()
+	script := `#!/bin/sh
+echo "{\"kind\":\"log\",\"level\":\"info\",\"message\":\"$(pwd -P)\",\"timestamp\":\"2025-10-20T14:08:18Z\"}"
+cat >/dev/null
+`
+	if err := os.MkdirAll(filepath.Join(lorchDir, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lorchDir, "bin", "agent.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(lorchDir)
+
+	workDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := NewAgentSupervisor(protocol.AgentTypeBuilder, []string{"./bin/agent.sh"}, nil, logger)
+	sup.SetWorkDir(workDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sup.Start(ctx); err != nil {
+		t.Fatalf("failed to start agent: %v", err)
+	}
+	defer sup.Stop(context.Background())
+
+	select {
+	case log := <-sup.Logs():
+		if log.Message != workDir {
+			t.Errorf("agent ran in %s, want %s", log.Message, workDir)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for log")
+	}
+}
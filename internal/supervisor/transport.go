@@ -0,0 +1,172 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Transport connects an AgentSupervisor to its agent. Without one, the
+// supervisor starts the agent as a child process and speaks NDJSON over its
+// stdin and stdout.
+type Transport interface {
+	// Connect reaches the agent and returns the connection to it
+	Connect(ctx context.Context) (*Conn, error)
+}
+
+// Conn is an open NDJSON connection to an agent
+type Conn struct {
+	// Writer carries lorch's messages; closing it tells the agent lorch is
+	// done with it
+	Writer io.WriteCloser
+	// Reader carries the agent's messages; closing it drops the connection
+	Reader io.ReadCloser
+	// Stderr is the agent's diagnostic output, nil if there is none
+	Stderr io.ReadCloser
+	// Wait blocks until the agent has exited or disconnected
+	Wait func() error
+
+	// process is set when lorch started the agent as its child
+	process *exec.Cmd
+}
+
+// SetTransport makes the supervisor reach its agent through t instead of
+// starting a child process. Resource limits and sandboxing only apply to
+// agents lorch starts itself. Call it before Start.
+func (s *AgentSupervisor) SetTransport(t Transport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transport = t
+}
+
+// connect opens the agent connection through the configured transport, or
+// by starting the agent command
+func (s *AgentSupervisor) connect(ctx context.Context) (*Conn, error) {
+	s.mu.Lock()
+	t := s.transport
+	s.mu.Unlock()
+	if t != nil {
+		return t.Connect(ctx)
+	}
+	return s.spawn()
+}
+
+// spawn starts the agent command as a child process in its own process
+// group, sandboxed if configured, connected through its stdio pipes
+func (s *AgentSupervisor) spawn() (*Conn, error) {
+	// Cancellation of the Start context is handled by watchContext, which
+	// cancels the in-flight command before escalating to signals.
+	s.mu.Lock()
+	sandbox := s.sandbox
+	workDir := s.workDir
+	s.mu.Unlock()
+
+	name := s.cmd[0]
+	if workDir != "" && strings.ContainsRune(name, filepath.Separator) && !filepath.IsAbs(name) {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s agent command: %w", s.agentType, err)
+		}
+		name = abs
+	}
+	proc := exec.Command(name, s.cmd[1:]...)
+	proc.Dir = workDir
+	setProcessGroup(proc)
+	proc.Env = s.environ()
+
+	// A sandboxed agent is started through lorch's sandbox init process;
+	// sandboxReady reports whether it managed to set the sandbox up
+	var sandboxReady func() error
+	if sandbox != nil {
+		ready, err := prepareSandbox(proc, *sandbox)
+		if err != nil {
+			return nil, fmt.Errorf("cannot sandbox %s agent: %w", s.agentType, err)
+		}
+		sandboxReady = ready
+	}
+
+	// Setup pipes
+	stdin, err := proc.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := proc.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	stderr, err := proc.StderrPipe()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	// Start process
+	if err := proc.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		stderr.Close()
+		if sandboxReady != nil {
+			sandboxReady()
+		}
+		return nil, fmt.Errorf("failed to start process: %w", err)
+	}
+
+	if sandboxReady != nil {
+		if err := sandboxReady(); err != nil {
+			proc.Process.Kill()
+			proc.Wait()
+			return nil, fmt.Errorf("cannot sandbox %s agent: %w", s.agentType, err)
+		}
+		s.logger.Info("agent sandboxed",
+			"type", s.agentType,
+			"workspace", sandbox.Workspace,
+			"read_only", sandbox.ReadOnly,
+			"network", sandbox.Network)
+	}
+
+	return &Conn{
+		Writer:  stdin,
+		Reader:  stdout,
+		Stderr:  stderr,
+		Wait:    proc.Wait,
+		process: proc,
+	}, nil
+}
+
+// hangUp drops the connection to an agent lorch did not start, which is
+// how such an agent is stopped
+func (s *AgentSupervisor) hangUp() {
+	s.mu.Lock()
+	stdin := s.stdin
+	stdout := s.stdout
+	s.mu.Unlock()
+
+	if stdin != nil {
+		stdin.Close()
+	}
+	if stdout != nil {
+		stdout.Close()
+	}
+}
+
+// forceStop kills the agent's process group, or hangs up on an agent lorch
+// did not start
+func (s *AgentSupervisor) forceStop() {
+	s.mu.Lock()
+	proc := s.process
+	s.mu.Unlock()
+
+	if proc != nil && proc.Process != nil {
+		signalGroup(proc.Process.Pid, syscall.SIGKILL)
+		return
+	}
+	s.hangUp()
+}
@@ -0,0 +1,109 @@
+package taskgraph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Failure is a task that ran and failed
+type Failure struct {
+	Task string
+	Err  error
+}
+
+// Skip is a task that did not run because Prerequisite did not complete
+type Skip struct {
+	Task         string
+	Prerequisite string
+}
+
+// IncompleteError reports the tasks Execute could not complete
+type IncompleteError struct {
+	Failed  []Failure
+	Skipped []Skip
+}
+
+func (e *IncompleteError) Error() string {
+	var parts []string
+	for _, f := range e.Failed {
+		parts = append(parts, fmt.Sprintf("task %s failed: %v", f.Task, f.Err))
+	}
+	for _, s := range e.Skipped {
+		parts = append(parts, fmt.Sprintf("task %s skipped: prerequisite %s did not complete", s.Task, s.Prerequisite))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap returns the errors of the failed tasks
+func (e *IncompleteError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// Execute runs tasks one at a time in dependency order. When a task fails,
+// every task that depends on it, directly or not, is skipped and reported
+// to skipped (which may be nil), while tasks that do not depend on it still
+// run. Prerequisites that are not in ids count as done. Execute stops early
+// only when ctx is cancelled, returning ctx's error; otherwise a run with
+// failed or skipped tasks returns an *IncompleteError.
+func Execute(ctx context.Context, ids []string, deps map[string][]string, run func(ctx context.Context, id string) error, skipped func(Skip)) error {
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	pending := make(map[string][]string, len(deps))
+	for _, id := range ids {
+		for _, dep := range deps[id] {
+			if known[dep] {
+				pending[id] = append(pending[id], dep)
+			}
+		}
+	}
+	order, err := Sort(ids, pending)
+	if err != nil {
+		return err
+	}
+
+	incomplete := &IncompleteError{}
+	done := make(map[string]bool, len(order))
+	for _, id := range order {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if dep := unmet(pending[id], done); dep != "" {
+			skip := Skip{Task: id, Prerequisite: dep}
+			incomplete.Skipped = append(incomplete.Skipped, skip)
+			if skipped != nil {
+				skipped(skip)
+			}
+			continue
+		}
+		if err := run(ctx, id); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			incomplete.Failed = append(incomplete.Failed, Failure{Task: id, Err: err})
+			continue
+		}
+		done[id] = true
+	}
+
+	if len(incomplete.Failed) > 0 || len(incomplete.Skipped) > 0 {
+		return incomplete
+	}
+	return nil
+}
+
+// unmet returns the first prerequisite that is not done
+func unmet(deps []string, done map[string]bool) string {
+	for _, dep := range deps {
+		if !done[dep] {
+			return dep
+		}
+	}
+	return ""
+}
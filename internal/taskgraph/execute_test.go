@@ -0,0 +1,91 @@
+package taskgraph
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExecuteRunsInDependencyOrder(t *testing.T) {
+	var ran []string
+	err := Execute(context.Background(), []string{"T-2", "T-1", "T-3"}, map[string][]string{"T-2": {"T-1"}},
+		func(_ context.Context, id string) error {
+			ran = append(ran, id)
+			return nil
+		}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"T-1", "T-2", "T-3"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran = %v, want %v", ran, want)
+	}
+}
+
+func TestExecuteSkipsDependentsOfFailedTask(t *testing.T) {
+	deps := map[string][]string{
+		"T-2": {"T-1"},
+		"T-3": {"T-2"},
+	}
+	boom := errors.New("boom")
+	var ran []string
+	var skips []Skip
+	err := Execute(context.Background(), []string{"T-1", "T-2", "T-3", "T-4"}, deps,
+		func(_ context.Context, id string) error {
+			ran = append(ran, id)
+			if id == "T-1" {
+				return boom
+			}
+			return nil
+		},
+		func(s Skip) { skips = append(skips, s) })
+
+	if want := []string{"T-1", "T-4"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran = %v, want %v", ran, want)
+	}
+	wantSkips := []Skip{{Task: "T-2", Prerequisite: "T-1"}, {Task: "T-3", Prerequisite: "T-2"}}
+	if !reflect.DeepEqual(skips, wantSkips) {
+		t.Errorf("skips = %v, want %v", skips, wantSkips)
+	}
+
+	var incomplete *IncompleteError
+	if !errors.As(err, &incomplete) {
+		t.Fatalf("expected an incomplete error, got %v", err)
+	}
+	if !errors.Is(err, boom) {
+		t.Errorf("error should wrap the task's failure")
+	}
+	if want := "task T-1 failed: boom; task T-2 skipped: prerequisite T-1 did not complete; task T-3 skipped: prerequisite T-2 did not complete"; err.Error() != want {
+		t.Errorf("message = %q", err.Error())
+	}
+}
+
+func TestExecuteTreatsOutsidePrerequisitesAsDone(t *testing.T) {
+	var ran []string
+	err := Execute(context.Background(), []string{"T-2"}, map[string][]string{"T-2": {"T-1"}},
+		func(_ context.Context, id string) error {
+			ran = append(ran, id)
+			return nil
+		}, nil)
+	if err != nil || !reflect.DeepEqual(ran, []string{"T-2"}) {
+		t.Fatalf("ran = %v, err = %v", ran, err)
+	}
+}
+
+func TestExecuteStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var ran []string
+	err := Execute(ctx, []string{"T-1", "T-2"}, nil,
+		func(ctx context.Context, id string) error {
+			ran = append(ran, id)
+			cancel()
+			return ctx.Err()
+		}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"T-1"}) {
+		t.Errorf("ran = %v, want [T-1]", ran)
+	}
+}
@@ -0,0 +1,159 @@
+// Package taskgraph orders the tasks of a run by their depends_on
+// prerequisites: topologically, with cycle detection, keeping the given
+// order between tasks that do not depend on each other.
+package taskgraph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CycleError reports tasks that depend on each other in a loop
+type CycleError struct {
+	// Cycle lists the tasks around the loop, starting and ending with the
+	// same task
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// MissingDependencyError reports a prerequisite that is not among the tasks
+type MissingDependencyError struct {
+	Task       string
+	Dependency string
+}
+
+func (e *MissingDependencyError) Error() string {
+	return fmt.Sprintf("task %s depends on unknown task %s", e.Task, e.Dependency)
+}
+
+// Sort returns ids ordered so that every task comes after the tasks it
+// depends on. Tasks that do not depend on each other keep their order in
+// ids. deps maps a task to its prerequisites, which must all be in ids.
+func Sort(ids []string, deps map[string][]string) ([]string, error) {
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	for _, id := range ids {
+		for _, dep := range deps[id] {
+			if !known[dep] {
+				return nil, &MissingDependencyError{Task: id, Dependency: dep}
+			}
+		}
+	}
+
+	// Repeatedly take the first task whose prerequisites are all placed
+	placed := make(map[string]bool, len(ids))
+	order := make([]string, 0, len(ids))
+	for len(order) < len(ids) {
+		progress := false
+		for _, id := range ids {
+			if placed[id] || !ready(id, deps, placed) {
+				continue
+			}
+			placed[id] = true
+			order = append(order, id)
+			progress = true
+			break
+		}
+		if !progress {
+			return nil, &CycleError{Cycle: findCycle(ids, deps, placed)}
+		}
+	}
+	return order, nil
+}
+
+// Waves groups ids into waves whose tasks only depend on tasks of earlier
+// waves, so each wave's tasks can run side by side. Within a wave tasks
+// keep their order in ids.
+func Waves(ids []string, deps map[string][]string) ([][]string, error) {
+	order, err := Sort(ids, deps)
+	if err != nil {
+		return nil, err
+	}
+	level := make(map[string]int, len(order))
+	var waves [][]string
+	for _, id := range order {
+		n := 0
+		for _, dep := range deps[id] {
+			if level[dep]+1 > n {
+				n = level[dep] + 1
+			}
+		}
+		level[id] = n
+		if n == len(waves) {
+			waves = append(waves, nil)
+		}
+	}
+	for _, id := range ids {
+		waves[level[id]] = append(waves[level[id]], id)
+	}
+	return waves, nil
+}
+
+// Closure returns id and everything it depends on, directly or not, in the
+// order of Sort
+func Closure(id string, ids []string, deps map[string][]string) ([]string, error) {
+	order, err := Sort(ids, deps)
+	if err != nil {
+		return nil, err
+	}
+	needed := map[string]bool{id: true}
+	stack := []string{id}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, dep := range deps[next] {
+			if !needed[dep] {
+				needed[dep] = true
+				stack = append(stack, dep)
+			}
+		}
+	}
+	var closure []string
+	for _, task := range order {
+		if needed[task] {
+			closure = append(closure, task)
+		}
+	}
+	return closure, nil
+}
+
+func ready(id string, deps map[string][]string, placed map[string]bool) bool {
+	for _, dep := range deps[id] {
+		if !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle follows unplaced prerequisites from the first unplaced task
+// until a task repeats; every unplaced task has one, or it would be ready
+func findCycle(ids []string, deps map[string][]string, placed map[string]bool) []string {
+	var start string
+	for _, id := range ids {
+		if !placed[id] {
+			start = id
+			break
+		}
+	}
+	seen := map[string]int{}
+	var path []string
+	for id := start; ; {
+		if at, ok := seen[id]; ok {
+			return append(path[at:], id)
+		}
+		seen[id] = len(path)
+		path = append(path, id)
+		for _, dep := range deps[id] {
+			if !placed[dep] {
+				id = dep
+				break
+			}
+		}
+	}
+}
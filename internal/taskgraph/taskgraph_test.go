@@ -0,0 +1,96 @@
+package taskgraph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSortKeepsIndependentOrder(t *testing.T) {
+	order, err := Sort([]string{"T-3", "T-1", "T-2"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"T-3", "T-1", "T-2"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestSortPlacesPrerequisitesFirst(t *testing.T) {
+	deps := map[string][]string{
+		"T-101": {"T-100"},
+		"T-102": {"T-101", "T-100"},
+	}
+	order, err := Sort([]string{"T-102", "T-101", "T-100", "T-200"}, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"T-100", "T-101", "T-102", "T-200"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestSortDetectsCycle(t *testing.T) {
+	deps := map[string][]string{
+		"T-1": {"T-3"},
+		"T-2": {"T-1"},
+		"T-3": {"T-2"},
+	}
+	_, err := Sort([]string{"T-0", "T-1", "T-2", "T-3"}, deps)
+	var cycle *CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	if want := []string{"T-1", "T-3", "T-2", "T-1"}; !reflect.DeepEqual(cycle.Cycle, want) {
+		t.Errorf("cycle = %v, want %v", cycle.Cycle, want)
+	}
+	if err.Error() != "dependency cycle: T-1 -> T-3 -> T-2 -> T-1" {
+		t.Errorf("message = %q", err.Error())
+	}
+}
+
+func TestSortDetectsSelfDependency(t *testing.T) {
+	_, err := Sort([]string{"T-1"}, map[string][]string{"T-1": {"T-1"}})
+	var cycle *CycleError
+	if !errors.As(err, &cycle) || !reflect.DeepEqual(cycle.Cycle, []string{"T-1", "T-1"}) {
+		t.Fatalf("expected T-1 -> T-1, got %v", err)
+	}
+}
+
+func TestSortRejectsUnknownDependency(t *testing.T) {
+	_, err := Sort([]string{"T-1"}, map[string][]string{"T-1": {"T-9"}})
+	var missing *MissingDependencyError
+	if !errors.As(err, &missing) || missing.Task != "T-1" || missing.Dependency != "T-9" {
+		t.Fatalf("expected a missing dependency error, got %v", err)
+	}
+}
+
+func TestWaves(t *testing.T) {
+	deps := map[string][]string{
+		"B": {"A"},
+		"C": {"A"},
+		"D": {"B", "E"},
+	}
+	waves, err := Waves([]string{"D", "C", "B", "A", "E"}, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"A", "E"}, {"C", "B"}, {"D"}}
+	if !reflect.DeepEqual(waves, want) {
+		t.Errorf("waves = %v, want %v", waves, want)
+	}
+}
+
+func TestClosure(t *testing.T) {
+	deps := map[string][]string{
+		"T-3": {"T-2"},
+		"T-2": {"T-1"},
+	}
+	closure, err := Closure("T-3", []string{"T-1", "T-2", "T-3", "T-4"}, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"T-1", "T-2", "T-3"}; !reflect.DeepEqual(closure, want) {
+		t.Errorf("closure = %v, want %v", closure, want)
+	}
+}
@@ -0,0 +1,196 @@
+// Package textdiff renders line-based unified diffs.
+package textdiff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Context is the number of unchanged lines shown around each change
+const Context = 3
+
+// MaxLines bounds the combined length of the inputs; larger files are only
+// reported as different
+const MaxLines = 20000
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+// op is one line of the edit script: a[aIndex] and/or b[bIndex]
+type op struct {
+	kind   opKind
+	aIndex int
+	bIndex int
+}
+
+// Unified returns a unified diff from a to b with the given file labels,
+// or "" when they are equal. Binary content and inputs longer than MaxLines
+// are described in one line instead.
+func Unified(fromLabel, toLabel string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	header := fmt.Sprintf("--- %s\n+++ %s\n", fromLabel, toLabel)
+	if bytes.IndexByte(a, 0) >= 0 || bytes.IndexByte(b, 0) >= 0 {
+		return fmt.Sprintf("Binary files %s and %s differ\n", fromLabel, toLabel)
+	}
+	aLines, bLines := splitLines(a), splitLines(b)
+	if len(aLines)+len(bLines) > MaxLines {
+		return header + fmt.Sprintf("(too large to diff: %d and %d lines)\n", len(aLines), len(bLines))
+	}
+
+	var out strings.Builder
+	out.WriteString(header)
+	ops := edits(aLines, bLines)
+	for _, h := range hunks(ops) {
+		writeHunk(&out, ops[h[0]:h[1]], aLines, bLines)
+	}
+	return out.String()
+}
+
+// splitLines splits text into lines that keep their trailing newline
+func splitLines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edits computes a shortest edit script from a to b (Myers' algorithm)
+func edits(a, b []string) []op {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back through the trace from the end of both inputs
+	var reversed []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY && x > 0 && y > 0 {
+			x, y = x-1, y-1
+			reversed = append(reversed, op{kind: opEqual, aIndex: x, bIndex: y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, op{kind: opInsert, aIndex: x, bIndex: y})
+		} else {
+			x--
+			reversed = append(reversed, op{kind: opDelete, aIndex: x, bIndex: y})
+		}
+	}
+
+	ops := make([]op, len(reversed))
+	for i, o := range reversed {
+		ops[len(reversed)-1-i] = o
+	}
+	return ops
+}
+
+// hunks groups the changes into [start, end) ranges of ops with Context
+// unchanged lines around them; nearby changes share a hunk
+func hunks(ops []op) [][2]int {
+	var result [][2]int
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == opEqual {
+			continue
+		}
+		start := max(i-Context, 0)
+		end := i + 1
+		for end < len(ops) {
+			next := end
+			for next < len(ops) && ops[next].kind == opEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*Context {
+				break
+			}
+			end = next + 1
+		}
+		end = min(end+Context, len(ops))
+		result = append(result, [2]int{start, end})
+		i = end - 1
+	}
+	return result
+}
+
+func writeHunk(out *strings.Builder, ops []op, a, b []string) {
+	aStart, bStart := ops[0].aIndex, ops[0].bIndex
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			aLen++
+		}
+		if o.kind != opDelete {
+			bLen++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, o := range ops {
+		var line string
+		if o.kind == opDelete {
+			line = a[o.aIndex]
+		} else {
+			line = b[o.bIndex]
+		}
+		out.WriteByte(byte(o.kind))
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a 0-based start and a length the way diff -u does
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
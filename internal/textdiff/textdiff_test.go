@@ -0,0 +1,52 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"separate hunks",
+			"a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			"a\nB\nc\nd\ne\nf\ng\nh\ni\nJ\nk\n",
+			"--- a/f\n+++ b/f\n@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n@@ -7,5 +7,5 @@\n g\n h\n i\n-j\n+J\n k\n",
+		},
+		{
+			"nearby changes share a hunk",
+			"a\nb\nc\nd\ne\n",
+			"A\nb\nc\nd\nE\n",
+			"--- a/f\n+++ b/f\n@@ -1,5 +1,5 @@\n-a\n+A\n b\n c\n d\n-e\n+E\n",
+		},
+		{"new file", "", "a\n", "--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n"},
+		{"deleted file", "a\nb\n", "", "--- a/f\n+++ b/f\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{
+			"missing final newline",
+			"a\nb\n",
+			"a\nb",
+			"--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{"binary", "a\x00", "b\x00", "Binary files a/f and b/f differ\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a/f", "b/f", []byte(tt.a), []byte(tt.b)); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedTooLarge(t *testing.T) {
+	a := strings.Repeat("x\n", MaxLines)
+	got := Unified("a/f", "b/f", []byte(a), []byte(a+"y\n"))
+	if !strings.Contains(got, "too large to diff") {
+		t.Errorf("Unified() = %q, want a too-large note", got)
+	}
+}
@@ -4,19 +4,32 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/redact"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 // Formatter formats protocol messages for console output
-type Formatter struct{}
+type Formatter struct {
+	redactor *redact.Redactor
+}
 
 // NewFormatter creates a new transcript formatter
 func NewFormatter() *Formatter {
 	return &Formatter{}
 }
 
+// SetRedactor removes secrets from formatted output; nil disables it
+func (f *Formatter) SetRedactor(r *redact.Redactor) {
+	f.redactor = r
+}
+
 // FormatEvent formats an event for console display
 func (f *Formatter) FormatEvent(evt *protocol.Event) string {
+	return f.redactor.Text(f.formatEvent(evt))
+}
+
+func (f *Formatter) formatEvent(evt *protocol.Event) string {
 	agentType := string(evt.From.AgentType)
 
 	// Build details based on event type
@@ -96,14 +109,52 @@ func (f *Formatter) FormatHeartbeat(hb *protocol.Heartbeat) string {
 // FormatCommand formats a command for console display
 func (f *Formatter) FormatCommand(cmd *protocol.Command) string {
 	agentType := string(cmd.To.AgentType)
-	return fmt.Sprintf("[lorch→%s] %s (task: %s)",
-		agentType, cmd.Action, cmd.TaskID)
+	return f.redactor.Text(fmt.Sprintf("[lorch→%s] %s (task: %s)",
+		agentType, cmd.Action, cmd.TaskID))
+}
+
+// maxChangesShown bounds the files listed by FormatChanges
+const maxChangesShown = 10
+
+// FormatChanges summarises the files a step changed, one line per file
+func (f *Formatter) FormatChanges(taskID string, changes []snapshot.FileChange) string {
+	if len(changes) == 0 {
+		return fmt.Sprintf("[lorch] no files changed (task: %s)", taskID)
+	}
+
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.Change]++
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[lorch] %d file(s) changed (task: %s): %d added, %d modified, %d removed",
+		len(changes), taskID, counts[snapshot.ChangeAdded], counts[snapshot.ChangeModified], counts[snapshot.ChangeRemoved])
+	for i, c := range changes {
+		if i == maxChangesShown {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(changes)-maxChangesShown)
+			break
+		}
+		fmt.Fprintf(&b, "\n  %s", f.FormatChange(c))
+	}
+	return f.redactor.Text(b.String())
+}
+
+// FormatChange renders one changed file with its size, or its size change
+func (f *Formatter) FormatChange(c snapshot.FileChange) string {
+	switch c.Change {
+	case snapshot.ChangeAdded:
+		return fmt.Sprintf("A %s (%s)", c.Path, f.formatSize(c.To.Size))
+	case snapshot.ChangeRemoved:
+		return fmt.Sprintf("D %s (%s)", c.Path, f.formatSize(c.From.Size))
+	default:
+		return fmt.Sprintf("M %s (%s → %s)", c.Path, f.formatSize(c.From.Size), f.formatSize(c.To.Size))
+	}
 }
 
 // FormatLog formats a log message for console display
 func (f *Formatter) FormatLog(log *protocol.Log) string {
 	level := strings.ToUpper(string(log.Level))
-	return fmt.Sprintf("[LOG:%s] %s", level, log.Message)
+	return f.redactor.Text(fmt.Sprintf("[LOG:%s] %s", level, log.Message))
 }
 
 // formatSize formats a byte size in a human-readable format
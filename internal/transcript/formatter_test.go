@@ -1,9 +1,12 @@
 package transcript
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/internal/snapshot"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 	"github.com/stretchr/testify/require"
 )
 
@@ -429,6 +432,28 @@ func TestFormatCommand(t *testing.T) {
 	}
 }
 
+func TestFormatChanges(t *testing.T) {
+	formatter := NewFormatter()
+	require.Equal(t, "[lorch] no files changed (task: T-0042)", formatter.FormatChanges("T-0042", nil))
+
+	changes := []snapshot.FileChange{
+		{Path: "src/new.go", Change: snapshot.ChangeAdded, To: &snapshot.FileInfo{Size: 2048}},
+		{Path: "src/main.go", Change: snapshot.ChangeModified, From: &snapshot.FileInfo{Size: 100}, To: &snapshot.FileInfo{Size: 120}},
+		{Path: "src/old.go", Change: snapshot.ChangeRemoved, From: &snapshot.FileInfo{Size: 10}},
+	}
+	require.Equal(t, "[lorch] 3 file(s) changed (task: T-0042): 1 added, 1 modified, 1 removed\n"+
+		"  A src/new.go (2.0 KiB)\n"+
+		"  M src/main.go (100 B → 120 B)\n"+
+		"  D src/old.go (10 B)",
+		formatter.FormatChanges("T-0042", changes))
+
+	many := make([]snapshot.FileChange, maxChangesShown+2)
+	for i := range many {
+		many[i] = snapshot.FileChange{Path: fmt.Sprintf("gen/%02d.go", i), Change: snapshot.ChangeAdded, To: &snapshot.FileInfo{}}
+	}
+	require.True(t, strings.HasSuffix(formatter.FormatChanges("T-0042", many), "\n  ... and 2 more"))
+}
+
 func TestFormatLog(t *testing.T) {
 	tests := []struct {
 		name     string
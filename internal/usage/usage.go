@@ -0,0 +1,166 @@
+package usage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// Scope identifies which budget a limit applies to
+type Scope string
+
+const (
+	ScopeTask Scope = "task"
+	ScopeRun  Scope = "run"
+)
+
+// BudgetExceeded describes a budget limit that has been crossed
+type BudgetExceeded struct {
+	Scope  Scope
+	TaskID string
+	// Metric is "usd" or "tokens"
+	Metric string
+	Limit  float64
+	Actual float64
+}
+
+// Error implements the error interface so callers can surface the breach directly
+func (b *BudgetExceeded) Error() string {
+	subject := "run"
+	if b.Scope == ScopeTask {
+		subject = "task " + b.TaskID
+	}
+	if b.Metric == "usd" {
+		return fmt.Sprintf("%s budget exceeded: $%.4f spent, limit $%.4f", subject, b.Actual, b.Limit)
+	}
+	return fmt.Sprintf("%s budget exceeded: %.0f tokens used, limit %.0f", subject, b.Actual, b.Limit)
+}
+
+// Tracker prices usage reports and aggregates them per task and per run.
+// It is safe for concurrent use.
+type Tracker struct {
+	prices map[string]config.ModelPrice
+	budget config.Budget
+
+	mu       sync.Mutex
+	run      protocol.Usage
+	tasks    map[string]protocol.Usage
+	approved map[string]bool
+}
+
+// NewTracker creates a tracker with the given price table and budget.
+// A nil budget means no limits are enforced.
+func NewTracker(prices map[string]config.ModelPrice, budget *config.Budget) *Tracker {
+	t := &Tracker{
+		prices:   prices,
+		tasks:    make(map[string]protocol.Usage),
+		approved: make(map[string]bool),
+	}
+	if budget != nil {
+		t.budget = *budget
+	}
+	return t
+}
+
+// Restore seeds the tracker with totals persisted by a previous run (resume)
+func (t *Tracker) Restore(run protocol.Usage, tasks map[string]protocol.Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.run = run
+	t.tasks = make(map[string]protocol.Usage, len(tasks))
+	for id, u := range tasks {
+		t.tasks[id] = u
+	}
+}
+
+// EstimateCost returns the cost of u according to the price table.
+// The second return value is false when the model has no price entry.
+func (t *Tracker) EstimateCost(u protocol.Usage) (float64, bool) {
+	price, ok := t.prices[u.Model]
+	if !ok {
+		return 0, false
+	}
+	cost := float64(u.InputTokens)*price.InputPerMTokUSD/1e6 +
+		float64(u.OutputTokens)*price.OutputPerMTokUSD/1e6
+	return cost, true
+}
+
+// Record prices u in place (when the agent did not supply a cost) and adds it
+// to the task and run totals.
+func (t *Tracker) Record(taskID string, u *protocol.Usage) {
+	if u == nil {
+		return
+	}
+	if u.EstimatedCostUSD == 0 {
+		if cost, ok := t.EstimateCost(*u); ok {
+			u.EstimatedCostUSD = cost
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.run.Add(*u)
+	taskTotal := t.tasks[taskID]
+	taskTotal.Add(*u)
+	t.tasks[taskID] = taskTotal
+}
+
+// TaskTotal returns the accumulated usage for a task
+func (t *Tracker) TaskTotal(taskID string) protocol.Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tasks[taskID]
+}
+
+// RunTotal returns the accumulated usage for the whole run
+func (t *Tracker) RunTotal() protocol.Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.run
+}
+
+// Check returns the first budget limit exceeded by the task or the run,
+// skipping limits a human has already approved going over.
+func (t *Tracker) Check(taskID string) *BudgetExceeded {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	task := t.tasks[taskID]
+	checks := []BudgetExceeded{
+		{Scope: ScopeTask, TaskID: taskID, Metric: "usd", Limit: t.budget.PerTaskUSD, Actual: task.EstimatedCostUSD},
+		{Scope: ScopeTask, TaskID: taskID, Metric: "tokens", Limit: float64(t.budget.PerTaskTokens), Actual: float64(task.TotalTokens())},
+		{Scope: ScopeRun, Metric: "usd", Limit: t.budget.PerRunUSD, Actual: t.run.EstimatedCostUSD},
+		{Scope: ScopeRun, Metric: "tokens", Limit: float64(t.budget.PerRunTokens), Actual: float64(t.run.TotalTokens())},
+	}
+
+	for _, c := range checks {
+		if c.Limit <= 0 || c.Actual <= c.Limit {
+			continue
+		}
+		if t.approved[approvalKey(c)] {
+			continue
+		}
+		exceeded := c
+		return &exceeded
+	}
+	return nil
+}
+
+// Approve records that a human allowed the run to continue past a limit.
+// The approval holds for the remainder of the run (or task, for task scope).
+func (t *Tracker) Approve(b *BudgetExceeded) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.approved[approvalKey(*b)] = true
+}
+
+func approvalKey(b BudgetExceeded) string {
+	if b.Scope == ScopeTask {
+		return fmt.Sprintf("%s:%s:%s", b.Scope, b.TaskID, b.Metric)
+	}
+	return fmt.Sprintf("%s:%s", b.Scope, b.Metric)
+}
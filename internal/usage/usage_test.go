@@ -0,0 +1,122 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/iambrandonn/lorch/internal/config"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordEstimatesCostFromPricing(t *testing.T) {
+	tracker := NewTracker(map[string]config.ModelPrice{
+		"sonnet": {InputPerMTokUSD: 3, OutputPerMTokUSD: 15},
+	}, nil)
+
+	u := &protocol.Usage{Model: "sonnet", InputTokens: 1_000_000, OutputTokens: 100_000}
+	tracker.Record("T-0001", u)
+
+	assert.InDelta(t, 4.5, u.EstimatedCostUSD, 1e-9)
+	assert.InDelta(t, 4.5, tracker.TaskTotal("T-0001").EstimatedCostUSD, 1e-9)
+	assert.Equal(t, int64(1_100_000), tracker.RunTotal().TotalTokens())
+}
+
+func TestRecordKeepsAgentSuppliedCost(t *testing.T) {
+	tracker := NewTracker(map[string]config.ModelPrice{
+		"sonnet": {InputPerMTokUSD: 3, OutputPerMTokUSD: 15},
+	}, nil)
+
+	u := &protocol.Usage{Model: "sonnet", InputTokens: 1000, EstimatedCostUSD: 1.25}
+	tracker.Record("T-0001", u)
+
+	assert.Equal(t, 1.25, u.EstimatedCostUSD)
+}
+
+func TestRecordUnknownModelHasNoCost(t *testing.T) {
+	tracker := NewTracker(nil, nil)
+
+	u := &protocol.Usage{Model: "unknown", InputTokens: 1000}
+	tracker.Record("T-0001", u)
+
+	assert.Zero(t, u.EstimatedCostUSD)
+	assert.Equal(t, int64(1000), tracker.RunTotal().InputTokens)
+}
+
+func TestCheckWithoutBudget(t *testing.T) {
+	tracker := NewTracker(nil, nil)
+	tracker.Record("T-0001", &protocol.Usage{InputTokens: 1 << 40})
+
+	assert.Nil(t, tracker.Check("T-0001"))
+}
+
+func TestCheckTaskBudget(t *testing.T) {
+	tracker := NewTracker(nil, &config.Budget{PerTaskTokens: 100})
+
+	tracker.Record("T-0001", &protocol.Usage{InputTokens: 60, OutputTokens: 40})
+	assert.Nil(t, tracker.Check("T-0001"), "reaching the limit exactly is allowed")
+
+	tracker.Record("T-0001", &protocol.Usage{OutputTokens: 1})
+	exceeded := tracker.Check("T-0001")
+	require.NotNil(t, exceeded)
+	assert.Equal(t, ScopeTask, exceeded.Scope)
+	assert.Equal(t, "tokens", exceeded.Metric)
+	assert.Equal(t, float64(101), exceeded.Actual)
+	assert.Contains(t, exceeded.Error(), "task T-0001 budget exceeded")
+
+	// A different task has its own budget
+	assert.Nil(t, tracker.Check("T-0002"))
+}
+
+func TestCheckRunBudgetSpansTasks(t *testing.T) {
+	tracker := NewTracker(nil, &config.Budget{PerRunUSD: 1})
+
+	tracker.Record("T-0001", &protocol.Usage{EstimatedCostUSD: 0.6})
+	assert.Nil(t, tracker.Check("T-0001"))
+
+	tracker.Record("T-0002", &protocol.Usage{EstimatedCostUSD: 0.6})
+	exceeded := tracker.Check("T-0002")
+	require.NotNil(t, exceeded)
+	assert.Equal(t, ScopeRun, exceeded.Scope)
+	assert.Equal(t, "usd", exceeded.Metric)
+	assert.Contains(t, exceeded.Error(), "run budget exceeded")
+}
+
+func TestApproveSuppressesRepeatPrompts(t *testing.T) {
+	tracker := NewTracker(nil, &config.Budget{PerTaskUSD: 1, PerRunUSD: 1})
+	tracker.Record("T-0001", &protocol.Usage{EstimatedCostUSD: 2})
+
+	first := tracker.Check("T-0001")
+	require.NotNil(t, first)
+	assert.Equal(t, ScopeTask, first.Scope)
+	tracker.Approve(first)
+
+	second := tracker.Check("T-0001")
+	require.NotNil(t, second)
+	assert.Equal(t, ScopeRun, second.Scope)
+	tracker.Approve(second)
+
+	tracker.Record("T-0001", &protocol.Usage{EstimatedCostUSD: 2})
+	assert.Nil(t, tracker.Check("T-0001"))
+
+	// Task-scoped approval does not carry over to other tasks
+	tracker.Record("T-0002", &protocol.Usage{EstimatedCostUSD: 2})
+	exceeded := tracker.Check("T-0002")
+	require.NotNil(t, exceeded)
+	assert.Equal(t, "T-0002", exceeded.TaskID)
+}
+
+func TestRestoreCountsPriorUsage(t *testing.T) {
+	tracker := NewTracker(nil, &config.Budget{PerRunTokens: 100})
+	tracker.Restore(
+		protocol.Usage{InputTokens: 90},
+		map[string]protocol.Usage{"T-0001": {InputTokens: 90}},
+	)
+
+	tracker.Record("T-0001", &protocol.Usage{InputTokens: 20})
+
+	assert.Equal(t, int64(110), tracker.TaskTotal("T-0001").InputTokens)
+	exceeded := tracker.Check("T-0001")
+	require.NotNil(t, exceeded)
+	assert.Equal(t, ScopeRun, exceeded.Scope)
+}
@@ -0,0 +1,675 @@
+// Package agentsdk implements the agent side of the lorch NDJSON protocol.
+//
+// An agent registers a Handler per action and calls Run. The SDK takes care
+// of the protocol plumbing every agent needs: the hello handshake, the
+// heartbeat goroutine and status tracking, snapshot version pinning, payload truncation under the
+// message size cap, replay of commands whose idempotency key was already
+// handled, and a clean shutdown on stdin EOF or context cancellation.
+//
+// Agents normally run as children of lorch and talk over stdio. Serve runs
+// one as a daemon that connects to lorch's agent socket instead and survives
+// lorch restarts.
+package agentsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// DefaultHeartbeatInterval matches the agent heartbeat default in MASTER-SPEC §3.3
+const DefaultHeartbeatInterval = 10 * time.Second
+
+// DefaultReconnectInterval is how long Serve waits between attempts to reach
+// lorch's agent socket
+const DefaultReconnectInterval = time.Second
+
+// ErrHandshakeRefused is returned by Run when lorch refuses the hello
+var ErrHandshakeRefused = errors.New("lorch refused the protocol handshake")
+
+// Handler performs the work for one action
+type Handler interface {
+	Handle(ctx context.Context, cmd *protocol.Command, e *Emitter) error
+}
+
+// HandlerFunc adapts a function to the Handler interface
+type HandlerFunc func(ctx context.Context, cmd *protocol.Command, e *Emitter) error
+
+// Handle calls f(ctx, cmd, e)
+func (f HandlerFunc) Handle(ctx context.Context, cmd *protocol.Command, e *Emitter) error {
+	return f(ctx, cmd, e)
+}
+
+// fatalError marks a handler error that should stop the agent
+type fatalError struct{ err error }
+
+func (f *fatalError) Error() string { return f.err.Error() }
+func (f *fatalError) Unwrap() error { return f.err }
+
+// Fatal wraps err so that Run stops and returns it instead of reporting it
+// as an error event and carrying on with the next command.
+func Fatal(err error) error {
+	return &fatalError{err: err}
+}
+
+// Config configures an Agent
+type Config struct {
+	Role    protocol.AgentType
+	AgentID string // defaults to "<role>#<random>"
+	Logger  *slog.Logger
+
+	HeartbeatInterval time.Duration // defaults to DefaultHeartbeatInterval
+	DisableHeartbeat  bool
+
+	// MaxMessageBytes caps emitted events (defaults to the NDJSON limit)
+	MaxMessageBytes int
+	// Truncate shrinks oversized payloads (defaults to TruncateGeneric)
+	Truncate TruncateFunc
+
+	// Receipts answers repeated idempotency keys (defaults to in-memory)
+	Receipts ReceiptStore
+
+	// Capabilities are announced in the hello message
+	Capabilities protocol.Capabilities
+
+	// AllowVersionDrift disables the snapshot pinning check, for test doubles
+	// that serve retries from several snapshots.
+	AllowVersionDrift bool
+
+	// PID and PPID reported in heartbeats (default to the current process)
+	PID  int
+	PPID int
+
+	// ReconnectInterval paces Serve's attempts to reach lorch (defaults to
+	// DefaultReconnectInterval)
+	ReconnectInterval time.Duration
+}
+
+// Agent runs the NDJSON command loop for a single agent process
+type Agent struct {
+	cfg      Config
+	logger   *slog.Logger
+	handlers map[protocol.Action]Handler
+
+	mu                 sync.Mutex
+	startedAt          time.Time
+	lastActivityAt     time.Time
+	status             protocol.HeartbeatStatus
+	taskID             string
+	heartbeatSeq       int64
+	observedSnapshotID string
+	protocolVersion    int
+}
+
+// New creates an agent for the given configuration
+func New(cfg Config) (*Agent, error) {
+	if cfg.Role == "" {
+		return nil, errors.New("agent role is required")
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.AgentID == "" {
+		cfg.AgentID = fmt.Sprintf("%s#%s", cfg.Role, uuid.New().String()[:8])
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.ReconnectInterval <= 0 {
+		cfg.ReconnectInterval = DefaultReconnectInterval
+	}
+	if cfg.Receipts == nil {
+		cfg.Receipts = NewMemoryReceiptStore()
+	}
+	if cfg.PID == 0 {
+		cfg.PID = os.Getpid()
+	}
+	if cfg.PPID == 0 {
+		cfg.PPID = os.Getppid()
+	}
+
+	now := time.Now().UTC()
+	return &Agent{
+		cfg:            cfg,
+		logger:         cfg.Logger,
+		handlers:       make(map[protocol.Action]Handler),
+		startedAt:      now,
+		lastActivityAt: now,
+		status:         protocol.HeartbeatStatusStarting,
+	}, nil
+}
+
+// Handle registers the handler for an action, replacing any previous one
+func (a *Agent) Handle(action protocol.Action, h Handler) {
+	a.handlers[action] = h
+}
+
+// HandleFunc registers a handler function for an action
+func (a *Agent) HandleFunc(action protocol.Action, f func(ctx context.Context, cmd *protocol.Command, e *Emitter) error) {
+	a.Handle(action, HandlerFunc(f))
+}
+
+// Role returns the agent type
+func (a *Agent) Role() protocol.AgentType {
+	return a.cfg.Role
+}
+
+// AgentID returns the agent identifier used in heartbeats and events
+func (a *Agent) AgentID() string {
+	return a.cfg.AgentID
+}
+
+// Status returns the current heartbeat status and task
+func (a *Agent) Status() (protocol.HeartbeatStatus, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.status, a.taskID
+}
+
+// SetStatus updates the status reported in heartbeats and marks activity
+func (a *Agent) SetStatus(status protocol.HeartbeatStatus, taskID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = status
+	a.taskID = taskID
+	a.lastActivityAt = time.Now().UTC()
+}
+
+// Touch records activity without changing the status
+func (a *Agent) Touch() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastActivityAt = time.Now().UTC()
+}
+
+// LastActivityAt returns when the agent last did something
+func (a *Agent) LastActivityAt() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastActivityAt
+}
+
+// HeartbeatSeq returns the sequence number of the last heartbeat sent
+func (a *Agent) HeartbeatSeq() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.heartbeatSeq
+}
+
+// ProtocolVersion returns the version lorch accepted in its hello_ack, or 0
+// before the acknowledgement arrives
+func (a *Agent) ProtocolVersion() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.protocolVersion
+}
+
+// ObservedSnapshotID returns the snapshot the agent is pinned to: that of
+// the last command it accepted, if any
+func (a *Agent) ObservedSnapshotID() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.observedSnapshotID
+}
+
+// Run reads commands from stdin and writes heartbeats, events and logs to
+// stdout until stdin is closed or ctx is cancelled. Handler errors are
+// reported as error events; only Fatal errors stop the loop.
+func (a *Agent) Run(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
+	emitter := NewEmitter(ndjson.NewEncoder(stdout, a.logger), a.logger, a.cfg.Role, a.cfg.AgentID, a.cfg.MaxMessageBytes, a.cfg.Truncate)
+	decoder := ndjson.NewDecoder(stdin, a.logger)
+	// Accept commands up to the size announced in the hello
+	decoder.SetLimit(emitter.MaxMessageBytes())
+
+	a.mu.Lock()
+	a.startedAt = time.Now().UTC()
+	a.protocolVersion = 0
+	a.mu.Unlock()
+
+	if err := emitter.encodeRaw(a.hello(emitter)); err != nil {
+		return fmt.Errorf("send hello: %w", err)
+	}
+
+	a.SetStatus(protocol.HeartbeatStatusStarting, "")
+	if err := a.sendHeartbeat(emitter); err != nil {
+		return fmt.Errorf("send starting heartbeat: %w", err)
+	}
+
+	hbCtx, stopHeartbeats := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	if !a.cfg.DisableHeartbeat {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.heartbeatLoop(hbCtx, emitter)
+		}()
+	}
+
+	a.SetStatus(protocol.HeartbeatStatusReady, "")
+	if err := a.sendHeartbeat(emitter); err != nil {
+		stopHeartbeats()
+		wg.Wait()
+		return fmt.Errorf("send ready heartbeat: %w", err)
+	}
+
+	// Decode in the background so cancellation is not blocked on stdin
+	type decoded struct {
+		msg any
+		err error
+	}
+	messages := make(chan decoded)
+	go func() {
+		defer close(messages)
+		for {
+			msg, err := decoder.DecodeEnvelope()
+			select {
+			case messages <- decoded{msg: msg, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			var oversize *ndjson.OversizeError
+			if err != nil && !errors.As(err, &oversize) {
+				return
+			}
+		}
+	}()
+
+	// Commands run one at a time off the read loop, so a cancel can arrive
+	// while a handler is busy
+	runErr := func() error {
+		var (
+			current *inflight
+			queued  []*protocol.Command
+			eof     bool
+		)
+		startNext := func() {
+			if current == nil && len(queued) > 0 {
+				current = a.start(ctx, queued[0], emitter)
+				queued = queued[1:]
+			}
+		}
+		finish := func() error {
+			if current == nil {
+				return nil
+			}
+			return a.settle(current, <-current.done, emitter)
+		}
+
+		for {
+			if eof && current == nil && len(queued) == 0 {
+				return nil
+			}
+
+			var done <-chan error
+			if current != nil {
+				done = current.done
+			}
+
+			select {
+			case <-ctx.Done():
+				return finish()
+			case err := <-done:
+				finished := current
+				current = nil
+				if err := a.settle(finished, err, emitter); err != nil {
+					return err
+				}
+				startNext()
+			case m, ok := <-messages:
+				if !ok || errors.Is(m.err, io.EOF) {
+					// Let in-flight and queued commands finish
+					eof = true
+					messages = nil
+					continue
+				}
+				var oversize *ndjson.OversizeError
+				if errors.As(m.err, &oversize) {
+					a.rejectOversize(oversize, emitter)
+					continue
+				}
+				if m.err != nil {
+					if err := finish(); err != nil {
+						return err
+					}
+					return fmt.Errorf("failed to decode command: %w", m.err)
+				}
+
+				switch msg := m.msg.(type) {
+				case *protocol.HelloAck:
+					if err := a.acknowledge(msg, emitter); err != nil {
+						return errors.Join(err, finish())
+					}
+				case *protocol.Cancel:
+					a.cancel(msg, current, emitter)
+				case *protocol.Command:
+					queued = append(queued, msg)
+					startNext()
+				default:
+					a.logger.Warn("ignoring non-command message", "type", fmt.Sprintf("%T", m.msg))
+				}
+			}
+		}
+	}()
+
+	// Graceful shutdown: announce stopping, then stop the heartbeat goroutine
+	a.SetStatus(protocol.HeartbeatStatusStopping, "")
+	if err := a.sendHeartbeat(emitter); err != nil {
+		a.logger.Debug("failed to send stopping heartbeat", "error", err)
+	}
+	stopHeartbeats()
+	wg.Wait()
+
+	return runErr
+}
+
+// Serve runs the agent as a long-lived daemon: it connects to lorch's agent
+// socket at path and runs the command loop over the connection, reconnecting
+// whenever lorch goes away, so that `lorch resume` can reattach it. It
+// returns when ctx is cancelled, when lorch refuses the handshake, or with
+// the first error that is not a lost connection (such as a Fatal handler
+// error).
+func (a *Agent) Serve(ctx context.Context, path string) error {
+	for {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			a.logger.Debug("lorch agent socket unavailable", "path", path, "error", err)
+		} else {
+			a.logger.Info("connected to lorch", "path", path)
+			err = a.Run(ctx, conn, conn)
+			conn.Close()
+			if ctx.Err() != nil {
+				return nil
+			}
+			if !disconnected(err) {
+				return err
+			}
+			a.logger.Info("disconnected from lorch, reconnecting", "path", path, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(a.cfg.ReconnectInterval):
+		}
+	}
+}
+
+// disconnected reports whether Run ended because lorch closed or lost the
+// connection
+func disconnected(err error) bool {
+	var opErr *net.OpError
+	return err == nil ||
+		errors.As(err, &opErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// hello describes this agent for the handshake
+func (a *Agent) hello(emitter *Emitter) protocol.Hello {
+	actions := make([]protocol.Action, 0, len(a.handlers))
+	for action := range a.handlers {
+		actions = append(actions, action)
+	}
+	slices.Sort(actions)
+
+	return protocol.Hello{
+		Kind:             protocol.MessageKindHello,
+		Agent:            protocol.AgentRef{AgentType: a.cfg.Role, AgentID: a.cfg.AgentID},
+		ProtocolVersions: slices.Clone(protocol.SupportedProtocolVersions),
+		SupportedActions: actions,
+		MaxMessageBytes:  emitter.MaxMessageBytes(),
+		Capabilities:     a.cfg.Capabilities,
+	}
+}
+
+// acknowledge records lorch's answer to the hello and adopts the negotiated
+// message limit. A refusal stops the agent.
+func (a *Agent) acknowledge(ack *protocol.HelloAck, emitter *Emitter) error {
+	if !ack.Accepted {
+		return fmt.Errorf("%w: %s", ErrHandshakeRefused, ack.Reason)
+	}
+	if ack.MaxMessageBytes > 0 && ack.MaxMessageBytes < emitter.maxMessageBytes {
+		emitter.maxMessageBytes = ack.MaxMessageBytes
+	}
+	a.mu.Lock()
+	a.protocolVersion = ack.ProtocolVersion
+	a.mu.Unlock()
+	a.logger.Info("protocol negotiated", "version", ack.ProtocolVersion, "max_message_bytes", ack.MaxMessageBytes)
+	return nil
+}
+
+// rejectOversize answers a message that was skipped for exceeding the size
+// limit with an error event naming it. The event is not recorded for
+// idempotent replay, since the command was never run.
+func (a *Agent) rejectOversize(e *ndjson.OversizeError, emitter *Emitter) {
+	a.logger.Error("skipping message over the size limit", "kind", e.Kind, "message_id", e.MessageID, "size", e.Size, "limit", e.Limit)
+	evt := emitter.NewEvent(&protocol.Command{CorrelationID: e.CorrelationID, TaskID: e.TaskID}, protocol.EventError)
+	evt.ObservedVersion = nil
+	evt.Status = "failed"
+	evt.Payload = map[string]any{
+		"code":         protocol.ErrorMessageTooLarge,
+		"message":      fmt.Sprintf("%d byte message exceeds the %d byte limit", e.Size, e.Limit),
+		"message_kind": e.Kind,
+		"message_id":   e.MessageID,
+		"size":         e.Size,
+		"limit":        e.Limit,
+	}
+	if err := emitter.encodeRaw(evt); err != nil {
+		a.logger.Warn("failed to report oversize message", "error", err)
+	}
+}
+
+// errCancelRequested is the context cause for a command lorch cancelled
+var errCancelRequested = errors.New("cancelled by lorch")
+
+// inflight is a command whose handler is running
+type inflight struct {
+	cmd       *protocol.Command
+	cancel    context.CancelCauseFunc
+	cancelReq *protocol.Cancel
+	done      chan error
+}
+
+// start runs cmd's handler in the background
+func (a *Agent) start(ctx context.Context, cmd *protocol.Command, emitter *Emitter) *inflight {
+	cmdCtx, cancel := context.WithCancelCause(ctx)
+	f := &inflight{cmd: cmd, cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		f.done <- a.dispatch(cmdCtx, cmd, emitter)
+	}()
+	return f
+}
+
+// settle finishes a command once its handler has returned, acknowledging a
+// pending cancel. It returns err, the dispatch result.
+func (a *Agent) settle(f *inflight, err error, emitter *Emitter) error {
+	f.cancel(nil)
+	if f.cancelReq != nil {
+		if ackErr := emitter.sendCancelAck(f.cancelReq, protocol.CancelStatusCancelled); ackErr != nil {
+			a.logger.Error("failed to acknowledge cancel", "error", ackErr)
+		}
+	}
+	return err
+}
+
+// cancel handles a cancel message. The handler of a matching in-flight
+// command sees its context cancelled and the acknowledgement is sent once it
+// returns; a cancel for anything else is acknowledged as not running.
+func (a *Agent) cancel(req *protocol.Cancel, current *inflight, emitter *Emitter) {
+	if current != nil && current.cmd.CorrelationID == req.CorrelationID {
+		a.logger.Info("cancelling command", "correlation_id", req.CorrelationID, "reason", req.Reason)
+		if current.cancelReq == nil {
+			current.cancelReq = req
+			current.cancel(errCancelRequested)
+		}
+		return
+	}
+
+	a.logger.Info("cancel for a command that is not running", "correlation_id", req.CorrelationID)
+	if err := emitter.sendCancelAck(req, protocol.CancelStatusNotRunning); err != nil {
+		a.logger.Error("failed to acknowledge cancel", "error", err)
+	}
+}
+
+// dispatch runs the handler for cmd. It returns an error only when the agent
+// should stop.
+func (a *Agent) dispatch(ctx context.Context, cmd *protocol.Command, emitter *Emitter) error {
+	a.logger.Info("handling command", "action", cmd.Action, "task_id", cmd.TaskID)
+	a.Touch()
+
+	if mismatch := a.checkVersion(cmd); mismatch != "" {
+		return a.report(cmd, emitter.SendError(cmd, "version_mismatch", mismatch))
+	}
+
+	// lorch retries a command (attempt > 0) when it rejected the recorded
+	// result, for example because the artifacts were partially written, so
+	// a retry runs the handler again instead of replaying
+	if cmd.IdempotencyKey != "" && cmd.Retry.Attempt == 0 {
+		if events, ok := a.cfg.Receipts.Lookup(cmd.IdempotencyKey); ok {
+			a.logger.Info("replaying events for repeated idempotency key", "ik", cmd.IdempotencyKey, "events", len(events))
+			return a.report(cmd, a.replay(cmd, events, emitter))
+		}
+	}
+
+	handler, ok := a.handlers[cmd.Action]
+	if !ok {
+		return a.report(cmd, emitter.SendError(cmd, "unsupported_action",
+			fmt.Sprintf("action %s not supported for role %s", cmd.Action, a.cfg.Role)))
+	}
+
+	a.SetStatus(protocol.HeartbeatStatusBusy, cmd.TaskID)
+	if err := a.sendHeartbeat(emitter); err != nil {
+		a.logger.Error("failed to send heartbeat", "error", err)
+	}
+	defer a.SetStatus(protocol.HeartbeatStatusReady, "")
+
+	emitter.beginCommand()
+	err := handler.Handle(ctx, cmd, emitter)
+	events := emitter.endCommand()
+
+	if errors.Is(context.Cause(ctx), errCancelRequested) && (err == nil || errors.Is(err, context.Canceled)) {
+		// The cancel acknowledgement reports the outcome; nothing is recorded
+		// so a retry with the same idempotency key runs again
+		a.logger.Info("command cancelled", "action", cmd.Action, "task_id", cmd.TaskID)
+		return nil
+	}
+	var fatal *fatalError
+	if errors.As(err, &fatal) {
+		return fatal.err
+	}
+	if err != nil {
+		a.logger.Error("command failed", "action", cmd.Action, "error", err)
+		return a.report(cmd, emitter.SendError(cmd, "command_failed", err.Error()))
+	}
+
+	if cmd.IdempotencyKey != "" && completed(events) {
+		a.cfg.Receipts.Record(cmd.IdempotencyKey, events)
+	}
+	return nil
+}
+
+// report logs failures to write protocol output; they are not fatal since
+// the orchestrator detects a broken pipe through missing heartbeats.
+func (a *Agent) report(cmd *protocol.Command, err error) error {
+	if err != nil {
+		a.logger.Error("failed to write response", "action", cmd.Action, "error", err)
+	}
+	return nil
+}
+
+// checkVersion pins the agent to the snapshot of each new command, since
+// lorch captures a fresh snapshot after every step that changes the
+// workspace and stamps it on the next command. A retry repeats an earlier
+// command, so it must target the snapshot the agent is pinned to; anything
+// else is described as a mismatch.
+func (a *Agent) checkVersion(cmd *protocol.Command) string {
+	if a.cfg.AllowVersionDrift || cmd.Version.SnapshotID == "" {
+		return ""
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case cmd.Version.SnapshotID == a.observedSnapshotID:
+		return ""
+	case a.observedSnapshotID == "":
+		a.logger.Info("recorded initial snapshot", "snapshot_id", cmd.Version.SnapshotID)
+	case cmd.Retry.Attempt > 0:
+		return fmt.Sprintf("expected snapshot %s, received %s", a.observedSnapshotID, cmd.Version.SnapshotID)
+	default:
+		a.logger.Info("snapshot advanced", "from", a.observedSnapshotID, "to", cmd.Version.SnapshotID)
+	}
+	a.observedSnapshotID = cmd.Version.SnapshotID
+	return ""
+}
+
+// replay re-emits the events recorded for an idempotency key, re-addressed to
+// the repeated command so the orchestrator can correlate them.
+func (a *Agent) replay(cmd *protocol.Command, events []protocol.Event, emitter *Emitter) error {
+	for _, recorded := range events {
+		evt := recorded
+		evt.MessageID = uuid.New().String()
+		evt.CorrelationID = cmd.CorrelationID
+		evt.OccurredAt = time.Now().UTC()
+		if err := emitter.encodeRaw(evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Agent) heartbeatLoop(ctx context.Context, emitter *Emitter) {
+	ticker := time.NewTicker(a.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.sendHeartbeat(emitter); err != nil {
+				a.logger.Error("failed to send heartbeat", "error", err)
+			}
+		}
+	}
+}
+
+func (a *Agent) sendHeartbeat(emitter *Emitter) error {
+	if a.cfg.DisableHeartbeat {
+		return nil
+	}
+
+	a.mu.Lock()
+	a.heartbeatSeq++
+	hb := protocol.Heartbeat{
+		Kind: protocol.MessageKindHeartbeat,
+		Agent: protocol.AgentRef{
+			AgentType: a.cfg.Role,
+			AgentID:   a.cfg.AgentID,
+		},
+		Seq:            a.heartbeatSeq,
+		Status:         a.status,
+		PID:            a.cfg.PID,
+		PPID:           a.cfg.PPID,
+		UptimeS:        time.Since(a.startedAt).Seconds(),
+		LastActivityAt: a.lastActivityAt,
+		TaskID:         a.taskID,
+	}
+	a.mu.Unlock()
+
+	return emitter.encodeRaw(hb)
+}
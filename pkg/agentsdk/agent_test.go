@@ -0,0 +1,511 @@
+package agentsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testCommand(action protocol.Action, ik, snapshotID string) protocol.Command {
+	return protocol.Command{
+		Kind:           protocol.MessageKindCommand,
+		MessageID:      "cmd-" + ik,
+		CorrelationID:  "corr-" + ik,
+		TaskID:         "T-0001",
+		IdempotencyKey: ik,
+		To:             protocol.AgentRef{AgentType: protocol.AgentTypeBuilder},
+		Action:         action,
+		Version:        protocol.Version{SnapshotID: snapshotID},
+	}
+}
+
+// runCommands feeds cmds to the agent and returns every message it wrote
+func runCommands(t *testing.T, agent *Agent, cmds ...protocol.Command) []any {
+	t.Helper()
+
+	var input bytes.Buffer
+	for _, cmd := range cmds {
+		require.NoError(t, json.NewEncoder(&input).Encode(cmd))
+	}
+
+	var output bytes.Buffer
+	require.NoError(t, agent.Run(context.Background(), &input, &output))
+
+	decoder := ndjson.NewDecoder(&output, testLogger())
+	var messages []any
+	for {
+		msg, err := decoder.DecodeEnvelope()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func eventsOf(messages []any) []*protocol.Event {
+	var events []*protocol.Event
+	for _, msg := range messages {
+		if evt, ok := msg.(*protocol.Event); ok {
+			events = append(events, evt)
+		}
+	}
+	return events
+}
+
+func heartbeatsOf(messages []any) []*protocol.Heartbeat {
+	var heartbeats []*protocol.Heartbeat
+	for _, msg := range messages {
+		if hb, ok := msg.(*protocol.Heartbeat); ok {
+			heartbeats = append(heartbeats, hb)
+		}
+	}
+	return heartbeats
+}
+
+func newTestAgent(t *testing.T, cfg Config) *Agent {
+	t.Helper()
+	if cfg.Role == "" {
+		cfg.Role = protocol.AgentTypeBuilder
+	}
+	cfg.Logger = testLogger()
+	agent, err := New(cfg)
+	require.NoError(t, err)
+	return agent
+}
+
+func completedHandler(calls *int) HandlerFunc {
+	return func(ctx context.Context, cmd *protocol.Command, e *Emitter) error {
+		*calls++
+		evt := e.NewEvent(cmd, protocol.EventBuilderCompleted)
+		evt.Status = "success"
+		return e.Emit(evt)
+	}
+}
+
+func TestNewRequiresRole(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+}
+
+func TestRunDispatchesToHandler(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	messages := runCommands(t, agent, testCommand(protocol.ActionImplement, "ik-1", "snap-1"))
+
+	require.Equal(t, 1, calls)
+	events := eventsOf(messages)
+	require.Len(t, events, 1)
+	assert.Equal(t, protocol.EventBuilderCompleted, events[0].Event)
+	assert.Equal(t, "corr-ik-1", events[0].CorrelationID)
+	assert.Equal(t, agent.AgentID(), events[0].From.AgentID)
+	require.NotNil(t, events[0].ObservedVersion)
+	assert.Equal(t, "snap-1", events[0].ObservedVersion.SnapshotID)
+	assert.Empty(t, heartbeatsOf(messages), "heartbeats disabled")
+}
+
+func TestRunHeartbeatLifecycle(t *testing.T) {
+	agent := newTestAgent(t, Config{PID: 42, PPID: 41})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	messages := runCommands(t, agent, testCommand(protocol.ActionImplement, "ik-1", "snap-1"))
+
+	heartbeats := heartbeatsOf(messages)
+	require.GreaterOrEqual(t, len(heartbeats), 4)
+
+	var statuses []protocol.HeartbeatStatus
+	for i, hb := range heartbeats {
+		assert.Equal(t, int64(i+1), hb.Seq, "sequence increments by one")
+		assert.Equal(t, 42, hb.PID)
+		statuses = append(statuses, hb.Status)
+	}
+	assert.Equal(t, protocol.HeartbeatStatusStarting, statuses[0])
+	assert.Equal(t, protocol.HeartbeatStatusReady, statuses[1])
+	assert.Contains(t, statuses, protocol.HeartbeatStatusBusy)
+	assert.Equal(t, protocol.HeartbeatStatusStopping, statuses[len(statuses)-1])
+
+	status, taskID := agent.Status()
+	assert.Equal(t, protocol.HeartbeatStatusStopping, status)
+	assert.Empty(t, taskID)
+	assert.Equal(t, int64(len(heartbeats)), agent.HeartbeatSeq())
+}
+
+func TestRunPeriodicHeartbeats(t *testing.T) {
+	agent := newTestAgent(t, Config{HeartbeatInterval: 10 * time.Millisecond})
+
+	stdinR, stdinW := io.Pipe()
+	var output bytes.Buffer
+
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(context.Background(), stdinR, &output) }()
+
+	time.Sleep(80 * time.Millisecond)
+	require.NoError(t, stdinW.Close())
+	require.NoError(t, <-done)
+
+	assert.Greater(t, strings.Count(output.String(), `"kind":"heartbeat"`), 4)
+}
+
+func TestRunStopsOnContextCancel(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+
+	stdinR, _ := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(ctx, stdinR, io.Discard) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
+
+func TestSnapshotAdvances(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	messages := runCommands(t, agent,
+		testCommand(protocol.ActionImplement, "ik-1", "snap-1"),
+		testCommand(protocol.ActionImplement, "ik-2", "snap-2"),
+	)
+
+	assert.Equal(t, 2, calls, "a command for a new snapshot must reach the handler")
+	assert.Equal(t, "snap-2", agent.ObservedSnapshotID())
+	for _, evt := range eventsOf(messages) {
+		assert.NotEqual(t, protocol.EventError, evt.Event)
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	retry := testCommand(protocol.ActionImplement, "ik-2", "snap-2")
+	retry.Retry.Attempt = 1
+	messages := runCommands(t, agent,
+		testCommand(protocol.ActionImplement, "ik-1", "snap-1"),
+		retry,
+	)
+
+	assert.Equal(t, 1, calls, "mismatched retry must not reach the handler")
+	assert.Equal(t, "snap-1", agent.ObservedSnapshotID())
+
+	events := eventsOf(messages)
+	require.Len(t, events, 2)
+	assert.Equal(t, protocol.EventError, events[1].Event)
+	assert.Equal(t, "version_mismatch", events[1].Payload["code"])
+	assert.Contains(t, events[1].Payload["message"], "expected snapshot snap-1, received snap-2")
+}
+
+func TestAllowVersionDrift(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true, AllowVersionDrift: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	retry := testCommand(protocol.ActionImplement, "ik-2", "snap-2")
+	retry.Retry.Attempt = 1
+	runCommands(t, agent,
+		testCommand(protocol.ActionImplement, "ik-1", "snap-1"),
+		retry,
+	)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestRepeatedIKReplaysEvents(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	retry := testCommand(protocol.ActionImplement, "ik-1", "snap-1")
+	retry.CorrelationID = "corr-retry"
+
+	messages := runCommands(t, agent, testCommand(protocol.ActionImplement, "ik-1", "snap-1"), retry)
+
+	assert.Equal(t, 1, calls, "handler runs once per idempotency key")
+
+	events := eventsOf(messages)
+	require.Len(t, events, 2)
+	assert.Equal(t, events[0].Event, events[1].Event)
+	assert.Equal(t, "corr-retry", events[1].CorrelationID)
+	assert.NotEqual(t, events[0].MessageID, events[1].MessageID)
+}
+
+func TestRetryAttemptIsNotReplayed(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	retry := testCommand(protocol.ActionImplement, "ik-1", "snap-1")
+	retry.Retry.Attempt = 1
+
+	messages := runCommands(t, agent, testCommand(protocol.ActionImplement, "ik-1", "snap-1"), retry)
+
+	assert.Equal(t, 2, calls, "a retry after a rejected result must run the handler again")
+	assert.Len(t, eventsOf(messages), 2)
+}
+
+func TestNeedsInputIsNotReplayed(t *testing.T) {
+	agent := newTestAgent(t, Config{Role: protocol.AgentTypeOrchestration, DisableHeartbeat: true})
+	calls := 0
+	agent.HandleFunc(protocol.ActionIntake, func(ctx context.Context, cmd *protocol.Command, e *Emitter) error {
+		calls++
+		evt := e.NewEvent(cmd, protocol.EventOrchestrationNeedsClarification)
+		evt.Status = "needs_input"
+		return e.Emit(evt)
+	})
+
+	runCommands(t, agent,
+		testCommand(protocol.ActionIntake, "ik-1", "snap-1"),
+		testCommand(protocol.ActionIntake, "ik-1", "snap-1"),
+	)
+
+	assert.Equal(t, 2, calls, "clarification rounds reuse the IK and must be re-handled")
+}
+
+func TestHandlerErrorBecomesErrorEvent(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	agent.HandleFunc(protocol.ActionImplement, func(ctx context.Context, cmd *protocol.Command, e *Emitter) error {
+		return errors.New("boom")
+	})
+
+	messages := runCommands(t, agent,
+		testCommand(protocol.ActionImplement, "ik-1", "snap-1"),
+		testCommand(protocol.ActionReview, "ik-2", "snap-1"),
+	)
+
+	events := eventsOf(messages)
+	require.Len(t, events, 2)
+	assert.Equal(t, "command_failed", events[0].Payload["code"])
+	assert.Equal(t, "boom", events[0].Payload["message"])
+	assert.Equal(t, "unsupported_action", events[1].Payload["code"])
+}
+
+func TestFatalErrorStopsRun(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	agent.HandleFunc(protocol.ActionImplement, func(ctx context.Context, cmd *protocol.Command, e *Emitter) error {
+		return Fatal(errors.New("crash"))
+	})
+
+	var input bytes.Buffer
+	cmd := testCommand(protocol.ActionImplement, "ik-1", "snap-1")
+	require.NoError(t, json.NewEncoder(&input).Encode(cmd))
+
+	err := agent.Run(context.Background(), &input, io.Discard)
+	require.Error(t, err)
+	assert.Equal(t, "crash", err.Error())
+}
+
+func TestEmitTruncatesOversizedPayload(t *testing.T) {
+	var output bytes.Buffer
+	e := NewEmitter(ndjson.NewEncoder(&output, testLogger()), testLogger(), protocol.AgentTypeBuilder, "builder#1", 1024, nil)
+
+	cmd := testCommand(protocol.ActionImplement, "ik-1", "snap-1")
+	evt := e.NewEvent(&cmd, protocol.EventBuilderCompleted)
+	evt.Payload = map[string]any{"log": strings.Repeat("x", 4096)}
+	require.NoError(t, e.Emit(evt))
+
+	assert.Less(t, output.Len(), 1024)
+	assert.Contains(t, output.String(), "_truncated")
+}
+
+func TestEmitUsesCustomTruncate(t *testing.T) {
+	var output bytes.Buffer
+	truncate := func(eventName string, payload map[string]any, maxBytes int) map[string]any {
+		return map[string]any{"summary": eventName}
+	}
+	e := NewEmitter(ndjson.NewEncoder(&output, testLogger()), testLogger(), protocol.AgentTypeBuilder, "builder#1", 512, truncate)
+
+	cmd := testCommand(protocol.ActionImplement, "ik-1", "snap-1")
+	evt := e.NewEvent(&cmd, protocol.EventBuilderCompleted)
+	evt.Payload = map[string]any{"log": strings.Repeat("x", 4096)}
+	require.NoError(t, e.Emit(evt))
+
+	assert.Contains(t, output.String(), `"summary":"builder.completed"`)
+}
+
+func TestTruncateGenericPreviewSize(t *testing.T) {
+	payload := map[string]any{"data": strings.Repeat("y", 100000)}
+
+	small := TruncateGeneric(payload, 1024)["_truncated"].(string)
+	assert.LessOrEqual(t, len(small), 256+len("…"))
+
+	large := TruncateGeneric(payload, 256*1024)["_truncated"].(string)
+	assert.LessOrEqual(t, len(large), 2048+len("…"))
+}
+
+func TestRunSendsHelloFirst(t *testing.T) {
+	agent := newTestAgent(t, Config{
+		Capabilities: protocol.Capabilities{StreamingProgress: true},
+	})
+	calls := 0
+	agent.Handle(protocol.ActionReview, completedHandler(&calls))
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	messages := runCommands(t, agent)
+
+	require.NotEmpty(t, messages)
+	hello, ok := messages[0].(*protocol.Hello)
+	require.True(t, ok, "first message must be hello, got %T", messages[0])
+	assert.Equal(t, protocol.AgentTypeBuilder, hello.Agent.AgentType)
+	assert.Equal(t, protocol.SupportedProtocolVersions, hello.ProtocolVersions)
+	assert.Equal(t, []protocol.Action{protocol.ActionImplement, protocol.ActionReview}, hello.SupportedActions)
+	assert.Equal(t, ndjson.MaxMessageSize, hello.MaxMessageBytes)
+	assert.True(t, hello.Capabilities.StreamingProgress)
+}
+
+func TestRunAcceptsHelloAck(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+
+	input := `{"kind":"hello_ack","accepted":true,"protocol_version":1,"max_message_bytes":1024}` + "\n"
+	require.NoError(t, agent.Run(context.Background(), strings.NewReader(input), io.Discard))
+	assert.Equal(t, 1, agent.ProtocolVersion())
+}
+
+func TestRunSkipsOversizeCommand(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true, MaxMessageBytes: 4096})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, completedHandler(&calls))
+
+	oversize := testCommand(protocol.ActionImplement, "ik-big", "snap-1")
+	oversize.Inputs = map[string]any{"padding": strings.Repeat("x", 8192)}
+	followUp := testCommand(protocol.ActionImplement, "ik-next", "snap-1")
+
+	messages := runCommands(t, agent, oversize, followUp)
+
+	events := eventsOf(messages)
+	require.Len(t, events, 2)
+	assert.Equal(t, protocol.EventError, events[0].Event)
+	assert.Equal(t, oversize.CorrelationID, events[0].CorrelationID)
+	assert.Equal(t, protocol.ErrorMessageTooLarge, events[0].Payload["code"])
+	assert.Equal(t, oversize.MessageID, events[0].Payload["message_id"])
+	assert.Equal(t, protocol.EventBuilderCompleted, events[1].Event)
+	assert.Equal(t, followUp.CorrelationID, events[1].CorrelationID)
+	assert.Equal(t, 1, calls, "only the follow-up command should run")
+}
+
+func TestRunStopsWhenHandshakeRefused(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+
+	input := `{"kind":"hello_ack","accepted":false,"reason":"no common protocol version"}` + "\n"
+	err := agent.Run(context.Background(), strings.NewReader(input), io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no common protocol version")
+}
+
+func cancelFor(cmd protocol.Command) protocol.Cancel {
+	return protocol.Cancel{
+		Kind:          protocol.MessageKindCancel,
+		MessageID:     "cancel-" + cmd.IdempotencyKey,
+		CorrelationID: cmd.CorrelationID,
+		TaskID:        cmd.TaskID,
+		Reason:        "operator interrupt",
+		IssuedAt:      time.Now().UTC(),
+	}
+}
+
+func TestCancelStopsInFlightCommand(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, HandlerFunc(func(ctx context.Context, cmd *protocol.Command, e *Emitter) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	cmd := testCommand(protocol.ActionImplement, "ik-cancel", "snap-1")
+	cancel := cancelFor(cmd)
+
+	var input bytes.Buffer
+	require.NoError(t, json.NewEncoder(&input).Encode(cmd))
+	require.NoError(t, json.NewEncoder(&input).Encode(cancel))
+
+	var output bytes.Buffer
+	require.NoError(t, agent.Run(context.Background(), &input, &output))
+	assert.Equal(t, 1, calls)
+
+	var messages []any
+	decoder := ndjson.NewDecoder(&output, testLogger())
+	for {
+		msg, err := decoder.DecodeEnvelope()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		messages = append(messages, msg)
+	}
+
+	events := eventsOf(messages)
+	require.Len(t, events, 1, "only the acknowledgement should be emitted")
+	ack := events[0]
+	assert.Equal(t, protocol.EventCancelAcknowledged, ack.Event)
+	assert.Equal(t, protocol.CancelStatusCancelled, ack.Status)
+	assert.Equal(t, cmd.CorrelationID, ack.CorrelationID)
+	assert.Equal(t, cancel.MessageID, ack.Payload["cancel_message_id"])
+}
+
+func TestCancelForUnknownCommandIsNotRunning(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+
+	cancel := cancelFor(testCommand(protocol.ActionImplement, "ik-gone", "snap-1"))
+	var input bytes.Buffer
+	require.NoError(t, json.NewEncoder(&input).Encode(cancel))
+
+	var output bytes.Buffer
+	require.NoError(t, agent.Run(context.Background(), &input, &output))
+
+	assert.Contains(t, output.String(), `"event":"cancel.acknowledged"`)
+	assert.Contains(t, output.String(), `"status":"not_running"`)
+}
+
+func TestCancelledCommandRunsAgainOnRetry(t *testing.T) {
+	agent := newTestAgent(t, Config{DisableHeartbeat: true})
+	calls := 0
+	agent.Handle(protocol.ActionImplement, HandlerFunc(func(ctx context.Context, cmd *protocol.Command, e *Emitter) error {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		evt := e.NewEvent(cmd, protocol.EventBuilderCompleted)
+		evt.Status = "success"
+		return e.Emit(evt)
+	}))
+
+	cmd := testCommand(protocol.ActionImplement, "ik-retry", "snap-1")
+	var input bytes.Buffer
+	require.NoError(t, json.NewEncoder(&input).Encode(cmd))
+	require.NoError(t, json.NewEncoder(&input).Encode(cancelFor(cmd)))
+	require.NoError(t, json.NewEncoder(&input).Encode(cmd))
+
+	var output bytes.Buffer
+	require.NoError(t, agent.Run(context.Background(), &input, &output))
+
+	assert.Equal(t, 2, calls, "a cancelled command must not be replayed from the IK cache")
+	assert.Contains(t, output.String(), `"event":"builder.completed"`)
+}
@@ -0,0 +1,208 @@
+package agentsdk
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iambrandonn/lorch/internal/ndjson"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// TruncateFunc shrinks an oversized event payload so the event fits within
+// maxBytes. Agents with structured payloads can supply their own strategy;
+// TruncateGeneric is used otherwise.
+type TruncateFunc func(eventName string, payload map[string]any, maxBytes int) map[string]any
+
+// Encoder writes one message per line. A json.Encoder will do; Agent.Run
+// uses lorch's NDJSON encoder, which also enforces the message size limit.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// encoder serializes writes from the command loop and the heartbeat goroutine
+type encoder struct {
+	mu  sync.Mutex
+	enc Encoder
+}
+
+func (e *encoder) Encode(v any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(v)
+}
+
+// Emitter writes events and logs on behalf of a handler. Events are stamped
+// with the agent identity and capped at the configured message size.
+type Emitter struct {
+	enc             *encoder
+	logger          *slog.Logger
+	agentType       protocol.AgentType
+	agentID         string
+	maxMessageBytes int
+	truncate        TruncateFunc
+
+	// events emitted for the command currently being handled (for IK receipts)
+	mu       sync.Mutex
+	recorded []protocol.Event
+}
+
+// NewEmitter creates an emitter that writes to enc. It is mainly useful for
+// testing handlers outside of Agent.Run.
+func NewEmitter(enc Encoder, logger *slog.Logger, agentType protocol.AgentType, agentID string, maxMessageBytes int, truncate TruncateFunc) *Emitter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if maxMessageBytes <= 0 {
+		maxMessageBytes = ndjson.DefaultLimit()
+	}
+	if limited, ok := enc.(interface{ SetLimit(n int) }); ok && maxMessageBytes > ndjson.DefaultLimit() {
+		// Events are truncated to fit maxMessageBytes; the encoder only
+		// needs to allow them through
+		limited.SetLimit(maxMessageBytes)
+	}
+	if truncate == nil {
+		truncate = func(_ string, payload map[string]any, maxBytes int) map[string]any {
+			return TruncateGeneric(payload, maxBytes)
+		}
+	}
+	return &Emitter{
+		enc:             &encoder{enc: enc},
+		logger:          logger,
+		agentType:       agentType,
+		agentID:         agentID,
+		maxMessageBytes: maxMessageBytes,
+		truncate:        truncate,
+	}
+}
+
+// MaxMessageBytes returns the size cap applied to emitted events
+func (e *Emitter) MaxMessageBytes() int {
+	return e.maxMessageBytes
+}
+
+// NewEvent creates a base event answering cmd with all required fields set
+func (e *Emitter) NewEvent(cmd *protocol.Command, eventName string) protocol.Event {
+	return protocol.Event{
+		Kind:          protocol.MessageKindEvent,
+		MessageID:     uuid.New().String(),
+		CorrelationID: cmd.CorrelationID,
+		TaskID:        cmd.TaskID,
+		From: protocol.AgentRef{
+			AgentType: e.agentType,
+			AgentID:   e.agentID,
+		},
+		Event: eventName,
+		ObservedVersion: &protocol.Version{
+			SnapshotID: cmd.Version.SnapshotID,
+		},
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// Emit writes an event, truncating its payload when the encoded event would
+// exceed the message size cap.
+func (e *Emitter) Emit(evt protocol.Event) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	if len(b) > e.maxMessageBytes {
+		e.logger.Warn("truncating oversized event payload",
+			"event", evt.Event,
+			"size", len(b),
+			"limit", e.maxMessageBytes)
+		evt.Payload = e.truncate(evt.Event, evt.Payload, e.maxMessageBytes)
+	}
+
+	if err := e.enc.Encode(evt); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.recorded = append(e.recorded, evt)
+	e.mu.Unlock()
+	return nil
+}
+
+// SendError emits a structured error event with a machine-readable code
+func (e *Emitter) SendError(cmd *protocol.Command, code, message string) error {
+	evt := e.NewEvent(cmd, protocol.EventError)
+	evt.Status = "failed"
+	evt.Payload = map[string]any{
+		"code":    code,
+		"message": message,
+	}
+	return e.Emit(evt)
+}
+
+// SendLog emits a log message
+func (e *Emitter) SendLog(level protocol.LogLevel, message string, fields map[string]any) error {
+	return e.enc.Encode(protocol.Log{
+		Kind:      protocol.MessageKindLog,
+		Level:     level,
+		Message:   message,
+		Fields:    fields,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// sendCancelAck answers a cancel request. Acknowledgements are not recorded
+// for idempotent replay.
+func (e *Emitter) sendCancelAck(req *protocol.Cancel, status string) error {
+	return e.enc.Encode(protocol.Event{
+		Kind:          protocol.MessageKindEvent,
+		MessageID:     uuid.New().String(),
+		CorrelationID: req.CorrelationID,
+		TaskID:        req.TaskID,
+		From: protocol.AgentRef{
+			AgentType: e.agentType,
+			AgentID:   e.agentID,
+		},
+		Event:      protocol.EventCancelAcknowledged,
+		Status:     status,
+		Payload:    map[string]any{"cancel_message_id": req.MessageID},
+		OccurredAt: time.Now().UTC(),
+	})
+}
+
+// encodeRaw writes a message without capping or recording it
+func (e *Emitter) encodeRaw(v any) error {
+	return e.enc.Encode(v)
+}
+
+// beginCommand resets the set of events recorded for the current command
+func (e *Emitter) beginCommand() {
+	e.mu.Lock()
+	e.recorded = nil
+	e.mu.Unlock()
+}
+
+// endCommand returns the events emitted since beginCommand
+func (e *Emitter) endCommand() []protocol.Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	events := e.recorded
+	e.recorded = nil
+	return events
+}
+
+// TruncateGeneric replaces a payload with a JSON preview of at most a quarter
+// of maxBytes (capped at 2 KiB) under the "_truncated" key.
+func TruncateGeneric(payload map[string]any, maxBytes int) map[string]any {
+	preview := ""
+	if pb, err := json.Marshal(payload); err == nil {
+		maxPreviewSize := maxBytes / 4
+		if maxPreviewSize > 2048 {
+			maxPreviewSize = 2048
+		}
+		if len(pb) > maxPreviewSize {
+			preview = string(pb[:maxPreviewSize]) + "…"
+		} else {
+			preview = string(pb)
+		}
+	}
+	return map[string]any{"_truncated": preview}
+}
@@ -0,0 +1,77 @@
+package agentsdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/iambrandonn/lorch/pkg/agentsdk"
+	"github.com/iambrandonn/lorch/pkg/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+// builder is written as an agent outside this module would write one: it
+// only imports lorch's public packages
+type builder struct{}
+
+func (builder) Handle(ctx context.Context, cmd *protocol.Command, e *agentsdk.Emitter) error {
+	evt := e.NewEvent(cmd, protocol.EventBuilderCompleted)
+	evt.Status = "success"
+	evt.Payload = map[string]any{"tests": map[string]any{"status": "pass"}}
+	return e.Emit(evt)
+}
+
+func TestExternalHandler(t *testing.T) {
+	agent, err := agentsdk.New(agentsdk.Config{
+		Role:             protocol.AgentTypeBuilder,
+		DisableHeartbeat: true,
+		Capabilities:     protocol.Capabilities{},
+	})
+	require.NoError(t, err)
+	agent.Handle(protocol.ActionImplement, builder{})
+
+	var input, output bytes.Buffer
+	require.NoError(t, json.NewEncoder(&input).Encode(protocol.Command{
+		Kind:           protocol.MessageKindCommand,
+		MessageID:      "cmd-1",
+		CorrelationID:  "corr-1",
+		TaskID:         "T-0001",
+		IdempotencyKey: "ik-1",
+		To:             protocol.AgentRef{AgentType: protocol.AgentTypeBuilder},
+		Action:         protocol.ActionImplement,
+		Version:        protocol.Version{SnapshotID: "snap-1"},
+	}))
+	require.NoError(t, agent.Run(context.Background(), &input, &output))
+
+	var events []protocol.Event
+	decoder := json.NewDecoder(&output)
+	for {
+		var evt protocol.Event
+		if err := decoder.Decode(&evt); errors.Is(err, io.EOF) {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+		if evt.Kind == protocol.MessageKindEvent {
+			events = append(events, evt)
+		}
+	}
+	require.Len(t, events, 1)
+	require.Equal(t, protocol.EventBuilderCompleted, events[0].Event)
+	require.Equal(t, "corr-1", events[0].CorrelationID)
+}
+
+func TestExternalEmitter(t *testing.T) {
+	var output bytes.Buffer
+	e := agentsdk.NewEmitter(json.NewEncoder(&output), nil, protocol.AgentTypeBuilder, "builder#1", 0, nil)
+	cmd := &protocol.Command{CorrelationID: "corr-1", TaskID: "T-0001"}
+	require.NoError(t, builder{}.Handle(context.Background(), cmd, e))
+
+	var evt protocol.Event
+	require.NoError(t, json.Unmarshal(output.Bytes(), &evt))
+	require.Equal(t, protocol.EventBuilderCompleted, evt.Event)
+	require.Equal(t, "builder#1", evt.From.AgentID)
+}
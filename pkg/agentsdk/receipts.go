@@ -0,0 +1,56 @@
+package agentsdk
+
+import (
+	"sync"
+
+	"github.com/iambrandonn/lorch/pkg/protocol"
+)
+
+// ReceiptStore remembers the events produced for each idempotency key so a
+// repeated command can be answered without redoing the work (MASTER-SPEC §5.4).
+type ReceiptStore interface {
+	Lookup(ik string) ([]protocol.Event, bool)
+	Record(ik string, events []protocol.Event)
+}
+
+// MemoryReceiptStore is an in-process ReceiptStore. Agents that must survive
+// restarts should back the store with the workspace receipts directory.
+type MemoryReceiptStore struct {
+	mu     sync.Mutex
+	events map[string][]protocol.Event
+}
+
+// NewMemoryReceiptStore creates an empty in-memory receipt store
+func NewMemoryReceiptStore() *MemoryReceiptStore {
+	return &MemoryReceiptStore{events: make(map[string][]protocol.Event)}
+}
+
+// Lookup returns the events recorded for ik
+func (m *MemoryReceiptStore) Lookup(ik string) ([]protocol.Event, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events, ok := m.events[ik]
+	return events, ok
+}
+
+// Record stores the events produced for ik
+func (m *MemoryReceiptStore) Record(ik string, events []protocol.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[ik] = append([]protocol.Event(nil), events...)
+}
+
+// completed reports whether events describe finished work worth replaying.
+// Errors and requests for more input must be retried with the same IK
+// (e.g. intake clarifications), so they are never recorded.
+func completed(events []protocol.Event) bool {
+	if len(events) == 0 {
+		return false
+	}
+	for _, evt := range events {
+		if evt.Event == protocol.EventError || evt.Status == "failed" || evt.Status == "needs_input" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package protocol
+
+import "time"
+
+// Cancel asks an agent to abandon the in-flight command identified by
+// CorrelationID. The agent must answer with a cancel.acknowledged event.
+type Cancel struct {
+	Kind          MessageKind `json:"kind"`
+	MessageID     string      `json:"message_id"`
+	CorrelationID string      `json:"correlation_id"`
+	TaskID        string      `json:"task_id"`
+	Reason        string      `json:"reason,omitempty"`
+	IssuedAt      time.Time   `json:"issued_at"`
+}
+
+// Statuses carried by cancel.acknowledged events
+const (
+	// CancelStatusCancelled means the agent stopped the command
+	CancelStatusCancelled = "cancelled"
+	// CancelStatusNotRunning means no command with that correlation ID was in
+	// flight, typically because it had already finished
+	CancelStatusNotRunning = "not_running"
+)
+
+// Escalation steps taken when an agent does not acknowledge a cancel in time
+const (
+	EscalationSIGTERM = "sigterm"
+	EscalationSIGKILL = "sigkill"
+)
+
+// CancelOutcome records how lorch stopped an in-flight command
+type CancelOutcome struct {
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	// Acknowledged is set when the agent answered the cancel in time;
+	// AckStatus then holds its cancel.acknowledged status
+	Acknowledged bool   `json:"acknowledged"`
+	AckStatus    string `json:"ack_status,omitempty"`
+	AckMessageID string `json:"ack_message_id,omitempty"`
+	// Escalation is the strongest signal sent to the agent process, if any
+	Escalation  string    `json:"escalation,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ProtocolVersion is the newest NDJSON protocol version this build speaks
+const ProtocolVersion = 1
+
+// SupportedProtocolVersions lists the versions lorch can negotiate, newest first
+var SupportedProtocolVersions = []int{ProtocolVersion}
+
+// Capabilities are optional protocol features an agent implements
+type Capabilities struct {
+	// StreamingProgress means the agent emits progress events while it works
+	StreamingProgress bool `json:"streaming_progress"`
+	// Cancellation means the agent honours cancel messages
+	Cancellation bool `json:"cancellation"`
+}
+
+// Hello is the first message an agent sends, declaring what it speaks
+type Hello struct {
+	Kind             MessageKind  `json:"kind"`
+	Agent            AgentRef     `json:"agent"`
+	ProtocolVersions []int        `json:"protocol_versions"`
+	SupportedActions []Action     `json:"supported_actions,omitempty"`
+	MaxMessageBytes  int          `json:"max_message_bytes,omitempty"`
+	Capabilities     Capabilities `json:"capabilities"`
+}
+
+// HelloAck is lorch's answer to Hello. When Accepted is false the agent
+// should exit; Reason explains the incompatibility.
+type HelloAck struct {
+	Kind            MessageKind `json:"kind"`
+	Accepted        bool        `json:"accepted"`
+	ProtocolVersion int         `json:"protocol_version,omitempty"`
+	MaxMessageBytes int         `json:"max_message_bytes,omitempty"`
+	Reason          string      `json:"reason,omitempty"`
+}
+
+// Negotiation records the outcome of the handshake with one agent
+type Negotiation struct {
+	ProtocolVersion  int          `json:"protocol_version"`
+	SupportedActions []Action     `json:"supported_actions,omitempty"`
+	MaxMessageBytes  int          `json:"max_message_bytes"`
+	Capabilities     Capabilities `json:"capabilities"`
+	// Legacy is set when the agent sent no hello and was assumed to speak
+	// protocol v1 with no optional capabilities
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// LegacyNegotiation describes an agent that predates the handshake
+func LegacyNegotiation(maxMessageBytes int) *Negotiation {
+	return &Negotiation{
+		ProtocolVersion: 1,
+		MaxMessageBytes: maxMessageBytes,
+		Legacy:          true,
+	}
+}
+
+// Supports reports whether the agent declared action. Agents that declared
+// no actions (including legacy agents) are assumed to support everything.
+func (n *Negotiation) Supports(action Action) bool {
+	if n == nil || len(n.SupportedActions) == 0 {
+		return true
+	}
+	return slices.Contains(n.SupportedActions, action)
+}
+
+// Negotiate picks the newest protocol version in both hello and supported,
+// and the smaller of the two message size limits. It returns an error
+// describing the mismatch when no version is shared.
+func Negotiate(hello *Hello, supported []int, maxMessageBytes int) (*Negotiation, error) {
+	version := 0
+	for _, v := range hello.ProtocolVersions {
+		if slices.Contains(supported, v) && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("agent speaks protocol versions %v but lorch supports %v; upgrade whichever side is older", hello.ProtocolVersions, supported)
+	}
+
+	limit := maxMessageBytes
+	if hello.MaxMessageBytes > 0 && hello.MaxMessageBytes < limit {
+		limit = hello.MaxMessageBytes
+	}
+
+	return &Negotiation{
+		ProtocolVersion:  version,
+		SupportedActions: slices.Clone(hello.SupportedActions),
+		MaxMessageBytes:  limit,
+		Capabilities:     hello.Capabilities,
+	}, nil
+}
@@ -0,0 +1,35 @@
+package protocol
+
+import "time"
+
+// Resource limit names, as used in LimitKill.Limit and the agent config
+const (
+	LimitMemory   = "memory"
+	LimitMaxProcs = "max_procs"
+	LimitWallTime = "wall_time"
+)
+
+// Sources of resource measurements
+const (
+	ResourceSourceCgroup = "cgroup"
+	ResourceSourceProc   = "proc"
+)
+
+// ResourceUsage is what an agent's process group consumed while it handled
+// one command, as measured by lorch
+type ResourceUsage struct {
+	// Source is "cgroup" or "proc", depending on where lorch read usage from
+	Source       string  `json:"source"`
+	CPUSeconds   float64 `json:"cpu_seconds"`
+	PeakRSSBytes int64   `json:"peak_rss_bytes"`
+	PeakProcs    int     `json:"peak_procs,omitempty"`
+	// LimitKill is set when the agent was killed for exceeding a limit
+	LimitKill *LimitKill `json:"limit_kill,omitempty"`
+}
+
+// LimitKill records an agent being killed for exceeding a resource limit
+type LimitKill struct {
+	Limit  string    `json:"limit"`
+	Detail string    `json:"detail"`
+	At     time.Time `json:"at"`
+}
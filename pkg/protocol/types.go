@@ -12,6 +12,9 @@ const (
 	MessageKindEvent     MessageKind = "event"
 	MessageKindHeartbeat MessageKind = "heartbeat"
 	MessageKindLog       MessageKind = "log"
+	MessageKindHello     MessageKind = "hello"
+	MessageKindHelloAck  MessageKind = "hello_ack"
+	MessageKindCancel    MessageKind = "cancel"
 )
 
 // AgentType represents the role of an agent
@@ -107,9 +110,41 @@ type Event struct {
 	Payload         map[string]any `json:"payload"`
 	Artifacts       []Artifact     `json:"artifacts,omitempty"`
 	ObservedVersion *Version       `json:"observed_version,omitempty"`
+	Usage           *Usage         `json:"usage,omitempty"`
 	OccurredAt      time.Time      `json:"occurred_at"`
 }
 
+// Usage reports LLM consumption for the work behind an event.
+// Agents attach it to terminal events; lorch fills EstimatedCostUSD from
+// its local price table when the agent leaves it empty.
+type Usage struct {
+	Model            string  `json:"model,omitempty"`
+	InputTokens      int64   `json:"input_tokens"`
+	OutputTokens     int64   `json:"output_tokens"`
+	WallTimeMs       int64   `json:"wall_time_ms,omitempty"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd,omitempty"`
+}
+
+// TotalTokens returns input plus output tokens.
+func (u Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// Add accumulates other into u. When models differ the aggregate model is
+// reported as "mixed".
+func (u *Usage) Add(other Usage) {
+	switch {
+	case u.Model == "":
+		u.Model = other.Model
+	case other.Model != "" && other.Model != u.Model:
+		u.Model = "mixed"
+	}
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.WallTimeMs += other.WallTimeMs
+	u.EstimatedCostUSD += other.EstimatedCostUSD
+}
+
 // HeartbeatStatus represents agent health status
 type HeartbeatStatus string
 
@@ -121,10 +156,12 @@ const (
 	HeartbeatStatusBackoff  HeartbeatStatus = "backoff"
 )
 
-// HeartbeatStats contains optional resource usage statistics
+// HeartbeatStats contains optional resource usage statistics. Agents may
+// fill them in; lorch overwrites them with what it measured when it can.
 type HeartbeatStats struct {
-	CPUPercent float64 `json:"cpu_pct,omitempty"`
+	CPUPercent float64 `json:"cpu_pct,omitempty"` // 100 is one fully used core
 	RSSBytes   int64   `json:"rss_bytes,omitempty"`
+	Procs      int     `json:"procs,omitempty"`
 }
 
 // Heartbeat is sent from agents to lorch for liveness
@@ -179,13 +216,22 @@ const (
 	EventOrchestrationPlanConflict       = "orchestration.plan_conflict"
 
 	// Generic events
-	EventArtifactProduced = "artifact.produced"
-	EventError            = "error"
+	EventArtifactProduced   = "artifact.produced"
+	EventError              = "error"
+	EventCancelAcknowledged = "cancel.acknowledged"
 
 	// System events
 	EventSystemUserDecision = "system.user_decision"
 )
 
+// ErrorMessageTooLarge is the code of the error event that stands in for a
+// message over the size limit
+const ErrorMessageTooLarge = "message_too_large"
+
+// ErrorSchemaViolation is the code of the error event that stands in for an
+// event rejected by strict schema validation
+const ErrorSchemaViolation = "schema_violation"
+
 // Review statuses
 const (
 	ReviewStatusApproved         = "approved"
@@ -512,3 +512,49 @@ func TestReviewCompletedEvent(t *testing.T) {
 		t.Fatalf("expected 1 artifact, got %d", len(decoded.Artifacts))
 	}
 }
+
+func TestNegotiate(t *testing.T) {
+	hello := &Hello{
+		Kind:             MessageKindHello,
+		Agent:            AgentRef{AgentType: AgentTypeBuilder},
+		ProtocolVersions: []int{1, 2},
+		SupportedActions: []Action{ActionImplement, ActionImplementChanges},
+		MaxMessageBytes:  64 * 1024,
+		Capabilities:     Capabilities{StreamingProgress: true},
+	}
+
+	n, err := Negotiate(hello, []int{1}, 256*1024)
+	if err != nil {
+		t.Fatalf("Negotiate() error = %v", err)
+	}
+	want := &Negotiation{
+		ProtocolVersion:  1,
+		SupportedActions: []Action{ActionImplement, ActionImplementChanges},
+		MaxMessageBytes:  64 * 1024,
+		Capabilities:     Capabilities{StreamingProgress: true},
+	}
+	if diff := cmp.Diff(want, n); diff != "" {
+		t.Errorf("Negotiate() mismatch (-want +got):\n%s", diff)
+	}
+	if !n.Supports(ActionImplement) || n.Supports(ActionReview) {
+		t.Errorf("Supports() does not follow declared actions: %v", n.SupportedActions)
+	}
+
+	n, err = Negotiate(hello, []int{2, 1}, 32*1024)
+	if err != nil {
+		t.Fatalf("Negotiate() error = %v", err)
+	}
+	if n.ProtocolVersion != 2 || n.MaxMessageBytes != 32*1024 {
+		t.Errorf("expected v2 with lorch's smaller limit, got v%d limit %d", n.ProtocolVersion, n.MaxMessageBytes)
+	}
+
+	hello.ProtocolVersions = []int{3}
+	_, err = Negotiate(hello, []int{1}, 256*1024)
+	if err == nil || !strings.Contains(err.Error(), "[3]") || !strings.Contains(err.Error(), "[1]") {
+		t.Errorf("expected an error naming both version sets, got %v", err)
+	}
+
+	if !LegacyNegotiation(1024).Supports(ActionReview) {
+		t.Error("legacy agents should be assumed to support every action")
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/iambrandonn/lorch/internal/ndjson"
-	"github.com/iambrandonn/lorch/internal/protocol"
+	"github.com/iambrandonn/lorch/pkg/protocol"
 )
 
 func TestFakeAgentBasicFlow(t *testing.T) {
@@ -116,8 +116,8 @@ func TestFakeAgentBasicFlow(t *testing.T) {
 						t.Error("missing tests payload")
 					}
 				}
-			case *protocol.Heartbeat:
-				// Skip heartbeats
+			case *protocol.Hello, *protocol.Heartbeat:
+				// Skip the handshake and heartbeats
 			default:
 				t.Errorf("unexpected message type: %T", msg)
 			}
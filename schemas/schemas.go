@@ -0,0 +1,10 @@
+// Package schemas embeds the versioned JSON Schema documents so the binary
+// can validate protocol messages and state files without reading from disk.
+package schemas
+
+import "embed"
+
+// V1 holds the v1 schema documents, addressed as "v1/<name>.v1.json".
+//
+//go:embed v1/*.json
+var V1 embed.FS